@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	authzdomain "github.com/astro-web3/oauth2-token-exchange/internal/domain/authz"
+	httptransport "github.com/astro-web3/oauth2-token-exchange/internal/transport/http"
+	"github.com/spf13/cobra"
+)
+
+func newCheckCmd(opts *rootOptions) *cobra.Command {
+	var route authzdomain.Route
+
+	cmd := &cobra.Command{
+		Use:   "check <pat>",
+		Short: "Run the authorization decision for a PAT once and print the resulting headers",
+		Long: "Runs the same decision as the ext_authz endpoint, including the token cache.\n" +
+			"Pass - to read the PAT from stdin and keep it out of the shell history.",
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			pat := args[0]
+			if pat == "-" {
+				line, err := bufio.NewReader(cmd.InOrStdin()).ReadString('\n')
+				if err != nil && line == "" {
+					return fmt.Errorf("failed to read PAT from stdin: %w", err)
+				}
+				pat = strings.TrimSpace(line)
+			}
+
+			cfg, err := loadConfig(opts.loader())
+			if err != nil {
+				return err
+			}
+
+			services, err := httptransport.NewServices(cfg)
+			if err != nil {
+				return err
+			}
+			defer services.Close()
+
+			decision, err := services.Authz.Check(cmd.Context(), pat, route, cfg.Auth.CacheTTL, cfg.HeaderKeyMap())
+			if err != nil {
+				return err
+			}
+			if !decision.Allow {
+				return errors.New("denied: " + decision.Reason)
+			}
+
+			out := cmd.OutOrStdout()
+			for _, name := range slices.Sorted(maps.Keys(decision.Headers)) {
+				fmt.Fprintf(out, "%s: %s\n", name, decision.Headers[name])
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&route.Host, "host", "", "host of the request to authorize, for tenants")
+	cmd.Flags().StringVar(&route.Method, "method", "GET", "method of the request to authorize, for rate limits")
+	cmd.Flags().StringVar(&route.Path, "path", "/", "path of the request to authorize, for rate limits")
+	return cmd
+}
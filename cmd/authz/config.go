@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"go.yaml.in/yaml/v3"
+)
+
+const yamlIndent = 2
+
+func newConfigCmd(opts *rootOptions) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "config",
+		Short: "Inspect the effective configuration",
+	}
+
+	cmd.AddCommand(
+		&cobra.Command{
+			Use:   "validate",
+			Short: "Validate the config and report every problem found",
+			Args:  cobra.NoArgs,
+			RunE: func(cmd *cobra.Command, _ []string) error {
+				cfg, err := loadConfig(opts.loader())
+				if err != nil {
+					return err
+				}
+				fmt.Fprintf(cmd.OutOrStdout(), "config is valid (version %s)\n", cfg.Version)
+				return nil
+			},
+		},
+		&cobra.Command{
+			Use:   "print",
+			Short: "Print the effective config with secrets redacted",
+			Long: "Prints the config after merging the environment file and environment overrides.\n" +
+				"Literal secrets are redacted; file:// and env:// references are shown as-is.",
+			Args: cobra.NoArgs,
+			RunE: func(cmd *cobra.Command, _ []string) error {
+				cfg, err := opts.loader().Load()
+				if err != nil {
+					return err
+				}
+
+				out := cmd.OutOrStdout()
+				fmt.Fprintf(out, "# version: %s\n", cfg.Version)
+
+				enc := yaml.NewEncoder(out)
+				enc.SetIndent(yamlIndent)
+				if err = enc.Encode(cfg.Redacted()); err != nil {
+					return fmt.Errorf("failed to print config: %w", err)
+				}
+				return enc.Close()
+			},
+		},
+	)
+
+	return cmd
+}
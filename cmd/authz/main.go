@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"errors"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
@@ -18,16 +19,30 @@ import (
 const shutdownTimeoutSeconds = 10
 
 func main() {
-	cfg := config.MustLoad()
+	if err := newRootCmd().Execute(); err != nil {
+		os.Exit(1)
+	}
+}
 
-	srv, err := httptransport.NewServer(cfg)
+func serve(opts *rootOptions) error {
+	loader := opts.loader()
+	cfg, err := loadConfig(loader)
 	if err != nil {
-		log.Fatalf("Failed to create server: %v", err)
+		return err
 	}
+	store := config.NewStore(cfg)
+
+	srv, err := httptransport.NewServer(store)
+	if err != nil {
+		return fmt.Errorf("failed to create server: %w", err)
+	}
+
+	loader.Watch(store)
 
 	serverErrChan := make(chan error, 1)
 	go func() {
-		log.Printf("Starting HTTP server on %s (mode: %s)", cfg.Server.Addr, cfg.Server.Mode)
+		log.Printf("Starting HTTP server on %s (mode: %s, config version: %s)",
+			cfg.Server.Addr, cfg.Server.Mode, cfg.Version)
 		if listenErr := srv.ListenAndServe(); listenErr != nil &&
 			!errors.Is(listenErr, http.ErrServerClosed) {
 			log.Printf("Server failed: %v", listenErr)
@@ -47,7 +62,7 @@ func main() {
 
 	shutdownCtx, shutdownCancel := context.WithTimeout(
 		context.Background(),
-		shutdownTimeoutSeconds*time.Second,
+		cfg.Server.DrainDelay+shutdownTimeoutSeconds*time.Second,
 	)
 	defer shutdownCancel()
 
@@ -62,4 +77,6 @@ func main() {
 	} else {
 		log.Println("Tracer provider stopped gracefully")
 	}
+
+	return nil
 }
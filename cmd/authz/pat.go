@@ -0,0 +1,300 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"text/tabwriter"
+	"time"
+
+	"connectrpc.com/connect"
+	patv1 "github.com/astro-web3/oauth2-token-exchange/pb/gen/go/pat/v1"
+	patv1connect "github.com/astro-web3/oauth2-token-exchange/pb/gen/go/pat/v1/patv1connect"
+	"github.com/spf13/cobra"
+)
+
+const (
+	defaultPATServer    = "http://localhost:8123"
+	defaultPATExpiresIn = 90 * 24 * time.Hour
+	tabPadding          = 2
+)
+
+// patOptions identify the caller to the PAT API. Behind the gateway only
+// --token is needed. Against the service directly, pass the JWT the gateway
+// would forward with --access-token, or, when the service runs in the
+// trusted_proxy identity mode, the identity headers with --user, --email and
+// --username.
+type patOptions struct {
+	server      string
+	token       string
+	accessToken string
+	user        string
+	email       string
+	username    string
+}
+
+func newPATCmd() *cobra.Command {
+	opts := &patOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "pat",
+		Short: "Create, get, list, rotate and delete PATs through the Connect PAT API",
+	}
+
+	flags := cmd.PersistentFlags()
+	flags.StringVar(&opts.server, "server", defaultPATServer, "PAT API base URL")
+	flags.StringVar(&opts.token, "token", "", "bearer token sent in the Authorization header")
+	flags.StringVar(&opts.accessToken, "access-token", "", "JWT sent as X-Auth-Request-Access-Token")
+	flags.StringVar(&opts.user, "user", "", "user ID sent as X-Auth-Request-User")
+	flags.StringVar(&opts.email, "email", "", "email sent as X-Auth-Request-Email")
+	flags.StringVar(&opts.username, "username", "", "preferred username sent as X-Auth-Request-Preferred-Username")
+
+	cmd.AddCommand(
+		newPATCreateCmd(opts),
+		newPATGetCmd(opts),
+		newPATListCmd(opts),
+		newPATRotateCmd(opts),
+		newPATDeleteCmd(opts),
+	)
+
+	return cmd
+}
+
+func newPATCreateCmd(opts *patOptions) *cobra.Command {
+	var expiresIn time.Duration
+
+	cmd := &cobra.Command{
+		Use:   "create",
+		Short: "Create a PAT and print its token",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			var expirationDate int64
+			if expiresIn > 0 {
+				expirationDate = time.Now().Add(expiresIn).Unix()
+			}
+			req := newPATRequest(opts, &patv1.CreatePATRequest{ExpirationDate: expirationDate})
+			resp, err := opts.client().CreatePAT(cmd.Context(), req)
+			if err != nil {
+				return err
+			}
+
+			pat := resp.Msg.GetPat()
+			out := cmd.OutOrStdout()
+			fmt.Fprintf(out, "id:         %s\n", pat.GetId())
+			fmt.Fprintf(out, "expires at: %s\n", formatUnix(pat.GetExpirationDate()))
+			fmt.Fprintf(out, "token:      %s\n", resp.Msg.GetToken())
+			return nil
+		},
+	}
+
+	cmd.Flags().DurationVar(&expiresIn, "expires-in", defaultPATExpiresIn,
+		"lifetime of the PAT; 0 uses the server's default lifetime")
+
+	return cmd
+}
+
+func newPATGetCmd(opts *patOptions) *cobra.Command {
+	return &cobra.Command{
+		Use:   "get <pat-id>",
+		Short: "Show one of the caller's PATs",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			req := newPATRequest(opts, &patv1.GetPATRequest{PatId: args[0]})
+			resp, err := opts.client().GetPAT(cmd.Context(), req)
+			if err != nil {
+				return err
+			}
+
+			pat := resp.Msg.GetPat()
+			out := cmd.OutOrStdout()
+			fmt.Fprintf(out, "id:           %s\n", pat.GetId())
+			fmt.Fprintf(out, "machine user: %s\n", pat.GetMachineUserId())
+			fmt.Fprintf(out, "expires at:   %s\n", formatUnix(pat.GetExpirationDate()))
+			fmt.Fprintf(out, "created at:   %s\n", formatUnix(pat.GetCreatedAt()))
+			return nil
+		},
+	}
+}
+
+// patListOptions are the flags of pat list.
+type patListOptions struct {
+	pageSize       int32
+	pageToken      string
+	sortBy         string
+	descending     bool
+	expired        bool
+	expiringBefore string
+	createdAfter   string
+}
+
+func newPATListCmd(opts *patOptions) *cobra.Command {
+	listOpts := &patListOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "List the caller's PATs",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			msg, err := listOpts.request(cmd)
+			if err != nil {
+				return err
+			}
+			resp, err := opts.client().ListPATs(cmd.Context(), newPATRequest(opts, msg))
+			if err != nil {
+				return err
+			}
+
+			w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, tabPadding, ' ', 0)
+			fmt.Fprintln(w, "ID\tMACHINE USER\tEXPIRES AT\tCREATED AT")
+			for _, pat := range resp.Msg.GetPats() {
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\n",
+					pat.GetId(),
+					pat.GetMachineUserId(),
+					formatUnix(pat.GetExpirationDate()),
+					formatUnix(pat.GetCreatedAt()),
+				)
+			}
+			if err = w.Flush(); err != nil {
+				return err
+			}
+			if token := resp.Msg.GetNextPageToken(); token != "" {
+				fmt.Fprintf(cmd.OutOrStdout(), "\n%d of %d PATs; next page: --page-token %s\n",
+					len(resp.Msg.GetPats()), resp.Msg.GetTotalSize(), token)
+			}
+			return nil
+		},
+	}
+
+	flags := cmd.Flags()
+	flags.Int32Var(&listOpts.pageSize, "page-size", 0, "PATs per page; 0 uses the server's default")
+	flags.StringVar(&listOpts.pageToken, "page-token", "", "token of the page to show, as printed by the previous page")
+	flags.StringVar(&listOpts.sortBy, "sort", "created_at", "sort by created_at or expiration_date")
+	flags.BoolVar(&listOpts.descending, "desc", false, "sort in descending order")
+	flags.BoolVar(&listOpts.expired, "expired", false, "only expired PATs; --expired=false for only unexpired PATs")
+	flags.StringVar(&listOpts.expiringBefore, "expiring-before", "", "only PATs expiring before this RFC 3339 time")
+	flags.StringVar(&listOpts.createdAfter, "created-after", "", "only PATs created after this RFC 3339 time")
+
+	return cmd
+}
+
+func (o *patListOptions) request(cmd *cobra.Command) (*patv1.ListPATsRequest, error) {
+	msg := &patv1.ListPATsRequest{
+		PageSize:   o.pageSize,
+		PageToken:  o.pageToken,
+		Descending: o.descending,
+		Filter:     &patv1.PATFilter{},
+	}
+
+	switch o.sortBy {
+	case "created_at":
+		msg.SortBy = patv1.PATSortField_PAT_SORT_FIELD_CREATED_AT
+	case "expiration_date":
+		msg.SortBy = patv1.PATSortField_PAT_SORT_FIELD_EXPIRATION_DATE
+	default:
+		return nil, fmt.Errorf("unknown sort field %q, want created_at or expiration_date", o.sortBy)
+	}
+
+	if cmd.Flags().Changed("expired") {
+		msg.Filter.Expired = &o.expired
+	}
+	for _, f := range []struct {
+		flag, value string
+		dst         *int64
+	}{
+		{"expiring-before", o.expiringBefore, &msg.Filter.ExpiringBefore},
+		{"created-after", o.createdAfter, &msg.Filter.CreatedAfter},
+	} {
+		if f.value == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, f.value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --%s: %w", f.flag, err)
+		}
+		*f.dst = t.Unix()
+	}
+
+	return msg, nil
+}
+
+func newPATDeleteCmd(opts *patOptions) *cobra.Command {
+	return &cobra.Command{
+		Use:   "delete <pat-id>",
+		Short: "Delete a PAT",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			req := newPATRequest(opts, &patv1.DeletePATRequest{PatId: args[0]})
+			if _, err := opts.client().DeletePAT(cmd.Context(), req); err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "deleted %s\n", args[0])
+			return nil
+		},
+	}
+}
+
+func newPATRotateCmd(opts *patOptions) *cobra.Command {
+	var gracePeriod time.Duration
+
+	cmd := &cobra.Command{
+		Use:   "rotate <pat-id>",
+		Short: "Replace a PAT and print the new token; the old one is deleted after a grace period",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			msg := &patv1.RotatePATRequest{PatId: args[0]}
+			if cmd.Flags().Changed("grace-period") {
+				seconds := int64(gracePeriod / time.Second)
+				msg.GracePeriodSeconds = &seconds
+			}
+			resp, err := opts.client().RotatePAT(cmd.Context(), newPATRequest(opts, msg))
+			if err != nil {
+				return err
+			}
+
+			pat := resp.Msg.GetPat()
+			out := cmd.OutOrStdout()
+			fmt.Fprintf(out, "id:         %s\n", pat.GetId())
+			fmt.Fprintf(out, "expires at: %s\n", formatUnix(pat.GetExpirationDate()))
+			fmt.Fprintf(out, "token:      %s\n", resp.Msg.GetToken())
+			fmt.Fprintf(out, "old id:     %s (deleted at %s)\n",
+				resp.Msg.GetOldPatId(), formatUnix(resp.Msg.GetOldPatDeleteAt()))
+			return nil
+		},
+	}
+
+	cmd.Flags().DurationVar(&gracePeriod, "grace-period", 0,
+		"how long the old PAT keeps working; unset uses the server's default, 0 deletes it right away")
+
+	return cmd
+}
+
+func (o *patOptions) client() patv1connect.PATServiceClient {
+	return patv1connect.NewPATServiceClient(http.DefaultClient, o.server)
+}
+
+func newPATRequest[T any](opts *patOptions, msg *T) *connect.Request[T] {
+	req := connect.NewRequest(msg)
+
+	headers := map[string]string{
+		"X-Auth-Request-User":               opts.user,
+		"X-Auth-Request-Email":              opts.email,
+		"X-Auth-Request-Preferred-Username": opts.username,
+		"X-Auth-Request-Access-Token":       opts.accessToken,
+	}
+	if opts.token != "" {
+		headers["Authorization"] = "Bearer " + opts.token
+	}
+	for name, value := range headers {
+		if value != "" {
+			req.Header().Set(name, value)
+		}
+	}
+
+	return req
+}
+
+func formatUnix(sec int64) string {
+	if sec == 0 {
+		return "-"
+	}
+	return time.Unix(sec, 0).UTC().Format(time.RFC3339)
+}
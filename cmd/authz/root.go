@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/astro-web3/oauth2-token-exchange/internal/config"
+	"github.com/spf13/cobra"
+)
+
+type rootOptions struct {
+	configFile string
+}
+
+func newRootCmd() *cobra.Command {
+	opts := &rootOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "authz",
+		Short: "OAuth2 token exchange authorization service",
+		Long: "Exchanges Zitadel PATs for JWTs behind Istio ext_authz and manages PATs.\n" +
+			"Without a subcommand the HTTP server is started.",
+		SilenceUsage: true,
+		Args:         cobra.NoArgs,
+		RunE: func(_ *cobra.Command, _ []string) error {
+			return serve(opts)
+		},
+	}
+
+	cmd.PersistentFlags().StringVar(&opts.configFile, "config", "",
+		"config file path (default: config.yaml in ./config or the working directory)")
+
+	cmd.AddCommand(
+		&cobra.Command{
+			Use:   "serve",
+			Short: "Start the HTTP server",
+			Args:  cobra.NoArgs,
+			RunE: func(_ *cobra.Command, _ []string) error {
+				return serve(opts)
+			},
+		},
+		newCheckCmd(opts),
+		newPATCmd(),
+		newConfigCmd(opts),
+	)
+
+	return cmd
+}
+
+func (o *rootOptions) loader() *config.Loader {
+	if o.configFile != "" {
+		return config.NewLoader(config.WithConfigFile(o.configFile))
+	}
+	return config.NewLoader()
+}
+
+// loadConfig loads and validates the config.
+func loadConfig(loader *config.Loader) (*config.Config, error) {
+	cfg, err := loader.Load()
+	if err != nil {
+		return nil, err
+	}
+	if err = cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid config:\n%w", err)
+	}
+	return cfg, nil
+}
@@ -29,7 +29,7 @@ echo -e "${YELLOW}Checking if server is running...${NC}"
 if ! curl -s -f "$SERVER_ADDR/healthz" > /dev/null; then
     echo -e "${RED}❌ Server is not running at $SERVER_ADDR${NC}"
     echo "Please start the server first:"
-    echo "  go run cmd/authz/main.go"
+    echo "  go run ./cmd/authz"
     exit 1
 fi
 echo -e "${GREEN}✅ Server is running${NC}"
@@ -13,6 +13,7 @@ type Service interface {
 	Check(
 		ctx context.Context,
 		pat string,
+		route authz.Route,
 		cacheTTL time.Duration,
 		headerKeys map[string]string,
 	) (*authz.AuthzDecision, error)
@@ -31,6 +32,7 @@ func NewService(domainService authz.Service) Service {
 func (s *service) Check(
 	ctx context.Context,
 	pat string,
+	route authz.Route,
 	cacheTTL time.Duration,
 	headerKeys map[string]string,
 ) (*authz.AuthzDecision, error) {
@@ -41,7 +43,7 @@ func (s *service) Check(
 		attribute.String("pat.prefix", getPATPrefix(pat)),
 	)
 
-	decision, err := s.domainService.AuthorizePAT(ctx, pat, cacheTTL, headerKeys)
+	decision, err := s.domainService.AuthorizePAT(ctx, pat, route, cacheTTL, headerKeys)
 	if err != nil {
 		span.RecordError(err)
 		return nil, err
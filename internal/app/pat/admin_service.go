@@ -0,0 +1,136 @@
+package pat
+
+import (
+	"context"
+	"time"
+
+	patdomain "github.com/astro-web3/oauth2-token-exchange/internal/domain/pat"
+	"github.com/astro-web3/oauth2-token-exchange/pkg/tracer"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+type AdminService struct {
+	domainService patdomain.AdminService
+
+	notifier patdomain.Notifier
+}
+
+// AdminServiceOption configures optional collaborators of AdminService.
+type AdminServiceOption func(*AdminService)
+
+// WithAdminNotifier sends a pat.deleted notification for every revoked PAT.
+func WithAdminNotifier(notifier patdomain.Notifier) AdminServiceOption {
+	return func(s *AdminService) {
+		s.notifier = notifier
+	}
+}
+
+func NewAdminService(domainService patdomain.AdminService, opts ...AdminServiceOption) *AdminService {
+	s := &AdminService{
+		domainService: domainService,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+func (s *AdminService) ListUserPATs(
+	ctx context.Context,
+	caller patdomain.Caller,
+	userID string,
+	query patdomain.ListQuery,
+) (*patdomain.Page, error) {
+	ctx, span := tracer.Start(ctx, "app.pat.admin.ListUserPATs")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.String("pat.admin_id", caller.UserID),
+		attribute.String("pat.user_id", userID),
+	)
+
+	page, err := s.domainService.ListUserPATs(ctx, caller, userID, query)
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+
+	span.SetAttributes(attribute.Int("pat.count", len(page.PATs)))
+
+	return page, nil
+}
+
+func (s *AdminService) RevokePAT(ctx context.Context, caller patdomain.Caller, userID, patID string) error {
+	ctx, span := tracer.Start(ctx, "app.pat.admin.RevokePAT")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.String("pat.admin_id", caller.UserID),
+		attribute.String("pat.user_id", userID),
+		attribute.String("pat.id", patID),
+	)
+
+	if err := s.domainService.RevokePAT(ctx, caller, userID, patID); err != nil {
+		span.RecordError(err)
+		return err
+	}
+
+	s.notifyRevoked(ctx, userID, patID)
+
+	return nil
+}
+
+func (s *AdminService) RevokeAllPATs(ctx context.Context, caller patdomain.Caller, userID string) ([]string, error) {
+	ctx, span := tracer.Start(ctx, "app.pat.admin.RevokeAllPATs")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.String("pat.admin_id", caller.UserID),
+		attribute.String("pat.user_id", userID),
+	)
+
+	revoked, err := s.domainService.RevokeAllPATs(ctx, caller, userID)
+	for _, patID := range revoked {
+		s.notifyRevoked(ctx, userID, patID)
+	}
+
+	span.SetAttributes(attribute.Int("pat.count", len(revoked)))
+	if err != nil {
+		span.RecordError(err)
+		return revoked, err
+	}
+
+	return revoked, nil
+}
+
+func (s *AdminService) ListMachineUsers(
+	ctx context.Context,
+	caller patdomain.Caller,
+) ([]*patdomain.MachineUser, error) {
+	ctx, span := tracer.Start(ctx, "app.pat.admin.ListMachineUsers")
+	defer span.End()
+
+	span.SetAttributes(attribute.String("pat.admin_id", caller.UserID))
+
+	users, err := s.domainService.ListMachineUsers(ctx, caller)
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+
+	span.SetAttributes(attribute.Int("pat.count", len(users)))
+
+	return users, nil
+}
+
+func (s *AdminService) notifyRevoked(ctx context.Context, userID, patID string) {
+	if s.notifier == nil {
+		return
+	}
+	s.notifier.Notify(ctx, patdomain.Notification{
+		Type:   patdomain.NotificationPATDeleted,
+		Time:   time.Now().UTC(),
+		UserID: userID,
+		PATID:  patID,
+	})
+}
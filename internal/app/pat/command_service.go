@@ -11,17 +11,38 @@ import (
 
 type CommandService struct {
 	domainService patdomain.Service
+
+	notifier           patdomain.Notifier
+	longLivedThreshold time.Duration
+}
+
+// CommandServiceOption configures optional collaborators of CommandService.
+type CommandServiceOption func(*CommandService)
+
+// WithNotifier sends a notification for every created and deleted PAT, and an
+// additional pat.long_lived notification when a PAT is created with a lifetime
+// above longLivedThreshold. A zero threshold disables the latter.
+func WithNotifier(notifier patdomain.Notifier, longLivedThreshold time.Duration) CommandServiceOption {
+	return func(s *CommandService) {
+		s.notifier = notifier
+		s.longLivedThreshold = longLivedThreshold
+	}
 }
 
-func NewCommandService(domainService patdomain.Service) *CommandService {
-	return &CommandService{
+func NewCommandService(domainService patdomain.Service, opts ...CommandServiceOption) *CommandService {
+	s := &CommandService{
 		domainService: domainService,
 	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
 }
 
 func (s *CommandService) CreatePAT(
 	ctx context.Context,
 	userID, email, preferredUsername string,
+	groups []string,
 	expirationDate time.Time,
 ) (*patdomain.PAT, string, error) {
 	ctx, span := tracer.Start(ctx, "app.pat.CreatePAT")
@@ -32,7 +53,7 @@ func (s *CommandService) CreatePAT(
 		attribute.String("pat.email", email),
 	)
 
-	pat, token, err := s.domainService.CreatePAT(ctx, userID, email, preferredUsername, expirationDate)
+	pat, token, err := s.domainService.CreatePAT(ctx, userID, email, preferredUsername, groups, expirationDate)
 	if err != nil {
 		span.RecordError(err)
 		return nil, "", err
@@ -40,6 +61,8 @@ func (s *CommandService) CreatePAT(
 
 	span.SetAttributes(attribute.String("pat.id", pat.ID))
 
+	s.notifyCreated(ctx, pat)
+
 	return pat, token, nil
 }
 
@@ -58,5 +81,70 @@ func (s *CommandService) DeletePAT(ctx context.Context, userID, patID string) er
 		return err
 	}
 
+	s.notify(ctx, patdomain.Notification{
+		Type:   patdomain.NotificationPATDeleted,
+		UserID: userID,
+		PATID:  patID,
+	})
+
 	return nil
 }
+
+func (s *CommandService) RotatePAT(
+	ctx context.Context,
+	userID, patID string,
+	groups []string,
+	gracePeriod *time.Duration,
+) (*patdomain.Rotation, string, error) {
+	ctx, span := tracer.Start(ctx, "app.pat.RotatePAT")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.String("pat.user_id", userID),
+		attribute.String("pat.id", patID),
+	)
+
+	rotation, token, err := s.domainService.RotatePAT(ctx, userID, patID, groups, gracePeriod)
+	if err != nil {
+		span.RecordError(err)
+		return nil, "", err
+	}
+
+	span.SetAttributes(attribute.String("pat.new_id", rotation.New.ID))
+
+	s.notify(ctx, patdomain.Notification{
+		Type:                patdomain.NotificationPATRotated,
+		UserID:              userID,
+		PATID:               rotation.New.ID,
+		MachineUserID:       rotation.New.MachineUserID,
+		ExpirationDate:      &rotation.New.ExpirationDate,
+		ReplacedPATID:       rotation.Old.ID,
+		ReplacedPATDeleteAt: &rotation.OldDeleteAt,
+	})
+
+	return rotation, token, nil
+}
+
+func (s *CommandService) notifyCreated(ctx context.Context, pat *patdomain.PAT) {
+	notification := patdomain.Notification{
+		Type:           patdomain.NotificationPATCreated,
+		UserID:         pat.HumanUserID,
+		PATID:          pat.ID,
+		MachineUserID:  pat.MachineUserID,
+		ExpirationDate: &pat.ExpirationDate,
+	}
+	s.notify(ctx, notification)
+
+	if s.longLivedThreshold > 0 && time.Until(pat.ExpirationDate) > s.longLivedThreshold {
+		notification.Type = patdomain.NotificationPATLongLived
+		s.notify(ctx, notification)
+	}
+}
+
+func (s *CommandService) notify(ctx context.Context, notification patdomain.Notification) {
+	if s.notifier == nil {
+		return
+	}
+	notification.Time = time.Now().UTC()
+	s.notifier.Notify(ctx, notification)
+}
@@ -18,19 +18,47 @@ func NewQueryService(domainService patdomain.Service) *QueryService {
 	}
 }
 
-func (s *QueryService) ListPATs(ctx context.Context, userID string) ([]*patdomain.PAT, error) {
+func (s *QueryService) GetPAT(ctx context.Context, userID, patID string) (*patdomain.PAT, error) {
+	ctx, span := tracer.Start(ctx, "app.pat.GetPAT")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.String("pat.user_id", userID),
+		attribute.String("pat.id", patID),
+	)
+
+	pat, err := s.domainService.GetPAT(ctx, userID, patID)
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+
+	return pat, nil
+}
+
+func (s *QueryService) ListPATs(
+	ctx context.Context,
+	userID string,
+	query patdomain.ListQuery,
+) (*patdomain.Page, error) {
 	ctx, span := tracer.Start(ctx, "app.pat.ListPATs")
 	defer span.End()
 
-	span.SetAttributes(attribute.String("pat.user_id", userID))
+	span.SetAttributes(
+		attribute.String("pat.user_id", userID),
+		attribute.Int("pat.page_size", query.PageSize),
+	)
 
-	pats, err := s.domainService.ListPATs(ctx, userID)
+	page, err := s.domainService.ListPATs(ctx, userID, query)
 	if err != nil {
 		span.RecordError(err)
 		return nil, err
 	}
 
-	span.SetAttributes(attribute.Int("pat.count", len(pats)))
+	span.SetAttributes(
+		attribute.Int("pat.count", len(page.PATs)),
+		attribute.Int("pat.total_size", page.TotalSize),
+	)
 
-	return pats, nil
+	return page, nil
 }
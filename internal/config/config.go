@@ -1,39 +1,123 @@
 package config
 
 import (
-	"fmt"
 	"log/slog"
 	"os"
 	"strings"
 	"time"
+)
+
+const (
+	CacheBackendRedis  = "redis"
+	CacheBackendMemory = "memory"
+)
 
-	"github.com/spf13/viper"
+// Identity modes select how the PAT API verifies its callers.
+const (
+	IdentityModeJWT          = "jwt"
+	IdentityModeSignedHeader = "signed_header"
+	IdentityModeMTLS         = "mtls"
+	IdentityModeTrustedProxy = "trusted_proxy"
 )
 
 type Config struct {
+	// Version identifies the loaded settings; it changes whenever a reload
+	// produces different effective configuration.
+	Version string `mapstructure:"-"`
+
 	Server struct {
 		Addr         string        `mapstructure:"addr"`
 		Mode         string        `mapstructure:"mode"`
 		ReadTimeout  time.Duration `mapstructure:"read_timeout"`
 		WriteTimeout time.Duration `mapstructure:"write_timeout"`
+		// DrainDelay is how long shutdown keeps serving after reporting the
+		// gRPC health as not serving, so load balancers stop sending traffic
+		// before connections are closed.
+		DrainDelay time.Duration `mapstructure:"drain_delay"`
+		// TLS serves HTTPS when CertFile and KeyFile are set. ClientCAFile
+		// verifies client certificates, as required by the mtls identity mode.
+		TLS struct {
+			CertFile     string `mapstructure:"cert_file"`
+			KeyFile      string `mapstructure:"key_file"`
+			ClientCAFile string `mapstructure:"client_ca_file"`
+		} `mapstructure:"tls"`
+		// ClientIP selects the client address used by audit events and the
+		// brute-force guard: the TrustedHops-th entry from the right of
+		// Header, as appended by the proxies in front of the service. Zero
+		// hops uses the connection's address.
+		ClientIP struct {
+			Header      string `mapstructure:"header"`
+			TrustedHops int    `mapstructure:"trusted_hops"`
+		} `mapstructure:"client_ip"`
 	} `mapstructure:"server"`
 
 	Redis struct {
-		URL      string `mapstructure:"url"`
+		URL      Secret `mapstructure:"url"`
 		PoolSize int    `mapstructure:"pool_size"`
 	} `mapstructure:"redis"`
 
+	Cache struct {
+		Backend string `mapstructure:"backend"` // "redis" or "memory"; empty selects by redis.url
+		Memory  struct {
+			MaxEntries      int           `mapstructure:"max_entries"`
+			CleanupInterval time.Duration `mapstructure:"cleanup_interval"`
+		} `mapstructure:"memory"`
+	} `mapstructure:"cache"`
+
 	Auth struct {
 		AdminMachineUser struct {
-			PAT string `mapstructure:"pat"`
+			PAT     Secret `mapstructure:"pat"`
+			KeyFile string `mapstructure:"key_file"` // service account key JSON; takes precedence over pat
 		} `mapstructure:"admin_machine_user"`
 		Zitadel struct {
 			Issuer         string `mapstructure:"issuer"`
 			ClientID       string `mapstructure:"client_id"`
-			ClientSecret   string `mapstructure:"client_secret"`
+			ClientSecret   Secret `mapstructure:"client_secret"`
 			OrganizationID string `mapstructure:"organization_id"`
+			// ClientAuthMethod is "client_secret_basic" (default) or "private_key_jwt".
+			ClientAuthMethod string `mapstructure:"client_auth_method"`
+			ClientKeyFile    string `mapstructure:"client_key_file"` // application key JSON for private_key_jwt
+			// Tenants exchange the PATs of requests to their hosts with their
+			// own application; other hosts use the application above.
+			Tenants []ZitadelTenant `mapstructure:"tenants"`
+			// HTTP configures the transport of all requests to Zitadel,
+			// including the JWKS fetched by the jwt identity mode.
+			HTTP struct {
+				Timeout             time.Duration `mapstructure:"timeout"`
+				RootCAFile          string        `mapstructure:"root_ca_file"` // trusted in addition to the system roots
+				ClientCertFile      string        `mapstructure:"client_cert_file"`
+				ClientKeyFile       string        `mapstructure:"client_key_file"`
+				ProxyURL            string        `mapstructure:"proxy_url"` // empty uses HTTP(S)_PROXY
+				MaxIdleConns        int           `mapstructure:"max_idle_conns"`
+				MaxIdleConnsPerHost int           `mapstructure:"max_idle_conns_per_host"`
+				MaxConnsPerHost     int           `mapstructure:"max_conns_per_host"` // 0 = unlimited
+				IdleConnTimeout     time.Duration `mapstructure:"idle_conn_timeout"`
+				KeepAlive           time.Duration `mapstructure:"keep_alive"`
+				DisableKeepAlives   bool          `mapstructure:"disable_keep_alives"`
+			} `mapstructure:"http"`
+			// Resilience tunes per-call timeouts, retries of idempotent calls
+			// and the circuit breaker; zero values use the built-in defaults.
+			Resilience struct {
+				Timeouts map[string]time.Duration `mapstructure:"timeouts"` // by endpoint name
+				Retry    struct {
+					MaxAttempts int           `mapstructure:"max_attempts"`
+					BaseBackoff time.Duration `mapstructure:"base_backoff"`
+					MaxBackoff  time.Duration `mapstructure:"max_backoff"`
+				} `mapstructure:"retry"`
+				CircuitBreaker struct {
+					FailureThreshold int           `mapstructure:"failure_threshold"` // negative disables
+					OpenDuration     time.Duration `mapstructure:"open_duration"`
+				} `mapstructure:"circuit_breaker"`
+			} `mapstructure:"resilience"`
 		} `mapstructure:"zitadel"`
-		CacheTTL   time.Duration `mapstructure:"cache_ttl"`
+		CacheTTL time.Duration `mapstructure:"cache_ttl"`
+		// CacheRefresh serves entries past soft_ttl_ratio of their TTL while
+		// refreshing them in the background, and jitters TTLs by ttl_jitter.
+		CacheRefresh struct {
+			SoftTTLRatio float64       `mapstructure:"soft_ttl_ratio"` // 0 disables refreshing
+			TTLJitter    float64       `mapstructure:"ttl_jitter"`
+			Timeout      time.Duration `mapstructure:"timeout"`
+		} `mapstructure:"cache_refresh"`
 		HeaderKeys struct {
 			UserID                string `mapstructure:"user_id"`
 			UserEmail             string `mapstructure:"user_email"`
@@ -41,11 +125,51 @@ type Config struct {
 			UserPreferredUsername string `mapstructure:"user_preferred_username"`
 			UserJWT               string `mapstructure:"user_jwt"`
 		} `mapstructure:"header_keys"`
+		// Identity configures how the PAT API establishes its caller. Only
+		// the trusted_proxy mode takes the header_keys headers at face value.
+		Identity struct {
+			Mode string `mapstructure:"mode"`
+			JWT  struct {
+				JWKSURL     string   `mapstructure:"jwks_url"` // empty uses <issuer>/oauth/v2/keys
+				Issuer      string   `mapstructure:"issuer"`   // empty uses auth.zitadel.issuer
+				Audiences   []string `mapstructure:"audiences"`
+				GroupsClaim string   `mapstructure:"groups_claim"`
+				RolesClaim  string   `mapstructure:"roles_claim"`
+			} `mapstructure:"jwt"`
+			SignedHeader struct {
+				Secret Secret        `mapstructure:"secret"`
+				MaxAge time.Duration `mapstructure:"max_age"`
+			} `mapstructure:"signed_header"`
+			MTLS struct {
+				// AllowedSubjects restricts the accepted client certificates
+				// by common name, DNS name or URI SAN; empty accepts any
+				// certificate issued by server.tls.client_ca_file.
+				AllowedSubjects []string `mapstructure:"allowed_subjects"`
+			} `mapstructure:"mtls"`
+		} `mapstructure:"identity"`
+		// RateLimits are checked in order on every allowed request; the first
+		// exhausted quota denies it with 429.
+		RateLimits []RateLimitRule `mapstructure:"rate_limits"`
+		// BruteForce delays and then blocks source IPs that present too many
+		// invalid PATs, before any Zitadel call is made for them.
+		BruteForce struct {
+			Enabled       bool          `mapstructure:"enabled"`
+			MaxFailures   int           `mapstructure:"max_failures"`
+			Window        time.Duration `mapstructure:"window"`
+			BlockDuration time.Duration `mapstructure:"block_duration"`
+			DelayAfter    int           `mapstructure:"delay_after"` // 0 disables delays
+			BaseDelay     time.Duration `mapstructure:"base_delay"`
+			MaxDelay      time.Duration `mapstructure:"max_delay"`
+		} `mapstructure:"brute_force"`
 	} `mapstructure:"auth"`
 
 	Observability struct {
-		MetricsEnabled     bool   `mapstructure:"metrics_enabled"`
-		TraceEnabled       bool   `mapstructure:"trace_enabled"`
+		MetricsEnabled bool `mapstructure:"metrics_enabled"`
+		TraceEnabled   bool `mapstructure:"trace_enabled"`
+		// OTLPMetricsEnabled and OTLPLogsEnabled export metrics and logs to
+		// TracingEndpointURL alongside traces.
+		OTLPMetricsEnabled bool   `mapstructure:"otlp_metrics_enabled"`
+		OTLPLogsEnabled    bool   `mapstructure:"otlp_logs_enabled"`
 		TracingEndpointURL string `mapstructure:"tracing_endpoint_url"`
 		LogLevel           string `mapstructure:"log_level"`
 		Format             string `mapstructure:"log_format"`
@@ -55,40 +179,155 @@ type Config struct {
 	CORS struct {
 		AllowedOrigins []string `mapstructure:"allowed_origins"`
 	} `mapstructure:"cors"`
+
+	// Audit selects the sinks audit events are written to; with none
+	// configured, auditing is disabled.
+	Audit struct {
+		Stdout bool `mapstructure:"stdout"`
+		File   struct {
+			Path       string `mapstructure:"path"`
+			MaxSizeMB  int    `mapstructure:"max_size_mb"`
+			MaxBackups int    `mapstructure:"max_backups"`
+		} `mapstructure:"file"`
+		Webhook struct {
+			URL         Secret `mapstructure:"url"`
+			MaxAttempts int    `mapstructure:"max_attempts"`
+		} `mapstructure:"webhook"`
+	} `mapstructure:"audit"`
+
+	// PATPolicy limits the PATs users can create; zero values mean unlimited.
+	PATPolicy struct {
+		MaxLifetime      time.Duration    `mapstructure:"max_lifetime"`
+		DefaultLifetime  time.Duration    `mapstructure:"default_lifetime"`
+		MaxActivePerUser int              `mapstructure:"max_active_per_user"`
+		GroupOverrides   []GroupPATPolicy `mapstructure:"group_overrides"`
+	} `mapstructure:"pat_policy"`
+
+	// PATRotation configures RotatePAT and the worker that deletes rotated
+	// PATs once their grace period ends.
+	PATRotation struct {
+		GracePeriod      time.Duration `mapstructure:"grace_period"`
+		MaxGracePeriod   time.Duration `mapstructure:"max_grace_period"`
+		DeletionInterval time.Duration `mapstructure:"deletion_interval"`
+	} `mapstructure:"pat_rotation"`
+
+	// Admin grants access to the AdminPATService to members of any of Groups
+	// and holders of any of Roles. Empty denies everyone.
+	Admin struct {
+		Groups []string `mapstructure:"groups"`
+		Roles  []string `mapstructure:"roles"`
+	} `mapstructure:"admin"`
+
+	Notifications struct {
+		// LongLivedThreshold triggers a pat.long_lived notification for PATs
+		// created with a longer lifetime; zero disables it.
+		LongLivedThreshold time.Duration `mapstructure:"long_lived_threshold"`
+		DeadLetterPath     string        `mapstructure:"dead_letter_path"`
+		Webhooks           []Webhook     `mapstructure:"webhooks"`
+	} `mapstructure:"notifications"`
+
+	// Reminders configures the background scan that warns PAT owners before
+	// their PATs expire.
+	Reminders struct {
+		Enabled  bool            `mapstructure:"enabled"`
+		Interval time.Duration   `mapstructure:"interval"`
+		Windows  []time.Duration `mapstructure:"windows"`
+		// Webhook sends reminders as pat.expiring notifications to
+		// notifications.webhooks.
+		Webhook bool `mapstructure:"webhook"`
+		SMTP    struct {
+			Addr     string        `mapstructure:"addr"`
+			Username string        `mapstructure:"username"`
+			Password Secret        `mapstructure:"password"`
+			From     string        `mapstructure:"from"`
+			Timeout  time.Duration `mapstructure:"timeout"` // of one message, from dial to QUIT
+		} `mapstructure:"smtp"`
+	} `mapstructure:"reminders"`
 }
 
-func MustLoad() *Config {
-	v := viper.New()
+// GroupPATPolicy replaces the PAT limits for members of Group; limits left at
+// zero keep the pat_policy value. When a user is in several such groups, the
+// most permissive value of each limit applies.
+type GroupPATPolicy struct {
+	Group            string        `mapstructure:"group"`
+	MaxLifetime      time.Duration `mapstructure:"max_lifetime"`
+	MaxActivePerUser int           `mapstructure:"max_active_per_user"`
+}
 
-	logger := slog.Default()
+// RateLimitRule allows Limit requests per Window, counted per PAT, user or
+// group, to the requests matching Methods and Paths (prefixes); empty
+// matches any. Groups, when set, restricts the rule to their members.
+type RateLimitRule struct {
+	Name    string        `mapstructure:"name"`
+	Methods []string      `mapstructure:"methods"`
+	Paths   []string      `mapstructure:"paths"`
+	By      string        `mapstructure:"by"` // "pat", "user" or "group"
+	Groups  []string      `mapstructure:"groups"`
+	Limit   int           `mapstructure:"limit"`
+	Window  time.Duration `mapstructure:"window"`
+}
 
-	v.SetConfigName("config")
-	v.SetConfigType("yaml")
-	v.AddConfigPath("./config")
-	v.AddConfigPath(".")
+// ZitadelTenant is a Zitadel application, on the same issuer, that token
+// exchanges for requests to Hosts authenticate as. ClientAuthMethod and
+// ClientKeyFile work as in auth.zitadel.
+type ZitadelTenant struct {
+	Name             string   `mapstructure:"name"`
+	Hosts            []string `mapstructure:"hosts"`
+	ClientID         string   `mapstructure:"client_id"`
+	ClientSecret     Secret   `mapstructure:"client_secret"`
+	ClientAuthMethod string   `mapstructure:"client_auth_method"`
+	ClientKeyFile    string   `mapstructure:"client_key_file"`
+}
 
-	v.AutomaticEnv()
-	v.SetEnvPrefix("OAUTH2_TOKEN_EXCHANGE")
-	v.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
+// Webhook is a receiver of PAT lifecycle notifications. Events lists the
+// subscribed notification types; empty subscribes to all.
+type Webhook struct {
+	Name        string   `mapstructure:"name"`
+	URL         Secret   `mapstructure:"url"`
+	Secret      Secret   `mapstructure:"secret"`
+	Events      []string `mapstructure:"events"`
+	MaxAttempts int      `mapstructure:"max_attempts"`
+}
 
-	if err := v.ReadInConfig(); err != nil {
-		logger.Error("Failed to read config", slog.Any("error", err))
+func MustLoad() *Config {
+	cfg, err := NewLoader().Load()
+	if err != nil {
+		slog.Default().Error("Failed to load config", slog.Any("error", err))
 		os.Exit(1)
 	}
 
-	if env := os.Getenv("APP_ENV"); env != "" {
-		v.SetConfigName(fmt.Sprintf("config.%s", env))
-		if err := v.MergeInConfig(); err != nil {
-			logger.Info("No environment-specific config (optional)", slog.String("env", env))
-		}
-		logger.Info("Environment-specific config loaded", slog.String("env", env))
+	if err = cfg.Validate(); err != nil {
+		slog.Default().Error("Invalid config", slog.Any("error", err))
+		os.Exit(1)
 	}
 
-	var cfg Config
-	if err := v.Unmarshal(&cfg); err != nil {
-		logger.Error("Failed to unmarshal config", slog.Any("error", err))
-		os.Exit(1)
+	return cfg
+}
+
+// HeaderKeyMap returns the configured response header names keyed by the
+// claim they carry, as consumed by the authz domain.
+func (c *Config) HeaderKeyMap() map[string]string {
+	return map[string]string{
+		"user_id":                 c.Auth.HeaderKeys.UserID,
+		"user_email":              c.Auth.HeaderKeys.UserEmail,
+		"user_groups":             c.Auth.HeaderKeys.UserGroups,
+		"user_preferred_username": c.Auth.HeaderKeys.UserPreferredUsername,
+		"user_jwt":                c.Auth.HeaderKeys.UserJWT,
+	}
+}
+
+// JWTIssuer returns the issuer caller JWTs must come from.
+func (c *Config) JWTIssuer() string {
+	if c.Auth.Identity.JWT.Issuer != "" {
+		return c.Auth.Identity.JWT.Issuer
 	}
+	return c.Auth.Zitadel.Issuer
+}
 
-	return &cfg
+// JWKSURL returns where the signing keys of caller JWTs are published.
+func (c *Config) JWKSURL() string {
+	if c.Auth.Identity.JWT.JWKSURL != "" {
+		return c.Auth.Identity.JWT.JWKSURL
+	}
+	return strings.TrimSuffix(c.JWTIssuer(), "/") + "/oauth/v2/keys"
 }
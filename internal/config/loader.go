@@ -0,0 +1,309 @@
+package config
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/astro-web3/oauth2-token-exchange/pkg/logger"
+	"github.com/fsnotify/fsnotify"
+	"github.com/spf13/viper"
+)
+
+const (
+	versionLength = 12
+	// reloadDebounce coalesces the events of a single save (truncate, write,
+	// rename) so the config is read once it is complete.
+	reloadDebounce = 100 * time.Millisecond
+)
+
+// Loader reads the configuration from the config files and environment.
+type Loader struct {
+	env  string
+	file string
+
+	mu          sync.Mutex
+	files       []string
+	reloadTimer *time.Timer
+	reloadMu    sync.Mutex
+}
+
+// LoaderOption configures a Loader.
+type LoaderOption func(*Loader)
+
+// WithConfigFile reads the config from path instead of searching for
+// config.yaml in ./config and the working directory.
+func WithConfigFile(path string) LoaderOption {
+	return func(l *Loader) {
+		l.file = path
+	}
+}
+
+func NewLoader(opts ...LoaderOption) *Loader {
+	l := &Loader{env: os.Getenv("APP_ENV")}
+	for _, opt := range opts {
+		opt(l)
+	}
+	return l
+}
+
+// Load reads config.yaml, merges config.<APP_ENV>.yaml when present, applies
+// environment overrides and resolves secret references. With WithConfigFile,
+// the environment file is looked up next to the given file, e.g.
+// values.<APP_ENV>.yaml for values.yaml.
+func (l *Loader) Load() (*Config, error) {
+	v := viper.New()
+
+	v.SetConfigType("yaml")
+	if l.file != "" {
+		v.SetConfigFile(l.file)
+	} else {
+		v.SetConfigName("config")
+		v.AddConfigPath("./config")
+		v.AddConfigPath(".")
+	}
+
+	v.AutomaticEnv()
+	v.SetEnvPrefix("OAUTH2_TOKEN_EXCHANGE")
+	v.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
+
+	if err := v.ReadInConfig(); err != nil {
+		return nil, fmt.Errorf("failed to read config: %w", err)
+	}
+	files := []string{v.ConfigFileUsed()}
+
+	if l.env != "" {
+		if l.file != "" {
+			ext := filepath.Ext(l.file)
+			v.SetConfigFile(strings.TrimSuffix(l.file, ext) + "." + l.env + ext)
+		} else {
+			v.SetConfigName("config." + l.env)
+		}
+		if err := v.MergeInConfig(); err != nil {
+			slog.Default().Info("No environment-specific config (optional)", slog.String("env", l.env))
+		} else {
+			slog.Default().Info("Environment-specific config loaded", slog.String("env", l.env))
+			files = append(files, v.ConfigFileUsed())
+		}
+	}
+
+	var cfg Config
+	if err := v.Unmarshal(&cfg); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal config: %w", err)
+	}
+
+	if err := cfg.resolveSecrets(); err != nil {
+		return nil, fmt.Errorf("failed to resolve secrets: %w", err)
+	}
+
+	if err := cfg.setVersion(); err != nil {
+		return nil, err
+	}
+
+	l.mu.Lock()
+	l.files = files
+	l.mu.Unlock()
+
+	return &cfg, nil
+}
+
+// Watch reloads the configuration whenever one of the loaded files changes
+// and swaps it into store if it passes validation. Invalid configurations
+// are logged and the previous configuration stays active.
+func (l *Loader) Watch(store *Store) {
+	l.mu.Lock()
+	files := append([]string(nil), l.files...)
+	l.mu.Unlock()
+
+	for _, file := range files {
+		w := viper.New()
+		w.SetConfigFile(file)
+		w.OnConfigChange(func(fsnotify.Event) {
+			l.scheduleReload(store)
+		})
+		w.WatchConfig()
+	}
+}
+
+func (l *Loader) scheduleReload(store *Store) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.reloadTimer != nil {
+		l.reloadTimer.Stop()
+	}
+	l.reloadTimer = time.AfterFunc(reloadDebounce, func() {
+		l.reload(store)
+	})
+}
+
+func (l *Loader) reload(store *Store) {
+	l.reloadMu.Lock()
+	defer l.reloadMu.Unlock()
+
+	ctx := context.Background()
+
+	cfg, err := l.Load()
+	if err != nil {
+		logger.ErrorContext(ctx, "config reload failed, keeping active config",
+			slog.String("config_version", store.Get().Version),
+			slog.String("error", err.Error()),
+		)
+		return
+	}
+
+	if err = cfg.Validate(); err != nil {
+		logger.ErrorContext(ctx, "reloaded config is invalid, keeping active config",
+			slog.String("config_version", store.Get().Version),
+			slog.String("error", err.Error()),
+		)
+		return
+	}
+
+	previous := store.Get()
+	if cfg.Version == previous.Version {
+		return
+	}
+
+	if sections := keepRestartRequired(previous, cfg); len(sections) > 0 {
+		logger.WarnContext(ctx, "config changes that require a restart were ignored",
+			slog.Any("sections", sections),
+		)
+		// The ignored changes must not show up in the active version.
+		if err = cfg.setVersion(); err != nil {
+			logger.ErrorContext(ctx, "config reload failed, keeping active config",
+				slog.String("config_version", previous.Version),
+				slog.String("error", err.Error()),
+			)
+			return
+		}
+		if cfg.Version == previous.Version {
+			return
+		}
+	}
+
+	store.swap(cfg)
+
+	logger.InfoContext(ctx, "config reloaded",
+		slog.String("previous_config_version", previous.Version),
+		slog.String("config_version", cfg.Version),
+	)
+}
+
+// configSection is a config section by config key, pointing into a Config.
+type configSection struct {
+	name  string
+	value any
+}
+
+// restartSections returns the sections of c that are only read at startup.
+// Of observability, only log_level is applied on reload.
+func restartSections(c *Config) []configSection {
+	return []configSection{
+		{"server", &c.Server},
+		{"redis", &c.Redis},
+		{"cache", &c.Cache},
+		{"auth.admin_machine_user", &c.Auth.AdminMachineUser},
+		{"auth.zitadel", &c.Auth.Zitadel},
+		{"auth.identity", &c.Auth.Identity},
+		{"auth.cache_refresh", &c.Auth.CacheRefresh},
+		{"auth.rate_limits", &c.Auth.RateLimits},
+		{"auth.brute_force", &c.Auth.BruteForce},
+		{"audit", &c.Audit},
+		{"pat_policy", &c.PATPolicy},
+		{"pat_rotation", &c.PATRotation},
+		{"admin", &c.Admin},
+		{"notifications", &c.Notifications},
+		{"reminders", &c.Reminders},
+		{"observability", &c.Observability},
+	}
+}
+
+// keepRestartRequired reverts the sections of newCfg that differ from oldCfg
+// but are only read at startup, so the stored config matches what is
+// running, and returns their names.
+func keepRestartRequired(oldCfg, newCfg *Config) []string {
+	logLevel := newCfg.Observability.LogLevel
+	newCfg.Observability.LogLevel = oldCfg.Observability.LogLevel
+	defer func() { newCfg.Observability.LogLevel = logLevel }()
+
+	oldSections, newSections := restartSections(oldCfg), restartSections(newCfg)
+
+	var names []string
+	for i, section := range newSections {
+		oldValue := reflect.ValueOf(oldSections[i].value).Elem()
+		newValue := reflect.ValueOf(section.value).Elem()
+		if !reflect.DeepEqual(oldValue.Interface(), newValue.Interface()) {
+			names = append(names, section.name)
+			newValue.Set(oldValue)
+		}
+	}
+	return names
+}
+
+// setVersion derives Version from the effective settings. Secrets count by
+// reference only, so the version never depends on secret material.
+func (c *Config) setVersion() error {
+	version, err := settingsVersion(c.Redacted())
+	if err != nil {
+		return err
+	}
+	c.Version = version
+	return nil
+}
+
+func settingsVersion(settings map[string]any) (string, error) {
+	data, err := json.Marshal(settings)
+	if err != nil {
+		return "", fmt.Errorf("failed to compute config version: %w", err)
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])[:versionLength], nil
+}
+
+// Store holds the active configuration. Reloads swap it atomically, so a
+// caller sees either the old or the new configuration, never a mix.
+type Store struct {
+	current atomic.Pointer[Config]
+
+	mu        sync.Mutex
+	listeners []func(*Config)
+}
+
+func NewStore(cfg *Config) *Store {
+	s := &Store{}
+	s.current.Store(cfg)
+	return s
+}
+
+// Get returns the active configuration. The returned value must not be modified.
+func (s *Store) Get() *Config {
+	return s.current.Load()
+}
+
+// OnChange registers fn to be called with the new configuration after each reload.
+func (s *Store) OnChange(fn func(*Config)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.listeners = append(s.listeners, fn)
+}
+
+func (s *Store) swap(cfg *Config) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.current.Store(cfg)
+	for _, fn := range s.listeners {
+		fn(cfg)
+	}
+}
@@ -0,0 +1,139 @@
+package config_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/astro-web3/oauth2-token-exchange/internal/config"
+)
+
+func writeConfig(t *testing.T, dir string, cacheTTL string, userIDHeader string) {
+	t.Helper()
+
+	data := fmt.Sprintf(`server:
+  addr: ":8123"
+  read_timeout: 30s
+  write_timeout: 30s
+auth:
+  admin_machine_user:
+    pat: admin-pat
+  zitadel:
+    issuer: https://zitadel.example.com
+    client_id: client-1
+    client_secret: secret
+  cache_ttl: %s
+  header_keys:
+    user_id: %q
+    user_email: X-Auth-Request-Email
+    user_groups: X-Auth-Request-Groups
+    user_preferred_username: X-Auth-Request-Preferred-Username
+    user_jwt: X-Auth-Request-Access-Token
+`, cacheTTL, userIDHeader)
+	if err := os.WriteFile(filepath.Join(dir, "config.yaml"), []byte(data), 0o600); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+}
+
+func TestLoader_Watch(t *testing.T) {
+	dir := t.TempDir()
+	t.Chdir(dir)
+	t.Setenv("APP_ENV", "")
+
+	writeConfig(t, dir, "5m", "X-Auth-Request-User")
+
+	loader := config.NewLoader()
+	cfg, err := loader.Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Version == "" {
+		t.Fatal("expected config version to be set")
+	}
+
+	store := config.NewStore(cfg)
+	changed := make(chan *config.Config, 1)
+	store.OnChange(func(newCfg *config.Config) {
+		changed <- newCfg
+	})
+	loader.Watch(store)
+
+	writeConfig(t, dir, "10m", "X-User")
+
+	select {
+	case newCfg := <-changed:
+		if newCfg.Auth.CacheTTL != 10*time.Minute {
+			t.Errorf("expected cache TTL 10m, got %s", newCfg.Auth.CacheTTL)
+		}
+		if newCfg.Version == cfg.Version {
+			t.Error("expected config version to change")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("config was not reloaded")
+	}
+
+	writeConfig(t, dir, "1m", "X User")
+
+	select {
+	case newCfg := <-changed:
+		t.Fatalf("invalid config was applied: %+v", newCfg.Auth)
+	case <-time.After(300 * time.Millisecond):
+	}
+	if got := store.Get().Auth.HeaderKeys.UserID; got != "X-User" {
+		t.Errorf("expected previous header key to stay active, got %q", got)
+	}
+}
+
+func TestLoader_Watch_KeepsRestartRequiredSections(t *testing.T) {
+	dir := t.TempDir()
+	t.Chdir(dir)
+	t.Setenv("APP_ENV", "")
+
+	writeConfig(t, dir, "5m", "X-Auth-Request-User")
+
+	loader := config.NewLoader()
+	cfg, err := loader.Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	store := config.NewStore(cfg)
+	changed := make(chan *config.Config, 1)
+	store.OnChange(func(newCfg *config.Config) {
+		changed <- newCfg
+	})
+	loader.Watch(store)
+
+	// server.addr is only read at startup; cache_ttl is applied on reload.
+	t.Setenv("OAUTH2_TOKEN_EXCHANGE_SERVER_ADDR", ":9000")
+	writeConfig(t, dir, "10m", "X-Auth-Request-User")
+
+	select {
+	case newCfg := <-changed:
+		if newCfg.Auth.CacheTTL != 10*time.Minute {
+			t.Errorf("expected cache TTL 10m, got %s", newCfg.Auth.CacheTTL)
+		}
+		if newCfg.Server.Addr != ":8123" {
+			t.Errorf("expected the running server address to stay active, got %q", newCfg.Server.Addr)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("config was not reloaded")
+	}
+
+	// A change to restart-required sections alone does not change the
+	// active config or its version.
+	version := store.Get().Version
+	t.Setenv("OAUTH2_TOKEN_EXCHANGE_SERVER_ADDR", ":9001")
+	writeConfig(t, dir, "10m", "X-Auth-Request-User")
+
+	select {
+	case newCfg := <-changed:
+		t.Fatalf("ignored change was applied as version %s", newCfg.Version)
+	case <-time.After(300 * time.Millisecond):
+	}
+	if store.Get().Version != version {
+		t.Errorf("expected version %s to stay active, got %s", version, store.Get().Version)
+	}
+}
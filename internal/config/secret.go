@@ -0,0 +1,292 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/astro-web3/oauth2-token-exchange/pkg/logger"
+	"github.com/fsnotify/fsnotify"
+)
+
+const (
+	secretFileScheme = "file://"
+	secretEnvScheme  = "env://"
+	redacted         = "[REDACTED]"
+)
+
+// Secret is a config value holding either a literal secret or a reference to
+// one: "file:///path" reads the file (trailing newlines trimmed) and
+// "env://NAME" reads the environment variable NAME. File contents are cached
+// and refreshed by WatchSecrets when the file changes, so rotated Kubernetes
+// secrets are picked up without a restart.
+//
+// Secrets are redacted whenever they are printed, logged or marshaled;
+// references are shown as-is since they carry no secret material.
+type Secret string
+
+// Value returns the current secret value. If a referenced file cannot be read,
+// the last successfully read value is returned and the error is logged.
+func (s Secret) Value() string {
+	value, err := s.Resolve()
+	if err != nil {
+		logger.WarnContext(context.Background(), "failed to resolve secret",
+			slog.String("ref", s.String()),
+			slog.String("error", err.Error()),
+		)
+	}
+	return value
+}
+
+// Resolve returns the current secret value or an error if it cannot be read.
+func (s Secret) Resolve() (string, error) {
+	ref := string(s)
+	switch {
+	case strings.HasPrefix(ref, secretFileScheme):
+		return secretFiles.get(strings.TrimPrefix(ref, secretFileScheme))
+	case strings.HasPrefix(ref, secretEnvScheme):
+		name := strings.TrimPrefix(ref, secretEnvScheme)
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			return "", fmt.Errorf("environment variable %s is not set", name)
+		}
+		return value, nil
+	default:
+		return ref, nil
+	}
+}
+
+// IsReference reports whether the secret points at a file or an environment variable.
+func (s Secret) IsReference() bool {
+	ref := string(s)
+	return strings.HasPrefix(ref, secretFileScheme) || strings.HasPrefix(ref, secretEnvScheme)
+}
+
+func (s Secret) String() string {
+	if s == "" || s.IsReference() {
+		return string(s)
+	}
+	return redacted
+}
+
+func (s Secret) GoString() string {
+	return s.String()
+}
+
+func (s Secret) LogValue() slog.Value {
+	return slog.StringValue(s.String())
+}
+
+func (s Secret) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// secrets returns every Secret field in cfg, so new secret fields are
+// resolved and watched without further wiring.
+func (c *Config) secrets() []Secret {
+	var out []Secret
+	collectSecrets(reflect.ValueOf(c).Elem(), &out)
+	return out
+}
+
+func collectSecrets(v reflect.Value, out *[]Secret) {
+	switch v.Kind() { //nolint:exhaustive // Only containers and secrets are relevant.
+	case reflect.Struct:
+		for i := range v.NumField() {
+			collectSecrets(v.Field(i), out)
+		}
+	case reflect.Slice:
+		for i := range v.Len() {
+			collectSecrets(v.Index(i), out)
+		}
+	case reflect.String:
+		if secret, ok := v.Interface().(Secret); ok && secret != "" {
+			*out = append(*out, secret)
+		}
+	}
+}
+
+// Redacted returns the configuration as nested maps keyed by config key, with
+// secrets redacted, for printing.
+func (c *Config) Redacted() map[string]any {
+	settings, _ := redactedValue(reflect.ValueOf(c).Elem()).(map[string]any)
+	return settings
+}
+
+func redactedValue(v reflect.Value) any {
+	switch value := v.Interface().(type) {
+	case Secret:
+		return value.String()
+	case time.Duration:
+		return value.String()
+	}
+
+	switch v.Kind() { //nolint:exhaustive // Other kinds are printed as-is.
+	case reflect.Struct:
+		settings := make(map[string]any, v.NumField())
+		for i := range v.NumField() {
+			key := v.Type().Field(i).Tag.Get("mapstructure")
+			if key == "" || key == "-" {
+				continue
+			}
+			settings[key] = redactedValue(v.Field(i))
+		}
+		return settings
+	case reflect.Slice:
+		items := make([]any, 0, v.Len())
+		for i := range v.Len() {
+			items = append(items, redactedValue(v.Index(i)))
+		}
+		return items
+	default:
+		return v.Interface()
+	}
+}
+
+// resolveSecrets checks that every secret reference in cfg can be read.
+func (c *Config) resolveSecrets() error {
+	var errs []error
+	for _, secret := range c.secrets() {
+		if _, err := secret.Resolve(); err != nil {
+			errs = append(errs, fmt.Errorf("secret %s: %w", secret, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+type secretFileCache struct {
+	mu     sync.RWMutex
+	values map[string]string
+}
+
+//nolint:gochecknoglobals // Secret file contents are shared by all Secret values referencing them.
+var secretFiles = &secretFileCache{values: make(map[string]string)}
+
+func (c *secretFileCache) get(path string) (string, error) {
+	c.mu.RLock()
+	value, ok := c.values[path]
+	c.mu.RUnlock()
+	if ok {
+		return value, nil
+	}
+
+	value, _, err := c.reload(path)
+	return value, err
+}
+
+// reload re-reads the file at path and reports whether its content changed.
+func (c *secretFileCache) reload(path string) (string, bool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		c.mu.RLock()
+		value := c.values[path]
+		c.mu.RUnlock()
+		return value, false, fmt.Errorf("failed to read secret file: %w", err)
+	}
+
+	value := strings.TrimRight(string(data), "\r\n")
+
+	c.mu.Lock()
+	previous, existed := c.values[path]
+	c.values[path] = value
+	c.mu.Unlock()
+
+	return value, existed && previous != value, nil
+}
+
+func (c *secretFileCache) pathsIn(dir string) []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	var paths []string
+	for path := range c.values {
+		if filepath.Dir(path) == dir {
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
+
+// SecretWatcher re-reads secret files when they change on disk.
+type SecretWatcher struct {
+	watcher *fsnotify.Watcher
+	done    chan struct{}
+}
+
+// WatchSecrets watches the directories of all file-referenced secrets in cfg.
+// Directories rather than files are watched because Kubernetes updates
+// mounted secrets by atomically swapping a symlink in the directory.
+func WatchSecrets(cfg *Config) (*SecretWatcher, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create secret watcher: %w", err)
+	}
+
+	dirs := make(map[string]bool)
+	for _, secret := range cfg.secrets() {
+		ref := string(secret)
+		if !strings.HasPrefix(ref, secretFileScheme) {
+			continue
+		}
+		dir := filepath.Dir(strings.TrimPrefix(ref, secretFileScheme))
+		if dirs[dir] {
+			continue
+		}
+		dirs[dir] = true
+		if err = watcher.Add(dir); err != nil {
+			_ = watcher.Close()
+			return nil, fmt.Errorf("failed to watch secret directory %s: %w", dir, err)
+		}
+	}
+
+	w := &SecretWatcher{watcher: watcher, done: make(chan struct{})}
+	go w.run()
+
+	return w, nil
+}
+
+func (w *SecretWatcher) run() {
+	defer close(w.done)
+
+	ctx := context.Background()
+	for {
+		select {
+		case event, ok := <-w.watcher.Events:
+			if !ok {
+				return
+			}
+			for _, path := range secretFiles.pathsIn(filepath.Dir(event.Name)) {
+				_, changed, err := secretFiles.reload(path)
+				if err != nil {
+					logger.WarnContext(ctx, "failed to reload secret file",
+						slog.String("path", path),
+						slog.String("error", err.Error()),
+					)
+					continue
+				}
+				if changed {
+					logger.InfoContext(ctx, "secret file reloaded", slog.String("path", path))
+				}
+			}
+		case err, ok := <-w.watcher.Errors:
+			if !ok {
+				return
+			}
+			logger.WarnContext(ctx, "secret watcher error", slog.String("error", err.Error()))
+		}
+	}
+}
+
+// Close stops watching secret files.
+func (w *SecretWatcher) Close() error {
+	err := w.watcher.Close()
+	<-w.done
+	return err
+}
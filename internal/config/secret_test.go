@@ -0,0 +1,97 @@
+package config_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/astro-web3/oauth2-token-exchange/internal/config"
+)
+
+func TestSecret_Resolve(t *testing.T) {
+	t.Setenv("TEST_CLIENT_SECRET", "from-env")
+
+	path := filepath.Join(t.TempDir(), "client_secret")
+	if err := os.WriteFile(path, []byte("from-file\n"), 0o600); err != nil {
+		t.Fatalf("failed to write secret: %v", err)
+	}
+
+	tests := []struct {
+		secret config.Secret
+		want   string
+	}{
+		{secret: "literal", want: "literal"},
+		{secret: "env://TEST_CLIENT_SECRET", want: "from-env"},
+		{secret: config.Secret("file://" + path), want: "from-file"},
+	}
+
+	for _, tt := range tests {
+		got, err := tt.secret.Resolve()
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.secret, err)
+		}
+		if got != tt.want {
+			t.Errorf("%s: expected %q, got %q", tt.secret, tt.want, got)
+		}
+	}
+
+	if _, err := config.Secret("env://TEST_MISSING_SECRET").Resolve(); err == nil {
+		t.Error("expected error for unset environment variable")
+	}
+}
+
+func TestSecret_Redacted(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Auth.Zitadel.ClientSecret = "super-secret"
+	cfg.Auth.AdminMachineUser.PAT = "env://ADMIN_PAT"
+
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, printed := range []string{fmt.Sprintf("%v", cfg), fmt.Sprintf("%+v", cfg), string(data)} {
+		if strings.Contains(printed, "super-secret") {
+			t.Errorf("secret leaked: %s", printed)
+		}
+		if !strings.Contains(printed, "env://ADMIN_PAT") {
+			t.Errorf("expected reference to be shown: %s", printed)
+		}
+	}
+}
+
+func TestWatchSecrets_ReloadsChangedFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pat")
+	if err := os.WriteFile(path, []byte("old"), 0o600); err != nil {
+		t.Fatalf("failed to write secret: %v", err)
+	}
+
+	cfg := &config.Config{}
+	cfg.Auth.AdminMachineUser.PAT = config.Secret("file://" + path)
+
+	if got := cfg.Auth.AdminMachineUser.PAT.Value(); got != "old" {
+		t.Fatalf("expected old, got %q", got)
+	}
+
+	watcher, err := config.WatchSecrets(cfg)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer watcher.Close()
+
+	if err = os.WriteFile(path, []byte("new"), 0o600); err != nil {
+		t.Fatalf("failed to write secret: %v", err)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for cfg.Auth.AdminMachineUser.PAT.Value() != "new" {
+		if time.Now().After(deadline) {
+			t.Fatal("secret was not reloaded")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,610 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/astro-web3/oauth2-token-exchange/internal/domain/pat"
+	"github.com/astro-web3/oauth2-token-exchange/internal/infra/zitadel"
+	"golang.org/x/net/http/httpguts"
+)
+
+const (
+	maxServerTimeout = 10 * time.Minute
+	maxDrainDelay    = time.Minute
+	maxCacheTTL      = 24 * time.Hour
+	maxTTLJitter     = 0.5
+
+	minCacheRefreshTimeout = 100 * time.Millisecond
+	maxCacheRefreshTimeout = 2 * time.Minute
+
+	minReminderInterval = time.Minute
+	maxReminderInterval = 24 * time.Hour
+	maxSMTPTimeout      = 5 * time.Minute
+
+	minDeletionInterval = time.Second
+	maxDeletionInterval = time.Hour
+
+	minSignatureMaxAge = time.Second
+	maxSignatureMaxAge = time.Hour
+
+	minRateLimitWindow = time.Second
+	maxRateLimitWindow = 24 * time.Hour
+
+	minBruteForceWindow = time.Second
+	maxBruteForceWindow = 24 * time.Hour
+	minBruteForceDelay  = time.Millisecond
+	maxBruteForceDelay  = 10 * time.Second
+
+	minZitadelTimeout     = 100 * time.Millisecond
+	maxZitadelTimeout     = 2 * time.Minute
+	maxZitadelAttempts    = 10
+	maxZitadelBackoff     = time.Minute
+	maxCircuitOpenTimeout = 10 * time.Minute
+)
+
+// Validate checks the configuration for missing required fields, malformed
+// URLs, out-of-range durations and invalid header names. All problems are
+// reported at once, one per line, prefixed with the offending config key.
+func (c *Config) Validate() error {
+	var v validator
+
+	c.validateServer(&v)
+	c.validateCache(&v)
+	c.validateZitadel(&v)
+	c.validateHeaderKeys(&v)
+	c.validateIdentity(&v)
+	c.validateRateLimits(&v)
+	c.validateBruteForce(&v)
+	c.validateObservability(&v)
+	c.validateAudit(&v)
+	c.validatePATPolicy(&v)
+	c.validatePATRotation(&v)
+	c.validateAdmin(&v)
+	c.validateNotifications(&v)
+	c.validateReminders(&v)
+
+	for i, origin := range c.CORS.AllowedOrigins {
+		v.url(fmt.Sprintf("cors.allowed_origins[%d]", i), origin, "http", "https")
+	}
+
+	return errors.Join(v.errs...)
+}
+
+// IdentityMode returns how PAT API callers are verified, defaulting to JWT
+// validation so that unverified headers are never trusted by accident.
+func (c *Config) IdentityMode() string {
+	if c.Auth.Identity.Mode != "" {
+		return c.Auth.Identity.Mode
+	}
+	return IdentityModeJWT
+}
+
+// CacheBackend returns the configured token cache backend, defaulting to
+// memory when no Redis URL is set.
+func (c *Config) CacheBackend() string {
+	if c.Cache.Backend != "" {
+		return c.Cache.Backend
+	}
+	if c.Redis.URL == "" {
+		return CacheBackendMemory
+	}
+	return CacheBackendRedis
+}
+
+func (c *Config) validateServer(v *validator) {
+	if c.Server.Addr == "" {
+		v.addf("server.addr", "is required")
+	} else if _, _, err := net.SplitHostPort(c.Server.Addr); err != nil {
+		v.addf("server.addr", "invalid address %q: %v", c.Server.Addr, err)
+	}
+	v.oneOf("server.mode", c.Server.Mode, "", "release", "debug")
+	v.durationIn("server.read_timeout", c.Server.ReadTimeout, time.Second, maxServerTimeout)
+	v.durationIn("server.write_timeout", c.Server.WriteTimeout, time.Second, maxServerTimeout)
+	if c.Server.DrainDelay != 0 {
+		v.durationIn("server.drain_delay", c.Server.DrainDelay, 0, maxDrainDelay)
+	}
+
+	t := c.Server.TLS
+	if (t.CertFile == "") != (t.KeyFile == "") {
+		v.addf("server.tls", "cert_file and key_file must be set together")
+	}
+	if t.ClientCAFile != "" && t.CertFile == "" {
+		v.addf("server.tls.client_ca_file", "requires cert_file and key_file")
+	}
+
+	ip := c.Server.ClientIP
+	if ip.TrustedHops < 0 {
+		v.addf("server.client_ip.trusted_hops", "must not be negative, got %d", ip.TrustedHops)
+	}
+	if ip.TrustedHops > 0 && !httpguts.ValidHeaderFieldName(ip.Header) {
+		v.addf("server.client_ip.header", "invalid header name %q", ip.Header)
+	}
+}
+
+func (c *Config) validateCache(v *validator) {
+	switch c.CacheBackend() {
+	case CacheBackendRedis:
+		redisURL, err := c.Redis.URL.Resolve()
+		switch {
+		case err != nil:
+			v.addf("redis.url", "%v", err)
+		case redisURL == "":
+			v.addf("redis.url", "is required when cache.backend is %q", CacheBackendRedis)
+		default:
+			// The URL may embed a password, so it is not included in the error.
+			if u, parseErr := url.Parse(redisURL); parseErr != nil ||
+				!slices.Contains([]string{"redis", "rediss", "unix"}, u.Scheme) {
+				v.addf("redis.url", "must be a redis://, rediss:// or unix:// URL")
+			}
+		}
+		if c.Redis.PoolSize < 0 {
+			v.addf("redis.pool_size", "must not be negative, got %d", c.Redis.PoolSize)
+		}
+	case CacheBackendMemory:
+		if c.Cache.Memory.MaxEntries < 0 {
+			v.addf("cache.memory.max_entries", "must not be negative, got %d", c.Cache.Memory.MaxEntries)
+		}
+		if c.Cache.Memory.CleanupInterval < 0 {
+			v.addf("cache.memory.cleanup_interval", "must not be negative, got %s", c.Cache.Memory.CleanupInterval)
+		}
+	default:
+		v.addf("cache.backend", "must be one of %q, %q, got %q", CacheBackendRedis, CacheBackendMemory, c.Cache.Backend)
+	}
+
+	v.durationIn("auth.cache_ttl", c.Auth.CacheTTL, time.Second, maxCacheTTL)
+
+	r := c.Auth.CacheRefresh
+	if r.SoftTTLRatio < 0 || r.SoftTTLRatio >= 1 {
+		v.addf("auth.cache_refresh.soft_ttl_ratio", "must be at least 0 and below 1, got %g", r.SoftTTLRatio)
+	}
+	if r.TTLJitter < 0 || r.TTLJitter > maxTTLJitter {
+		v.addf("auth.cache_refresh.ttl_jitter", "must be between 0 and %g, got %g", maxTTLJitter, r.TTLJitter)
+	}
+	if r.SoftTTLRatio > 0 {
+		v.durationIn("auth.cache_refresh.timeout", r.Timeout, minCacheRefreshTimeout, maxCacheRefreshTimeout)
+	}
+}
+
+func (c *Config) validateZitadel(v *validator) {
+	z := c.Auth.Zitadel
+
+	v.required("auth.zitadel.issuer", z.Issuer)
+	if z.Issuer != "" {
+		v.url("auth.zitadel.issuer", z.Issuer, "http", "https")
+	}
+	v.required("auth.zitadel.client_id", z.ClientID)
+	v.clientAuth("auth.zitadel", z.ClientAuthMethod, z.ClientSecret, z.ClientKeyFile)
+	c.validateZitadelTenants(v)
+
+	if c.Auth.AdminMachineUser.PAT == "" && c.Auth.AdminMachineUser.KeyFile == "" {
+		v.addf("auth.admin_machine_user", "one of pat or key_file is required")
+	}
+
+	c.validateZitadelHTTP(v)
+	c.validateZitadelResilience(v)
+}
+
+func (c *Config) validateZitadelTenants(v *validator) {
+	names := make(map[string]bool)
+	hosts := make(map[string]string)
+	for i, tenant := range c.Auth.Zitadel.Tenants {
+		field := fmt.Sprintf("auth.zitadel.tenants[%d]", i)
+		v.required(field+".name", tenant.Name)
+		if names[tenant.Name] {
+			v.addf(field+".name", "duplicate tenant %q", tenant.Name)
+		}
+		names[tenant.Name] = true
+
+		if len(tenant.Hosts) == 0 {
+			v.addf(field+".hosts", "at least one host is required")
+		}
+		for j, host := range tenant.Hosts {
+			host = strings.ToLower(host)
+			if other, ok := hosts[host]; ok {
+				v.addf(fmt.Sprintf("%s.hosts[%d]", field, j), "host %q is already used by tenant %q", host, other)
+			}
+			hosts[host] = tenant.Name
+		}
+
+		v.required(field+".client_id", tenant.ClientID)
+		v.clientAuth(field, tenant.ClientAuthMethod, tenant.ClientSecret, tenant.ClientKeyFile)
+	}
+}
+
+func (c *Config) validateZitadelHTTP(v *validator) {
+	h := c.Auth.Zitadel.HTTP
+
+	if h.Timeout != 0 {
+		v.durationIn("auth.zitadel.http.timeout", h.Timeout, time.Second, maxServerTimeout)
+	}
+	if (h.ClientCertFile == "") != (h.ClientKeyFile == "") {
+		v.addf("auth.zitadel.http.client_key_file", "client_cert_file and client_key_file must be set together")
+	}
+	if h.ProxyURL != "" {
+		v.url("auth.zitadel.http.proxy_url", h.ProxyURL, "http", "https", "socks5")
+	}
+	for _, n := range []struct {
+		field string
+		value int
+	}{
+		{"max_idle_conns", h.MaxIdleConns},
+		{"max_idle_conns_per_host", h.MaxIdleConnsPerHost},
+		{"max_conns_per_host", h.MaxConnsPerHost},
+	} {
+		if n.value < 0 {
+			v.addf("auth.zitadel.http."+n.field, "must not be negative, got %d", n.value)
+		}
+	}
+	if h.IdleConnTimeout < 0 {
+		v.addf("auth.zitadel.http.idle_conn_timeout", "must not be negative, got %s", h.IdleConnTimeout)
+	}
+	if h.KeepAlive < 0 {
+		v.addf("auth.zitadel.http.keep_alive", "must not be negative, got %s", h.KeepAlive)
+	}
+}
+
+func (c *Config) validateZitadelResilience(v *validator) {
+	r := c.Auth.Zitadel.Resilience
+
+	endpoints := zitadel.Endpoints()
+	for endpoint, timeout := range r.Timeouts {
+		field := "auth.zitadel.resilience.timeouts." + endpoint
+		if !slices.Contains(endpoints, endpoint) {
+			v.addf(field, "unknown endpoint, must be one of %q", endpoints)
+			continue
+		}
+		v.durationIn(field, timeout, minZitadelTimeout, maxZitadelTimeout)
+	}
+
+	if r.Retry.MaxAttempts < 0 || r.Retry.MaxAttempts > maxZitadelAttempts {
+		v.addf("auth.zitadel.resilience.retry.max_attempts", "must be between 0 and %d, got %d",
+			maxZitadelAttempts, r.Retry.MaxAttempts)
+	}
+	if r.Retry.BaseBackoff != 0 {
+		v.durationIn("auth.zitadel.resilience.retry.base_backoff", r.Retry.BaseBackoff,
+			time.Millisecond, maxZitadelBackoff)
+	}
+	if r.Retry.MaxBackoff != 0 {
+		v.durationIn("auth.zitadel.resilience.retry.max_backoff", r.Retry.MaxBackoff,
+			max(r.Retry.BaseBackoff, time.Millisecond), maxZitadelBackoff)
+	}
+	if r.CircuitBreaker.OpenDuration != 0 {
+		v.durationIn("auth.zitadel.resilience.circuit_breaker.open_duration", r.CircuitBreaker.OpenDuration,
+			time.Second, maxCircuitOpenTimeout)
+	}
+}
+
+func (c *Config) validateHeaderKeys(v *validator) {
+	keys := c.Auth.HeaderKeys
+	headers := []struct{ field, name string }{
+		{"user_id", keys.UserID},
+		{"user_email", keys.UserEmail},
+		{"user_groups", keys.UserGroups},
+		{"user_preferred_username", keys.UserPreferredUsername},
+		{"user_jwt", keys.UserJWT},
+	}
+
+	seen := make(map[string]string, len(headers))
+	for _, h := range headers {
+		field := "auth.header_keys." + h.field
+		if !httpguts.ValidHeaderFieldName(h.name) {
+			v.addf(field, "invalid header name %q", h.name)
+			continue
+		}
+		key := strings.ToLower(h.name)
+		if other, ok := seen[key]; ok {
+			v.addf(field, "header %q is already used by auth.header_keys.%s", h.name, other)
+			continue
+		}
+		seen[key] = h.field
+	}
+}
+
+func (c *Config) validateIdentity(v *validator) {
+	id := c.Auth.Identity
+
+	switch c.IdentityMode() {
+	case IdentityModeJWT:
+		if id.JWT.Issuer != "" {
+			v.url("auth.identity.jwt.issuer", id.JWT.Issuer, "http", "https")
+		}
+		if id.JWT.JWKSURL != "" {
+			v.url("auth.identity.jwt.jwks_url", id.JWT.JWKSURL, "http", "https")
+		}
+		for i, audience := range id.JWT.Audiences {
+			v.required(fmt.Sprintf("auth.identity.jwt.audiences[%d]", i), audience)
+		}
+	case IdentityModeSignedHeader:
+		if id.SignedHeader.Secret == "" {
+			v.addf("auth.identity.signed_header.secret", "is required to verify signatures")
+		}
+		v.durationIn("auth.identity.signed_header.max_age", id.SignedHeader.MaxAge,
+			minSignatureMaxAge, maxSignatureMaxAge)
+	case IdentityModeMTLS:
+		if c.Server.TLS.ClientCAFile == "" {
+			v.addf("server.tls.client_ca_file", "is required when auth.identity.mode is %q", IdentityModeMTLS)
+		}
+		for i, subject := range id.MTLS.AllowedSubjects {
+			v.required(fmt.Sprintf("auth.identity.mtls.allowed_subjects[%d]", i), subject)
+		}
+	case IdentityModeTrustedProxy:
+	default:
+		v.oneOf("auth.identity.mode", id.Mode,
+			IdentityModeJWT, IdentityModeSignedHeader, IdentityModeMTLS, IdentityModeTrustedProxy)
+	}
+}
+
+func (c *Config) validateRateLimits(v *validator) {
+	names := make(map[string]bool, len(c.Auth.RateLimits))
+	for i, rule := range c.Auth.RateLimits {
+		field := fmt.Sprintf("auth.rate_limits[%d]", i)
+		v.required(field+".name", rule.Name)
+		if rule.Name != "" && names[rule.Name] {
+			v.addf(field+".name", "duplicates rule %q", rule.Name)
+		}
+		names[rule.Name] = true
+
+		v.oneOf(field+".by", rule.By, "pat", "user", "group")
+		if rule.Limit <= 0 {
+			v.addf(field+".limit", "must be positive, got %d", rule.Limit)
+		}
+		v.durationIn(field+".window", rule.Window, minRateLimitWindow, maxRateLimitWindow)
+		for j, path := range rule.Paths {
+			if !strings.HasPrefix(path, "/") {
+				v.addf(fmt.Sprintf("%s.paths[%d]", field, j), "must start with /, got %q", path)
+			}
+		}
+	}
+}
+
+func (c *Config) validateBruteForce(v *validator) {
+	b := c.Auth.BruteForce
+	if !b.Enabled {
+		return
+	}
+
+	if b.MaxFailures <= 0 {
+		v.addf("auth.brute_force.max_failures", "must be positive, got %d", b.MaxFailures)
+	}
+	v.durationIn("auth.brute_force.window", b.Window, minBruteForceWindow, maxBruteForceWindow)
+	v.durationIn("auth.brute_force.block_duration", b.BlockDuration, minBruteForceWindow, maxBruteForceWindow)
+
+	if b.DelayAfter < 0 || b.DelayAfter >= max(b.MaxFailures, 1) {
+		v.addf("auth.brute_force.delay_after", "must be between 0 and max_failures - 1, got %d", b.DelayAfter)
+	}
+	if b.DelayAfter > 0 {
+		v.durationIn("auth.brute_force.base_delay", b.BaseDelay, minBruteForceDelay, maxBruteForceDelay)
+		v.durationIn("auth.brute_force.max_delay", b.MaxDelay, max(b.BaseDelay, minBruteForceDelay), maxBruteForceDelay)
+	}
+}
+
+func (c *Config) validateObservability(v *validator) {
+	o := c.Observability
+
+	v.oneOf("observability.log_level", strings.ToLower(o.LogLevel), "", "debug", "info", "warn", "warning", "error")
+	v.oneOf("observability.log_format", o.Format, "", "json", "text")
+	if o.TraceEnabled || o.OTLPMetricsEnabled || o.OTLPLogsEnabled {
+		v.required("observability.tracing_endpoint_url", o.TracingEndpointURL)
+	}
+	if o.TracingEndpointURL != "" {
+		v.url("observability.tracing_endpoint_url", o.TracingEndpointURL, "http", "https", "grpc")
+	}
+}
+
+func (c *Config) validateAudit(v *validator) {
+	a := c.Audit
+
+	if a.File.MaxSizeMB < 0 {
+		v.addf("audit.file.max_size_mb", "must not be negative")
+	}
+	if a.File.MaxBackups < 0 {
+		v.addf("audit.file.max_backups", "must not be negative")
+	}
+	if a.Webhook.URL != "" {
+		v.webhookURL("audit.webhook.url", a.Webhook.URL)
+	}
+	if a.Webhook.MaxAttempts < 0 {
+		v.addf("audit.webhook.max_attempts", "must not be negative")
+	}
+}
+
+func (c *Config) validatePATPolicy(v *validator) {
+	p := c.PATPolicy
+
+	if p.MaxLifetime < 0 {
+		v.addf("pat_policy.max_lifetime", "must not be negative, got %s", p.MaxLifetime)
+	}
+	if p.DefaultLifetime < 0 {
+		v.addf("pat_policy.default_lifetime", "must not be negative, got %s", p.DefaultLifetime)
+	}
+	if p.MaxLifetime > 0 && p.DefaultLifetime > p.MaxLifetime {
+		v.addf("pat_policy.default_lifetime", "must not exceed max_lifetime %s, got %s",
+			p.MaxLifetime, p.DefaultLifetime)
+	}
+	if p.MaxActivePerUser < 0 {
+		v.addf("pat_policy.max_active_per_user", "must not be negative, got %d", p.MaxActivePerUser)
+	}
+
+	for i, override := range p.GroupOverrides {
+		field := fmt.Sprintf("pat_policy.group_overrides[%d]", i)
+		v.required(field+".group", override.Group)
+		if override.MaxLifetime < 0 {
+			v.addf(field+".max_lifetime", "must not be negative, got %s", override.MaxLifetime)
+		}
+		if override.MaxActivePerUser < 0 {
+			v.addf(field+".max_active_per_user", "must not be negative, got %d", override.MaxActivePerUser)
+		}
+	}
+}
+
+func (c *Config) validatePATRotation(v *validator) {
+	r := c.PATRotation
+
+	if r.GracePeriod < 0 {
+		v.addf("pat_rotation.grace_period", "must not be negative, got %s", r.GracePeriod)
+	}
+	if r.MaxGracePeriod < 0 {
+		v.addf("pat_rotation.max_grace_period", "must not be negative, got %s", r.MaxGracePeriod)
+	}
+	if r.MaxGracePeriod > 0 && r.GracePeriod > r.MaxGracePeriod {
+		v.addf("pat_rotation.grace_period", "must not exceed max_grace_period %s, got %s",
+			r.MaxGracePeriod, r.GracePeriod)
+	}
+	if r.DeletionInterval != 0 {
+		v.durationIn("pat_rotation.deletion_interval", r.DeletionInterval, minDeletionInterval, maxDeletionInterval)
+	}
+}
+
+func (c *Config) validateAdmin(v *validator) {
+	for i, group := range c.Admin.Groups {
+		v.required(fmt.Sprintf("admin.groups[%d]", i), group)
+	}
+	for i, role := range c.Admin.Roles {
+		v.required(fmt.Sprintf("admin.roles[%d]", i), role)
+	}
+}
+
+// notificationEvents lists the notification types webhooks can subscribe to.
+func notificationEvents() []string {
+	types := pat.NotificationTypes()
+	events := make([]string, 0, len(types))
+	for _, t := range types {
+		events = append(events, string(t))
+	}
+	return events
+}
+
+func (c *Config) validateNotifications(v *validator) {
+	n := c.Notifications
+
+	if n.LongLivedThreshold < 0 {
+		v.addf("notifications.long_lived_threshold", "must not be negative, got %s", n.LongLivedThreshold)
+	}
+
+	for i, webhook := range n.Webhooks {
+		field := fmt.Sprintf("notifications.webhooks[%d]", i)
+		if webhook.URL == "" {
+			v.addf(field+".url", "is required")
+		} else {
+			v.webhookURL(field+".url", webhook.URL)
+		}
+		if webhook.Secret == "" {
+			v.addf(field+".secret", "is required to sign payloads")
+		}
+		for j, event := range webhook.Events {
+			v.oneOf(fmt.Sprintf("%s.events[%d]", field, j), event, notificationEvents()...)
+		}
+		if webhook.MaxAttempts < 0 {
+			v.addf(field+".max_attempts", "must not be negative")
+		}
+	}
+}
+
+func (c *Config) validateReminders(v *validator) {
+	r := c.Reminders
+	if !r.Enabled {
+		return
+	}
+
+	v.durationIn("reminders.interval", r.Interval, minReminderInterval, maxReminderInterval)
+	if len(r.Windows) == 0 {
+		v.addf("reminders.windows", "is required")
+	}
+	for i, w := range r.Windows {
+		if w <= 0 {
+			v.addf(fmt.Sprintf("reminders.windows[%d]", i), "must be positive, got %s", w)
+		}
+	}
+
+	if r.SMTP.Addr == "" && !r.Webhook {
+		v.addf("reminders", "requires smtp.addr or webhook")
+	}
+	// Sent reminders are tracked in Redis; in process they would repeat after
+	// every restart and on every replica.
+	if c.CacheBackend() != CacheBackendRedis {
+		v.addf("redis.url", "is required with cache.backend %q when reminders are enabled", CacheBackendRedis)
+	}
+	if r.SMTP.Addr != "" {
+		v.required("reminders.smtp.from", r.SMTP.From)
+		v.durationIn("reminders.smtp.timeout", r.SMTP.Timeout, time.Second, maxSMTPTimeout)
+	}
+	if r.Webhook && len(c.Notifications.Webhooks) == 0 {
+		v.addf("reminders.webhook", "requires notifications.webhooks")
+	}
+}
+
+type validator struct {
+	errs []error
+}
+
+func (v *validator) addf(field, format string, args ...any) {
+	v.errs = append(v.errs, fmt.Errorf("%s: %s", field, fmt.Sprintf(format, args...)))
+}
+
+func (v *validator) required(field, value string) {
+	if value == "" {
+		v.addf(field, "is required")
+	}
+}
+
+// clientAuth checks the client authentication of the Zitadel application
+// configured at prefix.
+func (v *validator) clientAuth(prefix, method string, secret Secret, keyFile string) {
+	switch method {
+	case "", zitadel.ClientAuthMethodSecretBasic:
+		v.required(prefix+".client_secret", string(secret))
+	case zitadel.ClientAuthMethodPrivateKeyJWT:
+		if keyFile == "" {
+			v.addf(prefix+".client_key_file", "is required when client_auth_method is %q",
+				zitadel.ClientAuthMethodPrivateKeyJWT)
+		}
+	default:
+		v.addf(prefix+".client_auth_method", "must be one of %q, %q, got %q",
+			zitadel.ClientAuthMethodSecretBasic, zitadel.ClientAuthMethodPrivateKeyJWT, method)
+	}
+}
+
+func (v *validator) oneOf(field, value string, allowed ...string) {
+	if slices.Contains(allowed, value) {
+		return
+	}
+	named := slices.DeleteFunc(slices.Clone(allowed), func(s string) bool { return s == "" })
+	v.addf(field, "must be one of %q, got %q", named, value)
+}
+
+func (v *validator) durationIn(field string, d, low, high time.Duration) {
+	if d < low || d > high {
+		v.addf(field, "must be between %s and %s, got %s", low, high, d)
+	}
+}
+
+func (v *validator) url(field, raw string, schemes ...string) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		v.addf(field, "invalid URL %q: %v", raw, err)
+		return
+	}
+	if !slices.Contains(schemes, u.Scheme) || u.Host == "" {
+		v.addf(field, "must be an absolute %s URL, got %q", strings.Join(schemes, " or "), raw)
+	}
+}
+
+// webhookURL checks an http(s) URL held in a Secret. Webhook URLs often embed
+// a token, so the URL is not included in the error.
+func (v *validator) webhookURL(field string, secret Secret) {
+	raw, err := secret.Resolve()
+	if err != nil {
+		v.addf(field, "%v", err)
+		return
+	}
+	if u, parseErr := url.Parse(raw); parseErr != nil ||
+		!slices.Contains([]string{"http", "https"}, u.Scheme) || u.Host == "" {
+		v.addf(field, "must be an absolute http or https URL")
+	}
+}
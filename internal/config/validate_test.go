@@ -0,0 +1,209 @@
+package config_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/astro-web3/oauth2-token-exchange/internal/config"
+	"github.com/astro-web3/oauth2-token-exchange/internal/infra/zitadel"
+)
+
+func validConfig() *config.Config {
+	cfg := &config.Config{}
+	cfg.Server.Addr = ":8123"
+	cfg.Server.ReadTimeout = 30 * time.Second
+	cfg.Server.WriteTimeout = 30 * time.Second
+	cfg.Redis.URL = "redis://localhost:6379/0"
+	cfg.Auth.AdminMachineUser.PAT = "admin-pat"
+	cfg.Auth.Zitadel.Issuer = "https://zitadel.example.com"
+	cfg.Auth.Zitadel.ClientID = "client-1"
+	cfg.Auth.Zitadel.ClientSecret = "secret"
+	cfg.Auth.CacheTTL = 5 * time.Minute
+	cfg.Auth.HeaderKeys.UserID = "X-Auth-Request-User"
+	cfg.Auth.HeaderKeys.UserEmail = "X-Auth-Request-Email"
+	cfg.Auth.HeaderKeys.UserGroups = "X-Auth-Request-Groups"
+	cfg.Auth.HeaderKeys.UserPreferredUsername = "X-Auth-Request-Preferred-Username"
+	cfg.Auth.HeaderKeys.UserJWT = "X-Auth-Request-Access-Token"
+	cfg.Observability.LogLevel = "info"
+	return cfg
+}
+
+func TestConfig_Validate(t *testing.T) {
+	if err := validConfig().Validate(); err != nil {
+		t.Fatalf("expected valid config, got: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		mutate func(cfg *config.Config)
+		field  string
+	}{
+		{"missing issuer", func(cfg *config.Config) { cfg.Auth.Zitadel.Issuer = "" }, "auth.zitadel.issuer"},
+		{"relative issuer", func(cfg *config.Config) { cfg.Auth.Zitadel.Issuer = "zitadel.example.com" }, "auth.zitadel.issuer"},
+		{"missing redis url", func(cfg *config.Config) {
+			cfg.Cache.Backend = config.CacheBackendRedis
+			cfg.Redis.URL = ""
+		}, "redis.url"},
+		{"zero timeout", func(cfg *config.Config) { cfg.Server.ReadTimeout = 0 }, "server.read_timeout"},
+		{"negative drain delay", func(cfg *config.Config) { cfg.Server.DrainDelay = -time.Second }, "server.drain_delay"},
+		{"invalid header", func(cfg *config.Config) { cfg.Auth.HeaderKeys.UserID = "X User" }, "auth.header_keys.user_id"},
+		{"duplicate header", func(cfg *config.Config) {
+			cfg.Auth.HeaderKeys.UserJWT = "x-auth-request-user"
+		}, "auth.header_keys.user_jwt"},
+		{"missing admin credentials", func(cfg *config.Config) { cfg.Auth.AdminMachineUser.PAT = "" }, "auth.admin_machine_user"},
+		{"private_key_jwt without key", func(cfg *config.Config) {
+			cfg.Auth.Zitadel.ClientAuthMethod = "private_key_jwt"
+		}, "auth.zitadel.client_key_file"},
+		{"tenant without client id", func(cfg *config.Config) {
+			cfg.Auth.Zitadel.Tenants = []config.ZitadelTenant{{Name: "acme", Hosts: []string{"api.acme.example"}}}
+		}, "auth.zitadel.tenants[0].client_id"},
+		{"tenant private_key_jwt without key", func(cfg *config.Config) {
+			cfg.Auth.Zitadel.Tenants = []config.ZitadelTenant{{
+				Name: "acme", Hosts: []string{"api.acme.example"}, ClientID: "client-2", ClientAuthMethod: "private_key_jwt",
+			}}
+		}, "auth.zitadel.tenants[0].client_key_file"},
+		{"host of two tenants", func(cfg *config.Config) {
+			cfg.Auth.Zitadel.Tenants = []config.ZitadelTenant{
+				{Name: "acme", Hosts: []string{"api.acme.example"}, ClientID: "client-2", ClientSecret: "secret"},
+				{Name: "other", Hosts: []string{"API.acme.example"}, ClientID: "client-3", ClientSecret: "secret"},
+			}
+		}, "auth.zitadel.tenants[1].hosts[0]"},
+		{"unknown log level", func(cfg *config.Config) { cfg.Observability.LogLevel = "verbose" }, "observability.log_level"},
+		{"otlp logs without endpoint", func(cfg *config.Config) {
+			cfg.Observability.OTLPLogsEnabled = true
+		}, "observability.tracing_endpoint_url"},
+		{"relative audit webhook", func(cfg *config.Config) {
+			cfg.Audit.Webhook.URL = "audit.example.com/events"
+		}, "audit.webhook.url"},
+		{"unsigned notification webhook", func(cfg *config.Config) {
+			cfg.Notifications.Webhooks = []config.Webhook{{URL: "https://hooks.example.com/pat"}}
+		}, "notifications.webhooks[0].secret"},
+		{"unknown notification event", func(cfg *config.Config) {
+			cfg.Notifications.Webhooks = []config.Webhook{{
+				URL:    "https://hooks.example.com/pat",
+				Secret: "s3cret",
+				Events: []string{"pat.renamed"},
+			}}
+		}, "notifications.webhooks[0].events[0]"},
+		{"default lifetime above maximum", func(cfg *config.Config) {
+			cfg.PATPolicy.MaxLifetime = 30 * 24 * time.Hour
+			cfg.PATPolicy.DefaultLifetime = 90 * 24 * time.Hour
+		}, "pat_policy.default_lifetime"},
+		{"reminders without sender", func(cfg *config.Config) {
+			cfg.Reminders.Enabled = true
+			cfg.Reminders.Interval = time.Hour
+			cfg.Reminders.Windows = []time.Duration{72 * time.Hour}
+		}, "reminders"},
+		{"reminders without redis", func(cfg *config.Config) {
+			cfg.Redis.URL = ""
+			cfg.Reminders.Enabled = true
+			cfg.Reminders.Interval = time.Hour
+			cfg.Reminders.Windows = []time.Duration{72 * time.Hour}
+			cfg.Reminders.Webhook = true
+			cfg.Notifications.Webhooks = []config.Webhook{{URL: "https://hooks.example.com/pat", Secret: "s3cret"}}
+		}, "redis.url"},
+		{"grace period above maximum", func(cfg *config.Config) {
+			cfg.PATRotation.GracePeriod = 14 * 24 * time.Hour
+			cfg.PATRotation.MaxGracePeriod = 7 * 24 * time.Hour
+		}, "pat_rotation.grace_period"},
+		{"unknown identity mode", func(cfg *config.Config) {
+			cfg.Auth.Identity.Mode = "headers"
+		}, "auth.identity.mode"},
+		{"signed header without secret", func(cfg *config.Config) {
+			cfg.Auth.Identity.Mode = config.IdentityModeSignedHeader
+			cfg.Auth.Identity.SignedHeader.MaxAge = time.Minute
+		}, "auth.identity.signed_header.secret"},
+		{"mtls without client CA", func(cfg *config.Config) {
+			cfg.Auth.Identity.Mode = config.IdentityModeMTLS
+		}, "server.tls.client_ca_file"},
+		{"duplicate rate limit", func(cfg *config.Config) {
+			rule := config.RateLimitRule{Name: "per-pat", By: "pat", Limit: 10, Window: time.Minute}
+			cfg.Auth.RateLimits = []config.RateLimitRule{rule, rule}
+		}, "auth.rate_limits[1].name"},
+		{"rate limit without window", func(cfg *config.Config) {
+			cfg.Auth.RateLimits = []config.RateLimitRule{{Name: "per-user", By: "user", Limit: 10}}
+		}, "auth.rate_limits[0].window"},
+		{"cache soft TTL ratio of one", func(cfg *config.Config) {
+			cfg.Auth.CacheRefresh.SoftTTLRatio, cfg.Auth.CacheRefresh.Timeout = 1, time.Second
+		}, "auth.cache_refresh.soft_ttl_ratio"},
+		{"cache TTL jitter above half", func(cfg *config.Config) {
+			cfg.Auth.CacheRefresh.TTLJitter = 0.75
+		}, "auth.cache_refresh.ttl_jitter"},
+		{"client IP hops without header", func(cfg *config.Config) {
+			cfg.Server.ClientIP.TrustedHops = 1
+		}, "server.client_ip.header"},
+		{"brute force delays after blocking", func(cfg *config.Config) {
+			b := &cfg.Auth.BruteForce
+			b.Enabled, b.MaxFailures, b.Window, b.BlockDuration = true, 5, time.Minute, time.Minute
+			b.DelayAfter, b.BaseDelay, b.MaxDelay = 5, 100*time.Millisecond, time.Second
+		}, "auth.brute_force.delay_after"},
+		{"zitadel client cert without key", func(cfg *config.Config) {
+			cfg.Auth.Zitadel.HTTP.ClientCertFile = "/etc/zitadel/client.crt"
+		}, "auth.zitadel.http.client_key_file"},
+		{"unsupported zitadel proxy scheme", func(cfg *config.Config) {
+			cfg.Auth.Zitadel.HTTP.ProxyURL = "ftp://proxy:21"
+		}, "auth.zitadel.http.proxy_url"},
+		{"unknown zitadel endpoint timeout", func(cfg *config.Config) {
+			cfg.Auth.Zitadel.Resilience.Timeouts = map[string]time.Duration{"introspect": time.Second}
+		}, "auth.zitadel.resilience.timeouts.introspect"},
+		{"zitadel max backoff below base", func(cfg *config.Config) {
+			retry := &cfg.Auth.Zitadel.Resilience.Retry
+			retry.BaseBackoff, retry.MaxBackoff = time.Second, 100*time.Millisecond
+		}, "auth.zitadel.resilience.retry.max_backoff"},
+		{"unsupported otlp scheme", func(cfg *config.Config) {
+			cfg.Observability.TracingEndpointURL = "tcp://collector:4317"
+		}, "observability.tracing_endpoint_url"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := validConfig()
+			tt.mutate(cfg)
+
+			err := cfg.Validate()
+			if err == nil {
+				t.Fatal("expected validation error")
+			}
+			if !strings.HasPrefix(err.Error(), tt.field+":") {
+				t.Errorf("expected error for %s, got: %v", tt.field, err)
+			}
+		})
+	}
+}
+
+func TestConfig_Validate_GRPCEndpoint(t *testing.T) {
+	cfg := validConfig()
+	cfg.Observability.TraceEnabled = true
+	cfg.Observability.OTLPMetricsEnabled = true
+	cfg.Observability.TracingEndpointURL = "grpc://otel-collector:4317"
+
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("expected grpc:// endpoint to be valid, got: %v", err)
+	}
+}
+
+func TestConfig_Validate_ZitadelEndpointTimeouts(t *testing.T) {
+	cfg := validConfig()
+	cfg.Auth.Zitadel.Resilience.Timeouts = make(map[string]time.Duration)
+	for _, endpoint := range zitadel.Endpoints() {
+		cfg.Auth.Zitadel.Resilience.Timeouts[endpoint] = time.Second
+	}
+
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("expected every zitadel endpoint to accept a timeout, got: %v", err)
+	}
+}
+
+func TestConfig_Validate_ReportsAllProblems(t *testing.T) {
+	err := (&config.Config{}).Validate()
+	if err == nil {
+		t.Fatal("expected validation error")
+	}
+
+	for _, field := range []string{"server.addr", "auth.zitadel.issuer", "auth.zitadel.client_id", "auth.cache_ttl"} {
+		if !strings.Contains(err.Error(), field+":") {
+			t.Errorf("expected error for %s, got: %v", field, err)
+		}
+	}
+}
@@ -0,0 +1,38 @@
+// Package audit defines the audit trail of PAT lifecycle operations and
+// authorization decisions. Events identify who did what to which PAT; they
+// never carry token values or token hashes.
+package audit
+
+import "time"
+
+type EventType string
+
+const (
+	EventPATCreated   EventType = "pat.created"
+	EventPATDeleted   EventType = "pat.deleted"
+	EventPATRotated   EventType = "pat.rotated"
+	EventPATsListed   EventType = "pat.listed"
+	EventAuthzDenied  EventType = "authz.denied"
+	EventAuthzBlocked EventType = "authz.blocked"
+	EventAdminAction  EventType = "admin.action"
+)
+
+const (
+	OutcomeSuccess = "success"
+	OutcomeFailure = "failure"
+)
+
+// Event is a single audit record. Actor is the user performing the operation
+// and Subject the resource it applies to, e.g. a PAT ID.
+type Event struct {
+	ID       string            `json:"id"`
+	Type     EventType         `json:"type"`
+	Time     time.Time         `json:"time"`
+	Actor    string            `json:"actor,omitempty"`
+	Subject  string            `json:"subject,omitempty"`
+	Outcome  string            `json:"outcome"`
+	Reason   string            `json:"reason,omitempty"`
+	SourceIP string            `json:"source_ip,omitempty"`
+	TraceID  string            `json:"trace_id,omitempty"`
+	Details  map[string]string `json:"details,omitempty"`
+}
@@ -0,0 +1,90 @@
+package audit
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"time"
+
+	"github.com/astro-web3/oauth2-token-exchange/pkg/logger"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const eventIDBytes = 16
+
+// Sink persists or forwards audit events.
+type Sink interface {
+	Write(ctx context.Context, event Event) error
+	Close() error
+}
+
+// Recorder is used by domain services to emit audit events. Recording never
+// fails the operation being audited; sink errors are logged instead.
+type Recorder interface {
+	Record(ctx context.Context, event Event)
+}
+
+type recorder struct {
+	sinks []Sink
+}
+
+// NewRecorder returns a Recorder that completes each event with its ID, time,
+// source IP and trace ID, then writes it to every sink in order.
+func NewRecorder(sinks ...Sink) Recorder {
+	return &recorder{sinks: sinks}
+}
+
+// Nop returns a Recorder that discards all events.
+func Nop() Recorder {
+	return NewRecorder()
+}
+
+func (r *recorder) Record(ctx context.Context, event Event) {
+	if len(r.sinks) == 0 {
+		return
+	}
+
+	event.ID = newEventID()
+	if event.Time.IsZero() {
+		event.Time = time.Now().UTC()
+	}
+	if event.Outcome == "" {
+		event.Outcome = OutcomeSuccess
+	}
+	if event.SourceIP == "" {
+		event.SourceIP = SourceIP(ctx)
+	}
+	if spanCtx := trace.SpanContextFromContext(ctx); spanCtx.HasTraceID() {
+		event.TraceID = spanCtx.TraceID().String()
+	}
+
+	for _, sink := range r.sinks {
+		if err := sink.Write(ctx, event); err != nil {
+			logger.ErrorContext(ctx, "failed to write audit event",
+				slog.String("type", string(event.Type)),
+				slog.String("id", event.ID),
+				slog.String("error", err.Error()),
+			)
+		}
+	}
+}
+
+func newEventID() string {
+	b := make([]byte, eventIDBytes)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+type sourceIPKey struct{}
+
+// WithSourceIP stores the client IP of the current request for audit events.
+func WithSourceIP(ctx context.Context, ip string) context.Context {
+	return context.WithValue(ctx, sourceIPKey{}, ip)
+}
+
+// SourceIP returns the client IP stored by WithSourceIP, or "".
+func SourceIP(ctx context.Context) string {
+	ip, _ := ctx.Value(sourceIPKey{}).(string)
+	return ip
+}
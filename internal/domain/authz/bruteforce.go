@@ -0,0 +1,121 @@
+package authz
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"log/slog"
+
+	"github.com/astro-web3/oauth2-token-exchange/internal/domain/audit"
+	"github.com/astro-web3/oauth2-token-exchange/internal/infra/cache"
+	"github.com/astro-web3/oauth2-token-exchange/pkg/logger"
+)
+
+// BruteForcePolicy slows down and then blocks source IPs that keep
+// presenting invalid PATs.
+type BruteForcePolicy struct {
+	// MaxFailures invalid PATs within Window block the source for
+	// BlockDuration.
+	MaxFailures   int
+	Window        time.Duration
+	BlockDuration time.Duration
+	// DelayAfter failures, each further request from the source waits
+	// BaseDelay, doubled per failure up to MaxDelay. Zero disables delays.
+	DelayAfter int
+	BaseDelay  time.Duration
+	MaxDelay   time.Duration
+}
+
+// WithBruteForceGuard counts invalid PATs per source IP in tracker and
+// enforces policy before any other check, so blocked sources cost no Zitadel
+// calls. The source IP is read with audit.SourceIP; requests without one are
+// not guarded.
+func WithBruteForceGuard(tracker cache.AttemptTracker, policy BruteForcePolicy) ServiceOption {
+	return func(s *service) {
+		s.attempts = tracker
+		s.bruteForce = policy
+	}
+}
+
+// delay returns how long a request from a source with failures invalid PATs
+// waits before it is processed.
+func (p *BruteForcePolicy) delay(failures int) time.Duration {
+	if p.DelayAfter <= 0 || failures < p.DelayAfter {
+		return 0
+	}
+	d := p.BaseDelay
+	for range failures - p.DelayAfter {
+		if d >= p.MaxDelay {
+			break
+		}
+		d *= 2
+	}
+	return min(d, p.MaxDelay)
+}
+
+// guard denies requests from blocked sources and delays requests from
+// sources with recent failures. Tracker failures let the request through.
+func (s *service) guard(ctx context.Context, sourceIP string) *AuthzDecision {
+	if s.attempts == nil || sourceIP == "" {
+		return nil
+	}
+
+	failures, blockedFor, err := s.attempts.Attempts(ctx, sourceIP)
+	if err != nil {
+		logger.WarnContext(ctx, "failed to get failed attempts", slog.String("error", err.Error()))
+		return nil
+	}
+	if blockedFor > 0 {
+		return &AuthzDecision{
+			Allow:      false,
+			Reason:     "too many invalid PATs from this address",
+			ReasonCode: ReasonSourceBlocked,
+			RetryAfter: blockedFor,
+		}
+	}
+
+	if d := s.bruteForce.delay(failures); d > 0 {
+		timer := time.NewTimer(d)
+		defer timer.Stop()
+		select {
+		case <-ctx.Done():
+		case <-timer.C:
+		}
+	}
+	return nil
+}
+
+// recordFailure counts a decision rejecting the presented PAT against its
+// source and audits the source being blocked.
+func (s *service) recordFailure(ctx context.Context, sourceIP string, decision *AuthzDecision) {
+	if s.attempts == nil || sourceIP == "" {
+		return
+	}
+	if decision.ReasonCode != ReasonInvalidPAT && decision.ReasonCode != ReasonCachedInvalid {
+		return
+	}
+
+	blocked, err := s.attempts.RecordFailure(ctx, sourceIP, cache.FailureLimit{
+		MaxFailures: s.bruteForce.MaxFailures,
+		Window:      s.bruteForce.Window,
+		BlockFor:    s.bruteForce.BlockDuration,
+	})
+	if err != nil {
+		logger.WarnContext(ctx, "failed to record failed attempt", slog.String("error", err.Error()))
+		return
+	}
+	if blocked {
+		logger.WarnContext(ctx, "blocked source after repeated invalid PATs",
+			slog.String("source_ip", sourceIP), slog.Duration("duration", s.bruteForce.BlockDuration))
+		s.auditor.Record(ctx, audit.Event{
+			Type:    audit.EventAuthzBlocked,
+			Outcome: audit.OutcomeSuccess,
+			Reason:  ReasonSourceBlocked,
+			Details: map[string]string{
+				"failures":         strconv.Itoa(s.bruteForce.MaxFailures),
+				"duration_seconds": strconv.Itoa(int(s.bruteForce.BlockDuration.Seconds())),
+			},
+		})
+	}
+}
@@ -0,0 +1,171 @@
+package authz
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"time"
+
+	"log/slog"
+
+	"github.com/astro-web3/oauth2-token-exchange/internal/infra/cache"
+	"github.com/astro-web3/oauth2-token-exchange/pkg/logger"
+)
+
+// Rate limit subjects name what a RateLimitRule counts requests by.
+const (
+	RateLimitByPAT   = "pat"
+	RateLimitByUser  = "user"
+	RateLimitByGroup = "group"
+)
+
+// Route is the request a decision is made for, as forwarded by the proxy.
+type Route struct {
+	// Host selects the tenant; it is not used by rate limits.
+	Host   string
+	Method string
+	Path   string
+}
+
+// RateLimitRule allows Limit requests per Window to the routes it matches,
+// counted per PAT, per user or per group.
+type RateLimitRule struct {
+	// Name identifies the rule's counters, so renaming a rule resets them.
+	Name string
+	// Methods and PathPrefixes select the routes; empty matches any.
+	Methods      []string
+	PathPrefixes []string
+	// By is one of the RateLimitBy constants.
+	By string
+	// Groups, when set, applies the rule only to members of these groups.
+	// Rules counted by group count only these groups.
+	Groups []string
+	Limit  int
+	Window time.Duration
+}
+
+// RateLimitStatus is the caller's quota under the most restrictive rule
+// that matched the request.
+type RateLimitStatus struct {
+	Limit     int
+	Remaining int
+	// Reset is how long until the full quota is available again.
+	Reset time.Duration
+}
+
+// WithRateLimits enforces rules on allowed requests, counting them in
+// limiter. Requests over a limit are denied with ReasonRateLimited and do not
+// count against any of the rules.
+func WithRateLimits(limiter cache.RateLimiter, rules []RateLimitRule) ServiceOption {
+	return func(s *service) {
+		s.rateLimiter = limiter
+		s.rateLimits = rules
+	}
+}
+
+func (r *RateLimitRule) matches(route Route) bool {
+	if len(r.Methods) > 0 && !slices.ContainsFunc(r.Methods, func(m string) bool {
+		return strings.EqualFold(m, route.Method)
+	}) {
+		return false
+	}
+	if len(r.PathPrefixes) > 0 && !slices.ContainsFunc(r.PathPrefixes, func(p string) bool {
+		return strings.HasPrefix(route.Path, p)
+	}) {
+		return false
+	}
+	return true
+}
+
+// keys returns the counters a request by the caller consumes under the rule.
+func (r *RateLimitRule) keys(patHash, userID string, groups []string) []string {
+	if len(r.Groups) > 0 && !slices.ContainsFunc(groups, func(g string) bool {
+		return slices.Contains(r.Groups, g)
+	}) {
+		return nil
+	}
+
+	prefix := r.Name + ":" + r.By + ":"
+	switch r.By {
+	case RateLimitByPAT:
+		return []string{prefix + patHash}
+	case RateLimitByUser:
+		if userID == "" {
+			return nil
+		}
+		return []string{prefix + userID}
+	case RateLimitByGroup:
+		var keys []string
+		for _, group := range groups {
+			if len(r.Groups) == 0 || slices.Contains(r.Groups, group) {
+				keys = append(keys, prefix+group)
+			}
+		}
+		return keys
+	default:
+		return nil
+	}
+}
+
+// limit applies the rate limits to an allowed decision. Every matching rule
+// is checked at once and a request only counts against the quotas when all
+// of them allow it, so a request denied by a later rule does not use up the
+// earlier ones. The first exhausted quota in rule order names the denial.
+// Limiter failures are logged and let the request through, so the rate
+// limiter's backend going down does not take down authorization.
+func (s *service) limit(
+	ctx context.Context,
+	route Route,
+	patHash, userID string,
+	groups []string,
+	decision *AuthzDecision,
+) *AuthzDecision {
+	if s.rateLimiter == nil {
+		return decision
+	}
+
+	var (
+		checks []cache.RateLimitCheck
+		rules  []*RateLimitRule
+	)
+	for i := range s.rateLimits {
+		rule := &s.rateLimits[i]
+		if !rule.matches(route) {
+			continue
+		}
+		for _, key := range rule.keys(patHash, userID, groups) {
+			checks = append(checks, cache.RateLimitCheck{
+				Key:   key,
+				Limit: cache.RateLimit{Limit: rule.Limit, Window: rule.Window},
+			})
+			rules = append(rules, rule)
+		}
+	}
+	if len(checks) == 0 {
+		return decision
+	}
+
+	results, err := s.rateLimiter.Allow(ctx, checks)
+	if err != nil {
+		logger.WarnContext(ctx, "failed to check rate limits, allowing request", slog.String("error", err.Error()))
+		return decision
+	}
+
+	for i, result := range results {
+		rule := rules[i]
+		status := &RateLimitStatus{Limit: rule.Limit, Remaining: result.Remaining, Reset: result.ResetAfter}
+		if !result.Allowed {
+			return &AuthzDecision{
+				Allow:      false,
+				Reason:     "rate limit " + rule.Name + " exceeded",
+				ReasonCode: ReasonRateLimited,
+				RateLimit:  status,
+				RetryAfter: result.RetryAfter,
+			}
+		}
+		if decision.RateLimit == nil || status.Remaining < decision.RateLimit.Remaining {
+			decision.RateLimit = status
+		}
+	}
+	return decision
+}
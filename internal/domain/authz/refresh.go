@@ -0,0 +1,121 @@
+package authz
+
+import (
+	"context"
+	"math/rand/v2"
+	"time"
+
+	"log/slog"
+
+	"github.com/astro-web3/oauth2-token-exchange/internal/infra/cache"
+	"github.com/astro-web3/oauth2-token-exchange/pkg/logger"
+	"github.com/astro-web3/oauth2-token-exchange/pkg/metrics"
+)
+
+const defaultRefreshTimeout = 10 * time.Second
+
+// RefreshPolicy keeps hot PATs from paying the userinfo and exchange latency
+// when their cache entry expires, and spreads out cache expiry.
+type RefreshPolicy struct {
+	// SoftTTLRatio is the share of the cache TTL after which a valid entry
+	// is stale. Stale entries are still served while one background refresh
+	// per PAT replaces them. Zero disables refreshing.
+	SoftTTLRatio float64
+	// Jitter varies each cache TTL randomly by up to this share, so entries
+	// cached together do not expire together.
+	Jitter float64
+	// Timeout bounds a background refresh; zero uses 10s.
+	Timeout time.Duration
+}
+
+// WithRefresh serves stale cached identities while refreshing them in the
+// background and jitters cache TTLs, according to policy.
+func WithRefresh(policy RefreshPolicy) ServiceOption {
+	return func(s *service) {
+		s.refresh = policy
+	}
+}
+
+// ttl jitters cacheTTL for an entry written at now and returns it with the
+// entry's soft expiry, which is zero when refreshing is disabled.
+func (p *RefreshPolicy) ttl(cacheTTL time.Duration, now time.Time) (time.Duration, time.Time) {
+	if p.Jitter > 0 {
+		//nolint:gosec // Jitter does not need a cryptographic source.
+		cacheTTL += time.Duration((rand.Float64()*2 - 1) * p.Jitter * float64(cacheTTL))
+	}
+
+	var softExpiresAt time.Time
+	if p.SoftTTLRatio > 0 {
+		softExpiresAt = now.Add(time.Duration(p.SoftTTLRatio * float64(cacheTTL)))
+	}
+	return cacheTTL, softExpiresAt
+}
+
+// store caches token under key with a jittered TTL. Valid tokens get a soft
+// expiry; invalid ones simply expire.
+func (s *service) store(ctx context.Context, key string, token *cache.CachedToken, cacheTTL time.Duration) error {
+	ttl, softExpiresAt := s.refresh.ttl(cacheTTL, time.Now())
+	if !token.IsInvalid {
+		token.SoftExpiresAt = softExpiresAt
+	}
+	return s.tokenCache.Set(ctx, key, token, ttl)
+}
+
+// stale reports whether cached should be refreshed in the background.
+func (s *service) stale(cached *cache.CachedToken) bool {
+	return s.refresh.SoftTTLRatio > 0 && !cached.IsInvalid && cached.Stale(time.Now())
+}
+
+// refreshInBackground resolves pat again and replaces its cache entry without
+// delaying the request that found it stale. Concurrent calls for the same PAT
+// share one refresh. A failed refresh leaves the stale entry in place unless
+// the PAT turned out to be invalid, which is cached as usual. Close waits for
+// refreshes in flight.
+func (s *service) refreshInBackground(ctx context.Context, pat string, ex exchange, cacheTTL time.Duration) {
+	ctx = context.WithoutCancel(ctx)
+	timeout := s.refresh.Timeout
+	if timeout <= 0 {
+		timeout = defaultRefreshTimeout
+	}
+
+	s.refreshes.DoChan(ex.cacheKey, func() (any, error) {
+		if !s.startRefresh() {
+			return nil, nil //nolint:nilnil // The result of a refresh is not used.
+		}
+		defer s.running.Done()
+
+		refreshCtx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+
+		reason := ReasonExchanged
+		if _, denied := s.resolve(refreshCtx, pat, ex, cacheTTL); denied != nil {
+			reason = denied.ReasonCode
+			logger.WarnContext(refreshCtx, "failed to refresh cached token",
+				slog.String("reason", denied.ReasonCode), slog.String("error", denied.Reason))
+		}
+		metrics.RecordCacheRefresh(reason)
+		return reason, nil
+	})
+}
+
+// startRefresh registers a background refresh with running, unless the
+// service is closed.
+func (s *service) startRefresh() bool {
+	s.refreshMu.Lock()
+	defer s.refreshMu.Unlock()
+
+	if s.closed {
+		return false
+	}
+	s.running.Add(1)
+	return true
+}
+
+func (s *service) Close() error {
+	s.refreshMu.Lock()
+	s.closed = true
+	s.refreshMu.Unlock()
+
+	s.running.Wait()
+	return nil
+}
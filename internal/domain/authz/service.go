@@ -9,13 +9,16 @@ import (
 	"errors"
 	"fmt"
 	"strings"
+	"sync"
 	"time"
 
 	"log/slog"
 
+	"github.com/astro-web3/oauth2-token-exchange/internal/domain/audit"
 	"github.com/astro-web3/oauth2-token-exchange/internal/infra/cache"
 	"github.com/astro-web3/oauth2-token-exchange/internal/infra/zitadel"
 	"github.com/astro-web3/oauth2-token-exchange/pkg/logger"
+	"golang.org/x/sync/singleflight"
 )
 
 const jwtPartsCount = 3
@@ -24,50 +27,116 @@ type Service interface {
 	AuthorizePAT(
 		ctx context.Context,
 		pat string,
+		route Route,
 		cacheTTL time.Duration,
 		headerKeys map[string]string,
 	) (*AuthzDecision, error)
+	// Close waits for the background refreshes in flight and skips those
+	// that have not started yet.
+	Close() error
 }
 
 type service struct {
 	tokenCache     cache.TokenCache
 	tokenExchanger zitadel.TokenExchanger
 	userInfoGetter zitadel.UserInfoGetter
-	adminPAT       string
+	adminTokens    zitadel.AdminTokenSource
+	auditor        audit.Recorder
+	rateLimiter    cache.RateLimiter
+	rateLimits     []RateLimitRule
+	attempts       cache.AttemptTracker
+	bruteForce     BruteForcePolicy
+	tenants        map[string]*Tenant
+	refresh        RefreshPolicy
+	refreshes      singleflight.Group
+
+	// refreshMu guards closed, so that no refresh is added to running once
+	// Close waits for it.
+	refreshMu sync.Mutex
+	closed    bool
+	running   sync.WaitGroup
 }
 
-func NewService(tokenCache cache.TokenCache, tokenExchanger zitadel.TokenExchanger) Service {
-	return &service{
+// ServiceOption configures optional collaborators of the authz service.
+type ServiceOption func(*service)
+
+// WithAuditor records an AuthzDenied event for every denied request.
+func WithAuditor(auditor audit.Recorder) ServiceOption {
+	return func(s *service) {
+		s.auditor = auditor
+	}
+}
+
+func NewService(tokenCache cache.TokenCache, tokenExchanger zitadel.TokenExchanger, opts ...ServiceOption) Service {
+	return newService(&service{
 		tokenCache:     tokenCache,
 		tokenExchanger: tokenExchanger,
-	}
+	}, opts)
 }
 
 func NewServiceWithMachineUserSupport(
 	tokenCache cache.TokenCache,
 	tokenExchanger zitadel.TokenExchanger,
 	userInfoGetter zitadel.UserInfoGetter,
-	adminPAT string,
+	adminTokens zitadel.AdminTokenSource,
+	opts ...ServiceOption,
 ) Service {
-	return &service{
+	return newService(&service{
 		tokenCache:     tokenCache,
 		tokenExchanger: tokenExchanger,
 		userInfoGetter: userInfoGetter,
-		adminPAT:       adminPAT,
+		adminTokens:    adminTokens,
+	}, opts)
+}
+
+func newService(s *service, opts []ServiceOption) *service {
+	s.auditor = audit.Nop()
+	for _, opt := range opts {
+		opt(s)
 	}
+	return s
 }
 
 func (s *service) AuthorizePAT(
 	ctx context.Context,
 	pat string,
+	route Route,
 	cacheTTL time.Duration,
 	headerKeys map[string]string,
 ) (*AuthzDecision, error) {
+	sourceIP := audit.SourceIP(ctx)
+	// Requests from blocked sources are counted in metrics but not audited
+	// one by one; the block itself is.
+	if decision := s.guard(ctx, sourceIP); decision != nil {
+		return decision, nil
+	}
+
+	decision := s.authorize(ctx, pat, route, cacheTTL, headerKeys)
+	s.recordFailure(ctx, sourceIP, decision)
+	if !decision.Allow {
+		s.auditor.Record(ctx, audit.Event{
+			Type:    audit.EventAuthzDenied,
+			Outcome: audit.OutcomeFailure,
+			Reason:  decision.ReasonCode,
+			Details: map[string]string{"message": decision.Reason},
+		})
+	}
+	return decision, nil
+}
+
+func (s *service) authorize(
+	ctx context.Context,
+	pat string,
+	route Route,
+	cacheTTL time.Duration,
+	headerKeys map[string]string,
+) *AuthzDecision {
 	if pat == "" {
 		return &AuthzDecision{
-			Allow:  false,
-			Reason: "PAT is empty",
-		}, nil
+			Allow:      false,
+			Reason:     "PAT is empty",
+			ReasonCode: ReasonEmptyPAT,
+		}
 	}
 
 	pat = strings.TrimPrefix(pat, "Bearer ")
@@ -75,14 +144,16 @@ func (s *service) AuthorizePAT(
 
 	if pat == "" {
 		return &AuthzDecision{
-			Allow:  false,
-			Reason: "PAT is empty after trimming",
-		}, nil
+			Allow:      false,
+			Reason:     "PAT is empty after trimming",
+			ReasonCode: ReasonEmptyPAT,
+		}
 	}
 
 	patHash := hashPAT(pat)
+	ex := s.exchangeFor(route.Host, patHash)
 
-	cached, err := s.tokenCache.Get(ctx, patHash)
+	cached, err := s.tokenCache.Get(ctx, ex.cacheKey)
 	if err != nil && !errors.Is(err, cache.ErrCacheMiss) {
 		logger.WarnContext(ctx, "failed to get from cache, will exchange token", slog.String("error", err.Error()))
 	}
@@ -90,24 +161,64 @@ func (s *service) AuthorizePAT(
 	if err == nil && cached != nil {
 		if cached.IsInvalid {
 			return &AuthzDecision{
-				Allow:  false,
-				Reason: "cached invalid token",
-			}, nil
+				Allow:      false,
+				Reason:     "cached invalid token",
+				ReasonCode: ReasonCachedInvalid,
+			}
 		}
-		return s.buildDecision(cached, headerKeys), nil
+		decision := s.buildDecision(cached, headerKeys)
+		decision.ReasonCode = ReasonCacheHit
+		if s.stale(cached) {
+			decision.ReasonCode = ReasonCacheStale
+			s.refreshInBackground(ctx, pat, ex, cacheTTL)
+		}
+		return s.limit(ctx, route, patHash, cached.UserID, cached.Groups, decision)
 	}
 
-	var tokenResp *zitadel.TokenResponse
-	var parseErr error
+	return s.exchangePAT(ctx, pat, patHash, ex, route, cacheTTL, headerKeys)
+}
 
-	if s.adminPAT == "" {
-		return &AuthzDecision{
-			Allow:  false,
-			Reason: "admin PAT is not set",
-		}, nil
+// exchangePAT resolves the PAT and authorizes the request with the result.
+func (s *service) exchangePAT(
+	ctx context.Context,
+	pat, patHash string,
+	ex exchange,
+	route Route,
+	cacheTTL time.Duration,
+	headerKeys map[string]string,
+) *AuthzDecision {
+	token, denied := s.resolve(ctx, pat, ex, cacheTTL)
+	if denied != nil {
+		return denied
+	}
+
+	decision := s.buildDecision(token, headerKeys)
+	decision.ReasonCode = ReasonExchanged
+	return s.limit(ctx, route, patHash, token.UserID, token.Groups, decision)
+}
+
+// resolve finds the PAT owner via userinfo, exchanges it for a JWT with the
+// admin actor token and caches the outcome, including invalid tokens. It
+// returns the cached token, or the decision denying the PAT.
+func (s *service) resolve(
+	ctx context.Context,
+	pat string,
+	ex exchange,
+	cacheTTL time.Duration,
+) (*cache.CachedToken, *AuthzDecision) {
+	if s.adminTokens == nil {
+		return nil, &AuthzDecision{
+			Allow:      false,
+			Reason:     "admin credentials are not set",
+			ReasonCode: ReasonAdminCredentialsMissing,
+		}
 	}
 
 	userInfo, err := s.userInfoGetter.GetUserInfo(ctx, pat)
+	if errors.Is(err, zitadel.ErrUnavailable) {
+		// An outage says nothing about the PAT, so it is not cached as invalid.
+		return nil, unavailable(err)
+	}
 
 	if err != nil || userInfo == nil {
 		logger.WarnContext(ctx, "failed to get user info", slog.String("error", err.Error()))
@@ -116,45 +227,64 @@ func (s *service) AuthorizePAT(
 		invalidToken := &cache.CachedToken{
 			IsInvalid: true,
 		}
-		if setErr := s.tokenCache.Set(ctx, patHash, invalidToken, cacheTTL); setErr != nil {
+		if setErr := s.store(ctx, ex.cacheKey, invalidToken, cacheTTL); setErr != nil {
 			logger.WarnContext(ctx, "failed to cache invalid token", slog.String("error", setErr.Error()))
 		}
 
-		return &AuthzDecision{
-			Allow:  false,
-			Reason: err.Error(),
-		}, nil
+		return nil, &AuthzDecision{
+			Allow:      false,
+			Reason:     err.Error(),
+			ReasonCode: ReasonInvalidPAT,
+		}
 	}
 
-	client, ok := s.tokenExchanger.(zitadel.Client)
+	client, ok := ex.exchanger.(zitadel.Client)
 
 	if !ok {
-		return &AuthzDecision{
-			Allow:  false,
-			Reason: "token exchanger is not a zitadel client",
-		}, nil
+		return nil, &AuthzDecision{
+			Allow:      false,
+			Reason:     "token exchanger is not a zitadel client",
+			ReasonCode: ReasonMisconfigured,
+		}
 	}
 
-	tokenResp, err = client.ExchangeWithActor(
+	adminToken, err := s.adminTokens.Token(ctx)
+	if errors.Is(err, zitadel.ErrUnavailable) {
+		return nil, unavailable(err)
+	}
+	if err != nil {
+		return nil, &AuthzDecision{
+			Allow:      false,
+			Reason:     fmt.Sprintf("failed to obtain admin token: %v", err),
+			ReasonCode: ReasonAdminTokenFailed,
+		}
+	}
+
+	tokenResp, err := client.ExchangeWithActor(
 		ctx,
 		userInfo.Username,
 		"urn:zitadel:params:oauth:token-type:user_id",
-		s.adminPAT,
+		adminToken,
 	)
+	if errors.Is(err, zitadel.ErrUnavailable) {
+		return nil, unavailable(err)
+	}
 
 	if err != nil {
-		return &AuthzDecision{
-			Allow:  false,
-			Reason: fmt.Sprintf("token exchange with actor failed: %v", err),
-		}, nil
+		return nil, &AuthzDecision{
+			Allow:      false,
+			Reason:     fmt.Sprintf("token exchange with actor failed: %v", err),
+			ReasonCode: ReasonExchangeFailed,
+		}
 	}
 
 	idTokenClaims, parseErr := parseIDTokenClaims(tokenResp.IDToken)
 	if parseErr != nil {
-		return &AuthzDecision{
-			Allow:  false,
-			Reason: fmt.Sprintf("parse id token failed: %v", parseErr),
-		}, nil
+		return nil, &AuthzDecision{
+			Allow:      false,
+			Reason:     fmt.Sprintf("parse id token failed: %v", parseErr),
+			ReasonCode: ReasonInvalidIDToken,
+		}
 	}
 
 	cachedToken := &cache.CachedToken{
@@ -165,19 +295,11 @@ func (s *service) AuthorizePAT(
 		PreferredUsername: idTokenClaims.PreferredUsername,
 	}
 
-	if setErr := s.tokenCache.Set(ctx, patHash, cachedToken, cacheTTL); setErr != nil {
+	if setErr := s.store(ctx, ex.cacheKey, cachedToken, cacheTTL); setErr != nil {
 		logger.WarnContext(ctx, "failed to set cache", slog.String("error", setErr.Error()))
 	}
 
-	tokenClaims := &TokenClaims{
-		UserID:            idTokenClaims.Sub,
-		Email:             idTokenClaims.Email,
-		Groups:            idTokenClaims.Groups,
-		PreferredUsername: idTokenClaims.PreferredUsername,
-		JWT:               tokenResp.AccessToken,
-	}
-
-	return s.buildDecisionFromClaims(tokenClaims, headerKeys), nil
+	return cachedToken, nil
 }
 
 func (s *service) buildDecision(cached *cache.CachedToken, headerKeys map[string]string) *AuthzDecision {
@@ -204,30 +326,6 @@ func (s *service) buildDecision(cached *cache.CachedToken, headerKeys map[string
 	}
 }
 
-func (s *service) buildDecisionFromClaims(claims *TokenClaims, headerKeys map[string]string) *AuthzDecision {
-	headers := make(map[string]string)
-	if claims.UserID != "" {
-		headers[headerKeys["user_id"]] = claims.UserID
-	}
-	if claims.Email != "" {
-		headers[headerKeys["user_email"]] = claims.Email
-	}
-	if len(claims.Groups) > 0 {
-		headers[headerKeys["user_groups"]] = strings.Join(claims.Groups, ",")
-	}
-	if claims.PreferredUsername != "" {
-		headers[headerKeys["user_preferred_username"]] = claims.PreferredUsername
-	}
-	if claims.JWT != "" {
-		headers[headerKeys["user_jwt"]] = claims.JWT
-	}
-
-	return &AuthzDecision{
-		Allow:   true,
-		Headers: headers,
-	}
-}
-
 func hashPAT(pat string) string {
 	hash := sha256.Sum256([]byte(pat))
 	return hex.EncodeToString(hash[:])
@@ -264,3 +362,13 @@ func parseIDTokenClaims(idToken string) (*idTokenClaims, error) {
 
 	return &claims, nil
 }
+
+// unavailable denies a request that could not be decided because Zitadel is
+// unreachable or its circuit breaker is open.
+func unavailable(err error) *AuthzDecision {
+	return &AuthzDecision{
+		Allow:      false,
+		Reason:     err.Error(),
+		ReasonCode: ReasonZitadelUnavailable,
+	}
+}
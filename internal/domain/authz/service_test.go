@@ -1,15 +1,25 @@
 package authz_test
 
 import (
+	"bytes"
 	"context"
 	"crypto/sha256"
 	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/astro-web3/oauth2-token-exchange/internal/domain/audit"
 	"github.com/astro-web3/oauth2-token-exchange/internal/domain/authz"
+	auditinfra "github.com/astro-web3/oauth2-token-exchange/internal/infra/audit"
 	"github.com/astro-web3/oauth2-token-exchange/internal/infra/cache"
 	"github.com/astro-web3/oauth2-token-exchange/internal/infra/zitadel"
+	"github.com/astro-web3/oauth2-token-exchange/pkg/secret"
 )
 
 type mockTokenCache struct {
@@ -71,6 +81,10 @@ func (m *mockZitadelClient) GetMachineUserByUsername(ctx context.Context, adminP
 	return nil, nil
 }
 
+func (m *mockZitadelClient) ListMachineUsers(ctx context.Context, adminPAT string) ([]*zitadel.MachineUser, error) {
+	return nil, nil
+}
+
 func (m *mockZitadelClient) CreateMachineUser(ctx context.Context, adminPAT, username, name, description string) (*zitadel.MachineUser, error) {
 	return nil, nil
 }
@@ -90,7 +104,7 @@ func (m *mockZitadelClient) RemovePersonalAccessToken(ctx context.Context, admin
 func TestService_AuthorizePAT_EmptyPAT(t *testing.T) {
 	svc := authz.NewService(&mockTokenCache{tokens: make(map[string]*cache.CachedToken)}, &mockTokenExchanger{})
 
-	decision, err := svc.AuthorizePAT(context.Background(), "", 5*time.Minute, map[string]string{
+	decision, err := svc.AuthorizePAT(context.Background(), "", authz.Route{}, 5*time.Minute, map[string]string{
 		"user_id":     "x-user-id",
 		"user_email":  "x-user-email",
 		"user_groups": "x-user-groups",
@@ -103,6 +117,9 @@ func TestService_AuthorizePAT_EmptyPAT(t *testing.T) {
 	if decision.Allow {
 		t.Error("expected decision to deny empty PAT")
 	}
+	if decision.ReasonCode != authz.ReasonEmptyPAT {
+		t.Errorf("expected reason code %s, got %s", authz.ReasonEmptyPAT, decision.ReasonCode)
+	}
 }
 
 func TestService_AuthorizePAT_CacheHit(t *testing.T) {
@@ -117,7 +134,7 @@ func TestService_AuthorizePAT_CacheHit(t *testing.T) {
 
 	svc := authz.NewService(mockCache, &mockTokenExchanger{})
 
-	decision, err := svc.AuthorizePAT(context.Background(), "Bearer test-token", 5*time.Minute, map[string]string{
+	decision, err := svc.AuthorizePAT(context.Background(), "Bearer test-token", authz.Route{}, 5*time.Minute, map[string]string{
 		"user_id":     "x-user-id",
 		"user_email":  "x-user-email",
 		"user_groups": "x-user-groups",
@@ -130,6 +147,9 @@ func TestService_AuthorizePAT_CacheHit(t *testing.T) {
 	if !decision.Allow {
 		t.Error("expected decision to allow cached token")
 	}
+	if decision.ReasonCode != authz.ReasonCacheHit {
+		t.Errorf("expected reason code %s, got %s", authz.ReasonCacheHit, decision.ReasonCode)
+	}
 	if decision.Headers["x-user-id"] != "user-123" {
 		t.Errorf("expected user-id header, got %v", decision.Headers)
 	}
@@ -142,9 +162,9 @@ func TestService_AuthorizePAT_CacheMiss(t *testing.T) {
 		mockUserInfoGetter: &mockUserInfoGetter{},
 	}
 
-	svc := authz.NewServiceWithMachineUserSupport(cache, client, client, "admin-pat")
+	svc := authz.NewServiceWithMachineUserSupport(cache, client, client, zitadel.NewStaticTokenSource(secret.Static("admin-pat")))
 
-	decision, err := svc.AuthorizePAT(context.Background(), "Bearer valid-token", 5*time.Minute, map[string]string{
+	decision, err := svc.AuthorizePAT(context.Background(), "Bearer valid-token", authz.Route{}, 5*time.Minute, map[string]string{
 		"user_id":     "x-user-id",
 		"user_email":  "x-user-email",
 		"user_groups": "x-user-groups",
@@ -157,12 +177,372 @@ func TestService_AuthorizePAT_CacheMiss(t *testing.T) {
 	if !decision.Allow {
 		t.Error("expected decision to allow after token exchange")
 	}
+	if decision.ReasonCode != authz.ReasonExchanged {
+		t.Errorf("expected reason code %s, got %s", authz.ReasonExchanged, decision.ReasonCode)
+	}
 	if decision.Headers["x-user-id"] != "user-123" {
 		t.Errorf("expected user-id header, got %v", decision.Headers)
 	}
 }
 
+func TestService_AuthorizePAT_ZitadelUnavailable(t *testing.T) {
+	tokens := &mockTokenCache{tokens: make(map[string]*cache.CachedToken)}
+	client := &mockZitadelClient{
+		mockTokenExchanger: &mockTokenExchanger{},
+		mockUserInfoGetter: &mockUserInfoGetter{
+			userInfoFunc: func(context.Context, string) (*zitadel.UserInfo, error) {
+				return nil, fmt.Errorf("get userinfo failed: %w", zitadel.ErrUnavailable)
+			},
+		},
+	}
+
+	svc := authz.NewServiceWithMachineUserSupport(tokens, client, client, zitadel.NewStaticTokenSource(secret.Static("admin-pat")))
+
+	decision, err := svc.AuthorizePAT(context.Background(), "Bearer valid-token", authz.Route{}, 5*time.Minute, map[string]string{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if decision.Allow || decision.ReasonCode != authz.ReasonZitadelUnavailable {
+		t.Errorf("expected %s denial, got %+v", authz.ReasonZitadelUnavailable, decision)
+	}
+	if len(tokens.tokens) != 0 {
+		t.Errorf("expected an outage not to be cached as an invalid PAT, got %v", tokens.tokens)
+	}
+}
+
 func hashPATForTest(pat string) string {
 	hash := sha256.Sum256([]byte(pat))
 	return hex.EncodeToString(hash[:])
 }
+
+func TestService_AuthorizePAT_AuditsDenial(t *testing.T) {
+	mockCache := &mockTokenCache{tokens: make(map[string]*cache.CachedToken)}
+	mockCache.tokens[hashPATForTest("revoked-token")] = &cache.CachedToken{IsInvalid: true}
+
+	var buf bytes.Buffer
+	svc := authz.NewService(mockCache, &mockTokenExchanger{},
+		authz.WithAuditor(audit.NewRecorder(auditinfra.NewWriterSink(&buf))))
+
+	ctx := audit.WithSourceIP(context.Background(), "203.0.113.7")
+	if _, err := svc.AuthorizePAT(ctx, "Bearer revoked-token", authz.Route{}, 5*time.Minute, map[string]string{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var event audit.Event
+	if err := json.Unmarshal(buf.Bytes(), &event); err != nil {
+		t.Fatalf("expected one audit event, got %q: %v", buf.String(), err)
+	}
+	if event.Type != audit.EventAuthzDenied || event.Reason != authz.ReasonCachedInvalid {
+		t.Errorf("unexpected event: %+v", event)
+	}
+	if event.SourceIP != "203.0.113.7" {
+		t.Errorf("expected source IP from context, got %q", event.SourceIP)
+	}
+	if strings.Contains(buf.String(), "revoked-token") || strings.Contains(buf.String(), hashPATForTest("revoked-token")) {
+		t.Errorf("audit event must not contain the PAT or its hash: %s", buf.String())
+	}
+}
+
+func TestService_AuthorizePAT_RateLimits(t *testing.T) {
+	mockCache := &mockTokenCache{tokens: make(map[string]*cache.CachedToken)}
+	mockCache.tokens[hashPATForTest("pat-a")] = &cache.CachedToken{UserID: "user-1", Groups: []string{"dev"}}
+	mockCache.tokens[hashPATForTest("pat-b")] = &cache.CachedToken{UserID: "user-1", Groups: []string{"dev"}}
+
+	svc := authz.NewService(mockCache, &mockTokenExchanger{}, authz.WithRateLimits(cache.NewMemoryRateLimiter(), []authz.RateLimitRule{
+		{Name: "writes", Methods: []string{"POST"}, PathPrefixes: []string{"/api/"}, By: authz.RateLimitByUser, Limit: 2, Window: time.Minute},
+		{Name: "admins", By: authz.RateLimitByGroup, Groups: []string{"admin"}, Limit: 1, Window: time.Minute},
+	}))
+
+	authorize := func(pat string, route authz.Route) *authz.AuthzDecision {
+		t.Helper()
+		decision, err := svc.AuthorizePAT(context.Background(), pat, route, 5*time.Minute, map[string]string{})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return decision
+	}
+	write := authz.Route{Method: "POST", Path: "/api/orders"}
+
+	first := authorize("pat-a", write)
+	if !first.Allow || first.RateLimit == nil || first.RateLimit.Limit != 2 || first.RateLimit.Remaining != 1 {
+		t.Fatalf("unexpected decision: %+v (%+v)", first, first.RateLimit)
+	}
+	// The quota is shared by all PATs of the user.
+	if d := authorize("pat-b", write); !d.Allow || d.RateLimit.Remaining != 0 {
+		t.Fatalf("unexpected decision: %+v (%+v)", d, d.RateLimit)
+	}
+
+	denied := authorize("pat-a", write)
+	if denied.Allow || denied.ReasonCode != authz.ReasonRateLimited || denied.RetryAfter <= 0 {
+		t.Fatalf("expected rate limited decision, got %+v (%+v)", denied, denied.RateLimit)
+	}
+
+	// Other routes and groups the caller is not in are not limited.
+	if d := authorize("pat-a", authz.Route{Method: "GET", Path: "/api/orders"}); !d.Allow || d.RateLimit != nil {
+		t.Errorf("unexpected decision: %+v", d)
+	}
+}
+
+func TestService_AuthorizePAT_RateLimitDenialConsumesNoQuota(t *testing.T) {
+	mockCache := &mockTokenCache{tokens: make(map[string]*cache.CachedToken)}
+	mockCache.tokens[hashPATForTest("pat-a")] = &cache.CachedToken{UserID: "user-1"}
+
+	svc := authz.NewService(mockCache, &mockTokenExchanger{}, authz.WithRateLimits(cache.NewMemoryRateLimiter(), []authz.RateLimitRule{
+		{Name: "all", By: authz.RateLimitByUser, Limit: 3, Window: time.Minute},
+		{Name: "writes", Methods: []string{"POST"}, By: authz.RateLimitByUser, Limit: 1, Window: time.Minute},
+	}))
+
+	authorize := func(route authz.Route) *authz.AuthzDecision {
+		t.Helper()
+		decision, err := svc.AuthorizePAT(context.Background(), "pat-a", route, 5*time.Minute, map[string]string{})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return decision
+	}
+	write := authz.Route{Method: "POST", Path: "/api/orders"}
+
+	if d := authorize(write); !d.Allow {
+		t.Fatalf("unexpected decision: %+v", d)
+	}
+	for range 3 {
+		if d := authorize(write); d.Allow || d.Reason != "rate limit writes exceeded" {
+			t.Fatalf("expected writes rate limited, got %+v", d)
+		}
+	}
+
+	// The denied writes did not use up the quota of the earlier rule.
+	if d := authorize(authz.Route{Method: "GET", Path: "/api/orders"}); !d.Allow || d.RateLimit.Remaining != 1 {
+		t.Errorf("unexpected decision: %+v (%+v)", d, d.RateLimit)
+	}
+}
+
+func TestService_Close_WaitsForRefreshes(t *testing.T) {
+	memory := cache.NewMemoryTokenCache(0, 0)
+	t.Cleanup(func() { _ = memory.(io.Closer).Close() })
+	patHash := hashPATForTest("hot")
+	stale := &cache.CachedToken{UserID: "user-old", SoftExpiresAt: time.Now().Add(-time.Second)}
+	if err := memory.Set(context.Background(), patHash, stale, time.Minute); err != nil {
+		t.Fatalf("failed to seed cache: %v", err)
+	}
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	client := &mockZitadelClient{
+		mockTokenExchanger: &mockTokenExchanger{},
+		mockUserInfoGetter: &mockUserInfoGetter{
+			userInfoFunc: func(context.Context, string) (*zitadel.UserInfo, error) {
+				close(started)
+				<-release
+				return &zitadel.UserInfo{Sub: "machine-1", Username: "user-123"}, nil
+			},
+		},
+	}
+	svc := authz.NewServiceWithMachineUserSupport(memory, client, client,
+		zitadel.NewStaticTokenSource(secret.Static("admin-pat")),
+		authz.WithRefresh(authz.RefreshPolicy{SoftTTLRatio: 0.5, Timeout: time.Second}))
+
+	if _, err := svc.AuthorizePAT(context.Background(), "hot", authz.Route{}, 5*time.Minute, map[string]string{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	<-started
+
+	closed := make(chan struct{})
+	go func() {
+		_ = svc.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+		t.Fatal("expected Close to wait for the refresh in flight")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release)
+	<-closed
+	if refreshed, _ := memory.Get(context.Background(), patHash); refreshed.UserID != "user-123" {
+		t.Errorf("expected the refresh to finish before Close returned, got %+v", refreshed)
+	}
+}
+
+func TestService_AuthorizePAT_BruteForceGuard(t *testing.T) {
+	mockCache := &mockTokenCache{tokens: make(map[string]*cache.CachedToken)}
+	mockCache.tokens[hashPATForTest("guessed")] = &cache.CachedToken{IsInvalid: true}
+	mockCache.tokens[hashPATForTest("valid")] = &cache.CachedToken{UserID: "user-1"}
+
+	var buf bytes.Buffer
+	svc := authz.NewService(mockCache, &mockTokenExchanger{},
+		authz.WithAuditor(audit.NewRecorder(auditinfra.NewWriterSink(&buf))),
+		authz.WithBruteForceGuard(cache.NewMemoryAttemptTracker(), authz.BruteForcePolicy{
+			MaxFailures:   3,
+			Window:        time.Minute,
+			BlockDuration: time.Minute,
+			DelayAfter:    2,
+			BaseDelay:     20 * time.Millisecond,
+			MaxDelay:      20 * time.Millisecond,
+		}))
+
+	attacker := audit.WithSourceIP(context.Background(), "203.0.113.7")
+	authorize := func(ctx context.Context, pat string) *authz.AuthzDecision {
+		t.Helper()
+		decision, err := svc.AuthorizePAT(ctx, pat, authz.Route{}, 5*time.Minute, map[string]string{})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return decision
+	}
+
+	authorize(attacker, "guessed")
+	authorize(attacker, "guessed")
+
+	// From the second failure on, requests are delayed before they are checked.
+	start := time.Now()
+	if d := authorize(attacker, "guessed"); d.ReasonCode != authz.ReasonCachedInvalid {
+		t.Fatalf("unexpected decision: %+v", d)
+	}
+	if elapsed := time.Since(start); elapsed < 20*time.Millisecond {
+		t.Errorf("expected request to be delayed, took %s", elapsed)
+	}
+
+	// The source is now blocked, even for valid PATs.
+	blocked := authorize(attacker, "valid")
+	if blocked.Allow || blocked.ReasonCode != authz.ReasonSourceBlocked || blocked.RetryAfter <= 0 {
+		t.Fatalf("expected blocked decision, got %+v", blocked)
+	}
+	if d := authorize(audit.WithSourceIP(context.Background(), "198.51.100.1"), "valid"); !d.Allow {
+		t.Errorf("expected other sources to be allowed, got %+v", d)
+	}
+
+	if !strings.Contains(buf.String(), `"type":"authz.blocked"`) ||
+		strings.Count(buf.String(), `"type":"authz.denied"`) != 3 {
+		t.Errorf("expected three denials and one block to be audited, got %s", buf.String())
+	}
+}
+
+// ttlRecordingCache records the TTL of every write to the wrapped cache.
+type ttlRecordingCache struct {
+	cache.TokenCache
+
+	mu   sync.Mutex
+	ttls []time.Duration
+}
+
+func (c *ttlRecordingCache) Set(ctx context.Context, patHash string, value *cache.CachedToken, ttl time.Duration) error {
+	c.mu.Lock()
+	c.ttls = append(c.ttls, ttl)
+	c.mu.Unlock()
+	return c.TokenCache.Set(ctx, patHash, value, ttl)
+}
+
+func TestService_AuthorizePAT_RefreshesStaleEntry(t *testing.T) {
+	memory := cache.NewMemoryTokenCache(0, 0)
+	t.Cleanup(func() { _ = memory.(io.Closer).Close() })
+	patHash := hashPATForTest("hot")
+	stale := &cache.CachedToken{UserID: "user-old", SoftExpiresAt: time.Now().Add(-time.Second)}
+	if err := memory.Set(context.Background(), patHash, stale, time.Minute); err != nil {
+		t.Fatalf("failed to seed cache: %v", err)
+	}
+	tokens := &ttlRecordingCache{TokenCache: memory}
+
+	var calls atomic.Int32
+	release := make(chan struct{})
+	client := &mockZitadelClient{
+		mockTokenExchanger: &mockTokenExchanger{},
+		mockUserInfoGetter: &mockUserInfoGetter{
+			userInfoFunc: func(context.Context, string) (*zitadel.UserInfo, error) {
+				calls.Add(1)
+				<-release
+				return &zitadel.UserInfo{Sub: "machine-1", Username: "user-123"}, nil
+			},
+		},
+	}
+	svc := authz.NewServiceWithMachineUserSupport(tokens, client, client,
+		zitadel.NewStaticTokenSource(secret.Static("admin-pat")),
+		authz.WithRefresh(authz.RefreshPolicy{SoftTTLRatio: 0.5, Jitter: 0.2, Timeout: time.Second}))
+	headerKeys := map[string]string{"user_id": "x-user-id"}
+
+	// Stale entries are served while Zitadel is still being asked.
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Go(func() {
+			decision, err := svc.AuthorizePAT(context.Background(), "hot", authz.Route{}, 5*time.Minute, headerKeys)
+			if err != nil || !decision.Allow || decision.ReasonCode != authz.ReasonCacheStale ||
+				decision.Headers["x-user-id"] != "user-old" {
+				t.Errorf("expected the stale entry to be served, got %+v, %v", decision, err)
+			}
+		})
+	}
+	wg.Wait()
+	close(release)
+
+	deadline := time.Now().Add(2 * time.Second)
+	var refreshed *cache.CachedToken
+	for time.Now().Before(deadline) {
+		if refreshed, _ = memory.Get(context.Background(), patHash); refreshed.UserID == "user-123" {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if refreshed.UserID != "user-123" {
+		t.Fatalf("expected the entry to be refreshed, got %+v", refreshed)
+	}
+	if calls.Load() != 1 {
+		t.Errorf("expected one refresh, got %d userinfo calls", calls.Load())
+	}
+
+	tokens.mu.Lock()
+	ttl := tokens.ttls[0]
+	tokens.mu.Unlock()
+	if ttl < 4*time.Minute || ttl > 6*time.Minute {
+		t.Errorf("expected a TTL within 20%% of 5m, got %s", ttl)
+	}
+	if soft := time.Until(refreshed.SoftExpiresAt); soft <= 0 || soft > ttl/2 {
+		t.Errorf("expected the soft expiry at half the TTL, got %s of %s", soft, ttl)
+	}
+
+	decision, err := svc.AuthorizePAT(context.Background(), "hot", authz.Route{}, 5*time.Minute, headerKeys)
+	if err != nil || decision.ReasonCode != authz.ReasonCacheHit {
+		t.Errorf("expected a fresh cache hit, got %+v, %v", decision, err)
+	}
+}
+
+func TestService_AuthorizePAT_Tenants(t *testing.T) {
+	tokens := &mockTokenCache{tokens: make(map[string]*cache.CachedToken)}
+	exchangerFor := func(jwt string) *mockZitadelClient {
+		return &mockZitadelClient{
+			mockTokenExchanger: &mockTokenExchanger{
+				exchangeFunc: func(ctx context.Context, pat string) (*zitadel.TokenResponse, error) {
+					resp, err := (&mockTokenExchanger{}).Exchange(ctx, pat)
+					resp.AccessToken = jwt
+					return resp, err
+				},
+			},
+			mockUserInfoGetter: &mockUserInfoGetter{},
+		}
+	}
+	client := exchangerFor("default-jwt")
+
+	svc := authz.NewServiceWithMachineUserSupport(tokens, client, client, zitadel.NewStaticTokenSource(secret.Static("admin-pat")),
+		authz.WithTenants([]authz.Tenant{
+			{Name: "acme", Hosts: []string{"api.acme.example"}, Exchanger: exchangerFor("acme-jwt")},
+		}))
+
+	for host, want := range map[string]string{
+		"api.acme.example":      "acme-jwt",
+		"API.acme.example:8443": "acme-jwt",
+		"api.other.example":     "default-jwt",
+		"":                      "default-jwt",
+	} {
+		decision, err := svc.AuthorizePAT(context.Background(), "Bearer valid-token", authz.Route{Host: host}, 5*time.Minute,
+			map[string]string{"user_jwt": "x-user-jwt"})
+		if err != nil || !decision.Allow {
+			t.Fatalf("host %q: unexpected decision %+v, %v", host, decision, err)
+		}
+		if got := decision.Headers["x-user-jwt"]; got != want {
+			t.Errorf("host %q: expected %s, got %s", host, want, got)
+		}
+	}
+	if len(tokens.tokens) != 2 {
+		t.Errorf("expected a cache entry per tenant, got %d", len(tokens.tokens))
+	}
+}
@@ -0,0 +1,46 @@
+package authz
+
+import (
+	"net"
+	"strings"
+
+	"github.com/astro-web3/oauth2-token-exchange/internal/infra/zitadel"
+)
+
+// Tenant is a Zitadel application that exchanges the PATs of requests to its
+// Hosts, so that each tenant can authenticate to the token endpoint its own
+// way. Requests to other hosts use the service's token exchanger.
+type Tenant struct {
+	Name      string
+	Hosts     []string
+	Exchanger zitadel.TokenExchanger
+}
+
+// WithTenants selects the token exchanger by the host of each request.
+func WithTenants(tenants []Tenant) ServiceOption {
+	return func(s *service) {
+		s.tenants = make(map[string]*Tenant)
+		for i := range tenants {
+			for _, host := range tenants[i].Hosts {
+				s.tenants[strings.ToLower(host)] = &tenants[i]
+			}
+		}
+	}
+}
+
+// exchange is how the PAT of a request is resolved: with the token exchanger
+// of its tenant, cached under a key that keeps the tokens of tenants apart.
+type exchange struct {
+	exchanger zitadel.TokenExchanger
+	cacheKey  string
+}
+
+func (s *service) exchangeFor(host, patHash string) exchange {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	if tenant, ok := s.tenants[strings.ToLower(host)]; ok {
+		return exchange{exchanger: tenant.Exchanger, cacheKey: tenant.Name + ":" + patHash}
+	}
+	return exchange{exchanger: s.tokenExchanger, cacheKey: patHash}
+}
@@ -1,18 +1,37 @@
 package authz
 
-type TokenClaims struct {
-	UserID            string
-	Email             string
-	Groups            []string
-	PreferredUsername string
-	JWT               string
-}
+import "time"
+
+// Reason codes classify a decision with a small fixed set of values, so they
+// can be used as metric labels, unlike the free-form Reason.
+const (
+	ReasonCacheHit                = "cache_hit"
+	ReasonCacheStale              = "cache_stale"
+	ReasonExchanged               = "exchanged"
+	ReasonEmptyPAT                = "empty_pat"
+	ReasonCachedInvalid           = "cached_invalid"
+	ReasonAdminCredentialsMissing = "admin_credentials_missing" //nolint:gosec // Reason code, not a credential.
+	ReasonInvalidPAT              = "invalid_pat"
+	ReasonMisconfigured           = "misconfigured"
+	ReasonAdminTokenFailed        = "admin_token_failed"
+	ReasonExchangeFailed          = "exchange_failed"
+	ReasonInvalidIDToken          = "invalid_id_token"
+	ReasonRateLimited             = "rate_limited"
+	ReasonSourceBlocked           = "source_blocked"
+	ReasonZitadelUnavailable      = "zitadel_unavailable"
+)
 
 // AuthzDecision represents the authorization decision returned by the domain service.
 //
 //nolint:revive // AuthzDecision keeps the domain name in the type for clarity
 type AuthzDecision struct {
-	Allow   bool
-	Headers map[string]string
-	Reason  string
+	Allow      bool
+	Headers    map[string]string
+	Reason     string
+	ReasonCode string
+	// RateLimit is set when a rate limit rule matched the request.
+	RateLimit *RateLimitStatus
+	// RetryAfter is set when the request was denied for being sent too
+	// often, with the time until the caller may try again.
+	RetryAfter time.Duration
 }
@@ -0,0 +1,198 @@
+package pat
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/astro-web3/oauth2-token-exchange/internal/domain/audit"
+	"github.com/astro-web3/oauth2-token-exchange/internal/infra/zitadel"
+)
+
+// Audit detail keys shared by several events.
+const (
+	detailUserID = "user_id"
+	detailCount  = "count"
+)
+
+// Admin actions recorded in the details of admin.action audit events.
+const (
+	AdminActionListPATs         = "list_pats"
+	AdminActionRevokePAT        = "revoke_pat"
+	AdminActionRevokeAllPATs    = "revoke_all_pats"
+	AdminActionListMachineUsers = "list_machine_users"
+)
+
+// Caller is the identity of the user calling the admin API.
+type Caller struct {
+	UserID string
+	Groups []string
+	Roles  []string
+}
+
+// AdminPolicy grants access to the admin API to members of any of Groups and
+// holders of any of Roles. An empty policy denies everyone.
+type AdminPolicy struct {
+	Groups []string
+	Roles  []string
+}
+
+func (p AdminPolicy) allows(caller Caller) bool {
+	if caller.UserID == "" {
+		return false
+	}
+	return slices.ContainsFunc(caller.Groups, func(g string) bool { return slices.Contains(p.Groups, g) }) ||
+		slices.ContainsFunc(caller.Roles, func(r string) bool { return slices.Contains(p.Roles, r) })
+}
+
+// AdminService manages the PATs of any user, e.g. for offboarding and
+// incident response. Every call is checked against the AdminPolicy and
+// recorded as an admin.action audit event, including denied calls.
+type AdminService interface {
+	ListUserPATs(ctx context.Context, caller Caller, userID string, query ListQuery) (*Page, error)
+	RevokePAT(ctx context.Context, caller Caller, userID, patID string) error
+	// RevokeAllPATs deletes every PAT of the user and returns the IDs of the
+	// deleted PATs, also when some deletions failed.
+	RevokeAllPATs(ctx context.Context, caller Caller, userID string) ([]string, error)
+	// ListMachineUsers lists the machine users this service created to hold
+	// PATs, leaving out other machine users of the organization.
+	ListMachineUsers(ctx context.Context, caller Caller) ([]*MachineUser, error)
+}
+
+type adminService struct {
+	*service
+
+	adminPolicy AdminPolicy
+}
+
+func NewAdminService(
+	zitadelClient zitadel.Client,
+	adminTokens zitadel.AdminTokenSource,
+	adminPolicy AdminPolicy,
+	opts ...ServiceOption,
+) AdminService {
+	return &adminService{
+		service:     newService(zitadelClient, adminTokens, opts...),
+		adminPolicy: adminPolicy,
+	}
+}
+
+func (s *adminService) ListUserPATs(ctx context.Context, caller Caller, userID string, query ListQuery) (*Page, error) {
+	var page *Page
+	err := s.authorize(caller)
+	if err == nil {
+		page, err = s.queryPATs(ctx, userID, query)
+	}
+
+	details := map[string]string{detailUserID: userID}
+	if page != nil {
+		details[detailCount] = strconv.Itoa(len(page.PATs))
+	}
+	s.recordAdmin(ctx, caller, AdminActionListPATs, userID, err, details)
+
+	return page, err
+}
+
+func (s *adminService) RevokePAT(ctx context.Context, caller Caller, userID, patID string) error {
+	err := s.authorize(caller)
+	if err == nil {
+		err = s.deletePAT(ctx, userID, patID)
+	}
+	s.recordAdmin(ctx, caller, AdminActionRevokePAT, patID, err, map[string]string{detailUserID: userID})
+	return err
+}
+
+func (s *adminService) RevokeAllPATs(ctx context.Context, caller Caller, userID string) ([]string, error) {
+	var revoked []string
+	err := s.authorize(caller)
+	if err == nil {
+		revoked, err = s.revokeAllPATs(ctx, userID)
+	}
+
+	details := map[string]string{detailUserID: userID, detailCount: strconv.Itoa(len(revoked))}
+	if len(revoked) > 0 {
+		details["pat_ids"] = strings.Join(revoked, ",")
+	}
+	s.recordAdmin(ctx, caller, AdminActionRevokeAllPATs, userID, err, details)
+
+	return revoked, err
+}
+
+func (s *adminService) revokeAllPATs(ctx context.Context, userID string) ([]string, error) {
+	pats, err := s.listPATs(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if len(pats) == 0 {
+		return nil, nil
+	}
+
+	adminToken, err := s.adminToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var revoked []string
+	var errs []error
+	for _, p := range pats {
+		err = s.zitadelClient.RemovePersonalAccessToken(ctx, adminToken, p.MachineUserID, p.ID)
+		if err != nil && !errors.Is(err, zitadel.ErrNotFound) {
+			errs = append(errs, fmt.Errorf("revoke PAT %s: %w", p.ID, err))
+			continue
+		}
+		revoked = append(revoked, p.ID)
+	}
+	return revoked, errors.Join(errs...)
+}
+
+func (s *adminService) ListMachineUsers(ctx context.Context, caller Caller) ([]*MachineUser, error) {
+	var users []*MachineUser
+	err := s.authorize(caller)
+	if err == nil {
+		users, err = s.listMachineUsers(ctx)
+	}
+	s.recordAdmin(ctx, caller, AdminActionListMachineUsers, "", err,
+		map[string]string{detailCount: strconv.Itoa(len(users))})
+	return users, err
+}
+
+func (s *adminService) listMachineUsers(ctx context.Context) ([]*MachineUser, error) {
+	adminToken, err := s.adminToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	zitadelUsers, err := s.zitadelClient.ListMachineUsers(ctx, adminToken)
+	if err != nil {
+		return nil, err
+	}
+
+	users := make([]*MachineUser, 0, len(zitadelUsers))
+	for _, mu := range zitadelUsers {
+		if owner, ok := ownMachineUser(mu); ok {
+			users = append(users, owner)
+		}
+	}
+	return users, nil
+}
+
+func (s *adminService) authorize(caller Caller) error {
+	if !s.adminPolicy.allows(caller) {
+		return ErrNotAdmin
+	}
+	return nil
+}
+
+func (s *adminService) recordAdmin(
+	ctx context.Context,
+	caller Caller,
+	action, subject string,
+	err error,
+	details map[string]string,
+) {
+	details["action"] = action
+	s.record(ctx, audit.EventAdminAction, caller.UserID, subject, err, details)
+}
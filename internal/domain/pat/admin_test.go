@@ -0,0 +1,113 @@
+package pat_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/astro-web3/oauth2-token-exchange/internal/domain/audit"
+	"github.com/astro-web3/oauth2-token-exchange/internal/domain/pat"
+	"github.com/astro-web3/oauth2-token-exchange/internal/infra/zitadel"
+	"github.com/astro-web3/oauth2-token-exchange/pkg/secret"
+)
+
+type recordingAuditor struct {
+	events []audit.Event
+}
+
+func (r *recordingAuditor) Record(_ context.Context, event audit.Event) {
+	r.events = append(r.events, event)
+}
+
+func newAdminService(client *fakeZitadelClient, auditor audit.Recorder) pat.AdminService {
+	return pat.NewAdminService(client, zitadel.NewStaticTokenSource(secret.Static("admin-pat")),
+		pat.AdminPolicy{Groups: []string{"security"}, Roles: []string{"pat-admin"}},
+		pat.WithAuditor(auditor))
+}
+
+func TestAdminService_Authorization(t *testing.T) {
+	tests := []struct {
+		name    string
+		caller  pat.Caller
+		wantErr error
+	}{
+		{"admin group", pat.Caller{UserID: "admin-1", Groups: []string{"dev", "security"}}, nil},
+		{"admin role", pat.Caller{UserID: "admin-1", Roles: []string{"pat-admin"}}, nil},
+		{"regular user", pat.Caller{UserID: "user-1", Groups: []string{"dev"}}, pat.ErrNotAdmin},
+		{"anonymous", pat.Caller{Groups: []string{"security"}}, pat.ErrNotAdmin},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			auditor := &recordingAuditor{}
+			client := &fakeZitadelClient{machineUsers: []*zitadel.MachineUser{{ID: "machine-1", Username: "user-1"}}}
+
+			_, err := newAdminService(client, auditor).ListMachineUsers(context.Background(), tt.caller)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+
+			if len(auditor.events) != 1 {
+				t.Fatalf("expected one audit event, got %d", len(auditor.events))
+			}
+			event := auditor.events[0]
+			wantOutcome := audit.OutcomeSuccess
+			if tt.wantErr != nil {
+				wantOutcome = audit.OutcomeFailure
+			}
+			if event.Type != audit.EventAdminAction || event.Outcome != wantOutcome ||
+				event.Actor != tt.caller.UserID || event.Details["action"] != pat.AdminActionListMachineUsers {
+				t.Errorf("unexpected audit event: %+v", event)
+			}
+		})
+	}
+}
+
+func TestAdminService_ListMachineUsers_OnlyOwnUsers(t *testing.T) {
+	client := &fakeZitadelClient{machineUsers: []*zitadel.MachineUser{
+		{ID: "machine-1", Username: "user-1", Description: "oauth2-token-exchange:alice@example.com"},
+		{ID: "machine-2", Username: "ci-deployer", Description: "deploys from CI"},
+		{ID: "machine-3", Username: "token-exchange-admin"},
+		// Created before the marker was introduced.
+		{ID: "machine-4", Username: "user-4", Description: "bob@example.com"},
+		{ID: "machine-5", Username: "ops-bot", Description: "Ops <ops@example.com>"},
+	}}
+	caller := pat.Caller{UserID: "admin-1", Groups: []string{"security"}}
+
+	users, err := newAdminService(client, &recordingAuditor{}).ListMachineUsers(context.Background(), caller)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []pat.MachineUser{
+		{ID: "machine-1", UserID: "user-1", Email: "alice@example.com"},
+		{ID: "machine-4", UserID: "user-4", Email: "bob@example.com"},
+	}
+	if len(users) != len(want) || *users[0] != want[0] || *users[1] != want[1] {
+		t.Errorf("expected only %+v, got %v", want, users)
+	}
+}
+
+func TestAdminService_RevokeAllPATs(t *testing.T) {
+	auditor := &recordingAuditor{}
+	client := &fakeZitadelClient{
+		machineUsers: []*zitadel.MachineUser{{ID: "machine-1", Username: "user-1"}},
+		pats: map[string][]*zitadel.PersonalAccessToken{
+			"machine-1": {{ID: "pat-1"}, {ID: "pat-2"}},
+		},
+	}
+	caller := pat.Caller{UserID: "admin-1", Groups: []string{"security"}}
+
+	revoked, err := newAdminService(client, auditor).RevokeAllPATs(context.Background(), caller, "user-1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(revoked) != 2 || len(client.pats["machine-1"]) != 0 {
+		t.Errorf("expected both PATs to be revoked, got %v, remaining %v", revoked, client.pats["machine-1"])
+	}
+
+	event := auditor.events[0]
+	if event.Subject != "user-1" || event.Details["pat_ids"] != "pat-1,pat-2" ||
+		event.Details["action"] != pat.AdminActionRevokeAllPATs {
+		t.Errorf("unexpected audit event: %+v", event)
+	}
+}
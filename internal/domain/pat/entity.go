@@ -1,6 +1,17 @@
 package pat
 
-import "time"
+import (
+	"net/mail"
+	"strings"
+	"time"
+
+	"github.com/astro-web3/oauth2-token-exchange/internal/infra/zitadel"
+)
+
+// machineUserMarker starts the description of the machine users this service
+// creates and is followed by the owner's email. It tells them apart from other
+// machine users of the organization, such as the admin user and integrations.
+const machineUserMarker = "oauth2-token-exchange:"
 
 type PAT struct {
 	ID             string
@@ -9,3 +20,37 @@ type PAT struct {
 	ExpirationDate time.Time
 	CreatedAt      time.Time
 }
+
+// MachineUser is the Zitadel machine user that owns a user's PATs.
+type MachineUser struct {
+	ID string
+	// UserID is the human user the machine user was created for.
+	UserID string
+	Email  string
+}
+
+func machineUserDescription(email string) string {
+	return machineUserMarker + email
+}
+
+// ownMachineUser returns mu if this service created it. Machine users created
+// before the marker was introduced have the bare owner's email as their
+// description and, like all of them, the owner's user ID as their username;
+// they are recognized by that.
+func ownMachineUser(mu *zitadel.MachineUser) (*MachineUser, bool) {
+	email, ok := strings.CutPrefix(mu.Description, machineUserMarker)
+	if !ok {
+		if mu.Username == "" || !isBareEmail(mu.Description) {
+			return nil, false
+		}
+		email = mu.Description
+	}
+	return &MachineUser{ID: mu.ID, UserID: mu.Username, Email: email}, true
+}
+
+// isBareEmail reports whether s is an email address without a display name or
+// anything around it.
+func isBareEmail(s string) bool {
+	addr, err := mail.ParseAddress(s)
+	return err == nil && addr.Name == "" && addr.Address == s
+}
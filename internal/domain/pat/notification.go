@@ -0,0 +1,51 @@
+package pat
+
+import (
+	"context"
+	"time"
+)
+
+type NotificationType string
+
+const (
+	NotificationPATCreated   NotificationType = "pat.created"
+	NotificationPATDeleted   NotificationType = "pat.deleted"
+	NotificationPATLongLived NotificationType = "pat.long_lived"
+	NotificationPATExpiring  NotificationType = "pat.expiring"
+	NotificationPATRotated   NotificationType = "pat.rotated"
+)
+
+// NotificationTypes lists every notification type, e.g. to validate
+// subscriptions.
+func NotificationTypes() []NotificationType {
+	return []NotificationType{
+		NotificationPATCreated,
+		NotificationPATDeleted,
+		NotificationPATLongLived,
+		NotificationPATExpiring,
+		NotificationPATRotated,
+	}
+}
+
+// Notification describes a PAT lifecycle change for outside consumers such as
+// chat channels or a SIEM. It never carries the token value.
+type Notification struct {
+	Type           NotificationType `json:"type"`
+	Time           time.Time        `json:"time"`
+	UserID         string           `json:"user_id"`
+	PATID          string           `json:"pat_id"`
+	MachineUserID  string           `json:"machine_user_id,omitempty"`
+	ExpirationDate *time.Time       `json:"expiration_date,omitempty"`
+	// Email is the owner's address, set on expiry reminders.
+	Email string `json:"email,omitempty"`
+	// ReplacedPATID is the rotated PAT, set on pat.rotated. PATID is its
+	// replacement.
+	ReplacedPATID string `json:"replaced_pat_id,omitempty"`
+	// ReplacedPATDeleteAt is when the rotated PAT will be deleted.
+	ReplacedPATDeleteAt *time.Time `json:"replaced_pat_delete_at,omitempty"`
+}
+
+// Notifier delivers notifications. Notify must not block on delivery.
+type Notifier interface {
+	Notify(ctx context.Context, notification Notification)
+}
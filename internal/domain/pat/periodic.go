@@ -0,0 +1,71 @@
+package pat
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// periodic runs fn immediately and then every interval until closed. It backs
+// the background workers of this package.
+type periodic struct {
+	interval time.Duration
+	fn       func(ctx context.Context)
+
+	stop     chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+	started  bool
+}
+
+func newPeriodic(interval time.Duration, fn func(ctx context.Context)) *periodic {
+	return &periodic{
+		interval: interval,
+		fn:       fn,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+func (p *periodic) start() {
+	p.started = true
+	go p.run()
+}
+
+// close stops the loop and waits for a running fn to return. fn's context is
+// canceled so it can stop early.
+func (p *periodic) close() {
+	p.stopOnce.Do(func() {
+		close(p.stop)
+	})
+	if p.started {
+		<-p.done
+	}
+}
+
+func (p *periodic) run() {
+	defer close(p.done)
+
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-p.stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	for {
+		p.fn(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
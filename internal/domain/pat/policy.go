@@ -0,0 +1,159 @@
+package pat
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// Policy limits the PATs users can create. A zero limit means unlimited.
+type Policy struct {
+	// MaxLifetime caps how far in the future a PAT may expire.
+	MaxLifetime time.Duration
+	// DefaultLifetime is used when no expiration date is requested. Without
+	// it, an expiration date is required.
+	DefaultLifetime time.Duration
+	// MaxActivePATs caps the unexpired PATs per user.
+	MaxActivePATs int
+	// GroupOverrides replace the limits for members of a group.
+	GroupOverrides []GroupPolicy
+	// RotationGracePeriod is how long a rotated PAT keeps working unless the
+	// request sets its own grace period.
+	RotationGracePeriod time.Duration
+	// MaxRotationGracePeriod caps the grace period a request may set.
+	MaxRotationGracePeriod time.Duration
+}
+
+// GroupPolicy overrides the limits of Policy for members of Group. A zero
+// limit is not overridden and keeps the value of Policy.
+type GroupPolicy struct {
+	Group         string
+	MaxLifetime   time.Duration
+	MaxActivePATs int
+}
+
+const (
+	// creationLockTTL bounds how long a creation holds the lock of its user,
+	// and how long another one waits for it.
+	creationLockTTL   = 30 * time.Second
+	creationLockRetry = 50 * time.Millisecond
+)
+
+// Ledger claims keys for a limited time, shared by all replicas when it is
+// backed by Redis. It records which reminders were sent, so each PAT gets at
+// most one reminder per window, and serializes the PAT creations of a user.
+type Ledger interface {
+	// Claim reserves key for ttl and reports whether it was free.
+	Claim(ctx context.Context, key string, ttl time.Duration) (bool, error)
+	// Release frees a claimed key, e.g. after a reminder could not be sent.
+	Release(ctx context.Context, key string) error
+}
+
+// Limits are the effective limits for one user.
+type Limits struct {
+	MaxLifetime   time.Duration
+	MaxActivePATs int
+}
+
+// LimitsFor returns the limits for a member of groups. When several group
+// overrides apply, the most permissive value of each limit wins.
+func (p Policy) LimitsFor(groups []string) Limits {
+	var matched []GroupPolicy
+	for _, override := range p.GroupOverrides {
+		if slices.Contains(groups, override.Group) {
+			matched = append(matched, override)
+		}
+	}
+	if len(matched) == 0 {
+		return Limits{MaxLifetime: p.MaxLifetime, MaxActivePATs: p.MaxActivePATs}
+	}
+
+	limits := p.overridden(matched[0])
+	for _, override := range matched[1:] {
+		next := p.overridden(override)
+		limits.MaxLifetime = permissive(limits.MaxLifetime, next.MaxLifetime)
+		limits.MaxActivePATs = permissive(limits.MaxActivePATs, next.MaxActivePATs)
+	}
+	return limits
+}
+
+// overridden returns the limits of override, inheriting the ones it leaves
+// unset from p.
+func (p Policy) overridden(override GroupPolicy) Limits {
+	limits := Limits{MaxLifetime: p.MaxLifetime, MaxActivePATs: p.MaxActivePATs}
+	if override.MaxLifetime > 0 {
+		limits.MaxLifetime = override.MaxLifetime
+	}
+	if override.MaxActivePATs > 0 {
+		limits.MaxActivePATs = override.MaxActivePATs
+	}
+	return limits
+}
+
+// expiration resolves the requested expiration date against the policy.
+func (p Policy) expiration(requested time.Time, limits Limits, now time.Time) (time.Time, error) {
+	if requested.IsZero() {
+		if p.DefaultLifetime <= 0 {
+			return time.Time{}, fmt.Errorf("%w: expiration_date is required", ErrInvalidExpiration)
+		}
+		requested = now.Add(p.DefaultLifetime)
+		if limits.MaxLifetime > 0 && p.DefaultLifetime > limits.MaxLifetime {
+			requested = now.Add(limits.MaxLifetime)
+		}
+		return requested, nil
+	}
+
+	if requested.Before(now) {
+		return time.Time{}, ErrInvalidExpiration
+	}
+	if limits.MaxLifetime > 0 && requested.Sub(now) > limits.MaxLifetime {
+		return time.Time{}, fmt.Errorf("%w: PATs may be valid for at most %s, requested expiration %s",
+			ErrLifetimeExceeded, formatLifetime(limits.MaxLifetime), requested.UTC().Format(time.RFC3339))
+	}
+	return requested, nil
+}
+
+// rotatedExpiration gives the replacement of old the same lifetime, starting
+// now and capped at the maximum. PATs without a known lifetime get the default.
+func (p Policy) rotatedExpiration(old *PAT, limits Limits, now time.Time) (time.Time, error) {
+	lifetime := old.ExpirationDate.Sub(old.CreatedAt)
+	if old.ExpirationDate.IsZero() || old.CreatedAt.IsZero() || lifetime <= 0 {
+		return p.expiration(time.Time{}, limits, now)
+	}
+	if limits.MaxLifetime > 0 {
+		lifetime = min(lifetime, limits.MaxLifetime)
+	}
+	return now.Add(lifetime), nil
+}
+
+// gracePeriod resolves the requested grace period of a rotation; nil selects
+// the default.
+func (p Policy) gracePeriod(requested *time.Duration) (time.Duration, error) {
+	if requested == nil {
+		return p.RotationGracePeriod, nil
+	}
+	if *requested < 0 {
+		return 0, fmt.Errorf("%w: must not be negative", ErrInvalidGracePeriod)
+	}
+	if p.MaxRotationGracePeriod > 0 && *requested > p.MaxRotationGracePeriod {
+		return 0, fmt.Errorf("%w: must not exceed %s, requested %s",
+			ErrInvalidGracePeriod, formatLifetime(p.MaxRotationGracePeriod), *requested)
+	}
+	return *requested, nil
+}
+
+func permissive[T int | time.Duration](a, b T) T {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	return max(a, b)
+}
+
+func formatLifetime(d time.Duration) string {
+	const day = 24 * time.Hour
+	if d%day == 0 {
+		return fmt.Sprintf("%d days", d/day)
+	}
+	return d.String()
+}
@@ -0,0 +1,163 @@
+package pat_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/astro-web3/oauth2-token-exchange/internal/domain/pat"
+	"github.com/astro-web3/oauth2-token-exchange/internal/infra/cache"
+	"github.com/astro-web3/oauth2-token-exchange/internal/infra/zitadel"
+	"github.com/astro-web3/oauth2-token-exchange/pkg/secret"
+)
+
+const day = 24 * time.Hour
+
+func (f *fakeZitadelClient) GetMachineUserByUsername(_ context.Context, _, username string) (*zitadel.MachineUser, error) {
+	for _, mu := range f.machineUsers {
+		if mu.Username == username {
+			return mu, nil
+		}
+	}
+	return nil, nil
+}
+
+func (f *fakeZitadelClient) AddPersonalAccessToken(
+	_ context.Context,
+	_, userID string,
+	expirationDate time.Time,
+) (*zitadel.PersonalAccessToken, string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	created := &zitadel.PersonalAccessToken{ID: "pat-new", UserID: userID, ExpirationDate: expirationDate}
+	f.pats[userID] = append(f.pats[userID], created)
+	return created, "token", nil
+}
+
+var testPolicy = pat.Policy{
+	MaxLifetime:     90 * day,
+	DefaultLifetime: 30 * day,
+	MaxActivePATs:   2,
+	GroupOverrides: []pat.GroupPolicy{
+		{Group: "ci", MaxLifetime: 365 * day, MaxActivePATs: 10},
+	},
+}
+
+func newPolicyClient(existing int) *fakeZitadelClient {
+	client := &fakeZitadelClient{
+		machineUsers: []*zitadel.MachineUser{{ID: "machine-1", Username: "user-1"}},
+		pats:         map[string][]*zitadel.PersonalAccessToken{},
+	}
+	for range existing {
+		client.pats["machine-1"] = append(client.pats["machine-1"],
+			&zitadel.PersonalAccessToken{ExpirationDate: time.Now().Add(day)})
+	}
+	// An expired PAT does not count against the quota.
+	client.pats["machine-1"] = append(client.pats["machine-1"],
+		&zitadel.PersonalAccessToken{ExpirationDate: time.Now().Add(-day)})
+	return client
+}
+
+func newPolicyService(existing int) pat.Service {
+	return pat.NewService(newPolicyClient(existing), zitadel.NewStaticTokenSource(secret.Static("admin-pat")),
+		pat.WithPolicy(testPolicy))
+}
+
+func TestService_CreatePAT_Policy(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name       string
+		existing   int
+		groups     []string
+		expiration time.Time
+		wantErr    error
+	}{
+		{"within limits", 0, nil, time.Now().Add(60 * day), nil},
+		{"lifetime exceeded", 0, nil, time.Now().Add(120 * day), pat.ErrLifetimeExceeded},
+		{"group override lifetime", 0, []string{"dev", "ci"}, time.Now().Add(120 * day), nil},
+		{"quota exceeded", 2, nil, time.Now().Add(day), pat.ErrQuotaExceeded},
+		{"group override quota", 2, []string{"ci"}, time.Now().Add(day), nil},
+		{"past expiration", 0, nil, time.Now().Add(-time.Hour), pat.ErrInvalidExpiration},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := newPolicyService(tt.existing)
+			_, _, err := svc.CreatePAT(ctx, "user-1", "", "", tt.groups, tt.expiration)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("expected error %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestService_CreatePAT_DefaultLifetime(t *testing.T) {
+	created, _, err := newPolicyService(0).CreatePAT(context.Background(), "user-1", "", "", nil, time.Time{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if lifetime := time.Until(created.ExpirationDate); lifetime < 29*day || lifetime > 30*day {
+		t.Errorf("expected the default lifetime of 30 days, got %s", lifetime)
+	}
+}
+
+func TestService_CreatePAT_ConcurrentQuota(t *testing.T) {
+	client := newPolicyClient(0)
+	// Counting takes a while, so unserialized creations would all see a free quota.
+	client.listDelay = 10 * time.Millisecond
+	svc := pat.NewService(client, zitadel.NewStaticTokenSource(secret.Static("admin-pat")),
+		pat.WithPolicy(testPolicy), pat.WithCreationLock(cache.NewMemoryLedger()))
+
+	var (
+		wg      sync.WaitGroup
+		created atomic.Int32
+	)
+	for range 10 {
+		wg.Go(func() {
+			if _, _, err := svc.CreatePAT(context.Background(), "user-1", "", "", nil, time.Now().Add(day)); err == nil {
+				created.Add(1)
+			}
+		})
+	}
+	wg.Wait()
+
+	if got := created.Load(); got != 2 {
+		t.Errorf("expected the quota of 2 PATs to hold under concurrency, got %d", got)
+	}
+}
+
+func TestPolicy_LimitsFor_InheritsUnsetOverrides(t *testing.T) {
+	policy := pat.Policy{
+		MaxLifetime:   90 * day,
+		MaxActivePATs: 2,
+		GroupOverrides: []pat.GroupPolicy{
+			{Group: "bulk", MaxActivePATs: 50},
+			{Group: "long-lived", MaxLifetime: 365 * day},
+		},
+	}
+
+	tests := []struct {
+		name   string
+		groups []string
+		want   pat.Limits
+	}{
+		{"no override", []string{"dev"}, pat.Limits{MaxLifetime: 90 * day, MaxActivePATs: 2}},
+		{"quota only", []string{"bulk"}, pat.Limits{MaxLifetime: 90 * day, MaxActivePATs: 50}},
+		{"lifetime only", []string{"long-lived"}, pat.Limits{MaxLifetime: 365 * day, MaxActivePATs: 2}},
+		{"both", []string{"bulk", "long-lived"}, pat.Limits{MaxLifetime: 365 * day, MaxActivePATs: 50}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := policy.LimitsFor(tt.groups); got != tt.want {
+				t.Errorf("expected %+v, got %+v", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,168 @@
+package pat
+
+import (
+	"cmp"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultPageSize = 50
+	MaxPageSize     = 100
+)
+
+type SortField string
+
+const (
+	SortByCreatedAt      SortField = "created_at"
+	SortByExpirationDate SortField = "expiration_date"
+)
+
+// ListFilter narrows ListPATs. Zero fields do not filter.
+type ListFilter struct {
+	// Expired keeps only expired PATs when true and only unexpired PATs when
+	// false.
+	Expired *bool
+	// ExpiringBefore keeps PATs that expire before it. PATs without an
+	// expiration date never match.
+	ExpiringBefore time.Time
+	// CreatedAfter keeps PATs created after it.
+	CreatedAfter time.Time
+}
+
+// ListQuery selects one page of a user's PATs. Pages are ordered by SortBy,
+// then by ID, so page tokens stay valid when PATs are created or deleted
+// between requests.
+type ListQuery struct {
+	Filter ListFilter
+	// SortBy defaults to SortByCreatedAt.
+	SortBy     SortField
+	Descending bool
+	// PageSize defaults to DefaultPageSize and is capped at MaxPageSize.
+	PageSize int
+	// PageToken is the NextPageToken of the previous page; empty selects the
+	// first page.
+	PageToken string
+}
+
+// Page is one page of ListPATs.
+type Page struct {
+	PATs          []*PAT
+	NextPageToken string
+	// TotalSize counts the PATs matching the filter across all pages.
+	TotalSize int
+}
+
+// cursor is the decoded page token: the sort position of the last PAT of the
+// previous page.
+type cursor struct {
+	SortBy     SortField `json:"s"`
+	Descending bool      `json:"d"`
+	Key        int64     `json:"k"`
+	ID         string    `json:"i"`
+}
+
+// apply filters, sorts and pages pats.
+func (q ListQuery) apply(pats []*PAT, now time.Time) (*Page, error) {
+	sortBy := cmp.Or(q.SortBy, SortByCreatedAt)
+	if sortBy != SortByCreatedAt && sortBy != SortByExpirationDate {
+		return nil, fmt.Errorf("%w: unknown sort field %q", ErrInvalidListQuery, q.SortBy)
+	}
+	if q.PageSize < 0 {
+		return nil, fmt.Errorf("%w: page size must not be negative", ErrInvalidListQuery)
+	}
+	pageSize := min(cmp.Or(q.PageSize, DefaultPageSize), MaxPageSize)
+
+	matched := slices.DeleteFunc(slices.Clone(pats), func(p *PAT) bool {
+		return !q.Filter.matches(p, now)
+	})
+
+	// compare orders the position (key, id) against p.
+	compare := func(key int64, id string, p *PAT) int {
+		c := cmp.Or(cmp.Compare(key, sortKey(p, sortBy)), strings.Compare(id, p.ID))
+		if q.Descending {
+			return -c
+		}
+		return c
+	}
+	slices.SortFunc(matched, func(a, b *PAT) int {
+		return compare(sortKey(a, sortBy), a.ID, b)
+	})
+
+	start := 0
+	if q.PageToken != "" {
+		after, err := decodeCursor(q.PageToken)
+		if err != nil {
+			return nil, err
+		}
+		if after.SortBy != sortBy || after.Descending != q.Descending {
+			return nil, fmt.Errorf("%w: page token belongs to a different sort order", ErrInvalidListQuery)
+		}
+		start, _ = slices.BinarySearchFunc(matched, after, func(p *PAT, c cursor) int {
+			return -compare(c.Key, c.ID, p)
+		})
+		// Skip the PAT the cursor points at, if it still exists.
+		if start < len(matched) && compare(after.Key, after.ID, matched[start]) == 0 {
+			start++
+		}
+	}
+
+	end := min(start+pageSize, len(matched))
+	page := &Page{PATs: matched[start:end], TotalSize: len(matched)}
+	if end < len(matched) {
+		last := matched[end-1]
+		page.NextPageToken = encodeCursor(cursor{
+			SortBy:     sortBy,
+			Descending: q.Descending,
+			Key:        sortKey(last, sortBy),
+			ID:         last.ID,
+		})
+	}
+	return page, nil
+}
+
+func (f ListFilter) matches(p *PAT, now time.Time) bool {
+	expired := !p.ExpirationDate.IsZero() && !p.ExpirationDate.After(now)
+	if f.Expired != nil && *f.Expired != expired {
+		return false
+	}
+	if !f.ExpiringBefore.IsZero() && (p.ExpirationDate.IsZero() || !p.ExpirationDate.Before(f.ExpiringBefore)) {
+		return false
+	}
+	if !f.CreatedAfter.IsZero() && !p.CreatedAt.After(f.CreatedAfter) {
+		return false
+	}
+	return true
+}
+
+func sortKey(p *PAT, sortBy SortField) int64 {
+	t := p.CreatedAt
+	if sortBy == SortByExpirationDate {
+		t = p.ExpirationDate
+	}
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixNano()
+}
+
+func encodeCursor(c cursor) string {
+	data, _ := json.Marshal(c) // A cursor always marshals.
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(token string) (cursor, error) {
+	var c cursor
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err == nil {
+		err = json.Unmarshal(data, &c)
+	}
+	if err != nil || c.ID == "" {
+		return cursor{}, fmt.Errorf("%w: malformed page token", ErrInvalidListQuery)
+	}
+	return c, nil
+}
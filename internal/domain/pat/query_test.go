@@ -0,0 +1,133 @@
+package pat_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/astro-web3/oauth2-token-exchange/internal/domain/pat"
+	"github.com/astro-web3/oauth2-token-exchange/internal/infra/zitadel"
+	"github.com/astro-web3/oauth2-token-exchange/pkg/secret"
+)
+
+// newQueryService returns a service for user-1 with PATs pat-0 to pat-6,
+// created one day apart. pat-0 and pat-1 are expired.
+func newQueryService() pat.Service {
+	now := time.Now()
+	client := &fakeZitadelClient{
+		machineUsers: []*zitadel.MachineUser{{ID: "machine-1", Username: "user-1"}},
+		pats:         map[string][]*zitadel.PersonalAccessToken{},
+	}
+	for i := range 7 {
+		created := now.Add(time.Duration(i-7) * day)
+		client.pats["machine-1"] = append(client.pats["machine-1"], &zitadel.PersonalAccessToken{
+			ID:             fmt.Sprintf("pat-%d", i),
+			CreatedAt:      created,
+			ExpirationDate: created.Add(6*day - time.Hour),
+		})
+	}
+	return pat.NewService(client, zitadel.NewStaticTokenSource(secret.Static("admin-pat")))
+}
+
+func ids(pats []*pat.PAT) []string {
+	out := make([]string, 0, len(pats))
+	for _, p := range pats {
+		out = append(out, p.ID)
+	}
+	return out
+}
+
+func TestService_ListPATs_Pagination(t *testing.T) {
+	ctx := context.Background()
+	svc := newQueryService()
+
+	var got []string
+	query := pat.ListQuery{SortBy: pat.SortByExpirationDate, Descending: true, PageSize: 3}
+	for pages := 0; ; pages++ {
+		if pages > 3 {
+			t.Fatal("pagination did not terminate")
+		}
+		page, err := svc.ListPATs(ctx, "user-1", query)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if page.TotalSize != 7 {
+			t.Errorf("expected total size 7, got %d", page.TotalSize)
+		}
+		got = append(got, ids(page.PATs)...)
+		if page.NextPageToken == "" {
+			break
+		}
+		query.PageToken = page.NextPageToken
+	}
+
+	want := []string{"pat-6", "pat-5", "pat-4", "pat-3", "pat-2", "pat-1", "pat-0"}
+	if !slices.Equal(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+}
+
+func TestService_ListPATs_Filter(t *testing.T) {
+	ctx := context.Background()
+	expired, unexpired := true, false
+	now := time.Now()
+
+	tests := []struct {
+		name   string
+		filter pat.ListFilter
+		want   []string
+	}{
+		{"expired", pat.ListFilter{Expired: &expired}, []string{"pat-0", "pat-1"}},
+		{"unexpired", pat.ListFilter{Expired: &unexpired}, []string{"pat-2", "pat-3", "pat-4", "pat-5", "pat-6"}},
+		{"expiring before", pat.ListFilter{Expired: &unexpired, ExpiringBefore: now.Add(2 * day)},
+			[]string{"pat-2", "pat-3"}},
+		{"created after", pat.ListFilter{CreatedAfter: now.Add(-3*day + time.Hour)}, []string{"pat-5", "pat-6"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page, err := newQueryService().ListPATs(ctx, "user-1", pat.ListQuery{Filter: tt.filter})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := ids(page.PATs); !slices.Equal(got, tt.want) {
+				t.Errorf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestService_ListPATs_InvalidQuery(t *testing.T) {
+	ctx := context.Background()
+	svc := newQueryService()
+
+	first, err := svc.ListPATs(ctx, "user-1", pat.ListQuery{PageSize: 2})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for name, query := range map[string]pat.ListQuery{
+		"malformed token":    {PageToken: "not-a-token"},
+		"changed sort order": {PageToken: first.NextPageToken, Descending: true},
+		"unknown sort field": {SortBy: "name"},
+	} {
+		if _, err = svc.ListPATs(ctx, "user-1", query); !errors.Is(err, pat.ErrInvalidListQuery) {
+			t.Errorf("%s: expected ErrInvalidListQuery, got %v", name, err)
+		}
+	}
+}
+
+func TestService_GetPAT(t *testing.T) {
+	svc := newQueryService()
+
+	got, err := svc.GetPAT(context.Background(), "user-1", "pat-3")
+	if err != nil || got.ID != "pat-3" || got.MachineUserID != "machine-1" {
+		t.Fatalf("unexpected result: %+v, %v", got, err)
+	}
+	if _, err = svc.GetPAT(context.Background(), "user-1", "pat-missing"); !errors.Is(err, pat.ErrPATNotFound) {
+		t.Errorf("expected ErrPATNotFound, got %v", err)
+	}
+}
@@ -0,0 +1,185 @@
+package pat
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"time"
+
+	"github.com/astro-web3/oauth2-token-exchange/internal/infra/zitadel"
+	"github.com/astro-web3/oauth2-token-exchange/pkg/logger"
+)
+
+// reminderKeyTTLMargin keeps a sent-reminder marker a little past the PAT's
+// expiration, so clock skew between replicas cannot cause a second reminder.
+const reminderKeyTTLMargin = 24 * time.Hour
+
+// ExpiryReminder asks the owner of a PAT to rotate it before it expires.
+// Window is the reminder window the PAT has entered, e.g. 72h.
+type ExpiryReminder struct {
+	PAT    *PAT
+	Email  string
+	Window time.Duration
+}
+
+// ReminderSender delivers expiry reminders, e.g. by email or webhook.
+type ReminderSender interface {
+	SendReminder(ctx context.Context, reminder ExpiryReminder) error
+}
+
+// ExpiryScanner periodically looks for PATs of the organization's machine
+// users that expire within one of the configured windows and sends a reminder
+// to the owning user. The owner's email is the machine user's description,
+// as set when the machine user is created for them.
+type ExpiryScanner struct {
+	zitadelClient zitadel.Client
+	adminTokens   zitadel.AdminTokenSource
+	ledger        Ledger
+	senders       []ReminderSender
+	windows       []time.Duration
+	loop          *periodic
+}
+
+func NewExpiryScanner(
+	zitadelClient zitadel.Client,
+	adminTokens zitadel.AdminTokenSource,
+	ledger Ledger,
+	senders []ReminderSender,
+	windows []time.Duration,
+	interval time.Duration,
+) *ExpiryScanner {
+	windows = slices.Clone(windows)
+	slices.Sort(windows)
+
+	s := &ExpiryScanner{
+		zitadelClient: zitadelClient,
+		adminTokens:   adminTokens,
+		ledger:        ledger,
+		senders:       senders,
+		windows:       windows,
+	}
+	s.loop = newPeriodic(interval, func(ctx context.Context) {
+		if err := s.Scan(ctx); err != nil && ctx.Err() == nil {
+			logger.ErrorContext(ctx, "PAT expiry scan failed", slog.String("error", err.Error()))
+		}
+	})
+	return s
+}
+
+// Start scans immediately and then every interval until Close is called.
+func (s *ExpiryScanner) Start() {
+	s.loop.start()
+}
+
+// Close stops the scanner and waits for a running scan to finish.
+func (s *ExpiryScanner) Close() error {
+	s.loop.close()
+	return nil
+}
+
+// Scan sends the reminders that are due now. Failures for single PATs are
+// logged and retried on the next scan.
+func (s *ExpiryScanner) Scan(ctx context.Context) error {
+	if s.adminTokens == nil {
+		return ErrAdminCredentialsNotSet
+	}
+	adminToken, err := s.adminTokens.Token(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to obtain admin token: %w", err)
+	}
+
+	machineUsers, err := s.zitadelClient.ListMachineUsers(ctx, adminToken)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	var errs []error
+	for _, mu := range machineUsers {
+		owner, own := ownMachineUser(mu)
+		if !own {
+			continue
+		}
+
+		zitadelPATs, listErr := s.zitadelClient.ListPersonalAccessTokens(ctx, adminToken, owner.ID)
+		if listErr != nil {
+			errs = append(errs, listErr)
+			continue
+		}
+
+		for _, zp := range zitadelPATs {
+			window, ok := s.window(zp.ExpirationDate.Sub(now))
+			if !ok {
+				continue
+			}
+			s.remind(ctx, ExpiryReminder{
+				PAT: &PAT{
+					ID:             zp.ID,
+					MachineUserID:  owner.ID,
+					HumanUserID:    owner.UserID,
+					ExpirationDate: zp.ExpirationDate,
+					CreatedAt:      zp.CreatedAt,
+				},
+				Email:  owner.Email,
+				Window: window,
+			})
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// window returns the smallest configured window the remaining lifetime falls
+// into. Expired PATs and PATs without an expiration date get no reminder.
+func (s *ExpiryScanner) window(remaining time.Duration) (time.Duration, bool) {
+	if remaining <= 0 {
+		return 0, false
+	}
+	for _, w := range s.windows {
+		if remaining <= w {
+			return w, true
+		}
+	}
+	return 0, false
+}
+
+func (s *ExpiryScanner) remind(ctx context.Context, reminder ExpiryReminder) {
+	key := fmt.Sprintf("pat-reminder:%s:%s", reminder.PAT.ID, reminder.Window)
+	ttl := time.Until(reminder.PAT.ExpirationDate) + reminderKeyTTLMargin
+
+	claimed, err := s.ledger.Claim(ctx, key, ttl)
+	if err != nil || !claimed {
+		if err != nil {
+			logger.WarnContext(ctx, "failed to claim PAT reminder", slog.String("error", err.Error()))
+		}
+		return
+	}
+
+	var errs []error
+	for _, sender := range s.senders {
+		if sendErr := sender.SendReminder(ctx, reminder); sendErr != nil {
+			errs = append(errs, sendErr)
+		}
+	}
+	if err = errors.Join(errs...); err == nil {
+		logger.InfoContext(ctx, "sent PAT expiry reminder",
+			slog.String("pat_id", reminder.PAT.ID),
+			slog.String("user_id", reminder.PAT.HumanUserID),
+			slog.Duration("window", reminder.Window),
+		)
+		return
+	}
+
+	logger.ErrorContext(ctx, "failed to send PAT expiry reminder",
+		slog.String("pat_id", reminder.PAT.ID),
+		slog.String("error", err.Error()),
+	)
+	if len(errs) == len(s.senders) {
+		// Nothing was delivered; try again on the next scan.
+		if releaseErr := s.ledger.Release(ctx, key); releaseErr != nil {
+			logger.WarnContext(ctx, "failed to release PAT reminder", slog.String("error", releaseErr.Error()))
+		}
+	}
+}
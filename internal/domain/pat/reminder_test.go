@@ -0,0 +1,103 @@
+package pat_test
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/astro-web3/oauth2-token-exchange/internal/domain/pat"
+	"github.com/astro-web3/oauth2-token-exchange/internal/infra/cache"
+	"github.com/astro-web3/oauth2-token-exchange/internal/infra/zitadel"
+	"github.com/astro-web3/oauth2-token-exchange/pkg/secret"
+)
+
+type fakeZitadelClient struct {
+	zitadel.Client
+
+	mu           sync.Mutex
+	machineUsers []*zitadel.MachineUser
+	pats         map[string][]*zitadel.PersonalAccessToken
+	listDelay    time.Duration
+}
+
+func (f *fakeZitadelClient) ListMachineUsers(context.Context, string) ([]*zitadel.MachineUser, error) {
+	return f.machineUsers, nil
+}
+
+func (f *fakeZitadelClient) ListPersonalAccessTokens(
+	_ context.Context,
+	_, userID string,
+) ([]*zitadel.PersonalAccessToken, error) {
+	f.mu.Lock()
+	pats := slices.Clone(f.pats[userID])
+	f.mu.Unlock()
+
+	time.Sleep(f.listDelay)
+	return pats, nil
+}
+
+type recordingSender struct {
+	reminders []pat.ExpiryReminder
+}
+
+func (r *recordingSender) SendReminder(_ context.Context, reminder pat.ExpiryReminder) error {
+	r.reminders = append(r.reminders, reminder)
+	return nil
+}
+
+func TestExpiryScanner_SendsOncePerWindow(t *testing.T) {
+	now := time.Now()
+	client := &fakeZitadelClient{
+		machineUsers: []*zitadel.MachineUser{
+			{ID: "machine-1", Username: "user-1", Description: "oauth2-token-exchange:user-1@example.com"},
+			// Machine users of other integrations are not reminded.
+			{ID: "machine-2", Username: "ci-deployer", Description: "deploys from CI"},
+			// Created before the marker was introduced.
+			{ID: "machine-3", Username: "user-3", Description: "user-3@example.com"},
+		},
+		pats: map[string][]*zitadel.PersonalAccessToken{
+			"machine-1": {
+				{ID: "pat-soon", ExpirationDate: now.Add(48 * time.Hour)},
+				{ID: "pat-later", ExpirationDate: now.Add(10 * 24 * time.Hour)},
+				{ID: "pat-far", ExpirationDate: now.Add(60 * 24 * time.Hour)},
+				{ID: "pat-expired", ExpirationDate: now.Add(-time.Hour)},
+			},
+			"machine-2": {{ID: "pat-foreign", ExpirationDate: now.Add(48 * time.Hour)}},
+			"machine-3": {{ID: "pat-legacy", ExpirationDate: now.Add(20 * time.Hour)}},
+		},
+	}
+	sender := &recordingSender{}
+	scanner := pat.NewExpiryScanner(
+		client,
+		zitadel.NewStaticTokenSource(secret.Static("admin-pat")),
+		cache.NewMemoryLedger(),
+		[]pat.ReminderSender{sender},
+		[]time.Duration{14 * 24 * time.Hour, 72 * time.Hour, 24 * time.Hour},
+		time.Hour,
+	)
+
+	for range 2 {
+		if err := scanner.Scan(context.Background()); err != nil {
+			t.Fatalf("scan failed: %v", err)
+		}
+	}
+
+	want := map[string]time.Duration{
+		"pat-soon":   72 * time.Hour,
+		"pat-later":  14 * 24 * time.Hour,
+		"pat-legacy": 24 * time.Hour,
+	}
+	if len(sender.reminders) != len(want) {
+		t.Fatalf("expected %d reminders across two scans, got %+v", len(want), sender.reminders)
+	}
+	for _, r := range sender.reminders {
+		if want[r.PAT.ID] != r.Window {
+			t.Errorf("unexpected window %s for %s", r.Window, r.PAT.ID)
+		}
+		if owner := r.PAT.HumanUserID; r.Email != owner+"@example.com" || r.PAT.MachineUserID == "machine-2" {
+			t.Errorf("unexpected owner for %s: %+v", r.PAT.ID, r)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package pat
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/astro-web3/oauth2-token-exchange/internal/infra/zitadel"
+	"github.com/astro-web3/oauth2-token-exchange/pkg/logger"
+)
+
+const (
+	// deletionBatchSize caps the deletions one worker run claims.
+	deletionBatchSize = 100
+	// deletionLease is how long a claimed deletion stays hidden from other
+	// replicas. Deletions that were not completed by then are retried.
+	deletionLease = 5 * time.Minute
+)
+
+// Rotation is the result of RotatePAT. Old keeps working until OldDeleteAt.
+type Rotation struct {
+	Old         *PAT
+	New         *PAT
+	OldDeleteAt time.Time
+}
+
+// ScheduledDeletion is a rotated PAT waiting for its grace period to end.
+type ScheduledDeletion struct {
+	PATID         string    `json:"pat_id"`
+	MachineUserID string    `json:"machine_user_id"`
+	UserID        string    `json:"user_id"`
+	DeleteAt      time.Time `json:"-"`
+}
+
+// DeletionQueue stores scheduled deletions until they are due. Deletions stay
+// in the queue until completed, so a crash between Claim and Complete only
+// delays them.
+type DeletionQueue interface {
+	// Schedule returns ErrAlreadyRotated if the PAT already has a deletion
+	// scheduled, so that a PAT can only be rotated once.
+	Schedule(ctx context.Context, deletion ScheduledDeletion) error
+	// Claim returns up to limit deletions that are due at now and hides them
+	// from other callers for lease.
+	Claim(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]ScheduledDeletion, error)
+	// Complete removes a deletion from the queue.
+	Complete(ctx context.Context, deletion ScheduledDeletion) error
+}
+
+// DeletionWorker periodically deletes rotated PATs whose grace period has
+// ended.
+type DeletionWorker struct {
+	zitadelClient zitadel.Client
+	adminTokens   zitadel.AdminTokenSource
+	queue         DeletionQueue
+	loop          *periodic
+}
+
+func NewDeletionWorker(
+	zitadelClient zitadel.Client,
+	adminTokens zitadel.AdminTokenSource,
+	queue DeletionQueue,
+	interval time.Duration,
+) *DeletionWorker {
+	w := &DeletionWorker{
+		zitadelClient: zitadelClient,
+		adminTokens:   adminTokens,
+		queue:         queue,
+	}
+	w.loop = newPeriodic(interval, func(ctx context.Context) {
+		if err := w.Run(ctx); err != nil && ctx.Err() == nil {
+			logger.ErrorContext(ctx, "scheduled PAT deletion failed", slog.String("error", err.Error()))
+		}
+	})
+	return w
+}
+
+// Start runs immediately and then every interval until Close is called.
+func (w *DeletionWorker) Start() {
+	w.loop.start()
+}
+
+// Close stops the worker and waits for a running batch to finish.
+func (w *DeletionWorker) Close() error {
+	w.loop.close()
+	return nil
+}
+
+// Run deletes the PATs that are due now. Failed deletions stay queued and are
+// retried once their lease ends.
+func (w *DeletionWorker) Run(ctx context.Context) error {
+	deletions, err := w.queue.Claim(ctx, time.Now(), deletionLease, deletionBatchSize)
+	if err != nil || len(deletions) == 0 {
+		return err
+	}
+
+	if w.adminTokens == nil {
+		return ErrAdminCredentialsNotSet
+	}
+	adminToken, err := w.adminTokens.Token(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to obtain admin token: %w", err)
+	}
+
+	var errs []error
+	for _, d := range deletions {
+		err = w.zitadelClient.RemovePersonalAccessToken(ctx, adminToken, d.MachineUserID, d.PATID)
+		if err != nil && !errors.Is(err, zitadel.ErrNotFound) {
+			errs = append(errs, fmt.Errorf("delete PAT %s: %w", d.PATID, err))
+			continue
+		}
+		if err = w.queue.Complete(ctx, d); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		logger.InfoContext(ctx, "deleted rotated PAT",
+			slog.String("pat_id", d.PATID),
+			slog.String("user_id", d.UserID),
+		)
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,180 @@
+package pat_test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/astro-web3/oauth2-token-exchange/internal/domain/pat"
+	"github.com/astro-web3/oauth2-token-exchange/internal/infra/cache"
+	"github.com/astro-web3/oauth2-token-exchange/internal/infra/zitadel"
+	"github.com/astro-web3/oauth2-token-exchange/pkg/secret"
+)
+
+func (f *fakeZitadelClient) RemovePersonalAccessToken(_ context.Context, _, userID, patID string) error {
+	idx := slices.IndexFunc(f.pats[userID], func(p *zitadel.PersonalAccessToken) bool { return p.ID == patID })
+	if idx < 0 {
+		return zitadel.ErrNotFound
+	}
+	f.pats[userID] = slices.Delete(f.pats[userID], idx, idx+1)
+	return nil
+}
+
+func newRotationFixture() (*fakeZitadelClient, pat.DeletionQueue, pat.Service) {
+	created := time.Now().Add(-10 * day)
+	client := &fakeZitadelClient{
+		machineUsers: []*zitadel.MachineUser{{ID: "machine-1", Username: "user-1"}},
+		pats: map[string][]*zitadel.PersonalAccessToken{
+			"machine-1": {{ID: "pat-old", UserID: "machine-1", CreatedAt: created, ExpirationDate: created.Add(30 * day)}},
+		},
+	}
+	queue := cache.NewMemoryDeletionQueue()
+	svc := pat.NewService(client, zitadel.NewStaticTokenSource(secret.Static("admin-pat")),
+		pat.WithPolicy(pat.Policy{RotationGracePeriod: time.Hour, MaxRotationGracePeriod: day}),
+		pat.WithDeletionQueue(queue))
+	return client, queue, svc
+}
+
+func patIDs(client *fakeZitadelClient) []string {
+	var ids []string
+	for _, p := range client.pats["machine-1"] {
+		ids = append(ids, p.ID)
+	}
+	return ids
+}
+
+func TestService_RotatePAT(t *testing.T) {
+	ctx := context.Background()
+	client, queue, svc := newRotationFixture()
+
+	rotation, token, err := svc.RotatePAT(ctx, "user-1", "pat-old", nil, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if token == "" || rotation.New.ID != "pat-new" || rotation.Old.ID != "pat-old" {
+		t.Fatalf("unexpected rotation: %+v", rotation)
+	}
+	if lifetime := time.Until(rotation.New.ExpirationDate); lifetime < 29*day || lifetime > 30*day {
+		t.Errorf("expected the old lifetime of 30 days, got %s", lifetime)
+	}
+	if wait := time.Until(rotation.OldDeleteAt); wait < 59*time.Minute || wait > time.Hour {
+		t.Errorf("expected the default grace period of 1h, got %s", wait)
+	}
+
+	// Both PATs work during the grace period.
+	worker := pat.NewDeletionWorker(client, zitadel.NewStaticTokenSource(secret.Static("admin-pat")),
+		queue, time.Minute)
+	if err = worker.Run(ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := patIDs(client); !slices.Equal(got, []string{"pat-old", "pat-new"}) {
+		t.Errorf("expected both PATs during the grace period, got %v", got)
+	}
+
+	deletions, err := queue.Claim(ctx, rotation.OldDeleteAt, time.Minute, 10)
+	if err != nil || len(deletions) != 1 || deletions[0].PATID != "pat-old" {
+		t.Fatalf("expected the old PAT to be scheduled, got %+v, %v", deletions, err)
+	}
+}
+
+func TestService_RotatePAT_GracePeriod(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name     string
+		grace    time.Duration
+		wantErr  error
+		wantPATs []string
+	}{
+		{"immediate deletion", 0, nil, []string{"pat-new"}},
+		{"custom grace period", 2 * time.Hour, nil, []string{"pat-old", "pat-new"}},
+		{"above maximum", 2 * day, pat.ErrInvalidGracePeriod, []string{"pat-old"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, _, svc := newRotationFixture()
+			_, _, err := svc.RotatePAT(ctx, "user-1", "pat-old", nil, &tt.grace)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+			if got := patIDs(client); !slices.Equal(got, tt.wantPATs) {
+				t.Errorf("expected PATs %v, got %v", tt.wantPATs, got)
+			}
+		})
+	}
+}
+
+func TestService_RotatePAT_WithoutDeletionQueue(t *testing.T) {
+	ctx := context.Background()
+	client, _, _ := newRotationFixture()
+	svc := pat.NewService(client, zitadel.NewStaticTokenSource(secret.Static("admin-pat")),
+		pat.WithPolicy(pat.Policy{RotationGracePeriod: time.Hour}))
+
+	if _, _, err := svc.RotatePAT(ctx, "user-1", "pat-old", nil, nil); !errors.Is(err, pat.ErrDeletionQueueNotSet) {
+		t.Fatalf("expected ErrDeletionQueueNotSet, got %v", err)
+	}
+	if got := patIDs(client); !slices.Equal(got, []string{"pat-old"}) {
+		t.Errorf("expected the rejected rotation to leave the PATs alone, got %v", got)
+	}
+
+	immediate := time.Duration(0)
+	if _, _, err := svc.RotatePAT(ctx, "user-1", "pat-old", nil, &immediate); err != nil {
+		t.Fatalf("expected a rotation without grace period to succeed, got %v", err)
+	}
+}
+
+func TestService_RotatePAT_AlreadyRotated(t *testing.T) {
+	ctx := context.Background()
+	client, _, svc := newRotationFixture()
+
+	if _, _, err := svc.RotatePAT(ctx, "user-1", "pat-old", nil, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// The old PAT still works during its grace period, but rotating it again
+	// would mint replacements that are never deleted.
+	if _, _, err := svc.RotatePAT(ctx, "user-1", "pat-old", nil, nil); !errors.Is(err, pat.ErrAlreadyRotated) {
+		t.Fatalf("expected ErrAlreadyRotated, got %v", err)
+	}
+	if got := patIDs(client); !slices.Equal(got, []string{"pat-old", "pat-new"}) {
+		t.Errorf("expected the second replacement to be removed, got %v", got)
+	}
+}
+
+func TestService_RotatePAT_NotFound(t *testing.T) {
+	_, _, svc := newRotationFixture()
+	if _, _, err := svc.RotatePAT(context.Background(), "user-1", "pat-missing", nil, nil); !errors.Is(
+		err, pat.ErrPATNotFound) {
+		t.Errorf("expected ErrPATNotFound, got %v", err)
+	}
+}
+
+func TestDeletionWorker_Run(t *testing.T) {
+	ctx := context.Background()
+	client, queue, _ := newRotationFixture()
+
+	past := time.Now().Add(-time.Minute)
+	for _, id := range []string{"pat-old", "pat-already-deleted"} {
+		err := queue.Schedule(ctx, pat.ScheduledDeletion{PATID: id, MachineUserID: "machine-1", DeleteAt: past})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	worker := pat.NewDeletionWorker(client, zitadel.NewStaticTokenSource(secret.Static("admin-pat")),
+		queue, time.Minute)
+	if err := worker.Run(ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if got := patIDs(client); len(got) != 0 {
+		t.Errorf("expected the due PAT to be deleted, got %v", got)
+	}
+	// PATs deleted in the meantime are completed, not retried.
+	deletions, err := queue.Claim(ctx, time.Now().Add(time.Hour), time.Minute, 10)
+	if err != nil || len(deletions) != 0 {
+		t.Errorf("expected an empty queue, got %+v, %v", deletions, err)
+	}
+}
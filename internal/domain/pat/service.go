@@ -6,13 +6,30 @@ import (
 )
 
 type Service interface {
+	// CreatePAT creates a PAT within the limits of the policy for the user's
+	// groups. A zero expirationDate selects the policy's default lifetime.
 	CreatePAT(
 		ctx context.Context,
 		userID, email, preferredUsername string,
+		groups []string,
 		expirationDate time.Time,
 	) (*PAT, string, error)
 
-	ListPATs(ctx context.Context, userID string) ([]*PAT, error)
+	// GetPAT returns one of the user's PATs, or ErrPATNotFound.
+	GetPAT(ctx context.Context, userID, patID string) (*PAT, error)
+
+	// ListPATs returns one page of the user's PATs matching query.
+	ListPATs(ctx context.Context, userID string, query ListQuery) (*Page, error)
 
 	DeletePAT(ctx context.Context, userID, patID string) error
+
+	// RotatePAT creates a replacement for patID with the same lifetime and
+	// deletes patID once the grace period has passed. A nil gracePeriod
+	// selects the policy's default; zero deletes patID right away.
+	RotatePAT(
+		ctx context.Context,
+		userID, patID string,
+		groups []string,
+		gracePeriod *time.Duration,
+	) (*Rotation, string, error)
 }
@@ -5,40 +5,132 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
+	"slices"
+	"strconv"
 	"time"
 
+	"github.com/astro-web3/oauth2-token-exchange/internal/domain/audit"
 	"github.com/astro-web3/oauth2-token-exchange/internal/infra/zitadel"
 	"github.com/astro-web3/oauth2-token-exchange/pkg/logger"
 )
 
 type service struct {
 	zitadelClient zitadel.Client
-	adminPAT      string
+	adminTokens   zitadel.AdminTokenSource
+	auditor       audit.Recorder
+	policy        Policy
+	deletions     DeletionQueue
+	creations     Ledger
 }
 
-func NewService(zitadelClient zitadel.Client, adminPAT string) Service {
-	return &service{
+// ServiceOption configures optional collaborators of the PAT service.
+type ServiceOption func(*service)
+
+// WithAuditor records an audit event for every create, list and delete,
+// whether it succeeds or fails.
+func WithAuditor(auditor audit.Recorder) ServiceOption {
+	return func(s *service) {
+		s.auditor = auditor
+	}
+}
+
+// WithPolicy enforces lifetime and quota limits on created PATs.
+func WithPolicy(policy Policy) ServiceOption {
+	return func(s *service) {
+		s.policy = policy
+	}
+}
+
+// WithDeletionQueue schedules the deletion of rotated PATs. Without it,
+// rotations with a grace period fail.
+func WithDeletionQueue(queue DeletionQueue) ServiceOption {
+	return func(s *service) {
+		s.deletions = queue
+	}
+}
+
+// WithCreationLock serializes the PAT creations of each user through lock, so
+// concurrent requests cannot exceed the active PAT quota. Without it, the
+// quota is a soft limit.
+func WithCreationLock(lock Ledger) ServiceOption {
+	return func(s *service) {
+		s.creations = lock
+	}
+}
+
+func NewService(zitadelClient zitadel.Client, adminTokens zitadel.AdminTokenSource, opts ...ServiceOption) Service {
+	return newService(zitadelClient, adminTokens, opts...)
+}
+
+func newService(zitadelClient zitadel.Client, adminTokens zitadel.AdminTokenSource, opts ...ServiceOption) *service {
+	s := &service{
 		zitadelClient: zitadelClient,
-		adminPAT:      adminPAT,
+		adminTokens:   adminTokens,
+		auditor:       audit.Nop(),
+	}
+	for _, opt := range opts {
+		opt(s)
 	}
+	return s
 }
 
 func (s *service) CreatePAT(
 	ctx context.Context,
 	userID, email, preferredUsername string,
+	groups []string,
+	expirationDate time.Time,
+) (*PAT, string, error) {
+	pat, token, err := s.createPAT(ctx, userID, email, preferredUsername, groups, expirationDate)
+
+	details := map[string]string{}
+	if !expirationDate.IsZero() {
+		details["requested_expiration_date"] = expirationDate.UTC().Format(time.RFC3339)
+	}
+	var patID string
+	if pat != nil {
+		patID = pat.ID
+		details["machine_user_id"] = pat.MachineUserID
+		details["expiration_date"] = pat.ExpirationDate.UTC().Format(time.RFC3339)
+	}
+	s.record(ctx, audit.EventPATCreated, userID, patID, err, details)
+
+	return pat, token, err
+}
+
+func (s *service) createPAT(
+	ctx context.Context,
+	userID, email, preferredUsername string,
+	groups []string,
 	expirationDate time.Time,
 ) (*PAT, string, error) {
-	if expirationDate.Before(time.Now()) {
-		return nil, "", ErrInvalidExpiration
+	now := time.Now()
+	limits := s.policy.LimitsFor(groups)
+	expirationDate, err := s.policy.expiration(expirationDate, limits, now)
+	if err != nil {
+		return nil, "", err
 	}
 
-	machineUser, err := s.zitadelClient.GetMachineUserByUsername(ctx, s.adminPAT, userID)
+	adminToken, err := s.adminToken(ctx)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if limits.MaxActivePATs > 0 {
+		unlock, lockErr := s.lockCreation(ctx, userID)
+		if lockErr != nil {
+			return nil, "", lockErr
+		}
+		defer unlock()
+	}
+
+	machineUser, err := s.zitadelClient.GetMachineUserByUsername(ctx, adminToken, userID)
 	if err != nil {
 		return nil, "", fmt.Errorf("failed to get user by username: %w", err)
 	}
 
 	if machineUser == nil {
-		machineUser, err = s.zitadelClient.CreateMachineUser(ctx, s.adminPAT, userID, preferredUsername, email)
+		machineUser, err = s.zitadelClient.CreateMachineUser(
+			ctx, adminToken, userID, preferredUsername, machineUserDescription(email))
 		if err != nil {
 			return nil, "", fmt.Errorf("failed to create machine user: %w", err)
 		}
@@ -52,7 +144,11 @@ func (s *service) CreatePAT(
 		return nil, "", errors.New("machine user is nil or has empty ID after get/create")
 	}
 
-	zitadelPAT, token, err := s.zitadelClient.AddPersonalAccessToken(ctx, s.adminPAT, machineUser.ID, expirationDate)
+	if err = s.checkQuota(ctx, adminToken, machineUser.ID, limits, now); err != nil {
+		return nil, "", err
+	}
+
+	zitadelPAT, token, err := s.zitadelClient.AddPersonalAccessToken(ctx, adminToken, machineUser.ID, expirationDate)
 	if err != nil {
 		return nil, "", err
 	}
@@ -66,8 +162,51 @@ func (s *service) CreatePAT(
 	}, token, nil
 }
 
-func (s *service) ListPATs(ctx context.Context, userID string) ([]*PAT, error) {
-	machineUser, err := s.zitadelClient.GetMachineUserByUsername(ctx, s.adminPAT, userID)
+func (s *service) GetPAT(ctx context.Context, userID, patID string) (*PAT, error) {
+	pat, err := s.getPAT(ctx, userID, patID)
+	s.record(ctx, audit.EventPATsListed, userID, patID, err, nil)
+	return pat, err
+}
+
+func (s *service) getPAT(ctx context.Context, userID, patID string) (*PAT, error) {
+	pats, err := s.listPATs(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	idx := slices.IndexFunc(pats, func(p *PAT) bool { return p.ID == patID })
+	if idx < 0 {
+		return nil, ErrPATNotFound
+	}
+	return pats[idx], nil
+}
+
+func (s *service) ListPATs(ctx context.Context, userID string, query ListQuery) (*Page, error) {
+	page, err := s.queryPATs(ctx, userID, query)
+
+	var count int
+	if page != nil {
+		count = len(page.PATs)
+	}
+	s.record(ctx, audit.EventPATsListed, userID, "", err, map[string]string{detailCount: strconv.Itoa(count)})
+
+	return page, err
+}
+
+func (s *service) queryPATs(ctx context.Context, userID string, query ListQuery) (*Page, error) {
+	pats, err := s.listPATs(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return query.apply(pats, time.Now())
+}
+
+func (s *service) listPATs(ctx context.Context, userID string) ([]*PAT, error) {
+	adminToken, err := s.adminToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	machineUser, err := s.zitadelClient.GetMachineUserByUsername(ctx, adminToken, userID)
 	if err != nil {
 		return nil, err
 	}
@@ -76,7 +215,7 @@ func (s *service) ListPATs(ctx context.Context, userID string) ([]*PAT, error) {
 		return []*PAT{}, nil
 	}
 
-	zitadelPATs, err := s.zitadelClient.ListPersonalAccessTokens(ctx, s.adminPAT, machineUser.ID)
+	zitadelPATs, err := s.zitadelClient.ListPersonalAccessTokens(ctx, adminToken, machineUser.ID)
 	if err != nil {
 		return nil, err
 	}
@@ -96,7 +235,18 @@ func (s *service) ListPATs(ctx context.Context, userID string) ([]*PAT, error) {
 }
 
 func (s *service) DeletePAT(ctx context.Context, userID, patID string) error {
-	machineUser, err := s.zitadelClient.GetMachineUserByUsername(ctx, s.adminPAT, userID)
+	err := s.deletePAT(ctx, userID, patID)
+	s.record(ctx, audit.EventPATDeleted, userID, patID, err, nil)
+	return err
+}
+
+func (s *service) deletePAT(ctx context.Context, userID, patID string) error {
+	adminToken, err := s.adminToken(ctx)
+	if err != nil {
+		return err
+	}
+
+	machineUser, err := s.zitadelClient.GetMachineUserByUsername(ctx, adminToken, userID)
 	if err != nil {
 		return err
 	}
@@ -105,5 +255,206 @@ func (s *service) DeletePAT(ctx context.Context, userID, patID string) error {
 		return ErrMachineUserNotFound
 	}
 
-	return s.zitadelClient.RemovePersonalAccessToken(ctx, s.adminPAT, machineUser.ID, patID)
+	return s.zitadelClient.RemovePersonalAccessToken(ctx, adminToken, machineUser.ID, patID)
+}
+
+func (s *service) RotatePAT(
+	ctx context.Context,
+	userID, patID string,
+	groups []string,
+	gracePeriod *time.Duration,
+) (*Rotation, string, error) {
+	rotation, token, err := s.rotatePAT(ctx, userID, patID, groups, gracePeriod)
+
+	details := map[string]string{}
+	if gracePeriod != nil {
+		details["requested_grace_period"] = gracePeriod.String()
+	}
+	if rotation != nil {
+		details["new_pat_id"] = rotation.New.ID
+		details["machine_user_id"] = rotation.New.MachineUserID
+		details["expiration_date"] = rotation.New.ExpirationDate.UTC().Format(time.RFC3339)
+		details["old_pat_delete_at"] = rotation.OldDeleteAt.UTC().Format(time.RFC3339)
+	}
+	s.record(ctx, audit.EventPATRotated, userID, patID, err, details)
+
+	return rotation, token, err
+}
+
+func (s *service) rotatePAT(
+	ctx context.Context,
+	userID, patID string,
+	groups []string,
+	requestedGracePeriod *time.Duration,
+) (*Rotation, string, error) {
+	gracePeriod, err := s.policy.gracePeriod(requestedGracePeriod)
+	if err != nil {
+		return nil, "", err
+	}
+	if gracePeriod > 0 && s.deletions == nil {
+		return nil, "", fmt.Errorf("%w for the grace period, rotate with a grace period of 0 instead",
+			ErrDeletionQueueNotSet)
+	}
+
+	old, err := s.getPAT(ctx, userID, patID)
+	if err != nil {
+		return nil, "", err
+	}
+
+	now := time.Now()
+	expirationDate, err := s.policy.rotatedExpiration(old, s.policy.LimitsFor(groups), now)
+	if err != nil {
+		return nil, "", err
+	}
+
+	adminToken, err := s.adminToken(ctx)
+	if err != nil {
+		return nil, "", err
+	}
+
+	// The quota is not checked: the old PAT goes away after the grace period
+	// and cannot be rotated again before that, as scheduling its deletion a
+	// second time fails, so rotating never adds to the user's active PATs
+	// for long.
+	zitadelPAT, token, err := s.zitadelClient.AddPersonalAccessToken(ctx, adminToken, old.MachineUserID, expirationDate)
+	if err != nil {
+		return nil, "", err
+	}
+	replacement := &PAT{
+		ID:             zitadelPAT.ID,
+		MachineUserID:  old.MachineUserID,
+		HumanUserID:    userID,
+		ExpirationDate: zitadelPAT.ExpirationDate,
+		CreatedAt:      zitadelPAT.CreatedAt,
+	}
+
+	deleteAt := now.Add(gracePeriod)
+	if err = s.retire(ctx, adminToken, old, deleteAt, gracePeriod); err != nil {
+		// Remove the replacement so a retry does not leave an extra PAT behind.
+		removeErr := s.zitadelClient.RemovePersonalAccessToken(
+			ctx, adminToken, replacement.MachineUserID, replacement.ID)
+		if removeErr != nil {
+			logger.ErrorContext(ctx, "failed to remove replacement PAT after failed rotation",
+				slog.String("pat_id", replacement.ID),
+				slog.String("error", removeErr.Error()),
+			)
+		}
+		return nil, "", fmt.Errorf("failed to schedule deletion of PAT %s: %w", old.ID, err)
+	}
+
+	return &Rotation{Old: old, New: replacement, OldDeleteAt: deleteAt}, token, nil
+}
+
+// retire deletes old at deleteAt, or right away without a grace period.
+func (s *service) retire(
+	ctx context.Context,
+	adminToken string,
+	old *PAT,
+	deleteAt time.Time,
+	gracePeriod time.Duration,
+) error {
+	if gracePeriod <= 0 {
+		return s.zitadelClient.RemovePersonalAccessToken(ctx, adminToken, old.MachineUserID, old.ID)
+	}
+	return s.deletions.Schedule(ctx, ScheduledDeletion{
+		PATID:         old.ID,
+		MachineUserID: old.MachineUserID,
+		UserID:        old.HumanUserID,
+		DeleteAt:      deleteAt,
+	})
+}
+
+// checkQuota rejects the creation when the user already has the maximum
+// number of unexpired PATs.
+func (s *service) checkQuota(
+	ctx context.Context,
+	adminToken, machineUserID string,
+	limits Limits,
+	now time.Time,
+) error {
+	if limits.MaxActivePATs <= 0 {
+		return nil
+	}
+
+	existing, err := s.zitadelClient.ListPersonalAccessTokens(ctx, adminToken, machineUserID)
+	if err != nil {
+		return fmt.Errorf("failed to count active PATs: %w", err)
+	}
+
+	active := 0
+	for _, zp := range existing {
+		if zp.ExpirationDate.IsZero() || zp.ExpirationDate.After(now) {
+			active++
+		}
+	}
+	if active >= limits.MaxActivePATs {
+		return fmt.Errorf("%w: %d of %d allowed PATs are active, delete one before creating another",
+			ErrQuotaExceeded, active, limits.MaxActivePATs)
+	}
+	return nil
+}
+
+// lockCreation waits until no other creation for userID is in progress and
+// returns the function that ends this one.
+func (s *service) lockCreation(ctx context.Context, userID string) (func(), error) {
+	if s.creations == nil {
+		return func() {}, nil
+	}
+
+	key := "pat-create:" + userID
+	waitCtx, cancel := context.WithTimeout(ctx, creationLockTTL)
+	defer cancel()
+	for {
+		claimed, err := s.creations.Claim(waitCtx, key, creationLockTTL)
+		if err != nil {
+			return nil, fmt.Errorf("failed to lock PAT creation: %w", err)
+		}
+		if claimed {
+			return func() {
+				if releaseErr := s.creations.Release(context.WithoutCancel(ctx), key); releaseErr != nil {
+					logger.WarnContext(ctx, "failed to unlock PAT creation", slog.String("error", releaseErr.Error()))
+				}
+			}, nil
+		}
+
+		select {
+		case <-waitCtx.Done():
+			return nil, fmt.Errorf("another PAT creation for this user is in progress: %w", waitCtx.Err())
+		case <-time.After(creationLockRetry):
+		}
+	}
+}
+
+func (s *service) record(
+	ctx context.Context,
+	eventType audit.EventType,
+	actor, subject string,
+	err error,
+	details map[string]string,
+) {
+	event := audit.Event{
+		Type:    eventType,
+		Actor:   actor,
+		Subject: subject,
+		Outcome: audit.OutcomeSuccess,
+		Details: details,
+	}
+	if err != nil {
+		event.Outcome = audit.OutcomeFailure
+		event.Reason = err.Error()
+	}
+	s.auditor.Record(ctx, event)
+}
+
+func (s *service) adminToken(ctx context.Context) (string, error) {
+	if s.adminTokens == nil {
+		return "", ErrAdminCredentialsNotSet
+	}
+
+	token, err := s.adminTokens.Token(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to obtain admin token: %w", err)
+	}
+
+	return token, nil
 }
@@ -3,9 +3,18 @@ package pat
 import "errors"
 
 var (
-	ErrPATNotFound         = errors.New("PAT not found")
-	ErrPATExpired          = errors.New("PAT expired")
-	ErrInvalidExpiration   = errors.New("invalid expiration date")
-	ErrMachineUserNotFound = errors.New("machine user not found")
-	ErrFailedToCreatePAT   = errors.New("failed to create PAT")
+	ErrPATNotFound            = errors.New("PAT not found")
+	ErrPATExpired             = errors.New("PAT expired")
+	ErrInvalidExpiration      = errors.New("invalid expiration date")
+	ErrMachineUserNotFound    = errors.New("machine user not found")
+	ErrFailedToCreatePAT      = errors.New("failed to create PAT")
+	ErrAdminCredentialsNotSet = errors.New("admin credentials are not set")
+	ErrLifetimeExceeded       = errors.New("PAT lifetime exceeds the maximum")
+	ErrQuotaExceeded          = errors.New("too many active PATs")
+	ErrDeletionQueueNotSet    = errors.New("no deletion queue is configured")
+	ErrInvalidGracePeriod     = errors.New("invalid grace period")
+	ErrAlreadyRotated         = errors.New("PAT was already rotated and is waiting for deletion")
+	ErrInvalidListQuery       = errors.New("invalid list query")
 )
+
+var ErrNotAdmin = errors.New("caller is not a PAT administrator")
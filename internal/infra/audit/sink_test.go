@@ -0,0 +1,109 @@
+package audit_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/astro-web3/oauth2-token-exchange/internal/domain/audit"
+	auditinfra "github.com/astro-web3/oauth2-token-exchange/internal/infra/audit"
+	"github.com/astro-web3/oauth2-token-exchange/pkg/retry"
+	"github.com/astro-web3/oauth2-token-exchange/pkg/secret"
+)
+
+func TestFileSink_Rotates(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	event := audit.Event{ID: "1", Type: audit.EventPATCreated, Actor: "user-1", Subject: "pat-1"}
+
+	line, _ := json.Marshal(event)
+	// Room for two events per file.
+	sink, err := auditinfra.NewFileSink(path, int64(2*(len(line)+1)), 2)
+	if err != nil {
+		t.Fatalf("failed to open file sink: %v", err)
+	}
+	defer sink.Close()
+
+	for range 7 {
+		if err = sink.Write(context.Background(), event); err != nil {
+			t.Fatalf("write failed: %v", err)
+		}
+	}
+
+	for file, want := range map[string]int{path: 1, path + ".1": 2, path + ".2": 2} {
+		data, readErr := os.ReadFile(file)
+		if readErr != nil {
+			t.Fatalf("failed to read %s: %v", file, readErr)
+		}
+		if got := strings.Count(string(data), "\n"); got != want {
+			t.Errorf("expected %d events in %s, got %d", want, file, got)
+		}
+	}
+	if _, err = os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Errorf("expected at most 2 backups, stat error: %v", err)
+	}
+}
+
+func TestWebhookSink_RetriesServerErrors(t *testing.T) {
+	var calls atomic.Int32
+	received := make(chan audit.Event, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		var event audit.Event
+		_ = json.NewDecoder(r.Body).Decode(&event)
+		received <- event
+	}))
+	defer srv.Close()
+
+	sink := auditinfra.NewWebhookSink(secret.Static(srv.URL), retry.Policy{MaxAttempts: 3, InitialBackoff: time.Millisecond}, nil)
+	if err := sink.Write(context.Background(), audit.Event{ID: "1", Type: audit.EventPATDeleted}); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+
+	select {
+	case event := <-received:
+		if event.Type != audit.EventPATDeleted {
+			t.Errorf("unexpected event: %+v", event)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("event was not delivered")
+	}
+	_ = sink.Close()
+
+	if got := calls.Load(); got < 2 {
+		t.Errorf("expected a retry after 503, got %d calls", got)
+	}
+}
+
+func TestWebhookSink_RejectsWritesAfterClose(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	defer srv.Close()
+
+	sink := auditinfra.NewWebhookSink(secret.Static(srv.URL), retry.Policy{MaxAttempts: 1}, nil)
+	event := audit.Event{ID: "1", Type: audit.EventPATDeleted}
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Go(func() {
+			for range 100 {
+				_ = sink.Write(context.Background(), event)
+			}
+		})
+	}
+	_ = sink.Close()
+	wg.Wait()
+
+	if err := sink.Write(context.Background(), event); !errors.Is(err, auditinfra.ErrWebhookSinkClosed) {
+		t.Errorf("expected ErrWebhookSinkClosed, got %v", err)
+	}
+}
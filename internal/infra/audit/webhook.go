@@ -0,0 +1,129 @@
+package audit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/astro-web3/oauth2-token-exchange/internal/domain/audit"
+	httpclient "github.com/astro-web3/oauth2-token-exchange/pkg/http"
+	"github.com/astro-web3/oauth2-token-exchange/pkg/logger"
+	"github.com/astro-web3/oauth2-token-exchange/pkg/retry"
+	"github.com/astro-web3/oauth2-token-exchange/pkg/secret"
+)
+
+const (
+	webhookQueueSize      = 1024
+	webhookAttemptTimeout = 10 * time.Second
+)
+
+var (
+	ErrWebhookQueueFull  = errors.New("audit webhook queue is full")
+	ErrWebhookSinkClosed = errors.New("audit webhook sink is closed")
+)
+
+// webhookSink POSTs each event as JSON to a URL from a background worker, so
+// slow or failing receivers never delay the audited request. Failed deliveries
+// are retried per policy; 4xx responses other than 429 are not retried.
+type webhookSink struct {
+	url    secret.Secret
+	policy retry.Policy
+	http   *httpclient.Client
+
+	queue chan audit.Event
+	done  chan struct{}
+
+	// mu is held for reading while queueing, so Close cannot close the queue
+	// during a send.
+	mu     sync.RWMutex
+	closed bool
+}
+
+// NewWebhookSink starts the delivery worker, which sends through client or,
+// if nil, the default HTTP client. url is resolved for every delivery. Close
+// stops accepting events and waits until the queued ones have been delivered
+// or given up on.
+func NewWebhookSink(url secret.Secret, policy retry.Policy, client *httpclient.Client) audit.Sink {
+	if client == nil {
+		client = httpclient.Default()
+	}
+	s := &webhookSink{
+		url:    url,
+		policy: policy,
+		http:   client,
+		queue:  make(chan audit.Event, webhookQueueSize),
+		done:   make(chan struct{}),
+	}
+
+	go s.run()
+
+	return s
+}
+
+func (s *webhookSink) Write(_ context.Context, event audit.Event) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return ErrWebhookSinkClosed
+	}
+
+	select {
+	case s.queue <- event:
+		return nil
+	default:
+		return ErrWebhookQueueFull
+	}
+}
+
+func (s *webhookSink) Close() error {
+	s.mu.Lock()
+	if !s.closed {
+		s.closed = true
+		close(s.queue)
+	}
+	s.mu.Unlock()
+
+	<-s.done
+	return nil
+}
+
+func (s *webhookSink) run() {
+	defer close(s.done)
+
+	for event := range s.queue {
+		ctx := context.Background()
+		if err := retry.Do(ctx, s.policy, func(ctx context.Context) error {
+			return s.deliver(ctx, event)
+		}); err != nil {
+			logger.ErrorContext(ctx, "failed to deliver audit event to webhook",
+				slog.String("type", string(event.Type)),
+				slog.String("id", event.ID),
+				slog.String("error", err.Error()),
+			)
+		}
+	}
+}
+
+func (s *webhookSink) deliver(ctx context.Context, event audit.Event) error {
+	ctx, cancel := context.WithTimeout(ctx, webhookAttemptTimeout)
+	defer cancel()
+
+	resp, err := s.http.Post(ctx, s.url.Value(), httpclient.WithBody(event))
+	if err != nil {
+		return fmt.Errorf("audit webhook request failed: %w", err)
+	}
+
+	status := resp.StatusCode()
+	switch {
+	case status < http.StatusBadRequest:
+		return nil
+	case status == http.StatusTooManyRequests || status >= http.StatusInternalServerError:
+		return fmt.Errorf("audit webhook returned %s", resp.Status())
+	default:
+		return retry.Permanent(fmt.Errorf("audit webhook returned %s", resp.Status()))
+	}
+}
@@ -0,0 +1,43 @@
+// Package audit provides the sinks audit events are written to: JSON lines on
+// stdout or in a rotated file, and an HTTP webhook.
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/astro-web3/oauth2-token-exchange/internal/domain/audit"
+)
+
+type writerSink struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+// NewWriterSink writes each event as one JSON line to w.
+func NewWriterSink(w io.Writer) audit.Sink {
+	return &writerSink{enc: json.NewEncoder(w)}
+}
+
+// NewStdoutSink writes each event as one JSON line to stdout.
+func NewStdoutSink() audit.Sink {
+	return NewWriterSink(os.Stdout)
+}
+
+func (s *writerSink) Write(_ context.Context, event audit.Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.enc.Encode(event); err != nil {
+		return fmt.Errorf("failed to encode audit event: %w", err)
+	}
+	return nil
+}
+
+func (s *writerSink) Close() error {
+	return nil
+}
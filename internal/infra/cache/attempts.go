@@ -0,0 +1,172 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/astro-web3/oauth2-token-exchange/pkg/metrics"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	failuresKeyPrefix = "authz:bruteforce:failures:"
+	blockedKeyPrefix  = "authz:bruteforce:blocked:"
+)
+
+// FailureLimit blocks a key for BlockFor once MaxFailures failures are
+// recorded within Window of the first one.
+type FailureLimit struct {
+	MaxFailures int
+	Window      time.Duration
+	BlockFor    time.Duration
+}
+
+// AttemptTracker counts failed attempts per key, such as a source IP, and
+// blocks keys that fail too often.
+type AttemptTracker interface {
+	// Attempts returns the failures recorded for key in its current window
+	// and, while key is blocked, the remaining block duration.
+	Attempts(ctx context.Context, key string) (failures int, blockedFor time.Duration, err error)
+	// RecordFailure counts a failure for key. It reports whether the failure
+	// blocked key, which also starts a new window.
+	RecordFailure(ctx context.Context, key string, limit FailureLimit) (blocked bool, err error)
+}
+
+// recordFailure increments the failure count in KEYS[1], whose window of
+// ARGV[1] ms starts with the first failure. At ARGV[2] failures it sets the
+// block KEYS[2] for ARGV[3] ms and clears the count.
+//
+//nolint:gochecknoglobals // Scripts are immutable and cache their SHA.
+var recordFailure = redis.NewScript(`
+local failures = redis.call('INCR', KEYS[1])
+if failures == 1 then
+  redis.call('PEXPIRE', KEYS[1], ARGV[1])
+end
+if failures >= tonumber(ARGV[2]) then
+  redis.call('SET', KEYS[2], 1, 'PX', ARGV[3])
+  redis.call('DEL', KEYS[1])
+  return 1
+end
+return 0
+`)
+
+type redisAttemptTracker struct {
+	client *redis.Client
+}
+
+// NewRedisAttemptTracker shares failure counts and blocks between replicas.
+func NewRedisAttemptTracker(client *redis.Client) AttemptTracker {
+	return &redisAttemptTracker{client: client}
+}
+
+func (t *redisAttemptTracker) Attempts(ctx context.Context, key string) (int, time.Duration, error) {
+	var failures *redis.StringCmd
+	var blocked *redis.DurationCmd
+	_, err := t.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		failures = pipe.Get(ctx, failuresKeyPrefix+key)
+		blocked = pipe.PTTL(ctx, blockedKeyPrefix+key)
+		return nil
+	})
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return 0, 0, fmt.Errorf("failed to get attempts: %w", err)
+	}
+
+	count, err := failures.Int()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return 0, 0, fmt.Errorf("failed to parse attempts: %w", err)
+	}
+	// PTTL reports missing keys and keys without expiry as negative values.
+	return count, max(blocked.Val(), 0), nil
+}
+
+func (t *redisAttemptTracker) RecordFailure(ctx context.Context, key string, limit FailureLimit) (bool, error) {
+	blocked, err := recordFailure.Run(ctx, t.client,
+		[]string{failuresKeyPrefix + key, blockedKeyPrefix + key},
+		limit.Window.Milliseconds(), limit.MaxFailures, limit.BlockFor.Milliseconds()).Int()
+	if err != nil {
+		return false, fmt.Errorf("failed to record failure: %w", err)
+	}
+	if blocked == 1 {
+		metrics.RecordSourceBlock()
+	}
+	return blocked == 1, nil
+}
+
+type memoryAttempts struct {
+	failures     int
+	windowEnds   time.Time
+	blockedUntil time.Time
+}
+
+type memoryAttemptTracker struct {
+	mu        sync.Mutex
+	attempts  map[string]*memoryAttempts
+	lastSweep time.Time
+}
+
+// NewMemoryAttemptTracker counts failures in process, for single-replica
+// deployments. With several replicas each one counts on its own.
+func NewMemoryAttemptTracker() AttemptTracker {
+	return &memoryAttemptTracker{attempts: make(map[string]*memoryAttempts), lastSweep: time.Now()}
+}
+
+func (t *memoryAttemptTracker) Attempts(_ context.Context, key string) (int, time.Duration, error) {
+	now := time.Now()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	a, ok := t.attempts[key]
+	if !ok {
+		return 0, 0, nil
+	}
+	var failures int
+	if now.Before(a.windowEnds) {
+		failures = a.failures
+	}
+	return failures, max(a.blockedUntil.Sub(now), 0), nil
+}
+
+func (t *memoryAttemptTracker) RecordFailure(_ context.Context, key string, limit FailureLimit) (bool, error) {
+	now := time.Now()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.sweep(now)
+
+	a, ok := t.attempts[key]
+	if !ok {
+		a = &memoryAttempts{}
+		t.attempts[key] = a
+	}
+	if !now.Before(a.windowEnds) {
+		a.failures, a.windowEnds = 0, now.Add(limit.Window)
+	}
+
+	a.failures++
+	if a.failures < limit.MaxFailures {
+		return false, nil
+	}
+
+	a.failures, a.windowEnds = 0, time.Time{}
+	a.blockedUntil = now.Add(limit.BlockFor)
+	metrics.RecordSourceBlock()
+	return true, nil
+}
+
+// sweep drops keys whose window and block have both ended.
+func (t *memoryAttemptTracker) sweep(now time.Time) {
+	if now.Sub(t.lastSweep) < rateLimitSweepInterval {
+		return
+	}
+	for key, a := range t.attempts {
+		if !now.Before(a.windowEnds) && !now.Before(a.blockedUntil) {
+			delete(t.attempts, key)
+		}
+	}
+	t.lastSweep = now
+}
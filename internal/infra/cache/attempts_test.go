@@ -0,0 +1,34 @@
+package cache_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/astro-web3/oauth2-token-exchange/internal/infra/cache"
+)
+
+func TestMemoryAttemptTracker(t *testing.T) {
+	tracker := cache.NewMemoryAttemptTracker()
+	ctx := context.Background()
+	limit := cache.FailureLimit{MaxFailures: 2, Window: time.Minute, BlockFor: time.Hour}
+
+	if blocked, err := tracker.RecordFailure(ctx, "203.0.113.7", limit); err != nil || blocked {
+		t.Fatalf("expected first failure not to block, got %v, %v", blocked, err)
+	}
+	if failures, blockedFor, err := tracker.Attempts(ctx, "203.0.113.7"); err != nil || failures != 1 || blockedFor != 0 {
+		t.Fatalf("unexpected attempts: %d, %s, %v", failures, blockedFor, err)
+	}
+
+	if blocked, err := tracker.RecordFailure(ctx, "203.0.113.7", limit); err != nil || !blocked {
+		t.Fatalf("expected second failure to block, got %v, %v", blocked, err)
+	}
+	failures, blockedFor, err := tracker.Attempts(ctx, "203.0.113.7")
+	if err != nil || failures != 0 || blockedFor <= 59*time.Minute {
+		t.Errorf("expected a fresh window and a one hour block, got %d, %s, %v", failures, blockedFor, err)
+	}
+
+	if failures, blockedFor, err = tracker.Attempts(ctx, "198.51.100.1"); err != nil || failures != 0 || blockedFor != 0 {
+		t.Errorf("expected keys to be tracked independently, got %d, %s, %v", failures, blockedFor, err)
+	}
+}
@@ -0,0 +1,178 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	patdomain "github.com/astro-web3/oauth2-token-exchange/internal/domain/pat"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	deletionQueueKey = "authz:pat:deletions"
+	// pendingDeletionsKey maps the ID of each PAT in the queue to its member.
+	pendingDeletionsKey = "authz:pat:deletions:pending"
+	// memberWithScore is the length of a member/score pair in a WITHSCORES reply.
+	memberWithScore = 2
+)
+
+// claimDeletions returns the members due at ARGV[1] with their scores and
+// moves them to ARGV[2], so no other replica claims them until then.
+//
+//nolint:gochecknoglobals // Scripts are immutable and cache their SHA.
+var claimDeletions = redis.NewScript(`
+local due = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1], 'WITHSCORES', 'LIMIT', 0, ARGV[3])
+for i = 1, #due, 2 do
+  redis.call('ZADD', KEYS[1], ARGV[2], due[i])
+end
+return due
+`)
+
+// scheduleDeletion adds ARGV[2] with score ARGV[3] to KEYS[1] unless the PAT
+// ARGV[1] is already pending in KEYS[2]. It returns 0 in that case.
+//
+//nolint:gochecknoglobals // Scripts are immutable and cache their SHA.
+var scheduleDeletion = redis.NewScript(`
+if redis.call('HSETNX', KEYS[2], ARGV[1], ARGV[2]) == 0 then
+  return 0
+end
+redis.call('ZADD', KEYS[1], ARGV[3], ARGV[2])
+return 1
+`)
+
+type redisDeletionQueue struct {
+	client *redis.Client
+}
+
+// NewRedisDeletionQueue keeps scheduled deletions in a sorted set scored by
+// their deletion time, so they survive restarts and are shared by all replicas.
+func NewRedisDeletionQueue(client *redis.Client) patdomain.DeletionQueue {
+	return &redisDeletionQueue{client: client}
+}
+
+func (q *redisDeletionQueue) Schedule(ctx context.Context, deletion patdomain.ScheduledDeletion) error {
+	member, err := json.Marshal(deletion)
+	if err != nil {
+		return fmt.Errorf("failed to marshal deletion: %w", err)
+	}
+
+	scheduled, err := scheduleDeletion.Run(ctx, q.client, []string{deletionQueueKey, pendingDeletionsKey},
+		deletion.PATID, string(member), deletion.DeleteAt.UnixMilli()).Bool()
+	if err != nil {
+		return fmt.Errorf("failed to schedule deletion of PAT %s: %w", deletion.PATID, err)
+	}
+	if !scheduled {
+		return patdomain.ErrAlreadyRotated
+	}
+	return nil
+}
+
+func (q *redisDeletionQueue) Claim(
+	ctx context.Context,
+	now time.Time,
+	lease time.Duration,
+	limit int,
+) ([]patdomain.ScheduledDeletion, error) {
+	due, err := claimDeletions.Run(ctx, q.client, []string{deletionQueueKey},
+		now.UnixMilli(), now.Add(lease).UnixMilli(), limit).StringSlice()
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim scheduled deletions: %w", err)
+	}
+
+	deletions := make([]patdomain.ScheduledDeletion, 0, len(due)/memberWithScore)
+	for pair := range slices.Chunk(due, memberWithScore) {
+		if len(pair) != memberWithScore {
+			break
+		}
+		var deletion patdomain.ScheduledDeletion
+		if err = json.Unmarshal([]byte(pair[0]), &deletion); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal deletion: %w", err)
+		}
+		score, parseErr := strconv.ParseFloat(pair[1], 64)
+		if parseErr != nil {
+			return nil, fmt.Errorf("invalid deletion score %q: %w", pair[1], parseErr)
+		}
+		deletion.DeleteAt = time.UnixMilli(int64(score))
+		deletions = append(deletions, deletion)
+	}
+	return deletions, nil
+}
+
+func (q *redisDeletionQueue) Complete(ctx context.Context, deletion patdomain.ScheduledDeletion) error {
+	member, err := json.Marshal(deletion)
+	if err != nil {
+		return fmt.Errorf("failed to marshal deletion: %w", err)
+	}
+	_, err = q.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZRem(ctx, deletionQueueKey, string(member))
+		pipe.HDel(ctx, pendingDeletionsKey, deletion.PATID)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to complete deletion of PAT %s: %w", deletion.PATID, err)
+	}
+	return nil
+}
+
+type memoryDeletion struct {
+	deletion patdomain.ScheduledDeletion
+	dueAt    time.Time
+}
+
+type memoryDeletionQueue struct {
+	mu        sync.Mutex
+	deletions map[string]memoryDeletion
+}
+
+// NewMemoryDeletionQueue keeps scheduled deletions in process, for
+// single-replica deployments. Deletions scheduled before a restart are lost.
+func NewMemoryDeletionQueue() patdomain.DeletionQueue {
+	return &memoryDeletionQueue{deletions: make(map[string]memoryDeletion)}
+}
+
+func (q *memoryDeletionQueue) Schedule(_ context.Context, deletion patdomain.ScheduledDeletion) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if _, ok := q.deletions[deletion.PATID]; ok {
+		return patdomain.ErrAlreadyRotated
+	}
+	q.deletions[deletion.PATID] = memoryDeletion{deletion: deletion, dueAt: deletion.DeleteAt}
+	return nil
+}
+
+func (q *memoryDeletionQueue) Claim(
+	_ context.Context,
+	now time.Time,
+	lease time.Duration,
+	limit int,
+) ([]patdomain.ScheduledDeletion, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var deletions []patdomain.ScheduledDeletion
+	for id, d := range q.deletions {
+		if len(deletions) >= limit {
+			break
+		}
+		if d.dueAt.After(now) {
+			continue
+		}
+		q.deletions[id] = memoryDeletion{deletion: d.deletion, dueAt: now.Add(lease)}
+		deletions = append(deletions, d.deletion)
+	}
+	return deletions, nil
+}
+
+func (q *memoryDeletionQueue) Complete(_ context.Context, deletion patdomain.ScheduledDeletion) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	delete(q.deletions, deletion.PATID)
+	return nil
+}
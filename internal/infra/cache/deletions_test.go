@@ -0,0 +1,56 @@
+package cache_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+
+	patdomain "github.com/astro-web3/oauth2-token-exchange/internal/domain/pat"
+	"github.com/astro-web3/oauth2-token-exchange/internal/infra/cache"
+)
+
+func TestDeletionQueue_SchedulesEachPATOnce(t *testing.T) {
+	client := redis.NewClient(&redis.Options{Addr: miniredis.RunT(t).Addr()})
+	t.Cleanup(func() { _ = client.Close() })
+	queues := map[string]patdomain.DeletionQueue{
+		"memory": cache.NewMemoryDeletionQueue(),
+		"redis":  cache.NewRedisDeletionQueue(client),
+	}
+
+	for name, queue := range queues {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			now := time.Now()
+			deletion := patdomain.ScheduledDeletion{
+				PATID:         "pat-1",
+				MachineUserID: "machine-1",
+				UserID:        "user-1",
+				DeleteAt:      now.Add(-time.Second),
+			}
+
+			if err := queue.Schedule(ctx, deletion); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			again := deletion
+			again.DeleteAt = now.Add(time.Hour)
+			if err := queue.Schedule(ctx, again); !errors.Is(err, patdomain.ErrAlreadyRotated) {
+				t.Fatalf("expected ErrAlreadyRotated, got %v", err)
+			}
+
+			claimed, err := queue.Claim(ctx, now, time.Minute, 10)
+			if err != nil || len(claimed) != 1 || claimed[0].PATID != "pat-1" {
+				t.Fatalf("expected the first deletion to be claimed, got %+v, %v", claimed, err)
+			}
+			if err = queue.Complete(ctx, claimed[0]); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if err = queue.Schedule(ctx, again); err != nil {
+				t.Errorf("expected a completed deletion to free the PAT, got %v", err)
+			}
+		})
+	}
+}
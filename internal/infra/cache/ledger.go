@@ -0,0 +1,78 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Ledger claims keys for a limited time, e.g. to make sure a reminder is sent
+// only once across replicas.
+type Ledger interface {
+	Claim(ctx context.Context, key string, ttl time.Duration) (bool, error)
+	Release(ctx context.Context, key string) error
+}
+
+type redisLedger struct {
+	client *redis.Client
+}
+
+// NewRedisLedger claims keys with SET NX, so claims are shared by all replicas.
+func NewRedisLedger(client *redis.Client) Ledger {
+	return &redisLedger{client: client}
+}
+
+func (l *redisLedger) Claim(ctx context.Context, key string, ttl time.Duration) (bool, error) {
+	ok, err := l.client.SetNX(ctx, "authz:ledger:"+key, 1, ttl).Result()
+	if err != nil {
+		return false, fmt.Errorf("failed to claim %s: %w", key, err)
+	}
+	return ok, nil
+}
+
+func (l *redisLedger) Release(ctx context.Context, key string) error {
+	if err := l.client.Del(ctx, "authz:ledger:"+key).Err(); err != nil {
+		return fmt.Errorf("failed to release %s: %w", key, err)
+	}
+	return nil
+}
+
+type memoryLedger struct {
+	mu     sync.Mutex
+	claims map[string]time.Time
+}
+
+// NewMemoryLedger keeps claims in process, for single-replica deployments.
+// Claims are lost on restart.
+func NewMemoryLedger() Ledger {
+	return &memoryLedger{claims: make(map[string]time.Time)}
+}
+
+func (l *memoryLedger) Claim(_ context.Context, key string, ttl time.Duration) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	for k, expiresAt := range l.claims {
+		if now.After(expiresAt) {
+			delete(l.claims, k)
+		}
+	}
+
+	if _, ok := l.claims[key]; ok {
+		return false, nil
+	}
+	l.claims[key] = now.Add(ttl)
+	return true, nil
+}
+
+func (l *memoryLedger) Release(_ context.Context, key string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	delete(l.claims, key)
+	return nil
+}
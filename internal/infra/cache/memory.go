@@ -0,0 +1,163 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+
+	"github.com/astro-web3/oauth2-token-exchange/pkg/metrics"
+)
+
+const (
+	DefaultMemoryMaxEntries      = 10000
+	DefaultMemoryCleanupInterval = time.Minute
+)
+
+// memoryCache is an in-process TokenCache for single-replica and development
+// deployments. Entries expire after their TTL and the least recently used
+// entry is evicted once maxEntries is reached.
+type memoryCache struct {
+	mu         sync.Mutex
+	entries    map[string]*list.Element
+	lru        *list.List
+	maxEntries int
+
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+type memoryEntry struct {
+	key       string
+	value     CachedToken
+	expiresAt time.Time
+}
+
+// NewMemoryTokenCache creates an in-memory TokenCache and starts a janitor
+// goroutine that removes expired entries every cleanupInterval.
+// Call Close to stop the janitor.
+func NewMemoryTokenCache(maxEntries int, cleanupInterval time.Duration) TokenCache {
+	if maxEntries <= 0 {
+		maxEntries = DefaultMemoryMaxEntries
+	}
+	if cleanupInterval <= 0 {
+		cleanupInterval = DefaultMemoryCleanupInterval
+	}
+
+	c := &memoryCache{
+		entries:    make(map[string]*list.Element),
+		lru:        list.New(),
+		maxEntries: maxEntries,
+		stop:       make(chan struct{}),
+	}
+
+	go c.janitor(cleanupInterval)
+
+	return c
+}
+
+func (m *memoryCache) Get(_ context.Context, patHash string) (*CachedToken, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	elem, ok := m.entries[patHash]
+	if !ok {
+		metrics.RecordCache(tierMemory, metrics.CacheMiss)
+		return nil, ErrCacheMiss
+	}
+
+	entry, _ := elem.Value.(*memoryEntry)
+	if entry.expired(time.Now()) {
+		m.removeElement(elem)
+		metrics.RecordCache(tierMemory, metrics.CacheMiss)
+		return nil, ErrCacheMiss
+	}
+
+	m.lru.MoveToFront(elem)
+	metrics.RecordCache(tierMemory, metrics.CacheHit)
+
+	return entry.value.clone(), nil
+}
+
+func (m *memoryCache) Set(_ context.Context, patHash string, value *CachedToken, ttl time.Duration) error {
+	var expiresAt time.Time
+	if ttl > 0 {
+		expiresAt = time.Now().Add(ttl)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if elem, ok := m.entries[patHash]; ok {
+		entry, _ := elem.Value.(*memoryEntry)
+		entry.value = *value.clone()
+		entry.expiresAt = expiresAt
+		m.lru.MoveToFront(elem)
+		return nil
+	}
+
+	m.entries[patHash] = m.lru.PushFront(&memoryEntry{
+		key:       patHash,
+		value:     *value.clone(),
+		expiresAt: expiresAt,
+	})
+
+	for m.lru.Len() > m.maxEntries {
+		m.removeElement(m.lru.Back())
+	}
+
+	return nil
+}
+
+// Close stops the janitor goroutine. It is safe to call multiple times.
+func (m *memoryCache) Close() error {
+	m.stopOnce.Do(func() {
+		close(m.stop)
+	})
+	return nil
+}
+
+func (m *memoryCache) janitor(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-m.stop:
+			return
+		case now := <-ticker.C:
+			m.deleteExpired(now)
+		}
+	}
+}
+
+func (m *memoryCache) deleteExpired(now time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for elem := m.lru.Back(); elem != nil; {
+		prev := elem.Prev()
+		if entry, _ := elem.Value.(*memoryEntry); entry.expired(now) {
+			m.removeElement(elem)
+		}
+		elem = prev
+	}
+}
+
+func (m *memoryCache) removeElement(elem *list.Element) {
+	entry, _ := m.lru.Remove(elem).(*memoryEntry)
+	delete(m.entries, entry.key)
+}
+
+func (e *memoryEntry) expired(now time.Time) bool {
+	return !e.expiresAt.IsZero() && !now.Before(e.expiresAt)
+}
+
+// clone returns a deep copy so callers cannot mutate cached state.
+func (t *CachedToken) clone() *CachedToken {
+	c := *t
+	if t.Groups != nil {
+		c.Groups = append([]string(nil), t.Groups...)
+	}
+	return &c
+}
@@ -0,0 +1,107 @@
+package cache_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/astro-web3/oauth2-token-exchange/internal/infra/cache"
+)
+
+func newMemoryCache(t *testing.T, maxEntries int) cache.TokenCache {
+	t.Helper()
+	c := cache.NewMemoryTokenCache(maxEntries, time.Hour)
+	t.Cleanup(func() {
+		if closer, ok := c.(io.Closer); ok {
+			_ = closer.Close()
+		}
+	})
+	return c
+}
+
+func TestMemoryTokenCache_SetGet(t *testing.T) {
+	c := newMemoryCache(t, 10)
+	ctx := context.Background()
+
+	if _, err := c.Get(ctx, "missing"); !errors.Is(err, cache.ErrCacheMiss) {
+		t.Fatalf("expected ErrCacheMiss, got %v", err)
+	}
+
+	token := &cache.CachedToken{UserID: "user-123", Groups: []string{"group1"}}
+	if err := c.Set(ctx, "hash", token, time.Minute); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	got, err := c.Get(ctx, "hash")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got.UserID != "user-123" {
+		t.Errorf("expected user-123, got %s", got.UserID)
+	}
+
+	got.Groups[0] = "mutated"
+	again, _ := c.Get(ctx, "hash")
+	if again.Groups[0] != "group1" {
+		t.Errorf("cached value was mutated through returned pointer: %v", again.Groups)
+	}
+}
+
+func TestMemoryTokenCache_Expiry(t *testing.T) {
+	c := newMemoryCache(t, 10)
+	ctx := context.Background()
+
+	if err := c.Set(ctx, "hash", &cache.CachedToken{IsInvalid: true}, 10*time.Millisecond); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	time.Sleep(20 * time.Millisecond)
+
+	if _, err := c.Get(ctx, "hash"); !errors.Is(err, cache.ErrCacheMiss) {
+		t.Fatalf("expected ErrCacheMiss after TTL, got %v", err)
+	}
+}
+
+func TestMemoryTokenCache_EvictsLeastRecentlyUsed(t *testing.T) {
+	c := newMemoryCache(t, 2)
+	ctx := context.Background()
+
+	_ = c.Set(ctx, "a", &cache.CachedToken{UserID: "a"}, time.Minute)
+	_ = c.Set(ctx, "b", &cache.CachedToken{UserID: "b"}, time.Minute)
+	_, _ = c.Get(ctx, "a")
+	_ = c.Set(ctx, "c", &cache.CachedToken{UserID: "c"}, time.Minute)
+
+	if _, err := c.Get(ctx, "b"); !errors.Is(err, cache.ErrCacheMiss) {
+		t.Errorf("expected b to be evicted, got %v", err)
+	}
+	for _, key := range []string{"a", "c"} {
+		if _, err := c.Get(ctx, key); err != nil {
+			t.Errorf("expected %s to be cached, got %v", key, err)
+		}
+	}
+}
+
+func TestMemoryTokenCache_ConcurrentAccess(t *testing.T) {
+	c := newMemoryCache(t, 50)
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	for i := range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range 100 {
+				key := fmt.Sprintf("key-%d", (i+j)%80)
+				_ = c.Set(ctx, key, &cache.CachedToken{UserID: key}, time.Minute)
+				if got, err := c.Get(ctx, key); err == nil && got.UserID != key {
+					t.Errorf("expected %s, got %s", key, got.UserID)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
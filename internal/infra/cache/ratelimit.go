@@ -0,0 +1,203 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	rateLimitKeyPrefix = "authz:ratelimit:"
+	// rateLimitSweepInterval bounds how often the memory limiter drops idle keys.
+	rateLimitSweepInterval = time.Minute
+	// rateLimitReplyLen is the length of the reply of allowRequest per key.
+	rateLimitReplyLen = 4
+)
+
+// RateLimit allows Limit requests per Window, with bursts of up to Limit.
+type RateLimit struct {
+	Limit  int
+	Window time.Duration
+}
+
+// RateLimitResult is the outcome of a RateLimiter.Allow call.
+type RateLimitResult struct {
+	Allowed bool
+	// Remaining is the number of requests that would be allowed right now.
+	Remaining int
+	// RetryAfter is how long a denied caller has to wait for its next request.
+	RetryAfter time.Duration
+	// ResetAfter is how long until the full quota is available again.
+	ResetAfter time.Duration
+}
+
+// RateLimitCheck is one quota a request is counted against.
+type RateLimitCheck struct {
+	Key   string
+	Limit RateLimit
+}
+
+// RateLimiter counts requests per key. Allow returns one result per check and
+// consumes one request from every key's quota only if all of them have one
+// left, so a request denied by one quota does not use up the others.
+type RateLimiter interface {
+	Allow(ctx context.Context, checks []RateLimitCheck) ([]*RateLimitResult, error)
+}
+
+// allowRequest runs the generic cell rate algorithm (GCRA), a token bucket
+// that stores a single timestamp per key: the theoretical arrival time (TAT)
+// at which the bucket is full again. ARGV holds now, followed by the emission
+// interval and the window of each key, in milliseconds. The TATs are only
+// advanced when every key allows the request. It returns allowed, remaining,
+// retry-after and reset-after for each key.
+//
+//nolint:gochecknoglobals // Scripts are immutable and cache their SHA.
+var allowRequest = redis.NewScript(`
+local now = tonumber(ARGV[1])
+local reply = {}
+local new_tats = {}
+local allowed = true
+for i, key in ipairs(KEYS) do
+  local interval = tonumber(ARGV[2 * i])
+  local window = tonumber(ARGV[2 * i + 1])
+  local tat = tonumber(redis.call('GET', key)) or now
+  if tat < now then
+    tat = now
+  end
+  local new_tat = tat + interval
+  local allow_at = new_tat - window
+  if allow_at > now then
+    allowed = false
+    for _, v in ipairs({0, 0, allow_at - now, tat - now}) do
+      table.insert(reply, v)
+    end
+  else
+    new_tats[i] = new_tat
+    for _, v in ipairs({1, math.floor((now - allow_at) / interval), 0, new_tat - now}) do
+      table.insert(reply, v)
+    end
+  end
+end
+if allowed then
+  for i, key in ipairs(KEYS) do
+    redis.call('SET', key, new_tats[i], 'PX', new_tats[i] - now)
+  end
+end
+return reply
+`)
+
+type redisRateLimiter struct {
+	client *redis.Client
+}
+
+// NewRedisRateLimiter shares quotas between all replicas. Each key is a
+// single string that expires once its quota is full again.
+func NewRedisRateLimiter(client *redis.Client) RateLimiter {
+	return &redisRateLimiter{client: client}
+}
+
+func (l *redisRateLimiter) Allow(ctx context.Context, checks []RateLimitCheck) ([]*RateLimitResult, error) {
+	if len(checks) == 0 {
+		return nil, nil
+	}
+
+	keys := make([]string, 0, len(checks))
+	args := make([]any, 0, 1+2*len(checks))
+	args = append(args, time.Now().UnixMilli())
+	for _, check := range checks {
+		keys = append(keys, rateLimitKeyPrefix+check.Key)
+		args = append(args, max(emissionInterval(check.Limit).Milliseconds(), 1), check.Limit.Window.Milliseconds())
+	}
+
+	reply, err := allowRequest.Run(ctx, l.client, keys, args...).Int64Slice()
+	if err != nil {
+		return nil, fmt.Errorf("failed to check rate limit: %w", err)
+	}
+	if len(reply) != rateLimitReplyLen*len(checks) {
+		return nil, fmt.Errorf("unexpected rate limit reply %v", reply)
+	}
+
+	results := make([]*RateLimitResult, 0, len(checks))
+	for r := range slices.Chunk(reply, rateLimitReplyLen) {
+		results = append(results, &RateLimitResult{
+			Allowed:    r[0] == 1,
+			Remaining:  int(r[1]),
+			RetryAfter: time.Duration(r[2]) * time.Millisecond,
+			ResetAfter: time.Duration(r[3]) * time.Millisecond,
+		})
+	}
+	return results, nil
+}
+
+type memoryRateLimiter struct {
+	mu        sync.Mutex
+	tats      map[string]time.Time
+	lastSweep time.Time
+}
+
+// NewMemoryRateLimiter counts requests in process, for single-replica
+// deployments. With several replicas each one enforces its own quota.
+func NewMemoryRateLimiter() RateLimiter {
+	return &memoryRateLimiter{tats: make(map[string]time.Time), lastSweep: time.Now()}
+}
+
+func (l *memoryRateLimiter) Allow(_ context.Context, checks []RateLimitCheck) ([]*RateLimitResult, error) {
+	now := time.Now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Sub(l.lastSweep) >= rateLimitSweepInterval {
+		for k, tat := range l.tats {
+			if !tat.After(now) {
+				delete(l.tats, k)
+			}
+		}
+		l.lastSweep = now
+	}
+
+	results := make([]*RateLimitResult, 0, len(checks))
+	tats := make([]time.Time, 0, len(checks))
+	allowed := true
+	for _, check := range checks {
+		tat, result := gcra(l.tats[check.Key], now, check.Limit)
+		results = append(results, result)
+		tats = append(tats, tat)
+		allowed = allowed && result.Allowed
+	}
+	if allowed {
+		for i, check := range checks {
+			l.tats[check.Key] = tats[i]
+		}
+	}
+	return results, nil
+}
+
+// gcra mirrors allowRequest and returns the key's new TAT with the result.
+func gcra(tat, now time.Time, limit RateLimit) (time.Time, *RateLimitResult) {
+	interval := emissionInterval(limit)
+	if tat.Before(now) {
+		tat = now
+	}
+
+	newTAT := tat.Add(interval)
+	allowAt := newTAT.Add(-limit.Window)
+	if allowAt.After(now) {
+		return tat, &RateLimitResult{RetryAfter: allowAt.Sub(now), ResetAfter: tat.Sub(now)}
+	}
+
+	return newTAT, &RateLimitResult{
+		Allowed:    true,
+		Remaining:  int(now.Sub(allowAt) / interval),
+		ResetAfter: newTAT.Sub(now),
+	}
+}
+
+// emissionInterval is the time it takes to regain one request.
+func emissionInterval(limit RateLimit) time.Duration {
+	return limit.Window / time.Duration(max(limit.Limit, 1))
+}
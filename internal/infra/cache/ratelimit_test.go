@@ -0,0 +1,90 @@
+package cache_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+
+	"github.com/astro-web3/oauth2-token-exchange/internal/infra/cache"
+)
+
+func rateLimiters(t *testing.T) map[string]cache.RateLimiter {
+	t.Helper()
+	client := redis.NewClient(&redis.Options{Addr: miniredis.RunT(t).Addr()})
+	t.Cleanup(func() { _ = client.Close() })
+	return map[string]cache.RateLimiter{
+		"memory": cache.NewMemoryRateLimiter(),
+		"redis":  cache.NewRedisRateLimiter(client),
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+	for name, limiter := range rateLimiters(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			limit := cache.RateLimit{Limit: 3, Window: time.Minute}
+			allow := func(key string) *cache.RateLimitResult {
+				t.Helper()
+				results, err := limiter.Allow(ctx, []cache.RateLimitCheck{{Key: key, Limit: limit}})
+				if err != nil || len(results) != 1 {
+					t.Fatalf("unexpected results: %v, %v", results, err)
+				}
+				return results[0]
+			}
+
+			for want := 2; want >= 0; want-- {
+				if result := allow("user:1"); !result.Allowed || result.Remaining != want {
+					t.Fatalf("expected allowed with %d remaining, got %+v", want, result)
+				}
+			}
+
+			result := allow("user:1")
+			if result.Allowed {
+				t.Fatalf("expected denied, got %+v", result)
+			}
+			// One request is regained every window/limit.
+			if result.RetryAfter <= 19*time.Second || result.RetryAfter > 20*time.Second {
+				t.Errorf("expected retry after about 20s, got %s", result.RetryAfter)
+			}
+			if result.ResetAfter <= 59*time.Second || result.ResetAfter > time.Minute {
+				t.Errorf("expected reset after about 1m, got %s", result.ResetAfter)
+			}
+
+			if result = allow("user:2"); !result.Allowed {
+				t.Errorf("expected keys to be limited independently, got %+v", result)
+			}
+		})
+	}
+}
+
+func TestRateLimiter_DeniedChecksConsumeNothing(t *testing.T) {
+	for name, limiter := range rateLimiters(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			checks := []cache.RateLimitCheck{
+				{Key: "wide:user:1", Limit: cache.RateLimit{Limit: 3, Window: time.Minute}},
+				{Key: "narrow:user:1", Limit: cache.RateLimit{Limit: 1, Window: time.Minute}},
+			}
+
+			results, err := limiter.Allow(ctx, checks)
+			if err != nil || !results[0].Allowed || !results[1].Allowed || results[0].Remaining != 2 {
+				t.Fatalf("expected both allowed, got %+v, %+v, %v", results[0], results[1], err)
+			}
+			for range 3 {
+				results, err = limiter.Allow(ctx, checks)
+				if err != nil || !results[0].Allowed || results[1].Allowed {
+					t.Fatalf("expected only the narrow check to deny, got %+v, %+v, %v", results[0], results[1], err)
+				}
+			}
+
+			// The denied requests did not count against the wide quota.
+			results, err = limiter.Allow(ctx, checks[:1])
+			if err != nil || !results[0].Allowed || results[0].Remaining != 1 {
+				t.Errorf("expected the wide quota to be untouched, got %+v, %v", results[0], err)
+			}
+		})
+	}
+}
@@ -7,11 +7,18 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/astro-web3/oauth2-token-exchange/pkg/metrics"
 	"github.com/redis/go-redis/v9"
 )
 
 var ErrCacheMiss = errors.New("cache miss")
 
+// Cache tiers used as metric labels.
+const (
+	tierRedis  = "redis"
+	tierMemory = "memory"
+)
+
 type CachedToken struct {
 	AccessToken       string   `json:"access_token"`
 	UserID            string   `json:"user_id"`
@@ -19,6 +26,14 @@ type CachedToken struct {
 	Groups            []string `json:"groups"`
 	PreferredUsername string   `json:"preferred_username"`
 	IsInvalid         bool     `json:"is_invalid"` // true indicates an invalid token cached to prevent penetration
+	// SoftExpiresAt is when the entry becomes stale: it is still served until
+	// its TTL ends but should be refreshed. Zero never goes stale.
+	SoftExpiresAt time.Time `json:"soft_expires_at,omitzero"`
+}
+
+// Stale reports whether the entry is past its soft expiry at now.
+func (t *CachedToken) Stale(now time.Time) bool {
+	return !t.SoftExpiresAt.IsZero() && !now.Before(t.SoftExpiresAt)
 }
 
 type TokenCache interface {
@@ -39,6 +54,7 @@ func NewRedisClient(url string, poolSize int) (*redis.Client, error) {
 	opt.PoolSize = poolSize
 
 	client := redis.NewClient(opt)
+	client.AddHook(metricsHook{})
 
 	ctx := context.Background()
 	if err = client.Ping(ctx).Err(); err != nil {
@@ -56,17 +72,21 @@ func (r *redisCache) Get(ctx context.Context, patHash string) (*CachedToken, err
 	key := fmt.Sprintf("authz:pat:%s", patHash)
 	val, err := r.client.Get(ctx, key).Result()
 	if errors.Is(err, redis.Nil) {
+		metrics.RecordCache(tierRedis, metrics.CacheMiss)
 		return nil, ErrCacheMiss
 	}
 	if err != nil {
+		metrics.RecordCache(tierRedis, metrics.CacheError)
 		return nil, fmt.Errorf("failed to get from redis: %w", err)
 	}
 
 	var token CachedToken
 	if err = json.Unmarshal([]byte(val), &token); err != nil {
+		metrics.RecordCache(tierRedis, metrics.CacheError)
 		return nil, fmt.Errorf("failed to unmarshal cached token: %w", err)
 	}
 
+	metrics.RecordCache(tierRedis, metrics.CacheHit)
 	return &token, nil
 }
 
@@ -0,0 +1,144 @@
+// Package mail sends PAT expiry reminders by email.
+package mail
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+
+	patdomain "github.com/astro-web3/oauth2-token-exchange/internal/domain/pat"
+	"github.com/astro-web3/oauth2-token-exchange/pkg/secret"
+)
+
+// DefaultSMTPTimeout bounds a whole SMTP exchange when SMTPConfig.Timeout is zero.
+const DefaultSMTPTimeout = 30 * time.Second
+
+var ErrNoRecipient = errors.New("PAT owner has no email address")
+
+// SMTPConfig is the mail server used to send reminders. Username and
+// Password are optional; when set, PLAIN auth is used, which net/smtp only
+// allows over TLS or to localhost. Password is resolved for every message.
+// Timeout bounds the whole exchange with the server, from dial to QUIT.
+type SMTPConfig struct {
+	Addr     string
+	Username string
+	Password secret.Secret
+	From     string
+	Timeout  time.Duration
+}
+
+type smtpSender struct {
+	cfg SMTPConfig
+}
+
+// NewSMTPSender returns a ReminderSender that emails the owner of the PAT.
+func NewSMTPSender(cfg SMTPConfig) patdomain.ReminderSender {
+	return &smtpSender{cfg: cfg}
+}
+
+func (s *smtpSender) SendReminder(ctx context.Context, reminder patdomain.ExpiryReminder) error {
+	to := reminder.Email
+	if to == "" {
+		return ErrNoRecipient
+	}
+	if strings.ContainsAny(to, "\r\n") {
+		return fmt.Errorf("invalid recipient address %q", to)
+	}
+
+	if err := s.send(ctx, to, message(s.cfg.From, reminder)); err != nil {
+		return fmt.Errorf("failed to send reminder email: %w", err)
+	}
+	return nil
+}
+
+// send delivers msg like smtp.SendMail, but dials with ctx and puts a
+// deadline on the connection, so a hung server cannot block the caller.
+func (s *smtpSender) send(ctx context.Context, to string, msg []byte) error {
+	host, _, err := net.SplitHostPort(s.cfg.Addr)
+	if err != nil {
+		return fmt.Errorf("invalid SMTP address: %w", err)
+	}
+
+	timeout := s.cfg.Timeout
+	if timeout <= 0 {
+		timeout = DefaultSMTPTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", s.cfg.Addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	deadline, _ := ctx.Deadline()
+	if err = conn.SetDeadline(deadline); err != nil {
+		return err
+	}
+	// Cancelling ctx unblocks reads and writes in progress.
+	stop := context.AfterFunc(ctx, func() { _ = conn.SetDeadline(time.Now()) })
+	defer stop()
+
+	client, err := smtp.NewClient(conn, host)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err = client.StartTLS(&tls.Config{ServerName: host, MinVersion: tls.VersionTLS12}); err != nil {
+			return err
+		}
+	}
+	if s.cfg.Username != "" {
+		var password string
+		if s.cfg.Password != nil {
+			password = s.cfg.Password.Value()
+		}
+		if err = client.Auth(smtp.PlainAuth("", s.cfg.Username, password, host)); err != nil {
+			return err
+		}
+	}
+
+	if err = client.Mail(s.cfg.From); err != nil {
+		return err
+	}
+	if err = client.Rcpt(to); err != nil {
+		return err
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err = w.Write(msg); err != nil {
+		return err
+	}
+	if err = w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+func message(from string, reminder patdomain.ExpiryReminder) []byte {
+	expires := reminder.PAT.ExpirationDate.UTC().Format(time.RFC1123)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", reminder.Email)
+	fmt.Fprintf(&b, "Subject: Your personal access token %s expires %s\r\n", reminder.PAT.ID, expires)
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	b.WriteString("\r\n")
+	fmt.Fprintf(&b, "Your personal access token %s expires on %s.\r\n", reminder.PAT.ID, expires)
+	b.WriteString("\r\n")
+	b.WriteString("Create a new token and update the pipelines and tools that use this one\r\n")
+	b.WriteString("before it expires, then delete the old token.\r\n")
+	return []byte(b.String())
+}
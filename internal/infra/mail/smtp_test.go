@@ -0,0 +1,60 @@
+package mail_test
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	patdomain "github.com/astro-web3/oauth2-token-exchange/internal/domain/pat"
+	"github.com/astro-web3/oauth2-token-exchange/internal/infra/mail"
+)
+
+func TestSMTPSender_HungServerTimesOut(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer listener.Close()
+
+	// The server accepts connections but never sends its greeting.
+	go func() {
+		for {
+			conn, acceptErr := listener.Accept()
+			if acceptErr != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	sender := mail.NewSMTPSender(mail.SMTPConfig{
+		Addr:    listener.Addr().String(),
+		From:    "no-reply@example.com",
+		Timeout: 100 * time.Millisecond,
+	})
+	reminder := patdomain.ExpiryReminder{
+		PAT:   &patdomain.PAT{ID: "pat-1", ExpirationDate: time.Now().Add(24 * time.Hour)},
+		Email: "alice@example.com",
+	}
+
+	start := time.Now()
+	if err = sender.SendReminder(context.Background(), reminder); err == nil {
+		t.Fatal("expected the send to fail")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("expected the timeout to end the send, took %s", elapsed)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	sender = mail.NewSMTPSender(mail.SMTPConfig{Addr: listener.Addr().String(), From: "no-reply@example.com"})
+
+	start = time.Now()
+	if err = sender.SendReminder(ctx, reminder); err == nil {
+		t.Fatal("expected the send to fail")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("expected cancellation to end the send, took %s", elapsed)
+	}
+}
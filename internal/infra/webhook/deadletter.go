@@ -0,0 +1,79 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/astro-web3/oauth2-token-exchange/pkg/logger"
+)
+
+const deadLetterFileMode = 0o600
+
+// deadLetter is a delivery that was given up on.
+type deadLetter struct {
+	Time       time.Time       `json:"time"`
+	Endpoint   string          `json:"endpoint"`
+	DeliveryID string          `json:"delivery_id"`
+	Event      string          `json:"event"`
+	Error      string          `json:"error"`
+	Payload    json.RawMessage `json:"payload"`
+}
+
+// DeadLetterLog records failed deliveries as JSON lines so they can be
+// inspected and replayed. Without a file they are logged as errors.
+type DeadLetterLog struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// NewDeadLetterLog appends to the file at path, or logs only if path is empty.
+func NewDeadLetterLog(path string) (*DeadLetterLog, error) {
+	if path == "" {
+		return &DeadLetterLog{}, nil
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, deadLetterFileMode)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open webhook dead-letter log: %w", err)
+	}
+	return &DeadLetterLog{file: file}, nil
+}
+
+func (l *DeadLetterLog) write(entry deadLetter) {
+	logger.ErrorContext(context.Background(), "webhook delivery failed permanently",
+		slog.String("endpoint", entry.Endpoint),
+		slog.String("delivery_id", entry.DeliveryID),
+		slog.String("event", entry.Event),
+		slog.String("error", entry.Error),
+	)
+	if l.file == nil {
+		return
+	}
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+	line = append(line, '\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if _, err = l.file.Write(line); err != nil {
+		logger.ErrorContext(context.Background(), "failed to write webhook dead-letter log",
+			slog.String("error", err.Error()),
+		)
+	}
+}
+
+func (l *DeadLetterLog) Close() error {
+	if l.file == nil {
+		return nil
+	}
+	return l.file.Close()
+}
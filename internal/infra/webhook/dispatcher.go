@@ -0,0 +1,247 @@
+// Package webhook delivers PAT lifecycle notifications to HTTP endpoints as
+// HMAC-signed JSON, with retries and a dead-letter log.
+package webhook
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	patdomain "github.com/astro-web3/oauth2-token-exchange/internal/domain/pat"
+	httpclient "github.com/astro-web3/oauth2-token-exchange/pkg/http"
+	"github.com/astro-web3/oauth2-token-exchange/pkg/retry"
+	"github.com/astro-web3/oauth2-token-exchange/pkg/secret"
+)
+
+const (
+	queueSize       = 256
+	attemptTimeout  = 10 * time.Second
+	deliveryIDBytes = 16
+)
+
+var errQueueFull = errors.New("webhook queue is full")
+
+// Endpoint is a webhook receiver and the notification types it subscribes
+// to; no Events subscribes to all of them. URL and Secret are resolved for
+// every delivery, so rotated values apply to the next one.
+type Endpoint struct {
+	Name   string
+	URL    secret.Secret
+	Secret secret.Secret
+	Events []patdomain.NotificationType
+	Retry  retry.Policy
+}
+
+func (e *Endpoint) subscribed(t patdomain.NotificationType) bool {
+	return len(e.Events) == 0 || slices.Contains(e.Events, t)
+}
+
+// payload is the JSON body sent to receivers. Text is a one-line summary so
+// chat webhooks such as Slack can display it as-is.
+type payload struct {
+	patdomain.Notification
+
+	ID   string `json:"id"`
+	Text string `json:"text"`
+}
+
+// Dispatcher implements patdomain.Notifier. Each endpoint has its own queue
+// and worker, so a failing receiver only delays its own deliveries.
+type Dispatcher struct {
+	workers    []*worker
+	deadLetter *DeadLetterLog
+
+	// mu is held for reading while queueing, so Close cannot close the
+	// queues during a send. Notifications after Close are dropped.
+	mu     sync.RWMutex
+	closed bool
+}
+
+type worker struct {
+	endpoint   Endpoint
+	http       *httpclient.Client
+	deadLetter *DeadLetterLog
+	queue      chan delivery
+	done       chan struct{}
+}
+
+type delivery struct {
+	id    string
+	event patdomain.NotificationType
+	body  []byte
+}
+
+// NewDispatcher starts one worker per endpoint, sending through client or, if
+// nil, the default HTTP client. Close stops the workers after the queued
+// deliveries have been attempted.
+func NewDispatcher(endpoints []Endpoint, deadLetter *DeadLetterLog, client *httpclient.Client) *Dispatcher {
+	if client == nil {
+		client = httpclient.Default()
+	}
+	d := &Dispatcher{deadLetter: deadLetter}
+	for _, endpoint := range endpoints {
+		w := &worker{
+			endpoint:   endpoint,
+			http:       client,
+			deadLetter: deadLetter,
+			queue:      make(chan delivery, queueSize),
+			done:       make(chan struct{}),
+		}
+		go w.run()
+		d.workers = append(d.workers, w)
+	}
+	return d
+}
+
+func (d *Dispatcher) Notify(_ context.Context, notification patdomain.Notification) {
+	p := payload{
+		ID:           newDeliveryID(),
+		Text:         summary(notification),
+		Notification: notification,
+	}
+	body, err := json.Marshal(p)
+	if err != nil {
+		return
+	}
+
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	if d.closed {
+		return
+	}
+
+	for _, w := range d.workers {
+		if !w.endpoint.subscribed(notification.Type) {
+			continue
+		}
+
+		dl := delivery{id: p.ID, event: notification.Type, body: body}
+		select {
+		case w.queue <- dl:
+		default:
+			w.giveUp(dl, errQueueFull)
+		}
+	}
+}
+
+// SendReminder implements patdomain.ReminderSender by notifying the endpoints
+// subscribed to pat.expiring. Delivery is asynchronous, so it never fails.
+func (d *Dispatcher) SendReminder(ctx context.Context, reminder patdomain.ExpiryReminder) error {
+	d.Notify(ctx, patdomain.Notification{
+		Type:           patdomain.NotificationPATExpiring,
+		Time:           time.Now().UTC(),
+		UserID:         reminder.PAT.HumanUserID,
+		PATID:          reminder.PAT.ID,
+		MachineUserID:  reminder.PAT.MachineUserID,
+		ExpirationDate: &reminder.PAT.ExpirationDate,
+		Email:          reminder.Email,
+	})
+	return nil
+}
+
+func (d *Dispatcher) Close() error {
+	d.mu.Lock()
+	if !d.closed {
+		d.closed = true
+		for _, w := range d.workers {
+			close(w.queue)
+		}
+	}
+	d.mu.Unlock()
+
+	for _, w := range d.workers {
+		<-w.done
+	}
+	return d.deadLetter.Close()
+}
+
+func (w *worker) run() {
+	defer close(w.done)
+
+	for dl := range w.queue {
+		err := retry.Do(context.Background(), w.endpoint.Retry, func(ctx context.Context) error {
+			return w.deliver(ctx, dl)
+		})
+		if err != nil {
+			w.giveUp(dl, err)
+		}
+	}
+}
+
+func (w *worker) deliver(ctx context.Context, dl delivery) error {
+	ctx, cancel := context.WithTimeout(ctx, attemptTimeout)
+	defer cancel()
+
+	timestamp := time.Now().Unix()
+	var secret string
+	if w.endpoint.Secret != nil {
+		secret = w.endpoint.Secret.Value()
+	}
+	resp, err := w.http.Post(ctx, w.endpoint.URL.Value(),
+		httpclient.WithBody(dl.body),
+		httpclient.WithHeader(HeaderSignature, Sign(secret, timestamp, dl.body)),
+		httpclient.WithHeader(HeaderTimestamp, strconv.FormatInt(timestamp, 10)),
+		httpclient.WithHeader(HeaderEvent, string(dl.event)),
+		httpclient.WithHeader(HeaderDelivery, dl.id),
+	)
+	if err != nil {
+		return fmt.Errorf("webhook request failed: %w", err)
+	}
+
+	status := resp.StatusCode()
+	switch {
+	case status < http.StatusBadRequest:
+		return nil
+	case status == http.StatusTooManyRequests || status >= http.StatusInternalServerError:
+		return fmt.Errorf("webhook returned %s", resp.Status())
+	default:
+		return retry.Permanent(fmt.Errorf("webhook returned %s", resp.Status()))
+	}
+}
+
+func (w *worker) giveUp(dl delivery, err error) {
+	w.deadLetter.write(deadLetter{
+		Time:       time.Now().UTC(),
+		Endpoint:   w.endpoint.Name,
+		DeliveryID: dl.id,
+		Event:      string(dl.event),
+		Error:      err.Error(),
+		Payload:    dl.body,
+	})
+}
+
+func summary(n patdomain.Notification) string {
+	var text string
+	switch n.Type {
+	case patdomain.NotificationPATCreated:
+		text = fmt.Sprintf("PAT %s created by %s", n.PATID, n.UserID)
+	case patdomain.NotificationPATDeleted:
+		text = fmt.Sprintf("PAT %s deleted by %s", n.PATID, n.UserID)
+	case patdomain.NotificationPATLongLived:
+		text = fmt.Sprintf("Long-lived PAT %s created by %s", n.PATID, n.UserID)
+	case patdomain.NotificationPATExpiring:
+		text = fmt.Sprintf("PAT %s of %s is about to expire", n.PATID, n.UserID)
+	case patdomain.NotificationPATRotated:
+		text = fmt.Sprintf("PAT %s rotated by %s, replaced by %s", n.ReplacedPATID, n.UserID, n.PATID)
+	default:
+		text = fmt.Sprintf("%s: PAT %s of %s", n.Type, n.PATID, n.UserID)
+	}
+	if n.ExpirationDate != nil {
+		text += ", expires " + n.ExpirationDate.UTC().Format(time.RFC3339)
+	}
+	return text
+}
+
+func newDeliveryID() string {
+	b := make([]byte, deliveryIDBytes)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
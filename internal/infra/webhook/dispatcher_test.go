@@ -0,0 +1,167 @@
+package webhook_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/astro-web3/oauth2-token-exchange/internal/config"
+	patdomain "github.com/astro-web3/oauth2-token-exchange/internal/domain/pat"
+	"github.com/astro-web3/oauth2-token-exchange/internal/infra/webhook"
+	"github.com/astro-web3/oauth2-token-exchange/pkg/retry"
+	"github.com/astro-web3/oauth2-token-exchange/pkg/secret"
+)
+
+func TestDispatcher_SignsAndFiltersByEvent(t *testing.T) {
+	type received struct {
+		event string
+		valid bool
+		body  map[string]any
+	}
+	deliveries := make(chan received, 4)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		timestamp, _ := strconv.ParseInt(r.Header.Get(webhook.HeaderTimestamp), 10, 64)
+
+		var decoded map[string]any
+		_ = json.Unmarshal(body, &decoded)
+		deliveries <- received{
+			event: r.Header.Get(webhook.HeaderEvent),
+			valid: webhook.Verify("s3cret", timestamp, body, r.Header.Get(webhook.HeaderSignature)),
+			body:  decoded,
+		}
+	}))
+	defer srv.Close()
+
+	deadLetter, _ := webhook.NewDeadLetterLog("")
+	d := webhook.NewDispatcher([]webhook.Endpoint{{
+		Name:   "siem",
+		URL:    secret.Static(srv.URL),
+		Secret: secret.Static("s3cret"),
+		Events: []patdomain.NotificationType{patdomain.NotificationPATDeleted},
+	}}, deadLetter, nil)
+
+	ctx := context.Background()
+	d.Notify(ctx, patdomain.Notification{Type: patdomain.NotificationPATCreated, UserID: "user-1", PATID: "pat-1"})
+	d.Notify(ctx, patdomain.Notification{Type: patdomain.NotificationPATDeleted, UserID: "user-1", PATID: "pat-1"})
+	_ = d.Close()
+	close(deliveries)
+
+	var got []received
+	for r := range deliveries {
+		got = append(got, r)
+	}
+	if len(got) != 1 {
+		t.Fatalf("expected only the subscribed event to be delivered, got %d deliveries", len(got))
+	}
+	if got[0].event != string(patdomain.NotificationPATDeleted) || !got[0].valid {
+		t.Errorf("unexpected delivery: %+v", got[0])
+	}
+	if got[0].body["pat_id"] != "pat-1" || got[0].body["text"] == "" {
+		t.Errorf("unexpected payload: %v", got[0].body)
+	}
+}
+
+func TestDispatcher_DeadLettersRejectedDeliveries(t *testing.T) {
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer srv.Close()
+
+	path := filepath.Join(t.TempDir(), "dead-letter.log")
+	deadLetter, err := webhook.NewDeadLetterLog(path)
+	if err != nil {
+		t.Fatalf("failed to open dead-letter log: %v", err)
+	}
+
+	d := webhook.NewDispatcher([]webhook.Endpoint{{
+		Name:   "slack",
+		URL:    secret.Static(srv.URL),
+		Secret: secret.Static("s3cret"),
+		Retry:  retry.Policy{MaxAttempts: 3, InitialBackoff: time.Millisecond},
+	}}, deadLetter, nil)
+	d.Notify(context.Background(), patdomain.Notification{Type: patdomain.NotificationPATCreated, PATID: "pat-1"})
+	_ = d.Close()
+
+	if calls != 1 {
+		t.Errorf("expected 4xx not to be retried, got %d calls", calls)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read dead-letter log: %v", err)
+	}
+	if !strings.Contains(string(data), `"endpoint":"slack"`) || !strings.Contains(string(data), `"pat_id":"pat-1"`) {
+		t.Errorf("unexpected dead-letter log: %s", data)
+	}
+}
+
+func TestDispatcher_ResolvesRotatedSecret(t *testing.T) {
+	t.Setenv("WEBHOOK_SECRET", "old-secret")
+
+	signatures := make(chan bool)
+	srv := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		timestamp, _ := strconv.ParseInt(r.Header.Get(webhook.HeaderTimestamp), 10, 64)
+		signatures <- webhook.Verify(os.Getenv("WEBHOOK_SECRET"), timestamp, body, r.Header.Get(webhook.HeaderSignature))
+	}))
+	defer srv.Close()
+
+	deadLetter, _ := webhook.NewDeadLetterLog("")
+	d := webhook.NewDispatcher([]webhook.Endpoint{{
+		Name:   "siem",
+		URL:    secret.Static(srv.URL),
+		Secret: config.Secret("env://WEBHOOK_SECRET"),
+	}}, deadLetter, nil)
+	defer func() { _ = d.Close() }()
+
+	notification := patdomain.Notification{Type: patdomain.NotificationPATCreated, PATID: "pat-1"}
+	d.Notify(context.Background(), notification)
+	if !<-signatures {
+		t.Fatal("expected the delivery to be signed with the current secret")
+	}
+
+	t.Setenv("WEBHOOK_SECRET", "new-secret")
+	d.Notify(context.Background(), notification)
+	if !<-signatures {
+		t.Error("expected the delivery after rotation to be signed with the new secret")
+	}
+}
+
+func TestDispatcher_DropsNotificationsAfterClose(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	defer srv.Close()
+
+	deadLetter, _ := webhook.NewDeadLetterLog("")
+	d := webhook.NewDispatcher([]webhook.Endpoint{{
+		Name: "siem",
+		URL:  secret.Static(srv.URL),
+	}}, deadLetter, nil)
+
+	// Requests still running when the server shuts down may notify while or
+	// after the dispatcher is closed.
+	notification := patdomain.Notification{Type: patdomain.NotificationPATDeleted, PATID: "pat-1"}
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Go(func() {
+			for range 100 {
+				d.Notify(context.Background(), notification)
+			}
+		})
+	}
+	_ = d.Close()
+	wg.Wait()
+	d.Notify(context.Background(), notification)
+}
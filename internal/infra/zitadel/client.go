@@ -12,9 +12,16 @@ import (
 
 	httpclient "github.com/astro-web3/oauth2-token-exchange/pkg/http"
 	"github.com/astro-web3/oauth2-token-exchange/pkg/logger"
+	"github.com/astro-web3/oauth2-token-exchange/pkg/secret"
 )
 
-const defaultPersonalAccessTokenPageLimit = 100
+const (
+	defaultPersonalAccessTokenPageLimit = 100
+	defaultUserPageLimit                = 100
+)
+
+// ErrNotFound is returned when the requested resource does not exist.
+var ErrNotFound = errors.New("not found")
 
 type UserInfo struct {
 	Sub      string `json:"sub"`
@@ -48,6 +55,7 @@ type UserInfoGetter interface {
 
 type MachineUserManager interface {
 	GetMachineUserByUsername(ctx context.Context, adminPAT, username string) (*MachineUser, error)
+	ListMachineUsers(ctx context.Context, adminPAT string) ([]*MachineUser, error)
 	CreateMachineUser(ctx context.Context, adminPAT, username, name, description string) (*MachineUser, error)
 }
 
@@ -71,17 +79,42 @@ type Client interface {
 type zitadelClient struct {
 	issuer         string
 	clientID       string
-	clientSecret   string
 	organizationID string
+	clientAuth     clientAuthenticator
+	resilience     *Resilience
+	http           *httpclient.Client
 }
 
-func NewClient(issuer, clientID, clientSecret, organizationID string) Client {
+func NewClient(
+	issuer, clientID string,
+	clientSecret secret.Secret,
+	organizationID string,
+	opts ...ClientOption,
+) Client {
 	issuer = strings.TrimSuffix(issuer, "/")
-	return &zitadelClient{
+	c := &zitadelClient{
 		issuer:         issuer,
 		clientID:       clientID,
-		clientSecret:   clientSecret,
 		organizationID: organizationID,
+		clientAuth:     &clientSecretBasicAuth{clientID: clientID, clientSecret: clientSecret},
+		http:           httpclient.Default(),
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.resilience == nil {
+		c.resilience = defaultResilience()
+	}
+
+	return c
+}
+
+// WithHTTPClient sends the client's requests through client instead of the
+// shared default HTTP client.
+func WithHTTPClient(client *httpclient.Client) ClientOption {
+	return func(c *zitadelClient) {
+		c.http = client
 	}
 }
 
@@ -96,14 +129,24 @@ func (c *zitadelClient) Exchange(ctx context.Context, pat string) (*TokenRespons
 
 	tokenEndpoint := c.issuer + "/oauth/v2/token"
 
+	authOpts, err := c.clientAuth.authenticate(form)
+	if err != nil {
+		return nil, fmt.Errorf("client authentication failed: %w", err)
+	}
+
 	var tokenResp TokenResponse
-	resp, err := httpclient.Post(
+	resp, err := c.resilience.call(
 		ctx,
+		c.http,
+		endpointTokenExchange,
+		http.MethodPost,
 		tokenEndpoint,
-		httpclient.WithBasicAuth(c.clientID, c.clientSecret),
-		httpclient.WithBody(form.Encode()),
-		httpclient.WithContentType("application/x-www-form-urlencoded"),
-		httpclient.WithResult(&tokenResp),
+		append(
+			authOpts,
+			httpclient.WithBody(form.Encode()),
+			httpclient.WithContentType("application/x-www-form-urlencoded"),
+			httpclient.WithResult(&tokenResp),
+		)...,
 	)
 	if err != nil {
 		logger.ErrorContext(ctx, "Token exchange request failed",
@@ -146,14 +189,24 @@ func (c *zitadelClient) ExchangeWithActor(
 
 	tokenEndpoint := c.issuer + "/oauth/v2/token"
 
+	authOpts, err := c.clientAuth.authenticate(form)
+	if err != nil {
+		return nil, fmt.Errorf("client authentication failed: %w", err)
+	}
+
 	var tokenResp TokenResponse
-	resp, err := httpclient.Post(
+	resp, err := c.resilience.call(
 		ctx,
+		c.http,
+		endpointTokenExchangeWithActor,
+		http.MethodPost,
 		tokenEndpoint,
-		httpclient.WithBasicAuth(c.clientID, c.clientSecret),
-		httpclient.WithBody(form.Encode()),
-		httpclient.WithContentType("application/x-www-form-urlencoded"),
-		httpclient.WithResult(&tokenResp),
+		append(
+			authOpts,
+			httpclient.WithBody(form.Encode()),
+			httpclient.WithContentType("application/x-www-form-urlencoded"),
+			httpclient.WithResult(&tokenResp),
+		)...,
 	)
 	if err != nil {
 		logger.ErrorContext(ctx, "Token exchange with actor request failed",
@@ -184,7 +237,15 @@ func (c *zitadelClient) GetUserInfo(ctx context.Context, pat string) (*UserInfo,
 	userInfoEndpoint := c.issuer + "/oidc/v1/userinfo"
 
 	var userInfo UserInfo
-	resp, err := httpclient.Get(ctx, userInfoEndpoint, httpclient.WithAuthToken(pat), httpclient.WithResult(&userInfo))
+	resp, err := c.resilience.call(
+		ctx,
+		c.http,
+		endpointUserInfo,
+		http.MethodGet,
+		userInfoEndpoint,
+		httpclient.WithAuthToken(pat),
+		httpclient.WithResult(&userInfo),
+	)
 	if err != nil {
 		logger.ErrorContext(ctx, "Get userinfo request failed",
 			slog.String("endpoint", userInfoEndpoint),
@@ -239,8 +300,11 @@ func (c *zitadelClient) GetMachineUserByUsername(ctx context.Context, adminPAT,
 
 	var result ListUsersResponse
 
-	resp, err := httpclient.Post(
+	resp, err := c.resilience.call(
 		ctx,
+		c.http,
+		endpointListUsers,
+		http.MethodPost,
 		searchEndpoint,
 		httpclient.WithAuthToken(adminPAT),
 		httpclient.WithBody(reqBody),
@@ -320,6 +384,76 @@ func (c *zitadelClient) GetMachineUserByUsername(ctx context.Context, adminPAT,
 	}, nil
 }
 
+// ListMachineUsers returns every machine user of the organization, following
+// pagination until all pages have been read.
+func (c *zitadelClient) ListMachineUsers(ctx context.Context, adminPAT string) ([]*MachineUser, error) {
+	var users []*MachineUser
+	for offset := uint64(0); ; {
+		result, err := c.listMachineUsersPage(ctx, adminPAT, offset)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, user := range result.Result {
+			if user.UserID == "" || user.Machine == nil {
+				continue
+			}
+			users = append(users, &MachineUser{
+				ID:          user.UserID,
+				Username:    user.Username,
+				Name:        user.Machine.Name,
+				Description: user.Machine.Description,
+			})
+		}
+
+		offset += uint64(len(result.Result))
+		if !result.Details.hasMore(offset, len(result.Result), defaultUserPageLimit) {
+			return users, nil
+		}
+	}
+}
+
+func (c *zitadelClient) listMachineUsersPage(
+	ctx context.Context,
+	adminPAT string,
+	offset uint64,
+) (*ListUsersResponse, error) {
+	reqBody := &ListUsersRequest{
+		Query: &ListQuery{
+			Offset: offset,
+			Limit:  defaultUserPageLimit,
+			Asc:    true,
+		},
+		Queries: []*SearchQuery{
+			{TypeQuery: &TypeQuery{Type: UserTypeMachine}},
+			{OrganizationIDQuery: &OrganizationIDQuery{OrganizationID: c.organizationID}},
+		},
+	}
+
+	var result ListUsersResponse
+	resp, err := c.resilience.call(
+		ctx,
+		c.http,
+		endpointListUsers,
+		http.MethodPost,
+		c.issuer+"/v2/users",
+		httpclient.WithAuthToken(adminPAT),
+		httpclient.WithBody(reqBody),
+		httpclient.WithResult(&result),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("list machine users failed: %w", err)
+	}
+	if resp.StatusCode() >= http.StatusBadRequest {
+		return nil, fmt.Errorf(
+			"list machine users failed with status %d: %s",
+			resp.StatusCode(),
+			string(resp.Body()),
+		)
+	}
+	return &result, nil
+}
+
 func (c *zitadelClient) CreateMachineUser(
 	ctx context.Context,
 	adminPAT, username, name, description string,
@@ -338,8 +472,11 @@ func (c *zitadelClient) CreateMachineUser(
 
 	var result CreateUserResponse
 
-	resp, err := httpclient.Post(
+	resp, err := c.resilience.call(
 		ctx,
+		c.http,
+		endpointCreateUser,
+		http.MethodPost,
 		createEndpoint,
 		httpclient.WithAuthToken(adminPAT),
 		httpclient.WithBody(reqBody),
@@ -428,8 +565,11 @@ func (c *zitadelClient) AddPersonalAccessToken(
 
 	var result AddPersonalAccessTokenResponse
 
-	resp, err := httpclient.Post(
+	resp, err := c.resilience.call(
 		ctx,
+		c.http,
+		endpointAddPAT,
+		http.MethodPost,
 		createEndpoint,
 		httpclient.WithAuthToken(adminPAT),
 		httpclient.WithBody(reqBody),
@@ -480,15 +620,42 @@ func (c *zitadelClient) AddPersonalAccessToken(
 	}, result.Token, nil
 }
 
+// ListPersonalAccessTokens returns every PAT of the user, following
+// pagination until all pages have been read.
 func (c *zitadelClient) ListPersonalAccessTokens(
 	ctx context.Context,
 	adminPAT, userID string,
 ) ([]*PersonalAccessToken, error) {
+	var pats []*PersonalAccessToken
+	for offset := uint64(0); ; {
+		result, err := c.listPersonalAccessTokensPage(ctx, adminPAT, userID, offset)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, pat := range result.Result {
+			pats = append(pats, pat.toPersonalAccessToken(userID))
+		}
+
+		offset += uint64(len(result.Result))
+		if !result.Pagination.hasMore(offset, len(result.Result), defaultPersonalAccessTokenPageLimit) {
+			return pats, nil
+		}
+	}
+}
+
+func (c *zitadelClient) listPersonalAccessTokensPage(
+	ctx context.Context,
+	adminPAT, userID string,
+	offset uint64,
+) (*ListPersonalAccessTokensResponse, error) {
 	listEndpoint := c.issuer + "/v2/users/pats/search"
 
 	reqBody := &ListPersonalAccessTokensRequest{
 		Pagination: &PaginationRequest{
-			Limit: defaultPersonalAccessTokenPageLimit,
+			Offset: offset,
+			Limit:  defaultPersonalAccessTokenPageLimit,
+			Asc:    true,
 		},
 		Filters: []*PersonalAccessTokensSearchFilter{
 			{
@@ -501,8 +668,11 @@ func (c *zitadelClient) ListPersonalAccessTokens(
 
 	var result ListPersonalAccessTokensResponse
 
-	resp, err := httpclient.Post(
+	resp, err := c.resilience.call(
 		ctx,
+		c.http,
+		endpointListPATs,
+		http.MethodPost,
 		listEndpoint,
 		httpclient.WithAuthToken(adminPAT),
 		httpclient.WithBody(reqBody),
@@ -532,32 +702,7 @@ func (c *zitadelClient) ListPersonalAccessTokens(
 		)
 	}
 
-	pats := make([]*PersonalAccessToken, 0, len(result.Result))
-	for _, pat := range result.Result {
-		patUserID := pat.UserID
-		if patUserID == "" {
-			patUserID = userID
-		}
-
-		var expirationDate time.Time
-		if pat.ExpirationDate != nil {
-			expirationDate = pat.ExpirationDate.Time
-		}
-
-		var createdAt time.Time
-		if pat.CreationDate != nil {
-			createdAt = pat.CreationDate.Time
-		}
-
-		pats = append(pats, &PersonalAccessToken{
-			ID:             pat.ID,
-			UserID:         patUserID,
-			ExpirationDate: expirationDate,
-			CreatedAt:      createdAt,
-		})
-	}
-
-	return pats, nil
+	return &result, nil
 }
 
 func (c *zitadelClient) RemovePersonalAccessToken(ctx context.Context, adminPAT, userID, patID string) error {
@@ -565,8 +710,11 @@ func (c *zitadelClient) RemovePersonalAccessToken(ctx context.Context, adminPAT,
 
 	var result RemovePersonalAccessTokenResponse
 
-	resp, err := httpclient.Delete(
+	resp, err := c.resilience.call(
 		ctx,
+		c.http,
+		endpointRemovePAT,
+		http.MethodDelete,
 		deleteEndpoint,
 		httpclient.WithAuthToken(adminPAT),
 		httpclient.WithResult(&result),
@@ -590,6 +738,9 @@ func (c *zitadelClient) RemovePersonalAccessToken(ctx context.Context, adminPAT,
 			slog.Int("status_code", resp.StatusCode()),
 			slog.String("response_body", bodyStr),
 		)
+		if resp.StatusCode() == http.StatusNotFound {
+			return fmt.Errorf("remove personal access token %s: %w", patID, ErrNotFound)
+		}
 		return fmt.Errorf(
 			"remove personal access token failed with status %d: %s",
 			resp.StatusCode(),
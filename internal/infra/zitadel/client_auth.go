@@ -0,0 +1,86 @@
+package zitadel
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+
+	httpclient "github.com/astro-web3/oauth2-token-exchange/pkg/http"
+	"github.com/astro-web3/oauth2-token-exchange/pkg/secret"
+)
+
+const (
+	ClientAuthMethodSecretBasic   = "client_secret_basic"
+	ClientAuthMethodPrivateKeyJWT = "private_key_jwt"
+
+	//nolint:gosec // Assertion type identifier, not a credential.
+	clientAssertionTypeJWTBearer = "urn:ietf:params:oauth:client-assertion-type:jwt-bearer"
+)
+
+// ClientOption configures optional behaviour of the ZITADEL client.
+type ClientOption func(*zitadelClient)
+
+// WithPrivateKeyJWT authenticates the client at the token endpoint with a
+// client assertion signed by the application key instead of the client secret.
+func WithPrivateKeyJWT(key *KeyFile) ClientOption {
+	return func(c *zitadelClient) {
+		var keys keySource
+		if key != nil {
+			keys = &staticKey{key: key}
+		}
+		c.clientAuth = &privateKeyJWTAuth{keys: keys, audience: c.issuer}
+	}
+}
+
+// WithPrivateKeyJWTFile is WithPrivateKeyJWT with the application key read
+// from the key file at path. The file is read again when it changes.
+func WithPrivateKeyJWTFile(path string) ClientOption {
+	return func(c *zitadelClient) {
+		c.clientAuth = &privateKeyJWTAuth{keys: newKeyFileSource(path), audience: c.issuer}
+	}
+}
+
+// clientAuthenticator adds client authentication to a token endpoint request.
+// It may add form parameters, so it must run before the form is encoded.
+type clientAuthenticator interface {
+	authenticate(form url.Values) ([]httpclient.RequestOption, error)
+}
+
+type clientSecretBasicAuth struct {
+	clientID     string
+	clientSecret secret.Secret
+}
+
+func (a *clientSecretBasicAuth) authenticate(_ url.Values) ([]httpclient.RequestOption, error) {
+	var secret string
+	if a.clientSecret != nil {
+		secret = a.clientSecret.Value()
+	}
+	return []httpclient.RequestOption{httpclient.WithBasicAuth(a.clientID, secret)}, nil
+}
+
+type privateKeyJWTAuth struct {
+	keys     keySource
+	audience string
+}
+
+func (a *privateKeyJWTAuth) authenticate(form url.Values) ([]httpclient.RequestOption, error) {
+	if a.keys == nil {
+		return nil, errors.New("private_key_jwt client authentication requires an application key")
+	}
+
+	key, signer, err := a.keys.load()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load application key: %w", err)
+	}
+	assertion, err := signAssertion(key, signer, a.audience)
+	if err != nil {
+		return nil, err
+	}
+
+	form.Set("client_id", key.ClientID)
+	form.Set("client_assertion_type", clientAssertionTypeJWTBearer)
+	form.Set("client_assertion", assertion)
+
+	return nil, nil
+}
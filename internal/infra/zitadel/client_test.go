@@ -0,0 +1,257 @@
+package zitadel_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/astro-web3/oauth2-token-exchange/internal/infra/zitadel"
+	httpclient "github.com/astro-web3/oauth2-token-exchange/pkg/http"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestClient_Exchange_PrivateKeyJWT(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatalf("failed to marshal key: %v", err)
+	}
+
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, _, ok := r.BasicAuth(); ok {
+			t.Error("expected no basic auth with private_key_jwt")
+		}
+		if err := r.ParseForm(); err != nil {
+			t.Errorf("failed to parse form: %v", err)
+		}
+		if got := r.Form.Get("client_assertion_type"); got != "urn:ietf:params:oauth:client-assertion-type:jwt-bearer" {
+			t.Errorf("unexpected client_assertion_type %q", got)
+		}
+
+		token, err := jwt.Parse(r.Form.Get("client_assertion"), func(*jwt.Token) (any, error) {
+			return &key.PublicKey, nil
+		}, jwt.WithAudience(server.URL), jwt.WithIssuer("client-1"), jwt.WithValidMethods([]string{"ES256"}))
+		if err != nil {
+			t.Errorf("invalid client assertion: %v", err)
+		} else if token.Header["kid"] != "app-key-1" {
+			t.Errorf("unexpected kid %v", token.Header["kid"])
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"access_token":"jwt","token_type":"Bearer"}`))
+	}))
+	defer server.Close()
+
+	client := zitadel.NewClient(server.URL, "client-1", nil, "org-1", zitadel.WithPrivateKeyJWT(&zitadel.KeyFile{
+		Type:     zitadel.KeyTypeApplication,
+		KeyID:    "app-key-1",
+		Key:      string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+		ClientID: "client-1",
+	}))
+
+	resp, err := client.Exchange(context.Background(), "pat")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.AccessToken != "jwt" {
+		t.Errorf("expected access token jwt, got %s", resp.AccessToken)
+	}
+}
+
+func TestClient_Exchange_PrivateKeyJWTFileRotation(t *testing.T) {
+	var kids []any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Errorf("failed to parse form: %v", err)
+		}
+		token, _, err := jwt.NewParser().ParseUnverified(r.Form.Get("client_assertion"), jwt.MapClaims{})
+		if err != nil {
+			t.Errorf("invalid client assertion: %v", err)
+		} else {
+			kids = append(kids, token.Header["kid"])
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"access_token":"jwt","token_type":"Bearer"}`))
+	}))
+	defer server.Close()
+
+	path := filepath.Join(t.TempDir(), "app-key.json")
+	writeKey := func(keyID string) {
+		t.Helper()
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatalf("failed to generate key: %v", err)
+		}
+		der, err := x509.MarshalPKCS8PrivateKey(key)
+		if err != nil {
+			t.Fatalf("failed to marshal key: %v", err)
+		}
+		data, err := json.Marshal(&zitadel.KeyFile{
+			Type:     zitadel.KeyTypeApplication,
+			KeyID:    keyID,
+			Key:      string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+			ClientID: "client-1",
+		})
+		if err != nil {
+			t.Fatalf("failed to marshal key file: %v", err)
+		}
+		if err = os.WriteFile(path, data, 0o600); err != nil {
+			t.Fatalf("failed to write key file: %v", err)
+		}
+	}
+
+	writeKey("key-1")
+	client := zitadel.NewClient(server.URL, "client-1", nil, "org-1", zitadel.WithPrivateKeyJWTFile(path))
+	exchange := func() {
+		t.Helper()
+		if _, err := client.Exchange(context.Background(), "pat"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	exchange()
+	exchange()
+	writeKey("key-2-rotated")
+	// Rotations are detected by size or modification time.
+	if err := os.Chtimes(path, time.Now(), time.Now().Add(time.Second)); err != nil {
+		t.Fatalf("failed to touch key file: %v", err)
+	}
+	exchange()
+
+	if fmt.Sprint(kids) != "[key-1 key-1 key-2-rotated]" {
+		t.Errorf("expected the rotated key to be used, got kids %v", kids)
+	}
+}
+
+func TestClient_ListMachineUsers_Paginates(t *testing.T) {
+	const (
+		total        = 150
+		appliedLimit = 40 // below the requested limit, as Zitadel may cap it
+	)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req zitadel.ListUsersRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("failed to decode request: %v", err)
+		}
+
+		resp := zitadel.ListUsersResponse{Details: &zitadel.ListDetails{TotalResult: strconv.Itoa(total)}}
+		for i := req.Query.Offset; i < min(req.Query.Offset+min(uint64(req.Query.Limit), appliedLimit), total); i++ {
+			resp.Result = append(resp.Result, &zitadel.User{
+				UserID:   fmt.Sprintf("machine-%d", i),
+				Username: fmt.Sprintf("user-%d", i),
+				Machine:  &zitadel.MachineUserResponse{Description: fmt.Sprintf("user-%d@example.com", i)},
+			})
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(resp)
+	}))
+	defer server.Close()
+
+	client := zitadel.NewClient(server.URL, "client-1", nil, "org-1")
+
+	users, err := client.ListMachineUsers(context.Background(), "admin-pat")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(users) != total {
+		t.Fatalf("expected %d users across pages, got %d", total, len(users))
+	}
+	if users[total-1].Username != "user-149" || users[total-1].Description != "user-149@example.com" {
+		t.Errorf("unexpected last user: %+v", users[total-1])
+	}
+}
+
+func TestClient_ListPersonalAccessTokens_Paginates(t *testing.T) {
+	const (
+		total        = 250
+		appliedLimit = 40 // below the requested limit, as Zitadel may cap it
+	)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req zitadel.ListPersonalAccessTokensRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("failed to decode request: %v", err)
+		}
+
+		resp := zitadel.ListPersonalAccessTokensResponse{
+			Pagination: &zitadel.PaginationResponse{
+				TotalResult:  strconv.Itoa(total),
+				AppliedLimit: strconv.Itoa(appliedLimit),
+			},
+		}
+		offset := req.Pagination.Offset
+		for i := offset; i < min(offset+appliedLimit, total); i++ {
+			resp.Result = append(resp.Result, &zitadel.PersonalAccessTokenResponse{ID: fmt.Sprintf("pat-%d", i)})
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(resp)
+	}))
+	defer server.Close()
+
+	client := zitadel.NewClient(server.URL, "client-1", nil, "org-1")
+
+	pats, err := client.ListPersonalAccessTokens(context.Background(), "admin-pat", "machine-1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(pats) != total {
+		t.Fatalf("expected %d PATs across pages, got %d", total, len(pats))
+	}
+	if pats[total-1].ID != "pat-249" || pats[total-1].UserID != "machine-1" {
+		t.Errorf("unexpected last PAT: %+v", pats[total-1])
+	}
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) { return f(r) }
+
+func TestClient_WithHTTPClient(t *testing.T) {
+	httpClient, err := httpclient.New(httpclient.Config{
+		Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+			if r.URL.String() != "https://zitadel.internal/oidc/v1/userinfo" {
+				t.Errorf("unexpected URL %s", r.URL)
+			}
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Header:     http.Header{"Content-Type": []string{"application/json"}},
+				Body:       io.NopCloser(strings.NewReader(`{"sub":"user-1"}`)),
+				Request:    r,
+			}, nil
+		}),
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	client := zitadel.NewClient("https://zitadel.internal", "client-1", nil, "org-1", zitadel.WithHTTPClient(httpClient))
+
+	info, err := client.GetUserInfo(context.Background(), "pat")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if info.Sub != "user-1" {
+		t.Errorf("expected sub user-1, got %s", info.Sub)
+	}
+}
@@ -0,0 +1,211 @@
+package zitadel
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	KeyTypeServiceAccount = "serviceaccount"
+	KeyTypeApplication    = "application"
+
+	assertionLifetime = 5 * time.Minute
+	jtiBytes          = 16
+)
+
+// KeyFile is a ZITADEL key file as downloaded from the console, either for a
+// service account (JWT profile grant) or for an application (private_key_jwt).
+type KeyFile struct {
+	Type     string `json:"type"`
+	KeyID    string `json:"keyId"`
+	Key      string `json:"key"`
+	UserID   string `json:"userId,omitempty"`
+	AppID    string `json:"appId,omitempty"`
+	ClientID string `json:"clientId,omitempty"`
+}
+
+// LoadKeyFile reads and parses a ZITADEL key file from path.
+func LoadKeyFile(path string) (*KeyFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key file: %w", err)
+	}
+	return ParseKeyFile(data)
+}
+
+// ParseKeyFile parses the JSON content of a ZITADEL key file.
+func ParseKeyFile(data []byte) (*KeyFile, error) {
+	var key KeyFile
+	if err := json.Unmarshal(data, &key); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal key file: %w", err)
+	}
+	if key.KeyID == "" || key.Key == "" {
+		return nil, errors.New("key file is missing keyId or key")
+	}
+	return &key, nil
+}
+
+// subject returns the identity the key signs for: the user ID of a service
+// account or the client ID of an application.
+func (k *KeyFile) subject() string {
+	if k.Type == KeyTypeApplication {
+		return k.ClientID
+	}
+	return k.UserID
+}
+
+// keySource yields a key file together with its parsed private key.
+type keySource interface {
+	load() (*KeyFile, crypto.Signer, error)
+}
+
+// staticKey parses its key once, on first use.
+type staticKey struct {
+	key *KeyFile
+
+	once   sync.Once
+	signer crypto.Signer
+	err    error
+}
+
+func (s *staticKey) load() (*KeyFile, crypto.Signer, error) {
+	s.once.Do(func() {
+		s.signer, s.err = parsePrivateKey([]byte(s.key.Key))
+	})
+	return s.key, s.signer, s.err
+}
+
+// keyFileSource reads and parses the key file at path again only when its
+// size or modification time changes, so rotated keys are picked up without
+// parsing the key for every assertion.
+type keyFileSource struct {
+	path string
+
+	mu      sync.Mutex
+	size    int64
+	modTime time.Time
+	key     *KeyFile
+	signer  crypto.Signer
+}
+
+func newKeyFileSource(path string) *keyFileSource {
+	return &keyFileSource{path: path}
+}
+
+func (s *keyFileSource) load() (*KeyFile, crypto.Signer, error) {
+	info, err := os.Stat(s.path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read key file: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.key != nil && info.Size() == s.size && info.ModTime().Equal(s.modTime) {
+		return s.key, s.signer, nil
+	}
+
+	key, err := LoadKeyFile(s.path)
+	if err != nil {
+		return nil, nil, err
+	}
+	signer, err := parsePrivateKey([]byte(key.Key))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	s.size, s.modTime, s.key, s.signer = info.Size(), info.ModTime(), key, signer
+	return key, signer, nil
+}
+
+// signAssertion builds and signs a short-lived JWT assertion where the key's
+// subject is both issuer and subject, as required by RFC 7523.
+func signAssertion(k *KeyFile, signer crypto.Signer, audience string) (string, error) {
+	method, err := signingMethodFor(signer)
+	if err != nil {
+		return "", err
+	}
+
+	jti := make([]byte, jtiBytes)
+	if _, err = rand.Read(jti); err != nil {
+		return "", fmt.Errorf("failed to generate jti: %w", err)
+	}
+
+	now := time.Now()
+	token := jwt.NewWithClaims(method, jwt.RegisteredClaims{
+		Issuer:    k.subject(),
+		Subject:   k.subject(),
+		Audience:  jwt.ClaimStrings{audience},
+		IssuedAt:  jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(now.Add(assertionLifetime)),
+		ID:        hex.EncodeToString(jti),
+	})
+	token.Header["kid"] = k.KeyID
+
+	signed, err := token.SignedString(signer)
+	if err != nil {
+		return "", fmt.Errorf("failed to sign assertion: %w", err)
+	}
+
+	return signed, nil
+}
+
+func parsePrivateKey(data []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("private key is not PEM encoded")
+	}
+
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParseECPrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse private key: %w", err)
+	}
+
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported private key type %T", key)
+	}
+
+	return signer, nil
+}
+
+func signingMethodFor(signer crypto.Signer) (jwt.SigningMethod, error) {
+	switch key := signer.(type) {
+	case *rsa.PrivateKey:
+		return jwt.SigningMethodRS256, nil
+	case *ecdsa.PrivateKey:
+		switch key.Curve {
+		case elliptic.P256():
+			return jwt.SigningMethodES256, nil
+		case elliptic.P384():
+			return jwt.SigningMethodES384, nil
+		case elliptic.P521():
+			return jwt.SigningMethodES512, nil
+		default:
+			return nil, fmt.Errorf("unsupported EC curve %s", key.Curve.Params().Name)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported private key type %T", signer)
+	}
+}
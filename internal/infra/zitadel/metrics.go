@@ -0,0 +1,15 @@
+package zitadel
+
+// Endpoint names used as metric labels. They name the operation rather than
+// the URL path, which may contain user and PAT IDs.
+const (
+	endpointTokenExchange          = "token_exchange"
+	endpointTokenExchangeWithActor = "token_exchange_with_actor"
+	endpointJWTProfile             = "jwt_profile"
+	endpointUserInfo               = "userinfo"
+	endpointListUsers              = "list_users"
+	endpointCreateUser             = "create_user"
+	endpointAddPAT                 = "add_pat"
+	endpointListPATs               = "list_pats"
+	endpointRemovePAT              = "remove_pat"
+)
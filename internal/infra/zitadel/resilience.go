@@ -0,0 +1,323 @@
+package zitadel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	httpclient "github.com/astro-web3/oauth2-token-exchange/pkg/http"
+	"github.com/astro-web3/oauth2-token-exchange/pkg/logger"
+	"github.com/astro-web3/oauth2-token-exchange/pkg/metrics"
+	"github.com/astro-web3/oauth2-token-exchange/pkg/retry"
+	"github.com/go-resty/resty/v2"
+)
+
+// ErrUnavailable is returned when Zitadel cannot be reached, keeps failing
+// with 5xx or 429 responses, or the circuit breaker is open. It says nothing
+// about the credentials of the call.
+var ErrUnavailable = errors.New("zitadel unavailable")
+
+const (
+	authzCallTimeout      = 5 * time.Second
+	managementCallTimeout = 15 * time.Second
+
+	DefaultMaxAttempts      = 3
+	DefaultBaseBackoff      = 100 * time.Millisecond
+	DefaultMaxBackoff       = 2 * time.Second
+	DefaultFailureThreshold = 5
+	DefaultOpenDuration     = 30 * time.Second
+)
+
+// endpointPolicies sets the timeout of each attempt and whether an endpoint
+// may be retried. Calls on the authorization path get short timeouts. Calls
+// that create resources are never retried, as a lost response would create
+// them twice.
+//
+//nolint:gochecknoglobals // Read-only table of per-endpoint defaults.
+var endpointPolicies = map[string]struct {
+	timeout    time.Duration
+	idempotent bool
+}{
+	endpointTokenExchange:          {authzCallTimeout, true},
+	endpointTokenExchangeWithActor: {authzCallTimeout, true},
+	endpointJWTProfile:             {authzCallTimeout, true},
+	endpointUserInfo:               {authzCallTimeout, true},
+	endpointListUsers:              {managementCallTimeout, true},
+	endpointListPATs:               {managementCallTimeout, true},
+	endpointRemovePAT:              {managementCallTimeout, true},
+	endpointCreateUser:             {managementCallTimeout, false},
+	endpointAddPAT:                 {managementCallTimeout, false},
+}
+
+// Endpoints lists the endpoint names accepted in ResiliencePolicy.Timeouts,
+// sorted.
+func Endpoints() []string {
+	return slices.Sorted(maps.Keys(endpointPolicies))
+}
+
+// ResiliencePolicy configures timeouts, retries and the circuit breaker of
+// calls to Zitadel. Zero values use the defaults.
+type ResiliencePolicy struct {
+	// Timeouts overrides the timeout of each attempt by endpoint name.
+	Timeouts map[string]time.Duration
+	// MaxAttempts bounds the attempts of idempotent calls, which are retried
+	// on transport errors, 5xx and 429 responses with jittered exponential
+	// backoff from BaseBackoff up to MaxBackoff, or after Retry-After.
+	// Retry-After values above MaxBackoff end the call.
+	MaxAttempts int
+	BaseBackoff time.Duration
+	MaxBackoff  time.Duration
+	// FailureThreshold consecutive failed attempts open the circuit, which
+	// rejects calls for OpenDuration and then lets one probe call through.
+	// A negative threshold disables the circuit breaker.
+	FailureThreshold int
+	OpenDuration     time.Duration
+}
+
+// Resilience sends calls to Zitadel according to a ResiliencePolicy. Share
+// one between the client and the admin token source, so they trip the same
+// circuit breaker.
+type Resilience struct {
+	policy  ResiliencePolicy
+	breaker *circuitBreaker
+}
+
+// NewResilience returns a Resilience applying policy. Its circuit breaker
+// reports to the process-wide zitadel_circuit_breaker_state gauge, so create
+// one per process and inject it with WithResilience.
+func NewResilience(policy ResiliencePolicy) *Resilience {
+	r := newResilience(policy)
+	if r.breaker != nil {
+		r.breaker.publish = true
+		metrics.SetZitadelCircuitState(r.breaker.state)
+	}
+	return r
+}
+
+// defaultResilience applies the default policy for clients and token sources
+// that were not given a Resilience. It does not report its circuit state.
+func defaultResilience() *Resilience {
+	return newResilience(ResiliencePolicy{})
+}
+
+func newResilience(policy ResiliencePolicy) *Resilience {
+	if policy.MaxAttempts <= 0 {
+		policy.MaxAttempts = DefaultMaxAttempts
+	}
+	if policy.BaseBackoff <= 0 {
+		policy.BaseBackoff = DefaultBaseBackoff
+	}
+	if policy.MaxBackoff <= 0 {
+		policy.MaxBackoff = DefaultMaxBackoff
+	}
+	if policy.FailureThreshold == 0 {
+		policy.FailureThreshold = DefaultFailureThreshold
+	}
+	if policy.OpenDuration <= 0 {
+		policy.OpenDuration = DefaultOpenDuration
+	}
+
+	r := &Resilience{policy: policy}
+	if policy.FailureThreshold > 0 {
+		r.breaker = &circuitBreaker{
+			threshold:    policy.FailureThreshold,
+			openDuration: policy.OpenDuration,
+			state:        metrics.CircuitClosed,
+		}
+	}
+	return r
+}
+
+// WithResilience replaces the client's default Resilience.
+func WithResilience(r *Resilience) ClientOption {
+	return func(c *zitadelClient) {
+		c.resilience = r
+	}
+}
+
+// call performs a request against a Zitadel endpoint, retrying idempotent
+// calls, and records the latency of each attempt. Responses that are still
+// retryable after the last attempt are returned as ErrUnavailable; other
+// error responses are returned as-is for the caller to interpret.
+func (r *Resilience) call(
+	ctx context.Context,
+	client *httpclient.Client,
+	endpoint, method, url string,
+	opts ...httpclient.RequestOption,
+) (*resty.Response, error) {
+	endpointPolicy := endpointPolicies[endpoint]
+	timeout := endpointPolicy.timeout
+	if t, ok := r.policy.Timeouts[endpoint]; ok && t > 0 {
+		timeout = t
+	}
+	policy := retry.Policy{
+		MaxAttempts:    1,
+		InitialBackoff: r.policy.BaseBackoff,
+		MaxBackoff:     r.policy.MaxBackoff,
+		Jitter:         true,
+	}
+	if endpointPolicy.idempotent {
+		policy.MaxAttempts = r.policy.MaxAttempts
+	}
+
+	var resp *resty.Response
+	attempt := 0
+	err := retry.Do(ctx, policy, func(ctx context.Context) error {
+		attempt++
+		if attempt > 1 {
+			logger.DebugContext(ctx, "Retrying Zitadel call",
+				slog.String("endpoint", endpoint), slog.Int("attempt", attempt))
+			metrics.RecordZitadelRetry(endpoint)
+		}
+		if r.breaker != nil && !r.breaker.allow() {
+			return retry.Permanent(fmt.Errorf("%w: circuit breaker is open", ErrUnavailable))
+		}
+
+		var err error
+		resp, err = r.attempt(ctx, client, endpoint, method, url, timeout, opts)
+		// Calls cancelled by the caller say nothing about Zitadel's health.
+		retryable := ctx.Err() == nil && (err != nil || isRetryableStatus(resp.StatusCode()))
+		if r.breaker != nil {
+			r.breaker.record(ctx.Err() != nil, !retryable)
+		}
+		switch {
+		case !retryable:
+			return retry.Permanent(err)
+		case err != nil:
+			return fmt.Errorf("%w: %w", ErrUnavailable, err)
+		}
+
+		err = fmt.Errorf("%w: status %d", ErrUnavailable, resp.StatusCode())
+		if after, ok := parseRetryAfter(resp.Header().Get("Retry-After")); ok {
+			return retry.After(err, after)
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (r *Resilience) attempt(
+	ctx context.Context,
+	client *httpclient.Client,
+	endpoint, method, url string,
+	timeout time.Duration,
+	opts []httpclient.RequestOption,
+) (*resty.Response, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	start := time.Now()
+	resp, err := client.Request(ctx, method, url, opts...)
+
+	// Error responses count as failures even though no error is returned for them.
+	failure := err
+	if failure == nil && resp.IsError() {
+		failure = errors.New(resp.Status())
+	}
+	metrics.ObserveZitadel(endpoint, time.Since(start), failure)
+
+	return resp, err
+}
+
+func isRetryableStatus(status int) bool {
+	return status == http.StatusTooManyRequests || status >= http.StatusInternalServerError
+}
+
+// parseRetryAfter reads a Retry-After value in seconds or as an HTTP date.
+func parseRetryAfter(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		return max(time.Until(at), 0), true
+	}
+	return 0, false
+}
+
+// circuitBreaker opens after threshold consecutive failures and rejects calls
+// until openDuration has passed. It then lets a single probe through, whose
+// outcome closes or reopens the circuit.
+type circuitBreaker struct {
+	threshold    int
+	openDuration time.Duration
+	// publish reports state changes to the circuit breaker state gauge.
+	publish bool
+
+	mu       sync.Mutex
+	state    string
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+func (b *circuitBreaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case metrics.CircuitOpen:
+		if time.Since(b.openedAt) < b.openDuration {
+			return false
+		}
+		b.setState(metrics.CircuitHalfOpen)
+		b.probing = true
+		return true
+	case metrics.CircuitHalfOpen:
+		if b.probing {
+			return false
+		}
+		b.probing = true
+		return true
+	default:
+		return true
+	}
+}
+
+// record counts the outcome of an allowed call; cancelled calls only end a
+// probe so that another one can be made.
+func (b *circuitBreaker) record(cancelled, success bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+	if cancelled {
+		return
+	}
+	if success {
+		b.failures = 0
+		if b.state != metrics.CircuitClosed {
+			b.setState(metrics.CircuitClosed)
+		}
+		return
+	}
+
+	b.failures++
+	if b.state == metrics.CircuitHalfOpen || b.failures >= b.threshold {
+		b.openedAt = time.Now()
+		if b.state != metrics.CircuitOpen {
+			b.setState(metrics.CircuitOpen)
+		}
+	}
+}
+
+func (b *circuitBreaker) setState(state string) {
+	logger.WarnContext(context.Background(), "Zitadel circuit breaker changed state",
+		slog.String("from", b.state), slog.String("to", state))
+	b.state = state
+	if b.publish {
+		metrics.SetZitadelCircuitState(state)
+	}
+}
@@ -0,0 +1,89 @@
+package zitadel_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/astro-web3/oauth2-token-exchange/internal/infra/zitadel"
+)
+
+func TestResilience_RetriesIdempotentCalls(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		if calls.Add(1) == 1 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"sub":"user-1","preferred_username":"alice"}`))
+	}))
+	defer server.Close()
+
+	client := zitadel.NewClient(server.URL, "client-1", nil, "org-1",
+		zitadel.WithResilience(zitadel.NewResilience(zitadel.ResiliencePolicy{})))
+
+	info, err := client.GetUserInfo(context.Background(), "pat")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if info.Sub != "user-1" || calls.Load() != 2 {
+		t.Errorf("expected success on the second attempt, got %+v after %d calls", info, calls.Load())
+	}
+}
+
+func TestResilience_DoesNotRetryCreatingCalls(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	client := zitadel.NewClient(server.URL, "client-1", nil, "org-1",
+		zitadel.WithResilience(zitadel.NewResilience(zitadel.ResiliencePolicy{BaseBackoff: time.Millisecond})))
+
+	_, _, err := client.AddPersonalAccessToken(context.Background(), "admin-pat", "user-1", time.Now().Add(time.Hour))
+	if !errors.Is(err, zitadel.ErrUnavailable) {
+		t.Errorf("expected ErrUnavailable, got %v", err)
+	}
+	if calls.Load() != 1 {
+		t.Errorf("expected a single attempt, got %d", calls.Load())
+	}
+}
+
+func TestResilience_CircuitBreakerFailsFast(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	client := zitadel.NewClient(server.URL, "client-1", nil, "org-1",
+		zitadel.WithResilience(zitadel.NewResilience(zitadel.ResiliencePolicy{
+			MaxAttempts:      2,
+			BaseBackoff:      time.Millisecond,
+			FailureThreshold: 2,
+			OpenDuration:     time.Minute,
+		})))
+
+	if _, err := client.GetUserInfo(context.Background(), "pat"); !errors.Is(err, zitadel.ErrUnavailable) {
+		t.Fatalf("expected ErrUnavailable, got %v", err)
+	}
+	if calls.Load() != 2 {
+		t.Fatalf("expected 2 attempts, got %d", calls.Load())
+	}
+
+	if _, err := client.GetUserInfo(context.Background(), "pat"); !errors.Is(err, zitadel.ErrUnavailable) {
+		t.Errorf("expected ErrUnavailable from the open circuit, got %v", err)
+	}
+	if calls.Load() != 2 {
+		t.Errorf("expected no call while the circuit is open, got %d", calls.Load())
+	}
+}
@@ -0,0 +1,216 @@
+package zitadel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	httpclient "github.com/astro-web3/oauth2-token-exchange/pkg/http"
+	"github.com/astro-web3/oauth2-token-exchange/pkg/logger"
+	"github.com/astro-web3/oauth2-token-exchange/pkg/secret"
+	"golang.org/x/sync/singleflight"
+)
+
+//nolint:gosec // Grant type and scope identifiers, not credentials.
+const (
+	grantTypeJWTBearer = "urn:ietf:params:oauth:grant-type:jwt-bearer"
+	adminTokenScope    = "openid urn:zitadel:iam:org:project:id:zitadel:aud"
+
+	// adminTokenRefreshSkew is how long before expiry a cached admin token is refreshed.
+	adminTokenRefreshSkew = time.Minute
+	// defaultAdminTokenLifetime is assumed when the token endpoint omits expires_in.
+	defaultAdminTokenLifetime = 10 * time.Minute
+)
+
+// AdminTokenSource provides the admin bearer token used for management API
+// calls and as the actor token in ExchangeWithActor.
+type AdminTokenSource interface {
+	Token(ctx context.Context) (string, error)
+}
+
+type staticTokenSource struct {
+	pat secret.Secret
+}
+
+// NewStaticTokenSource returns an AdminTokenSource that yields the given
+// long-lived admin PAT, re-reading it on every call so rotations apply.
+func NewStaticTokenSource(pat secret.Secret) AdminTokenSource {
+	return &staticTokenSource{pat: pat}
+}
+
+func (s *staticTokenSource) Token(_ context.Context) (string, error) {
+	token := s.pat.Value()
+	if token == "" {
+		return "", errors.New("admin PAT is not set")
+	}
+	return token, nil
+}
+
+type jwtProfileTokenSource struct {
+	issuer     string
+	keys       keySource
+	resilience *Resilience
+	http       *httpclient.Client
+
+	// fetches lets one caller mint a token while the others wait for it; mu
+	// only guards the cached token, never the token endpoint call.
+	fetches   singleflight.Group
+	mu        sync.Mutex
+	token     string
+	expiresAt time.Time
+}
+
+// NewJWTProfileTokenSource returns an AdminTokenSource that mints short-lived
+// admin access tokens with the RFC 7523 JWT bearer grant, signed by the
+// service account key at keyPath. Tokens are cached and refreshed shortly
+// before they expire. The key file is read again when it changes, so that
+// rotated keys are picked up without a restart. A nil resilience uses the
+// default ResiliencePolicy and a nil client the default HTTP client.
+func NewJWTProfileTokenSource(
+	issuer, keyPath string,
+	resilience *Resilience,
+	client *httpclient.Client,
+) AdminTokenSource {
+	if resilience == nil {
+		resilience = defaultResilience()
+	}
+	if client == nil {
+		client = httpclient.Default()
+	}
+	return &jwtProfileTokenSource{
+		issuer:     strings.TrimSuffix(issuer, "/"),
+		keys:       newKeyFileSource(keyPath),
+		resilience: resilience,
+		http:       client,
+	}
+}
+
+func (s *jwtProfileTokenSource) Token(ctx context.Context) (string, error) {
+	if token, fresh := s.cached(time.Now()); fresh {
+		return token, nil
+	}
+
+	// The shared refresh must not fail for every waiter when the caller that
+	// started it gives up, so it runs detached and each caller waits on its
+	// own context.
+	refreshCtx := context.WithoutCancel(ctx)
+	select {
+	case result := <-s.fetches.DoChan("token", func() (any, error) { return s.refresh(refreshCtx) }):
+		if result.Err != nil {
+			return "", result.Err
+		}
+		token, _ := result.Val.(string)
+		return token, nil
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+// cached returns the cached token and whether it is fresh enough to use
+// without a refresh.
+func (s *jwtProfileTokenSource) cached(now time.Time) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.token, s.token != "" && now.Before(s.expiresAt.Add(-adminTokenRefreshSkew))
+}
+
+// refresh mints a new token and caches it. If minting fails, a cached token
+// that has not expired yet is returned instead.
+func (s *jwtProfileTokenSource) refresh(ctx context.Context) (string, error) {
+	now := time.Now()
+	// A caller that queued behind a completed refresh finds its token here.
+	if token, fresh := s.cached(now); fresh {
+		return token, nil
+	}
+
+	tokenResp, err := s.fetch(ctx)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err != nil {
+		if s.token != "" && now.Before(s.expiresAt) {
+			logger.WarnContext(ctx, "Failed to refresh admin token, using cached token until expiry",
+				slog.Time("expires_at", s.expiresAt),
+				slog.String("error", err.Error()),
+			)
+			return s.token, nil
+		}
+		return "", err
+	}
+
+	lifetime := time.Duration(tokenResp.ExpiresIn) * time.Second
+	if lifetime <= 0 {
+		lifetime = defaultAdminTokenLifetime
+	}
+
+	s.token = tokenResp.AccessToken
+	s.expiresAt = now.Add(lifetime)
+
+	return s.token, nil
+}
+
+func (s *jwtProfileTokenSource) fetch(ctx context.Context) (*TokenResponse, error) {
+	key, signer, err := s.keys.load()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load service account key: %w", err)
+	}
+
+	assertion, err := signAssertion(key, signer, s.issuer)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", grantTypeJWTBearer)
+	form.Set("assertion", assertion)
+	form.Set("scope", adminTokenScope)
+
+	tokenEndpoint := s.issuer + "/oauth/v2/token"
+
+	var tokenResp TokenResponse
+	resp, err := s.resilience.call(
+		ctx,
+		s.http,
+		endpointJWTProfile,
+		http.MethodPost,
+		tokenEndpoint,
+		httpclient.WithBody(form.Encode()),
+		httpclient.WithContentType("application/x-www-form-urlencoded"),
+		httpclient.WithResult(&tokenResp),
+	)
+	if err != nil {
+		logger.ErrorContext(ctx, "JWT profile token request failed",
+			slog.String("endpoint", tokenEndpoint),
+			slog.String("error", err.Error()),
+		)
+		return nil, fmt.Errorf("jwt profile token request failed: %w", err)
+	}
+
+	if resp.StatusCode() >= http.StatusBadRequest {
+		bodyStr := string(resp.Body())
+		logger.ErrorContext(ctx, "JWT profile token request failed",
+			slog.String("endpoint", tokenEndpoint),
+			slog.Int("status_code", resp.StatusCode()),
+			slog.String("response_body", bodyStr),
+		)
+		return nil, fmt.Errorf(
+			"jwt profile token request failed with status %d: %s",
+			resp.StatusCode(),
+			bodyStr,
+		)
+	}
+
+	if tokenResp.AccessToken == "" {
+		return nil, errors.New("jwt profile token response has empty access token")
+	}
+
+	return &tokenResp, nil
+}
@@ -0,0 +1,154 @@
+package zitadel_test
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/astro-web3/oauth2-token-exchange/internal/infra/zitadel"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func writeServiceAccountKey(t *testing.T, key *rsa.PrivateKey) string {
+	t.Helper()
+
+	keyPEM := pem.EncodeToMemory(&pem.Block{
+		Type:  "RSA PRIVATE KEY",
+		Bytes: x509.MarshalPKCS1PrivateKey(key),
+	})
+	data, err := json.Marshal(&zitadel.KeyFile{
+		Type:   zitadel.KeyTypeServiceAccount,
+		KeyID:  "key-1",
+		Key:    string(keyPEM),
+		UserID: "admin-user",
+	})
+	if err != nil {
+		t.Fatalf("failed to marshal key file: %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "key.json")
+	if err = os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatalf("failed to write key file: %v", err)
+	}
+	return path
+}
+
+func TestJWTProfileTokenSource_MintsAndCachesToken(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+
+	var calls atomic.Int32
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Errorf("failed to parse form: %v", err)
+		}
+		if got := r.Form.Get("grant_type"); got != "urn:ietf:params:oauth:grant-type:jwt-bearer" {
+			t.Errorf("unexpected grant_type %q", got)
+		}
+
+		claims := &jwt.RegisteredClaims{}
+		_, err := jwt.ParseWithClaims(r.Form.Get("assertion"), claims, func(*jwt.Token) (any, error) {
+			return &key.PublicKey, nil
+		}, jwt.WithAudience(server.URL), jwt.WithIssuer("admin-user"))
+		if err != nil {
+			t.Errorf("invalid assertion: %v", err)
+		}
+
+		n := calls.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = fmt.Fprintf(w, `{"access_token":"admin-token-%d","token_type":"Bearer","expires_in":3600}`, n)
+	}))
+	defer server.Close()
+
+	source := zitadel.NewJWTProfileTokenSource(server.URL+"/", writeServiceAccountKey(t, key), nil, nil)
+
+	for range 3 {
+		token, tokenErr := source.Token(context.Background())
+		if tokenErr != nil {
+			t.Fatalf("unexpected error: %v", tokenErr)
+		}
+		if token != "admin-token-1" {
+			t.Errorf("expected cached admin-token-1, got %s", token)
+		}
+	}
+
+	if calls.Load() != 1 {
+		t.Errorf("expected 1 token request, got %d", calls.Load())
+	}
+}
+
+func TestJWTProfileTokenSource_TokenEndpointError(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(`{"error":"invalid_grant"}`))
+	}))
+	defer server.Close()
+
+	source := zitadel.NewJWTProfileTokenSource(server.URL, writeServiceAccountKey(t, key), nil, nil)
+
+	if _, err = source.Token(context.Background()); err == nil {
+		t.Fatal("expected error from token endpoint")
+	}
+}
+
+func TestJWTProfileTokenSource_SharesConcurrentMint(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+
+	var calls atomic.Int32
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		calls.Add(1)
+		<-release
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"access_token":"admin-token","token_type":"Bearer","expires_in":3600}`))
+	}))
+	defer server.Close()
+
+	source := zitadel.NewJWTProfileTokenSource(server.URL, writeServiceAccountKey(t, key), nil, nil)
+
+	// A caller that gives up is not held by the mint in progress.
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err = source.Token(ctx); err == nil {
+		t.Fatal("expected the caller's deadline to end the wait")
+	}
+
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Go(func() {
+			if token, tokenErr := source.Token(context.Background()); tokenErr != nil || token != "admin-token" {
+				t.Errorf("expected the shared token, got %q, %v", token, tokenErr)
+			}
+		})
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if calls.Load() != 1 {
+		t.Errorf("expected 1 token request, got %d", calls.Load())
+	}
+}
@@ -2,6 +2,7 @@ package zitadel
 
 import (
 	"encoding/json"
+	"strconv"
 	"time"
 )
 
@@ -114,6 +115,14 @@ type ListDetails struct {
 	Timestamp         *RFC3339Time `json:"timestamp,omitempty"`
 }
 
+// hasMore reports whether results remain after offset.
+func (d *ListDetails) hasMore(offset uint64, pageLen int, limit uint32) bool {
+	if d == nil {
+		return hasMore("", offset, pageLen, limit)
+	}
+	return hasMore(d.TotalResult, offset, pageLen, limit)
+}
+
 // User represents a user in ZITADEL
 type User struct {
 	UserID             string               `json:"userId,omitempty"`
@@ -203,6 +212,27 @@ type PaginationResponse struct {
 	AppliedLimit string `json:"appliedLimit,omitempty"`
 }
 
+// hasMore reports whether results remain after offset.
+func (p *PaginationResponse) hasMore(offset uint64, pageLen int, limit uint32) bool {
+	if p == nil {
+		return hasMore("", offset, pageLen, limit)
+	}
+	return hasMore(p.TotalResult, offset, pageLen, limit)
+}
+
+// hasMore reports whether results remain after offset. Zitadel may apply a
+// lower limit than requested, so a short page only ends the listing when the
+// total is unknown.
+func hasMore(totalResult string, offset uint64, pageLen int, limit uint32) bool {
+	if pageLen == 0 {
+		return false
+	}
+	if total, err := strconv.ParseUint(totalResult, 10, 64); err == nil {
+		return offset < total
+	}
+	return pageLen >= int(limit)
+}
+
 // PersonalAccessTokenResponse represents a personal access token in API response
 type PersonalAccessTokenResponse struct {
 	CreationDate   *RFC3339Time `json:"creationDate,omitempty"`
@@ -213,6 +243,22 @@ type PersonalAccessTokenResponse struct {
 	ExpirationDate *RFC3339Time `json:"expirationDate,omitempty"`
 }
 
+// toPersonalAccessToken converts the response; userID is used when the
+// response omits it.
+func (r *PersonalAccessTokenResponse) toPersonalAccessToken(userID string) *PersonalAccessToken {
+	pat := &PersonalAccessToken{ID: r.ID, UserID: r.UserID}
+	if pat.UserID == "" {
+		pat.UserID = userID
+	}
+	if r.ExpirationDate != nil {
+		pat.ExpirationDate = r.ExpirationDate.Time
+	}
+	if r.CreationDate != nil {
+		pat.CreatedAt = r.CreationDate.Time
+	}
+	return pat
+}
+
 // RemovePersonalAccessTokenRequest represents the request for RemovePersonalAccessToken API
 type RemovePersonalAccessTokenRequest struct {
 	UserID  string `json:"userId"`
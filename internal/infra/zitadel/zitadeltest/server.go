@@ -0,0 +1,550 @@
+// Package zitadeltest provides an in-memory Zitadel for tests. It serves the
+// endpoints used by the zitadel client over httptest, so tests can exercise
+// the PAT check and the PAT API without a live instance.
+package zitadeltest
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/astro-web3/oauth2-token-exchange/internal/infra/zitadel"
+)
+
+// Endpoint names select the endpoint a scripted failure applies to and whose
+// calls are counted.
+const (
+	EndpointToken      = "token"
+	EndpointUserInfo   = "userinfo"
+	EndpointListUsers  = "list_users"
+	EndpointCreateUser = "create_user"
+	EndpointAddPAT     = "add_pat"
+	EndpointListPATs   = "list_pats"
+	EndpointRemovePAT  = "remove_pat"
+)
+
+// Credentials accepted by a new Server.
+const (
+	ClientID     = "fake-client"
+	ClientSecret = "fake-client-secret" //nolint:gosec // Test credential.
+	AdminToken   = "fake-admin-token"   //nolint:gosec // Test credential.
+)
+
+//nolint:gosec // Grant and token type identifiers, not credentials.
+const (
+	grantTypeTokenExchange = "urn:ietf:params:oauth:grant-type:token-exchange"
+	tokenTypeUserID        = "urn:zitadel:params:oauth:token-type:user_id"
+	tokenLifetime          = time.Hour
+	defaultPageLimit       = 100
+)
+
+// User is a user of the fake. Machine users own PATs; the token exchange
+// issues tokens for any user by ID.
+type User struct {
+	ID          string
+	Username    string
+	Name        string
+	Description string
+	Email       string
+	Groups      []string
+	Machine     bool
+}
+
+// PAT is a personal access token issued by the fake.
+type PAT struct {
+	ID         string
+	UserID     string
+	Token      string
+	Expiration time.Time
+	Created    time.Time
+}
+
+// Server is a fake Zitadel. Management endpoints require AdminToken, the
+// token endpoint requires ClientID and ClientSecret with HTTP basic auth and
+// the actor token of an exchange must be AdminToken.
+type Server struct {
+	// URL is the issuer URL to configure the client with.
+	URL string
+
+	server *httptest.Server
+
+	mu       sync.Mutex
+	nextID   int
+	users    map[string]*User
+	pats     map[string]*PAT
+	failures map[string][]failure
+	calls    map[string]int
+}
+
+type failure struct {
+	status int
+	times  int // remaining responses; negative fails until ClearFailures
+}
+
+// NewServer starts a fake Zitadel that is closed when the test ends.
+func NewServer(tb testing.TB) *Server {
+	tb.Helper()
+
+	s := &Server{
+		users:    make(map[string]*User),
+		pats:     make(map[string]*PAT),
+		failures: make(map[string][]failure),
+		calls:    make(map[string]int),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /oauth/v2/token", s.handle(EndpointToken, s.token))
+	mux.HandleFunc("GET /oidc/v1/userinfo", s.handle(EndpointUserInfo, s.userInfo))
+	mux.HandleFunc("POST /v2/users", s.handle(EndpointListUsers, s.admin(s.listUsers)))
+	mux.HandleFunc("POST /v2/users/new", s.handle(EndpointCreateUser, s.admin(s.createUser)))
+	mux.HandleFunc("POST /v2/users/{userId}/pats", s.handle(EndpointAddPAT, s.admin(s.addPAT)))
+	mux.HandleFunc("POST /v2/users/pats/search", s.handle(EndpointListPATs, s.admin(s.listPATs)))
+	mux.HandleFunc("DELETE /v2/users/{userId}/pats/{tokenId}", s.handle(EndpointRemovePAT, s.admin(s.removePAT)))
+
+	s.server = httptest.NewServer(mux)
+	s.URL = s.server.URL
+	tb.Cleanup(s.server.Close)
+
+	return s
+}
+
+// AddUser stores u, assigning an ID when it has none, and returns the stored
+// copy.
+func (s *Server) AddUser(u User) *User {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if u.ID == "" {
+		u.ID = s.newID()
+	}
+	s.users[u.ID] = &u
+	return &u
+}
+
+// AddPAT issues a PAT for the user and returns its token.
+func (s *Server) AddPAT(userID string, expiration time.Time) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.issuePAT(userID, expiration).Token
+}
+
+// MachineUser returns the machine user with the username, or nil.
+func (s *Server) MachineUser(username string) *User {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, u := range s.users {
+		if u.Machine && u.Username == username {
+			c := *u
+			return &c
+		}
+	}
+	return nil
+}
+
+// PATs returns the PATs of the user ordered by ID.
+func (s *Server) PATs(userID string) []PAT {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.patsOf(userID)
+}
+
+// Fail answers the next times calls to endpoint with status; a negative
+// times fails every call until ClearFailures. Failures queue per endpoint.
+func (s *Server) Fail(endpoint string, status, times int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.failures[endpoint] = append(s.failures[endpoint], failure{status: status, times: times})
+}
+
+// ClearFailures drops all scripted failures.
+func (s *Server) ClearFailures() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	clear(s.failures)
+}
+
+// Calls returns how many requests endpoint has received, failed ones
+// included.
+func (s *Server) Calls(endpoint string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.calls[endpoint]
+}
+
+// handle counts the call and answers it with the next scripted failure, if
+// any, before passing it to next.
+func (s *Server) handle(endpoint string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if status, ok := s.count(endpoint); ok {
+			writeError(w, status, "scripted failure")
+			return
+		}
+		next(w, r)
+	}
+}
+
+func (s *Server) count(endpoint string) (int, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.calls[endpoint]++
+	queue := s.failures[endpoint]
+	if len(queue) == 0 {
+		return 0, false
+	}
+
+	f := &queue[0]
+	if f.times > 0 {
+		f.times--
+		if f.times == 0 {
+			s.failures[endpoint] = queue[1:]
+		}
+	}
+	return f.status, true
+}
+
+func (s *Server) admin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if bearer(r) != AdminToken {
+			writeError(w, http.StatusUnauthorized, "invalid admin token")
+			return
+		}
+		next(w, r)
+	}
+}
+
+func (s *Server) token(w http.ResponseWriter, r *http.Request) {
+	if id, secret, ok := r.BasicAuth(); !ok || id != ClientID || secret != ClientSecret {
+		writeTokenError(w, http.StatusUnauthorized, "invalid_client")
+		return
+	}
+	if err := r.ParseForm(); err != nil || r.Form.Get("grant_type") != grantTypeTokenExchange {
+		writeTokenError(w, http.StatusBadRequest, "unsupported_grant_type")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var user *User
+	switch {
+	case r.Form.Get("actor_token") != "":
+		if r.Form.Get("actor_token") != AdminToken || r.Form.Get("subject_token_type") != tokenTypeUserID {
+			writeTokenError(w, http.StatusBadRequest, "invalid_request")
+			return
+		}
+		user = s.users[r.Form.Get("subject_token")]
+	default:
+		user = s.userOfPAT(r.Form.Get("subject_token"))
+	}
+	if user == nil {
+		writeTokenError(w, http.StatusBadRequest, "invalid_grant")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, &zitadel.TokenResponse{ //nolint:gosec // Fake tokens.
+		AccessToken:     "fake-access-token-" + user.ID + "-" + s.newID(),
+		TokenType:       "Bearer",
+		IssuedTokenType: "urn:ietf:params:oauth:token-type:access_token",
+		IDToken:         idToken(user),
+		ExpiresIn:       int64(tokenLifetime.Seconds()),
+	})
+}
+
+func (s *Server) userInfo(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user := s.userOfPAT(bearer(r))
+	if user == nil {
+		writeError(w, http.StatusUnauthorized, "invalid token")
+		return
+	}
+	writeJSON(w, http.StatusOK, &zitadel.UserInfo{
+		Sub:      user.ID,
+		Username: user.Username,
+		Email:    user.Email,
+		Name:     user.Name,
+	})
+}
+
+func (s *Server) listUsers(w http.ResponseWriter, r *http.Request) {
+	var req zitadel.ListUsersRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var matched []*zitadel.User
+	for _, id := range s.sortedUserIDs() {
+		u := s.users[id]
+		if !matchesUserQueries(u, req.Queries) {
+			continue
+		}
+		result := &zitadel.User{UserID: u.ID, State: "USER_STATE_ACTIVE", Username: u.Username}
+		if u.Machine {
+			result.Machine = &zitadel.MachineUserResponse{Name: u.Name, Description: u.Description}
+		}
+		matched = append(matched, result)
+	}
+
+	var offset uint64
+	limit := uint32(defaultPageLimit)
+	if req.Query != nil {
+		offset = req.Query.Offset
+		if req.Query.Limit > 0 {
+			limit = req.Query.Limit
+		}
+	}
+	writeJSON(w, http.StatusOK, &zitadel.ListUsersResponse{
+		Details: &zitadel.ListDetails{TotalResult: strconv.Itoa(len(matched))},
+		Result:  page(matched, offset, limit),
+	})
+}
+
+func (s *Server) createUser(w http.ResponseWriter, r *http.Request) {
+	var req zitadel.CreateUserRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Username == nil || req.Machine == nil {
+		writeError(w, http.StatusBadRequest, "username and machine are required")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, u := range s.users {
+		if u.Username == *req.Username {
+			writeError(w, http.StatusConflict, "user already exists")
+			return
+		}
+	}
+
+	id := s.newID()
+	s.users[id] = &User{
+		ID:          id,
+		Username:    *req.Username,
+		Name:        req.Machine.Name,
+		Description: req.Machine.Description,
+		Machine:     true,
+	}
+	writeJSON(w, http.StatusCreated, &zitadel.CreateUserResponse{
+		ID:           id,
+		CreationDate: &zitadel.RFC3339Time{Time: time.Now()},
+	})
+}
+
+func (s *Server) addPAT(w http.ResponseWriter, r *http.Request) {
+	var req zitadel.AddPersonalAccessTokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user := s.users[r.PathValue("userId")]
+	if user == nil || !user.Machine {
+		writeError(w, http.StatusNotFound, "machine user not found")
+		return
+	}
+
+	var expiration time.Time
+	if req.ExpirationDate != nil {
+		expiration = req.ExpirationDate.Time
+	}
+	pat := s.issuePAT(user.ID, expiration)
+	writeJSON(w, http.StatusOK, &zitadel.AddPersonalAccessTokenResponse{
+		CreationDate: &zitadel.RFC3339Time{Time: pat.Created},
+		TokenID:      pat.ID,
+		Token:        pat.Token,
+	})
+}
+
+func (s *Server) listPATs(w http.ResponseWriter, r *http.Request) {
+	var req zitadel.ListPersonalAccessTokensRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var userID string
+	for _, f := range req.Filters {
+		if f.UserIDFilter != nil {
+			userID = f.UserIDFilter.ID
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var results []*zitadel.PersonalAccessTokenResponse
+	for _, pat := range s.patsOf(userID) {
+		results = append(results, &zitadel.PersonalAccessTokenResponse{
+			CreationDate:   &zitadel.RFC3339Time{Time: pat.Created},
+			ID:             pat.ID,
+			UserID:         pat.UserID,
+			ExpirationDate: &zitadel.RFC3339Time{Time: pat.Expiration},
+		})
+	}
+
+	var offset uint64
+	limit := uint32(defaultPageLimit)
+	if req.Pagination != nil {
+		offset = req.Pagination.Offset
+		if req.Pagination.Limit > 0 {
+			limit = req.Pagination.Limit
+		}
+	}
+	writeJSON(w, http.StatusOK, &zitadel.ListPersonalAccessTokensResponse{
+		Pagination: &zitadel.PaginationResponse{
+			TotalResult:  strconv.Itoa(len(results)),
+			AppliedLimit: strconv.FormatUint(uint64(limit), 10),
+		},
+		Result: page(results, offset, limit),
+	})
+}
+
+func (s *Server) removePAT(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for token, pat := range s.pats {
+		if pat.ID == r.PathValue("tokenId") && pat.UserID == r.PathValue("userId") {
+			delete(s.pats, token)
+			writeJSON(w, http.StatusOK, &zitadel.RemovePersonalAccessTokenResponse{
+				DeletionDate: &zitadel.RFC3339Time{Time: time.Now()},
+			})
+			return
+		}
+	}
+	writeError(w, http.StatusNotFound, "personal access token not found")
+}
+
+// userOfPAT returns the owner of an unexpired PAT. Callers hold s.mu.
+func (s *Server) userOfPAT(token string) *User {
+	pat := s.pats[token]
+	if pat == nil || (!pat.Expiration.IsZero() && time.Now().After(pat.Expiration)) {
+		return nil
+	}
+	return s.users[pat.UserID]
+}
+
+// issuePAT stores a new PAT. Callers hold s.mu.
+func (s *Server) issuePAT(userID string, expiration time.Time) *PAT {
+	pat := &PAT{
+		ID:         s.newID(),
+		UserID:     userID,
+		Token:      randomToken(),
+		Expiration: expiration,
+		Created:    time.Now(),
+	}
+	s.pats[pat.Token] = pat
+	return pat
+}
+
+// patsOf returns copies of the user's PATs ordered by ID. Callers hold s.mu.
+func (s *Server) patsOf(userID string) []PAT {
+	var pats []PAT
+	for _, pat := range s.pats {
+		if pat.UserID == userID {
+			pats = append(pats, *pat)
+		}
+	}
+	slices.SortFunc(pats, func(a, b PAT) int { return strings.Compare(a.ID, b.ID) })
+	return pats
+}
+
+// sortedUserIDs returns the user IDs in creation order. Callers hold s.mu.
+func (s *Server) sortedUserIDs() []string {
+	ids := make([]string, 0, len(s.users))
+	for id := range s.users {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+	return ids
+}
+
+// newID returns IDs that sort in creation order, like Zitadel's. Callers
+// hold s.mu.
+func (s *Server) newID() string {
+	s.nextID++
+	return fmt.Sprintf("%018d", s.nextID)
+}
+
+func matchesUserQueries(u *User, queries []*zitadel.SearchQuery) bool {
+	for _, q := range queries {
+		if q.UserNameQuery != nil && q.UserNameQuery.UserName != u.Username {
+			return false
+		}
+		if q.TypeQuery != nil && (q.TypeQuery.Type == zitadel.UserTypeMachine) != u.Machine {
+			return false
+		}
+	}
+	return true
+}
+
+func page[T any](items []T, offset uint64, limit uint32) []T {
+	start := min(offset, uint64(len(items)))
+	end := min(start+uint64(limit), uint64(len(items)))
+	return items[start:end]
+}
+
+// idToken returns an unsigned JWT with the user's claims. The service reads
+// the claims of ID tokens from the token endpoint without verifying them.
+func idToken(u *User) string {
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none","typ":"JWT"}`))
+	claims, _ := json.Marshal(map[string]any{ //nolint:errchkjson // Marshaling strings cannot fail.
+		"sub":                u.ID,
+		"email":              u.Email,
+		"groups":             u.Groups,
+		"preferred_username": u.Username,
+		"exp":                time.Now().Add(tokenLifetime).Unix(),
+	})
+	return header + "." + base64.RawURLEncoding.EncodeToString(claims) + ".fake-signature"
+}
+
+func randomToken() string {
+	b := make([]byte, 24) //nolint:mnd // Long enough to never collide in tests.
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func bearer(r *http.Request) string {
+	return strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+// writeTokenError answers in the shape of OAuth 2.0 token errors.
+func writeTokenError(w http.ResponseWriter, status int, code string) {
+	writeJSON(w, status, map[string]string{"error": code})
+}
+
+// writeError answers in the shape of Zitadel's API errors.
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]any{"code": status, "message": message})
+}
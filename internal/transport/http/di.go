@@ -1,84 +1,124 @@
 package http
 
 import (
+	"cmp"
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"os"
+	"slices"
+	"time"
 
+	"connectrpc.com/grpchealth"
 	authzapp "github.com/astro-web3/oauth2-token-exchange/internal/app/authz"
 	patapp "github.com/astro-web3/oauth2-token-exchange/internal/app/pat"
 	"github.com/astro-web3/oauth2-token-exchange/internal/config"
+	auditdomain "github.com/astro-web3/oauth2-token-exchange/internal/domain/audit"
 	authzdomain "github.com/astro-web3/oauth2-token-exchange/internal/domain/authz"
 	patdomain "github.com/astro-web3/oauth2-token-exchange/internal/domain/pat"
+	auditinfra "github.com/astro-web3/oauth2-token-exchange/internal/infra/audit"
 	"github.com/astro-web3/oauth2-token-exchange/internal/infra/cache"
+	"github.com/astro-web3/oauth2-token-exchange/internal/infra/mail"
+	"github.com/astro-web3/oauth2-token-exchange/internal/infra/webhook"
 	"github.com/astro-web3/oauth2-token-exchange/internal/infra/zitadel"
 	pathandler "github.com/astro-web3/oauth2-token-exchange/internal/transport/http/handler"
+	"github.com/astro-web3/oauth2-token-exchange/internal/transport/http/identity"
+	patv1connect "github.com/astro-web3/oauth2-token-exchange/pb/gen/go/pat/v1/patv1connect"
+	httpclient "github.com/astro-web3/oauth2-token-exchange/pkg/http"
 	"github.com/astro-web3/oauth2-token-exchange/pkg/logger"
+	"github.com/astro-web3/oauth2-token-exchange/pkg/metrics"
 	"github.com/astro-web3/oauth2-token-exchange/pkg/otel"
+	"github.com/astro-web3/oauth2-token-exchange/pkg/retry"
 	"github.com/astro-web3/oauth2-token-exchange/pkg/tracer"
+	"github.com/redis/go-redis/v9"
+	prometheusbridge "go.opentelemetry.io/contrib/bridges/prometheus"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
 )
 
 type Server struct {
 	httpServer *http.Server
+	services   *Services
+	health     *grpchealth.StaticChecker
+	drainDelay time.Duration
 }
 
 const (
 	idleTimeoutMultiplier = 2
 	serviceName           = "oauth2-token-exchange"
+
+	defaultDeletionInterval = time.Minute
 )
 
-func NewServer(cfg *config.Config) (*Server, error) {
+func NewServer(store *config.Store) (*Server, error) {
+	cfg := store.Get()
+
 	logger.InitLogger(cfg.Observability.LogLevel, cfg.Observability.Format, cfg.Observability.LogSource)
+	metrics.SetConfigVersion(cfg.Version)
+	store.OnChange(func(newCfg *config.Config) {
+		logger.SetLevel(newCfg.Observability.LogLevel)
+		metrics.SetConfigVersion(newCfg.Version)
+	})
 
 	otelCfg := otel.Config{
 		ServiceName:        serviceName,
 		EndpointURL:        cfg.Observability.TracingEndpointURL,
 		Enabled:            cfg.Observability.TraceEnabled,
+		MetricsEnabled:     cfg.Observability.OTLPMetricsEnabled,
+		LogsEnabled:        cfg.Observability.OTLPLogsEnabled,
 		SampleRatio:        1.0,
 		Insecure:           true,
 		ResourceAttributes: make(map[string]string),
+		MetricProducers: []sdkmetric.Producer{
+			prometheusbridge.NewMetricProducer(prometheusbridge.WithGatherer(metrics.Gatherer())),
+		},
 	}
 	if err := tracer.InitTracer(serviceName, otelCfg); err != nil {
-		return nil, fmt.Errorf("failed to initialize tracer: %w", err)
+		return nil, fmt.Errorf("failed to initialize telemetry: %w", err)
 	}
+	logger.AddHandler(otel.LogHandler(serviceName))
 
-	redisClient, err := cache.NewRedisClient(cfg.Redis.URL, cfg.Redis.PoolSize)
+	tlsConfig, err := newTLSConfig(cfg)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create redis client: %w", err)
+		return nil, err
 	}
 
-	tokenCache := cache.NewTokenCache(redisClient)
-	zitadelClient := zitadel.NewClient(
-		cfg.Auth.Zitadel.Issuer,
-		cfg.Auth.Zitadel.ClientID,
-		cfg.Auth.Zitadel.ClientSecret,
-		cfg.Auth.Zitadel.OrganizationID,
-	)
+	services, err := NewServices(cfg)
+	if err != nil {
+		return nil, err
+	}
+	verifier, err := newIdentityVerifier(cfg, services.zitadelHTTP)
+	if err != nil {
+		_ = services.Close()
+		return nil, err
+	}
 
-	var authzDomainService authzdomain.Service
-	if cfg.Auth.AdminMachineUser.PAT != "" {
-		authzDomainService = authzdomain.NewServiceWithMachineUserSupport(
-			tokenCache,
-			zitadelClient,
-			zitadelClient,
-			cfg.Auth.AdminMachineUser.PAT,
-		)
-	} else {
-		authzDomainService = authzdomain.NewService(tokenCache, zitadelClient)
+	if services.ExpiryScanner != nil {
+		services.ExpiryScanner.Start()
 	}
-	appService := authzapp.NewService(authzDomainService)
+	services.DeletionWorker.Start()
 
-	patDomainService := patdomain.NewService(zitadelClient, cfg.Auth.AdminMachineUser.PAT)
-	patCommandService := patapp.NewCommandService(patDomainService)
-	patQueryService := patapp.NewQueryService(patDomainService)
-	patHandler := pathandler.NewPATHandler(patCommandService, patQueryService)
+	patHandler := pathandler.NewPATHandler(services.PATCommand, services.PATQuery)
+	handler := NewHandler(services.Authz, store)
+	adminHandler := pathandler.NewAdminPATHandler(services.PATAdmin)
+	health := grpchealth.NewStaticChecker(patv1connect.PATServiceName, patv1connect.AdminPATServiceName)
+	router := NewRouter(handler, store, patHandler, adminHandler, verifier, health)
 
-	handler := NewHandler(appService, cfg)
-	router := NewRouter(handler, cfg, patHandler)
+	// HTTP/2 lets one port answer gRPC as well as gRPC-Web and Connect:
+	// negotiated through ALPN with TLS, and as h2c without.
+	protocols := new(http.Protocols)
+	protocols.SetHTTP1(true)
+	protocols.SetHTTP2(true)
+	protocols.SetUnencryptedHTTP2(true)
 
 	httpServer := &http.Server{
 		Addr:         cfg.Server.Addr,
 		Handler:      router,
+		Protocols:    protocols,
+		TLSConfig:    tlsConfig,
 		ReadTimeout:  cfg.Server.ReadTimeout,
 		WriteTimeout: cfg.Server.WriteTimeout,
 		IdleTimeout:  cfg.Server.ReadTimeout * idleTimeoutMultiplier,
@@ -86,13 +126,616 @@ func NewServer(cfg *config.Config) (*Server, error) {
 
 	return &Server{
 		httpServer: httpServer,
+		services:   services,
+		health:     health,
+		drainDelay: cfg.Server.DrainDelay,
 	}, nil
 }
 
+// Services holds the application services wired from the configuration. It is
+// shared by the HTTP server and the one-shot CLI commands.
+type Services struct {
+	Authz      authzapp.Service
+	PATCommand *patapp.CommandService
+	PATQuery   *patapp.QueryService
+	PATAdmin   *patapp.AdminService
+	// ExpiryScanner is nil unless reminders are enabled. It is not started,
+	// so only the server runs it.
+	ExpiryScanner *patdomain.ExpiryScanner
+	// DeletionWorker deletes rotated PATs after their grace period. Like
+	// ExpiryScanner, it is only started by the server.
+	DeletionWorker *patdomain.DeletionWorker
+
+	// zitadelHTTP is the client for Zitadel, which also serves the JWKS.
+	zitadelHTTP *httpclient.Client
+	closers     []io.Closer
+}
+
+// NewServices builds the token cache, Zitadel client and application services.
+// Close releases the cache and stops watching secret files.
+func NewServices(cfg *config.Config) (*Services, error) {
+	secretWatcher, err := config.WatchSecrets(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	services := &Services{closers: []io.Closer{secretWatcher}}
+	if err = services.build(cfg); err != nil {
+		_ = services.Close()
+		return nil, err
+	}
+
+	return services, nil
+}
+
+func (s *Services) build(cfg *config.Config) error {
+	redisClient, err := newRedisClient(cfg)
+	if err != nil {
+		return err
+	}
+
+	tokenCache := newTokenCache(cfg, redisClient)
+	if closer, ok := tokenCache.(io.Closer); ok {
+		s.closers = append(s.closers, closer)
+	}
+
+	httpClient, err := newZitadelHTTPClient(cfg)
+	if err != nil {
+		return err
+	}
+	s.zitadelHTTP = httpClient
+	resilience := newZitadelResilience(cfg)
+	zitadelClient, err := newZitadelClient(cfg, httpClient, resilience)
+	if err != nil {
+		return err
+	}
+
+	webhookClient, err := newWebhookHTTPClient()
+	if err != nil {
+		return err
+	}
+	auditSinks, err := newAuditSinks(cfg, webhookClient)
+	if err != nil {
+		return err
+	}
+	for _, sink := range auditSinks {
+		s.closers = append(s.closers, sink)
+	}
+	auditor := auditdomain.NewRecorder(auditSinks...)
+
+	adminTokens := newAdminTokenSource(cfg, httpClient, resilience)
+
+	authzOpts := []authzdomain.ServiceOption{
+		authzdomain.WithAuditor(auditor),
+		authzdomain.WithRefresh(newRefreshPolicy(cfg)),
+	}
+	if len(cfg.Auth.Zitadel.Tenants) > 0 {
+		tenants, tenantsErr := newTenants(cfg, httpClient, resilience)
+		if tenantsErr != nil {
+			return tenantsErr
+		}
+		authzOpts = append(authzOpts, authzdomain.WithTenants(tenants))
+	}
+	if len(cfg.Auth.RateLimits) > 0 {
+		authzOpts = append(authzOpts, authzdomain.WithRateLimits(newRateLimiter(redisClient), newRateLimitRules(cfg)))
+	}
+	if cfg.Auth.BruteForce.Enabled {
+		authzOpts = append(authzOpts, authzdomain.WithBruteForceGuard(newAttemptTracker(redisClient), newBruteForcePolicy(cfg)))
+	}
+
+	var authzDomainService authzdomain.Service
+	if adminTokens != nil {
+		authzDomainService = authzdomain.NewServiceWithMachineUserSupport(
+			tokenCache,
+			zitadelClient,
+			zitadelClient,
+			adminTokens,
+			authzOpts...,
+		)
+	} else {
+		authzDomainService = authzdomain.NewService(tokenCache, zitadelClient, authzOpts...)
+	}
+	// Background refreshes write to the token cache and the audit sinks, so
+	// they finish before either is closed.
+	s.closers = append(s.closers, authzDomainService)
+	s.Authz = authzapp.NewService(authzDomainService)
+
+	var dispatcher *webhook.Dispatcher
+	var commandOpts []patapp.CommandServiceOption
+	var adminOpts []patapp.AdminServiceOption
+	if len(cfg.Notifications.Webhooks) > 0 {
+		if dispatcher, err = newWebhookDispatcher(cfg, webhookClient); err != nil {
+			return err
+		}
+		s.closers = append(s.closers, dispatcher)
+		commandOpts = append(commandOpts, patapp.WithNotifier(dispatcher, cfg.Notifications.LongLivedThreshold))
+		adminOpts = append(adminOpts, patapp.WithAdminNotifier(dispatcher))
+	}
+
+	deletionQueue := newDeletionQueue(redisClient)
+	s.DeletionWorker = patdomain.NewDeletionWorker(zitadelClient, adminTokens, deletionQueue,
+		cmp.Or(cfg.PATRotation.DeletionInterval, defaultDeletionInterval))
+	s.closers = append(s.closers, s.DeletionWorker)
+
+	patDomainService := patdomain.NewService(
+		zitadelClient,
+		adminTokens,
+		patdomain.WithAuditor(auditor),
+		patdomain.WithPolicy(newPATPolicy(cfg)),
+		patdomain.WithDeletionQueue(deletionQueue),
+		patdomain.WithCreationLock(newCreationLock(redisClient)),
+	)
+	s.PATCommand = patapp.NewCommandService(patDomainService, commandOpts...)
+	s.PATQuery = patapp.NewQueryService(patDomainService)
+
+	patAdminService := patdomain.NewAdminService(
+		zitadelClient,
+		adminTokens,
+		patdomain.AdminPolicy{Groups: cfg.Admin.Groups, Roles: cfg.Admin.Roles},
+		patdomain.WithAuditor(auditor),
+	)
+	s.PATAdmin = patapp.NewAdminService(patAdminService, adminOpts...)
+
+	if cfg.Reminders.Enabled {
+		s.ExpiryScanner = newExpiryScanner(cfg, zitadelClient, adminTokens, redisClient, dispatcher)
+		s.closers = append(s.closers, s.ExpiryScanner)
+	}
+
+	return nil
+}
+
+// Close releases resources in reverse order of creation, so background
+// workers stop before the sinks they write to are closed.
+func (s *Services) Close() error {
+	var err error
+	for _, closer := range slices.Backward(s.closers) {
+		err = errors.Join(err, closer.Close())
+	}
+	return err
+}
+
+// newZitadelHTTPClient builds the HTTP client for requests to Zitadel from
+// auth.zitadel.http.
+func newZitadelHTTPClient(cfg *config.Config) (*httpclient.Client, error) {
+	h := cfg.Auth.Zitadel.HTTP
+	client, err := httpclient.New(httpclient.Config{
+		Timeout:             h.Timeout,
+		RootCAFile:          h.RootCAFile,
+		ClientCertFile:      h.ClientCertFile,
+		ClientKeyFile:       h.ClientKeyFile,
+		ProxyURL:            h.ProxyURL,
+		MaxIdleConns:        h.MaxIdleConns,
+		MaxIdleConnsPerHost: h.MaxIdleConnsPerHost,
+		MaxConnsPerHost:     h.MaxConnsPerHost,
+		IdleConnTimeout:     h.IdleConnTimeout,
+		KeepAlive:           h.KeepAlive,
+		DisableKeepAlives:   h.DisableKeepAlives,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create zitadel http client: %w", err)
+	}
+	return client, nil
+}
+
+// newWebhookHTTPClient builds the HTTP client shared by audit and
+// notification webhooks. Their receivers are third parties, so it does not
+// use the CA, client certificate or proxy configured for Zitadel.
+func newWebhookHTTPClient() (*httpclient.Client, error) {
+	client, err := httpclient.New(httpclient.Config{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create webhook http client: %w", err)
+	}
+	return client, nil
+}
+
+// newZitadelResilience builds the Resilience shared by the Zitadel client
+// and the admin token source, so both trip the same circuit breaker.
+func newZitadelResilience(cfg *config.Config) *zitadel.Resilience {
+	r := cfg.Auth.Zitadel.Resilience
+	return zitadel.NewResilience(zitadel.ResiliencePolicy{
+		Timeouts:         r.Timeouts,
+		MaxAttempts:      r.Retry.MaxAttempts,
+		BaseBackoff:      r.Retry.BaseBackoff,
+		MaxBackoff:       r.Retry.MaxBackoff,
+		FailureThreshold: r.CircuitBreaker.FailureThreshold,
+		OpenDuration:     r.CircuitBreaker.OpenDuration,
+	})
+}
+
+func newZitadelClient(
+	cfg *config.Config,
+	httpClient *httpclient.Client,
+	resilience *zitadel.Resilience,
+) (zitadel.Client, error) {
+	opts := []zitadel.ClientOption{zitadel.WithHTTPClient(httpClient), zitadel.WithResilience(resilience)}
+	authOpt, err := newClientAuthOption(cfg.Auth.Zitadel.ClientAuthMethod, cfg.Auth.Zitadel.ClientKeyFile)
+	if err != nil {
+		return nil, err
+	}
+	if authOpt != nil {
+		opts = append(opts, authOpt)
+	}
+
+	return zitadel.NewClient(
+		cfg.Auth.Zitadel.Issuer,
+		cfg.Auth.Zitadel.ClientID,
+		cfg.Auth.Zitadel.ClientSecret,
+		cfg.Auth.Zitadel.OrganizationID,
+		opts...,
+	), nil
+}
+
+// newTenants builds a Zitadel client for the application of each tenant in
+// auth.zitadel.tenants. They share the transport and circuit breaker of the
+// default client, as they call the same Zitadel.
+func newTenants(
+	cfg *config.Config,
+	httpClient *httpclient.Client,
+	resilience *zitadel.Resilience,
+) ([]authzdomain.Tenant, error) {
+	tenants := make([]authzdomain.Tenant, 0, len(cfg.Auth.Zitadel.Tenants))
+	for _, t := range cfg.Auth.Zitadel.Tenants {
+		opts := []zitadel.ClientOption{zitadel.WithHTTPClient(httpClient), zitadel.WithResilience(resilience)}
+		authOpt, err := newClientAuthOption(t.ClientAuthMethod, t.ClientKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("tenant %s: %w", t.Name, err)
+		}
+		if authOpt != nil {
+			opts = append(opts, authOpt)
+		}
+
+		tenants = append(tenants, authzdomain.Tenant{
+			Name:  t.Name,
+			Hosts: t.Hosts,
+			Exchanger: zitadel.NewClient(
+				cfg.Auth.Zitadel.Issuer,
+				t.ClientID,
+				t.ClientSecret,
+				cfg.Auth.Zitadel.OrganizationID,
+				opts...,
+			),
+		})
+	}
+	return tenants, nil
+}
+
+// newClientAuthOption returns the option selecting method at the token
+// endpoint, or nil for the client's default, client_secret_basic.
+func newClientAuthOption(method, keyFile string) (zitadel.ClientOption, error) {
+	switch method {
+	case "", zitadel.ClientAuthMethodSecretBasic:
+		return nil, nil
+	case zitadel.ClientAuthMethodPrivateKeyJWT:
+		// Fail at startup on a missing or malformed key; later changes to
+		// the file are picked up as they happen.
+		if _, err := zitadel.LoadKeyFile(keyFile); err != nil {
+			return nil, fmt.Errorf("failed to load zitadel client key: %w", err)
+		}
+		return zitadel.WithPrivateKeyJWTFile(keyFile), nil
+	default:
+		return nil, fmt.Errorf("unknown zitadel client auth method %q", method)
+	}
+}
+
+// newIdentityVerifier verifies PAT API callers as selected by
+// auth.identity.mode. The identity headers are those the gateway forwards
+// from the ext_authz response. The JWKS is usually Zitadel's, so it is
+// fetched through zitadelHTTP like other Zitadel calls.
+func newIdentityVerifier(cfg *config.Config, zitadelHTTP *httpclient.Client) (identity.Verifier, error) {
+	headers := identity.Headers{
+		UserID:            cfg.Auth.HeaderKeys.UserID,
+		Email:             cfg.Auth.HeaderKeys.UserEmail,
+		PreferredUsername: cfg.Auth.HeaderKeys.UserPreferredUsername,
+		Groups:            cfg.Auth.HeaderKeys.UserGroups,
+		Roles:             identity.HeaderRoles,
+		AccessToken:       cfg.Auth.HeaderKeys.UserJWT,
+	}
+
+	idCfg := cfg.Auth.Identity
+	switch cfg.IdentityMode() {
+	case config.IdentityModeJWT:
+		return identity.NewJWTVerifier(headers, identity.JWTConfig{
+			JWKSURL:     cfg.JWKSURL(),
+			Issuer:      cfg.JWTIssuer(),
+			Audiences:   idCfg.JWT.Audiences,
+			GroupsClaim: idCfg.JWT.GroupsClaim,
+			RolesClaim:  idCfg.JWT.RolesClaim,
+			HTTPClient:  zitadelHTTP,
+		}), nil
+	case config.IdentityModeSignedHeader:
+		return identity.NewSignedHeaderVerifier(headers, idCfg.SignedHeader.Secret, idCfg.SignedHeader.MaxAge), nil
+	case config.IdentityModeMTLS:
+		return identity.NewMTLSVerifier(headers, idCfg.MTLS.AllowedSubjects), nil
+	case config.IdentityModeTrustedProxy:
+		logger.WarnContext(context.Background(), "PAT API trusts identity headers without verification")
+		return identity.NewTrustedProxyVerifier(headers), nil
+	default:
+		return nil, fmt.Errorf("unknown identity mode %q", idCfg.Mode)
+	}
+}
+
+// newTLSConfig returns nil unless server.tls configures a certificate.
+func newTLSConfig(cfg *config.Config) (*tls.Config, error) {
+	tlsCfg := cfg.Server.TLS
+	if tlsCfg.CertFile == "" {
+		return nil, nil //nolint:nilnil // No TLS config serves plain HTTP.
+	}
+
+	cert, err := tls.LoadX509KeyPair(tlsCfg.CertFile, tlsCfg.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load server certificate: %w", err)
+	}
+	config := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	if tlsCfg.ClientCAFile != "" {
+		caPEM, readErr := os.ReadFile(tlsCfg.ClientCAFile)
+		if readErr != nil {
+			return nil, fmt.Errorf("failed to read client CA file: %w", readErr)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caPEM) {
+			return nil, errors.New("client CA file contains no certificates")
+		}
+		config.ClientCAs = pool
+		// Client certificates stay optional so health checks and ext_authz
+		// keep working; the mtls identity mode rejects PAT API calls
+		// without a verified one.
+		config.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+
+	return config, nil
+}
+
+func newAdminTokenSource(
+	cfg *config.Config,
+	httpClient *httpclient.Client,
+	resilience *zitadel.Resilience,
+) zitadel.AdminTokenSource {
+	switch {
+	case cfg.Auth.AdminMachineUser.KeyFile != "":
+		logger.InfoContext(context.Background(), "using JWT profile admin tokens from service account key")
+		return zitadel.NewJWTProfileTokenSource(cfg.Auth.Zitadel.Issuer, cfg.Auth.AdminMachineUser.KeyFile, resilience, httpClient)
+	case cfg.Auth.AdminMachineUser.PAT != "":
+		return zitadel.NewStaticTokenSource(cfg.Auth.AdminMachineUser.PAT)
+	default:
+		return nil
+	}
+}
+
+func newAuditSinks(cfg *config.Config, webhookClient *httpclient.Client) ([]auditdomain.Sink, error) {
+	var sinks []auditdomain.Sink
+
+	if cfg.Audit.Stdout {
+		sinks = append(sinks, auditinfra.NewStdoutSink())
+	}
+	if cfg.Audit.File.Path != "" {
+		sink, err := auditinfra.NewFileSink(
+			cfg.Audit.File.Path,
+			int64(cfg.Audit.File.MaxSizeMB)<<20, //nolint:mnd // MiB to bytes
+			cfg.Audit.File.MaxBackups,
+		)
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, sink)
+	}
+	if cfg.Audit.Webhook.URL != "" {
+		sinks = append(sinks, auditinfra.NewWebhookSink(
+			cfg.Audit.Webhook.URL,
+			retry.Policy{MaxAttempts: cfg.Audit.Webhook.MaxAttempts},
+			webhookClient,
+		))
+	}
+
+	return sinks, nil
+}
+
+func newWebhookDispatcher(cfg *config.Config, client *httpclient.Client) (*webhook.Dispatcher, error) {
+	deadLetter, err := webhook.NewDeadLetterLog(cfg.Notifications.DeadLetterPath)
+	if err != nil {
+		return nil, err
+	}
+
+	endpoints := make([]webhook.Endpoint, 0, len(cfg.Notifications.Webhooks))
+	for _, hook := range cfg.Notifications.Webhooks {
+		events := make([]patdomain.NotificationType, 0, len(hook.Events))
+		for _, event := range hook.Events {
+			events = append(events, patdomain.NotificationType(event))
+		}
+		endpoints = append(endpoints, webhook.Endpoint{
+			Name:   hook.Name,
+			URL:    hook.URL,
+			Secret: hook.Secret,
+			Events: events,
+			Retry:  retry.Policy{MaxAttempts: hook.MaxAttempts},
+		})
+	}
+
+	return webhook.NewDispatcher(endpoints, deadLetter, client), nil
+}
+
+// newRedisClient connects to Redis when it backs the token cache, and
+// returns nil otherwise.
+func newRedisClient(cfg *config.Config) (*redis.Client, error) {
+	if cfg.CacheBackend() != config.CacheBackendRedis {
+		return nil, nil //nolint:nilnil // No Redis client without the redis cache backend.
+	}
+
+	redisClient, err := cache.NewRedisClient(cfg.Redis.URL.Value(), cfg.Redis.PoolSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create redis client: %w", err)
+	}
+	return redisClient, nil
+}
+
+func newTokenCache(cfg *config.Config, redisClient *redis.Client) cache.TokenCache {
+	if redisClient != nil {
+		return cache.NewTokenCache(redisClient)
+	}
+
+	logger.InfoContext(context.Background(), "using in-memory token cache")
+	return cache.NewMemoryTokenCache(cfg.Cache.Memory.MaxEntries, cfg.Cache.Memory.CleanupInterval)
+}
+
+func newPATPolicy(cfg *config.Config) patdomain.Policy {
+	policy := patdomain.Policy{
+		MaxLifetime:            cfg.PATPolicy.MaxLifetime,
+		DefaultLifetime:        cfg.PATPolicy.DefaultLifetime,
+		MaxActivePATs:          cfg.PATPolicy.MaxActivePerUser,
+		RotationGracePeriod:    cfg.PATRotation.GracePeriod,
+		MaxRotationGracePeriod: cfg.PATRotation.MaxGracePeriod,
+	}
+	for _, override := range cfg.PATPolicy.GroupOverrides {
+		policy.GroupOverrides = append(policy.GroupOverrides, patdomain.GroupPolicy{
+			Group:         override.Group,
+			MaxLifetime:   override.MaxLifetime,
+			MaxActivePATs: override.MaxActivePerUser,
+		})
+	}
+	return policy
+}
+
+// newCreationLock serializes PAT creations per user across replicas through
+// Redis when available; the in-memory lock only covers this replica.
+func newCreationLock(redisClient *redis.Client) patdomain.Ledger {
+	if redisClient != nil {
+		return cache.NewRedisLedger(redisClient)
+	}
+	return cache.NewMemoryLedger()
+}
+
+// newRateLimiter shares rate limit counters between replicas through Redis
+// when available.
+func newRateLimiter(redisClient *redis.Client) cache.RateLimiter {
+	if redisClient != nil {
+		return cache.NewRedisRateLimiter(redisClient)
+	}
+	return cache.NewMemoryRateLimiter()
+}
+
+func newRateLimitRules(cfg *config.Config) []authzdomain.RateLimitRule {
+	rules := make([]authzdomain.RateLimitRule, 0, len(cfg.Auth.RateLimits))
+	for _, rule := range cfg.Auth.RateLimits {
+		rules = append(rules, authzdomain.RateLimitRule{
+			Name:         rule.Name,
+			Methods:      rule.Methods,
+			PathPrefixes: rule.Paths,
+			By:           rule.By,
+			Groups:       rule.Groups,
+			Limit:        rule.Limit,
+			Window:       rule.Window,
+		})
+	}
+	return rules
+}
+
+// newAttemptTracker shares failure counts and blocks between replicas
+// through Redis when available.
+func newAttemptTracker(redisClient *redis.Client) cache.AttemptTracker {
+	if redisClient != nil {
+		return cache.NewRedisAttemptTracker(redisClient)
+	}
+	return cache.NewMemoryAttemptTracker()
+}
+
+func newBruteForcePolicy(cfg *config.Config) authzdomain.BruteForcePolicy {
+	b := cfg.Auth.BruteForce
+	return authzdomain.BruteForcePolicy{
+		MaxFailures:   b.MaxFailures,
+		Window:        b.Window,
+		BlockDuration: b.BlockDuration,
+		DelayAfter:    b.DelayAfter,
+		BaseDelay:     b.BaseDelay,
+		MaxDelay:      b.MaxDelay,
+	}
+}
+
+func newRefreshPolicy(cfg *config.Config) authzdomain.RefreshPolicy {
+	r := cfg.Auth.CacheRefresh
+	return authzdomain.RefreshPolicy{
+		SoftTTLRatio: r.SoftTTLRatio,
+		Jitter:       r.TTLJitter,
+		Timeout:      r.Timeout,
+	}
+}
+
+// newDeletionQueue keeps rotated PATs awaiting deletion in Redis, so
+// deletions survive restarts and are shared by replicas. Without Redis they
+// are kept in memory and lost on restart, leaving the old PATs to expire on
+// their own.
+func newDeletionQueue(redisClient *redis.Client) patdomain.DeletionQueue {
+	if redisClient == nil {
+		return cache.NewMemoryDeletionQueue()
+	}
+	return cache.NewRedisDeletionQueue(redisClient)
+}
+
+// newExpiryScanner sends reminders by email and/or webhook. Sent reminders
+// are tracked in Redis, which validation requires, so replicas and restarts
+// do not send duplicates.
+func newExpiryScanner(
+	cfg *config.Config,
+	zitadelClient zitadel.Client,
+	adminTokens zitadel.AdminTokenSource,
+	redisClient *redis.Client,
+	dispatcher *webhook.Dispatcher,
+) *patdomain.ExpiryScanner {
+	var senders []patdomain.ReminderSender
+	if smtpCfg := cfg.Reminders.SMTP; smtpCfg.Addr != "" {
+		senders = append(senders, mail.NewSMTPSender(mail.SMTPConfig{
+			Addr:     smtpCfg.Addr,
+			Username: smtpCfg.Username,
+			Password: smtpCfg.Password,
+			From:     smtpCfg.From,
+			Timeout:  smtpCfg.Timeout,
+		}))
+	}
+	if cfg.Reminders.Webhook && dispatcher != nil {
+		senders = append(senders, dispatcher)
+	}
+
+	return patdomain.NewExpiryScanner(
+		zitadelClient,
+		adminTokens,
+		cache.NewRedisLedger(redisClient),
+		senders,
+		cfg.Reminders.Windows,
+		cfg.Reminders.Interval,
+	)
+}
+
+// ListenAndServe serves HTTPS when server.tls is configured and plain HTTP
+// otherwise.
 func (s *Server) ListenAndServe() error {
+	if s.httpServer.TLSConfig != nil {
+		return s.httpServer.ListenAndServeTLS("", "")
+	}
 	return s.httpServer.ListenAndServe()
 }
 
+// Handler returns the router serving every endpoint, so tests can drive the
+// server without listening on a port.
+func (s *Server) Handler() http.Handler {
+	return s.httpServer.Handler
+}
+
+// Shutdown reports the services as not serving to gRPC health checks, keeps
+// serving for the drain delay, then drains in-flight requests and releases the
+// services.
 func (s *Server) Shutdown(ctx context.Context) error {
-	return s.httpServer.Shutdown(ctx)
+	for _, service := range []string{"", patv1connect.PATServiceName, patv1connect.AdminPATServiceName} {
+		s.health.SetStatus(service, grpchealth.StatusNotServing)
+	}
+
+	// Keep serving until load balancers have seen the health change.
+	if s.drainDelay > 0 {
+		select {
+		case <-time.After(s.drainDelay):
+		case <-ctx.Done():
+		}
+	}
+	return errors.Join(s.httpServer.Shutdown(ctx), s.services.Close())
 }
@@ -1,49 +1,74 @@
 package http
 
 import (
+	"context"
+	"math"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
 	"log/slog"
 
 	"github.com/astro-web3/oauth2-token-exchange/internal/app/authz"
 	"github.com/astro-web3/oauth2-token-exchange/internal/config"
+	authzdomain "github.com/astro-web3/oauth2-token-exchange/internal/domain/authz"
 	"github.com/astro-web3/oauth2-token-exchange/pkg/logger"
+	"github.com/astro-web3/oauth2-token-exchange/pkg/metrics"
 	"github.com/astro-web3/oauth2-token-exchange/pkg/tracer"
 	"github.com/gin-gonic/gin"
 	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type Handler struct {
 	appService authz.Service
-	cfg        *config.Config
-	headerKeys map[string]string
+	store      *config.Store
 }
 
-func NewHandler(appService authz.Service, cfg *config.Config) *Handler {
+// NewHandler creates the forward-auth handler. Header keys and cache TTL are
+// read from store on every request so config reloads apply immediately.
+func NewHandler(appService authz.Service, store *config.Store) *Handler {
 	return &Handler{
 		appService: appService,
-		cfg:        cfg,
-		headerKeys: map[string]string{
-			"user_id":                 cfg.Auth.HeaderKeys.UserID,
-			"user_email":              cfg.Auth.HeaderKeys.UserEmail,
-			"user_groups":             cfg.Auth.HeaderKeys.UserGroups,
-			"user_preferred_username": cfg.Auth.HeaderKeys.UserPreferredUsername,
-			"user_jwt":                cfg.Auth.HeaderKeys.UserJWT,
-		},
+		store:      store,
 	}
 }
 
+// Reason codes for decisions made by the handler itself, complementing the
+// domain reason codes in authz.
+const (
+	reasonMissingHeader = "missing_header"
+	reasonInternalError = "internal_error"
+)
+
+// Rate limit headers report the caller's quota under the most restrictive
+// matching rule, in the style of the IETF RateLimit header fields draft.
+const (
+	headerRateLimitLimit     = "X-RateLimit-Limit"
+	headerRateLimitRemaining = "X-RateLimit-Remaining"
+	headerRateLimitReset     = "X-RateLimit-Reset"
+	headerRetryAfter         = "Retry-After"
+)
+
 func (h *Handler) Check(c *gin.Context) {
 	ctx, span := tracer.Start(c.Request.Context(), "transport.http.Check")
 	defer span.End()
 
+	start := time.Now()
+	result, reasonCode := metrics.ResultError, reasonInternalError
+	defer func() {
+		metrics.RecordDecision(result, reasonCode)
+		metrics.ObserveCheck(result, time.Since(start))
+	}()
+
 	authHeader := c.GetHeader("Authorization")
 	if authHeader == "" {
 		authHeader = c.GetHeader("authorization")
 	}
 
 	if authHeader == "" {
+		result, reasonCode = metrics.ResultDeny, reasonMissingHeader
 		span.SetAttributes(attribute.Bool("authz.missing_header", true))
 		logger.WarnContext(ctx, "missing authorization header")
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "missing authorization header"})
@@ -53,7 +78,12 @@ func (h *Handler) Check(c *gin.Context) {
 	pat := strings.TrimPrefix(authHeader, "Bearer ")
 	pat = strings.TrimSpace(pat)
 
-	decision, err := h.appService.Check(ctx, pat, h.cfg.Auth.CacheTTL, h.headerKeys)
+	// The proxy forwards the original request's host, and its method and
+	// path below the route prefix.
+	route := authzdomain.Route{Host: c.Request.Host, Method: c.Request.Method, Path: c.Param("path")}
+
+	cfg := h.store.Get()
+	decision, err := h.appService.Check(ctx, pat, route, cfg.Auth.CacheTTL, cfg.HeaderKeyMap())
 
 	if err != nil {
 		span.RecordError(err)
@@ -62,16 +92,14 @@ func (h *Handler) Check(c *gin.Context) {
 		return
 	}
 
+	reasonCode = decision.ReasonCode
+	setRateLimitHeaders(c, decision.RateLimit)
 	if !decision.Allow {
-		span.SetAttributes(
-			attribute.Bool("authz.allowed", false),
-			attribute.String("authz.reason", decision.Reason),
-		)
-		logger.WarnContext(ctx, "authorization denied", slog.String("reason", decision.Reason))
-		c.JSON(http.StatusUnauthorized, gin.H{"error": decision.Reason})
+		result = deny(ctx, c, decision)
 		return
 	}
 
+	result = metrics.ResultAllow
 	span.SetAttributes(attribute.Bool("authz.allowed", true))
 
 	for k, v := range decision.Headers {
@@ -80,3 +108,45 @@ func (h *Handler) Check(c *gin.Context) {
 
 	c.Status(http.StatusOK)
 }
+
+// deny writes the response to a denied decision and returns its metrics
+// result: 429 with Retry-After for throttled callers, 503 while Zitadel is
+// unavailable and 401 otherwise.
+func deny(ctx context.Context, c *gin.Context, decision *authzdomain.AuthzDecision) string {
+	trace.SpanFromContext(ctx).SetAttributes(
+		attribute.Bool("authz.allowed", false),
+		attribute.String("authz.reason", decision.Reason),
+		attribute.String("authz.reason_code", decision.ReasonCode),
+	)
+
+	switch {
+	case decision.RetryAfter > 0:
+		logger.WarnContext(ctx, "too many requests", slog.String("reason", decision.Reason))
+		c.Header(headerRetryAfter, seconds(decision.RetryAfter))
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": decision.Reason})
+		return metrics.ResultDeny
+	case decision.ReasonCode == authzdomain.ReasonZitadelUnavailable:
+		logger.ErrorContext(ctx, "zitadel unavailable", slog.String("reason", decision.Reason))
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "authorization service unavailable"})
+		return metrics.ResultError
+	default:
+		logger.WarnContext(ctx, "authorization denied", slog.String("reason", decision.Reason))
+		c.JSON(http.StatusUnauthorized, gin.H{"error": decision.Reason})
+		return metrics.ResultDeny
+	}
+}
+
+func setRateLimitHeaders(c *gin.Context, status *authzdomain.RateLimitStatus) {
+	if status == nil {
+		return
+	}
+	c.Header(headerRateLimitLimit, strconv.Itoa(status.Limit))
+	c.Header(headerRateLimitRemaining, strconv.Itoa(status.Remaining))
+	c.Header(headerRateLimitReset, seconds(status.Reset))
+}
+
+// seconds rounds d up to whole seconds, so clients retrying after that long
+// are not denied again.
+func seconds(d time.Duration) string {
+	return strconv.FormatInt(int64(math.Ceil(d.Seconds())), 10)
+}
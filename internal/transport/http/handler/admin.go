@@ -0,0 +1,157 @@
+package handler
+
+import (
+	"context"
+	"errors"
+
+	"connectrpc.com/connect"
+	patapp "github.com/astro-web3/oauth2-token-exchange/internal/app/pat"
+	patdomain "github.com/astro-web3/oauth2-token-exchange/internal/domain/pat"
+	patv1 "github.com/astro-web3/oauth2-token-exchange/pb/gen/go/pat/v1"
+	patv1connect "github.com/astro-web3/oauth2-token-exchange/pb/gen/go/pat/v1/patv1connect"
+	"github.com/astro-web3/oauth2-token-exchange/pkg/tracer"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+type AdminPATHandler struct {
+	adminService *patapp.AdminService
+}
+
+func NewAdminPATHandler(adminService *patapp.AdminService) patv1connect.AdminPATServiceHandler {
+	return &AdminPATHandler{adminService: adminService}
+}
+
+func (h *AdminPATHandler) ListUserPATs(
+	ctx context.Context,
+	req *connect.Request[patv1.ListUserPATsRequest],
+) (*connect.Response[patv1.ListPATsResponse], error) {
+	ctx, span := tracer.Start(ctx, "transport.http.admin.ListUserPATs")
+	defer span.End()
+
+	caller, err := callerFrom(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	userID := req.Msg.GetUserId()
+	span.SetAttributes(attribute.String("pat.user_id", userID))
+
+	page, err := h.adminService.ListUserPATs(ctx, caller, userID, toListQuery(req.Msg.GetQuery()))
+	if err != nil {
+		span.RecordError(err)
+		return nil, adminError(err)
+	}
+
+	patProtos := make([]*patv1.PAT, 0, len(page.PATs))
+	for _, pat := range page.PATs {
+		patProtos = append(patProtos, toProtoPAT(pat))
+	}
+
+	return connect.NewResponse(&patv1.ListPATsResponse{
+		Pats:          patProtos,
+		NextPageToken: page.NextPageToken,
+		TotalSize:     int32(page.TotalSize), //nolint:gosec // A user's PAT count fits in int32.
+	}), nil
+}
+
+func (h *AdminPATHandler) RevokePAT(
+	ctx context.Context,
+	req *connect.Request[patv1.RevokePATRequest],
+) (*connect.Response[patv1.RevokePATResponse], error) {
+	ctx, span := tracer.Start(ctx, "transport.http.admin.RevokePAT")
+	defer span.End()
+
+	caller, err := callerFrom(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	userID, patID := req.Msg.GetUserId(), req.Msg.GetPatId()
+	span.SetAttributes(
+		attribute.String("pat.user_id", userID),
+		attribute.String("pat.id", patID),
+	)
+
+	if err = h.adminService.RevokePAT(ctx, caller, userID, patID); err != nil {
+		span.RecordError(err)
+		return nil, adminError(err)
+	}
+
+	return connect.NewResponse(&patv1.RevokePATResponse{}), nil
+}
+
+func (h *AdminPATHandler) RevokeAllPATs(
+	ctx context.Context,
+	req *connect.Request[patv1.RevokeAllPATsRequest],
+) (*connect.Response[patv1.RevokeAllPATsResponse], error) {
+	ctx, span := tracer.Start(ctx, "transport.http.admin.RevokeAllPATs")
+	defer span.End()
+
+	caller, err := callerFrom(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	userID := req.Msg.GetUserId()
+	span.SetAttributes(attribute.String("pat.user_id", userID))
+
+	revoked, err := h.adminService.RevokeAllPATs(ctx, caller, userID)
+	if err != nil {
+		span.RecordError(err)
+		return nil, adminError(err)
+	}
+
+	return connect.NewResponse(&patv1.RevokeAllPATsResponse{RevokedPatIds: revoked}), nil
+}
+
+func (h *AdminPATHandler) ListMachineUsers(
+	ctx context.Context,
+	_ *connect.Request[patv1.ListMachineUsersRequest],
+) (*connect.Response[patv1.ListMachineUsersResponse], error) {
+	ctx, span := tracer.Start(ctx, "transport.http.admin.ListMachineUsers")
+	defer span.End()
+
+	caller, err := callerFrom(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	users, err := h.adminService.ListMachineUsers(ctx, caller)
+	if err != nil {
+		span.RecordError(err)
+		return nil, adminError(err)
+	}
+
+	userProtos := make([]*patv1.MachineUser, 0, len(users))
+	for _, user := range users {
+		userProtos = append(userProtos, &patv1.MachineUser{
+			Id:     user.ID,
+			UserId: user.UserID,
+			Email:  user.Email,
+		})
+	}
+
+	return connect.NewResponse(&patv1.ListMachineUsersResponse{MachineUsers: userProtos}), nil
+}
+
+// callerFrom returns the caller established by the identity interceptor.
+func callerFrom(ctx context.Context) (patdomain.Caller, error) {
+	id, err := callerIdentity(ctx)
+	if err != nil {
+		return patdomain.Caller{}, err
+	}
+	return patdomain.Caller{UserID: id.UserID, Groups: id.Groups, Roles: id.Roles}, nil
+}
+
+func adminError(err error) *connect.Error {
+	switch {
+	case errors.Is(err, patdomain.ErrNotAdmin):
+		return connect.NewError(connect.CodePermissionDenied, err)
+	case errors.Is(err, patdomain.ErrPATNotFound), errors.Is(err, patdomain.ErrMachineUserNotFound):
+		return connect.NewError(connect.CodeNotFound, err)
+	case errors.Is(err, patdomain.ErrInvalidListQuery):
+		return connect.NewError(connect.CodeInvalidArgument, err)
+	default:
+		return connect.NewError(connect.CodeInternal, err)
+	}
+}
@@ -8,18 +8,13 @@ import (
 	"connectrpc.com/connect"
 	patapp "github.com/astro-web3/oauth2-token-exchange/internal/app/pat"
 	patdomain "github.com/astro-web3/oauth2-token-exchange/internal/domain/pat"
+	"github.com/astro-web3/oauth2-token-exchange/internal/transport/http/identity"
 	patv1 "github.com/astro-web3/oauth2-token-exchange/pb/gen/go/pat/v1"
 	patv1connect "github.com/astro-web3/oauth2-token-exchange/pb/gen/go/pat/v1/patv1connect"
 	"github.com/astro-web3/oauth2-token-exchange/pkg/tracer"
 	"go.opentelemetry.io/otel/attribute"
 )
 
-const (
-	headerUserID            = "X-Auth-Request-User"
-	headerEmail             = "X-Auth-Request-Email"
-	headerPreferredUsername = "X-Auth-Request-Preferred-Username"
-)
-
 type PATHandler struct {
 	commandService *patapp.CommandService
 	queryService   *patapp.QueryService
@@ -42,30 +37,36 @@ func (h *PATHandler) CreatePAT(
 	ctx, span := tracer.Start(ctx, "transport.http.CreatePAT")
 	defer span.End()
 
-	userID := req.Header().Get(headerUserID)
-	email := req.Header().Get(headerEmail)
-	preferredUsername := req.Header().Get(headerPreferredUsername)
-
-	if userID == "" {
-		return nil, connect.NewError(connect.CodeUnauthenticated, errors.New("missing X-Auth-Request-User header"))
+	caller, err := callerIdentity(ctx)
+	if err != nil {
+		return nil, err
 	}
+	userID := caller.UserID
 
-	expirationDate := time.Unix(req.Msg.GetExpirationDate(), 0)
-	if expirationDate.Before(time.Now()) {
-		return nil, connect.NewError(connect.CodeInvalidArgument, patdomain.ErrInvalidExpiration)
+	// Zero leaves the expiration to the PAT policy's default lifetime.
+	var expirationDate time.Time
+	if sec := req.Msg.GetExpirationDate(); sec != 0 {
+		expirationDate = time.Unix(sec, 0)
+		if expirationDate.Before(time.Now()) {
+			return nil, connect.NewError(connect.CodeInvalidArgument, patdomain.ErrInvalidExpiration)
+		}
 	}
 
 	span.SetAttributes(
 		attribute.String("pat.user_id", userID),
-		attribute.String("pat.email", email),
+		attribute.String("pat.email", caller.Email),
 	)
 
-	pat, token, err := h.commandService.CreatePAT(ctx, userID, email, preferredUsername, expirationDate)
+	pat, token, err := h.commandService.CreatePAT(
+		ctx, userID, caller.Email, caller.PreferredUsername, caller.Groups, expirationDate)
 	if err != nil {
 		span.RecordError(err)
-		if errors.Is(err, patdomain.ErrInvalidExpiration) {
+		if errors.Is(err, patdomain.ErrInvalidExpiration) || errors.Is(err, patdomain.ErrLifetimeExceeded) {
 			return nil, connect.NewError(connect.CodeInvalidArgument, err)
 		}
+		if errors.Is(err, patdomain.ErrQuotaExceeded) {
+			return nil, connect.NewError(connect.CodeResourceExhausted, err)
+		}
 		if errors.Is(err, patdomain.ErrFailedToCreatePAT) {
 			return nil, connect.NewError(connect.CodeInternal, err)
 		}
@@ -73,19 +74,45 @@ func (h *PATHandler) CreatePAT(
 	}
 
 	connectResp := connect.NewResponse(&patv1.CreatePATResponse{
-		Pat: &patv1.PAT{
-			Id:             pat.ID,
-			MachineUserId:  pat.MachineUserID,
-			HumanUserId:    pat.HumanUserID,
-			ExpirationDate: pat.ExpirationDate.Unix(),
-			CreatedAt:      pat.CreatedAt.Unix(),
-		},
+		Pat:   toProtoPAT(pat),
 		Token: token,
 	})
 
 	return connectResp, nil
 }
 
+func (h *PATHandler) GetPAT(
+	ctx context.Context,
+	req *connect.Request[patv1.GetPATRequest],
+) (*connect.Response[patv1.GetPATResponse], error) {
+	ctx, span := tracer.Start(ctx, "transport.http.GetPAT")
+	defer span.End()
+
+	caller, err := callerIdentity(ctx)
+	if err != nil {
+		return nil, err
+	}
+	userID := caller.UserID
+
+	patID := req.Msg.GetPatId()
+
+	span.SetAttributes(
+		attribute.String("pat.user_id", userID),
+		attribute.String("pat.id", patID),
+	)
+
+	pat, err := h.queryService.GetPAT(ctx, userID, patID)
+	if err != nil {
+		span.RecordError(err)
+		if errors.Is(err, patdomain.ErrPATNotFound) {
+			return nil, connect.NewError(connect.CodeNotFound, err)
+		}
+		return nil, connect.NewError(connect.CodeInternal, err)
+	}
+
+	return connect.NewResponse(&patv1.GetPATResponse{Pat: toProtoPAT(pat)}), nil
+}
+
 func (h *PATHandler) ListPATs(
 	ctx context.Context,
 	req *connect.Request[patv1.ListPATsRequest],
@@ -93,32 +120,32 @@ func (h *PATHandler) ListPATs(
 	ctx, span := tracer.Start(ctx, "transport.http.ListPATs")
 	defer span.End()
 
-	userID := req.Header().Get(headerUserID)
-	if userID == "" {
-		return nil, connect.NewError(connect.CodeUnauthenticated, errors.New("missing X-Auth-Request-User header"))
+	caller, err := callerIdentity(ctx)
+	if err != nil {
+		return nil, err
 	}
+	userID := caller.UserID
 
 	span.SetAttributes(attribute.String("pat.user_id", userID))
 
-	pats, err := h.queryService.ListPATs(ctx, userID)
+	page, err := h.queryService.ListPATs(ctx, userID, toListQuery(req.Msg))
 	if err != nil {
 		span.RecordError(err)
+		if errors.Is(err, patdomain.ErrInvalidListQuery) {
+			return nil, connect.NewError(connect.CodeInvalidArgument, err)
+		}
 		return nil, connect.NewError(connect.CodeInternal, err)
 	}
 
-	patProtos := make([]*patv1.PAT, 0, len(pats))
-	for _, pat := range pats {
-		patProtos = append(patProtos, &patv1.PAT{
-			Id:             pat.ID,
-			MachineUserId:  pat.MachineUserID,
-			HumanUserId:    pat.HumanUserID,
-			ExpirationDate: pat.ExpirationDate.Unix(),
-			CreatedAt:      pat.CreatedAt.Unix(),
-		})
+	patProtos := make([]*patv1.PAT, 0, len(page.PATs))
+	for _, pat := range page.PATs {
+		patProtos = append(patProtos, toProtoPAT(pat))
 	}
 
 	return connect.NewResponse(&patv1.ListPATsResponse{
-		Pats: patProtos,
+		Pats:          patProtos,
+		NextPageToken: page.NextPageToken,
+		TotalSize:     int32(page.TotalSize), //nolint:gosec // A user's PAT count fits in int32.
 	}), nil
 }
 
@@ -129,10 +156,11 @@ func (h *PATHandler) DeletePAT(
 	ctx, span := tracer.Start(ctx, "transport.http.DeletePAT")
 	defer span.End()
 
-	userID := req.Header().Get(headerUserID)
-	if userID == "" {
-		return nil, connect.NewError(connect.CodeUnauthenticated, errors.New("missing X-Auth-Request-User header"))
+	caller, err := callerIdentity(ctx)
+	if err != nil {
+		return nil, err
 	}
+	userID := caller.UserID
 
 	patID := req.Msg.GetPatId()
 
@@ -141,8 +169,7 @@ func (h *PATHandler) DeletePAT(
 		attribute.String("pat.id", patID),
 	)
 
-	err := h.commandService.DeletePAT(ctx, userID, patID)
-	if err != nil {
+	if err = h.commandService.DeletePAT(ctx, userID, patID); err != nil {
 		span.RecordError(err)
 		if errors.Is(err, patdomain.ErrPATNotFound) {
 			return nil, connect.NewError(connect.CodeNotFound, err)
@@ -157,3 +184,102 @@ func (h *PATHandler) DeletePAT(
 		Success: true,
 	}), nil
 }
+
+func (h *PATHandler) RotatePAT(
+	ctx context.Context,
+	req *connect.Request[patv1.RotatePATRequest],
+) (*connect.Response[patv1.RotatePATResponse], error) {
+	ctx, span := tracer.Start(ctx, "transport.http.RotatePAT")
+	defer span.End()
+
+	caller, err := callerIdentity(ctx)
+	if err != nil {
+		return nil, err
+	}
+	userID := caller.UserID
+
+	patID := req.Msg.GetPatId()
+
+	span.SetAttributes(
+		attribute.String("pat.user_id", userID),
+		attribute.String("pat.id", patID),
+	)
+
+	// Unset leaves the grace period to the server's default.
+	var gracePeriod *time.Duration
+	if req.Msg.GracePeriodSeconds != nil {
+		d := time.Duration(req.Msg.GetGracePeriodSeconds()) * time.Second
+		gracePeriod = &d
+	}
+
+	rotation, token, err := h.commandService.RotatePAT(ctx, userID, patID, caller.Groups, gracePeriod)
+	if err != nil {
+		span.RecordError(err)
+		if errors.Is(err, patdomain.ErrPATNotFound) || errors.Is(err, patdomain.ErrMachineUserNotFound) {
+			return nil, connect.NewError(connect.CodeNotFound, err)
+		}
+		if errors.Is(err, patdomain.ErrInvalidGracePeriod) || errors.Is(err, patdomain.ErrInvalidExpiration) {
+			return nil, connect.NewError(connect.CodeInvalidArgument, err)
+		}
+		if errors.Is(err, patdomain.ErrDeletionQueueNotSet) || errors.Is(err, patdomain.ErrAlreadyRotated) {
+			return nil, connect.NewError(connect.CodeFailedPrecondition, err)
+		}
+		return nil, connect.NewError(connect.CodeInternal, err)
+	}
+
+	return connect.NewResponse(&patv1.RotatePATResponse{
+		Pat:            toProtoPAT(rotation.New),
+		Token:          token,
+		OldPatId:       rotation.Old.ID,
+		OldPatDeleteAt: rotation.OldDeleteAt.Unix(),
+	}), nil
+}
+
+func toListQuery(msg *patv1.ListPATsRequest) patdomain.ListQuery {
+	query := patdomain.ListQuery{
+		Descending: msg.GetDescending(),
+		PageSize:   int(msg.GetPageSize()),
+		PageToken:  msg.GetPageToken(),
+	}
+
+	switch msg.GetSortBy() {
+	case patv1.PATSortField_PAT_SORT_FIELD_EXPIRATION_DATE:
+		query.SortBy = patdomain.SortByExpirationDate
+	case patv1.PATSortField_PAT_SORT_FIELD_CREATED_AT, patv1.PATSortField_PAT_SORT_FIELD_UNSPECIFIED:
+		query.SortBy = patdomain.SortByCreatedAt
+	}
+
+	if filter := msg.GetFilter(); filter != nil {
+		if filter.Expired != nil {
+			expired := filter.GetExpired()
+			query.Filter.Expired = &expired
+		}
+		if sec := filter.GetExpiringBefore(); sec != 0 {
+			query.Filter.ExpiringBefore = time.Unix(sec, 0)
+		}
+		if sec := filter.GetCreatedAfter(); sec != 0 {
+			query.Filter.CreatedAfter = time.Unix(sec, 0)
+		}
+	}
+
+	return query
+}
+
+func toProtoPAT(pat *patdomain.PAT) *patv1.PAT {
+	return &patv1.PAT{
+		Id:             pat.ID,
+		MachineUserId:  pat.MachineUserID,
+		HumanUserId:    pat.HumanUserID,
+		ExpirationDate: pat.ExpirationDate.Unix(),
+		CreatedAt:      pat.CreatedAt.Unix(),
+	}
+}
+
+// callerIdentity returns the caller established by the identity interceptor.
+func callerIdentity(ctx context.Context) (*identity.Identity, error) {
+	caller, ok := identity.FromContext(ctx)
+	if !ok || caller.UserID == "" {
+		return nil, connect.NewError(connect.CodeUnauthenticated, identity.ErrUnauthenticated)
+	}
+	return caller, nil
+}
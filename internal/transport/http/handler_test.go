@@ -4,27 +4,30 @@ import (
 	"context"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/astro-web3/oauth2-token-exchange/internal/config"
 	authzdomain "github.com/astro-web3/oauth2-token-exchange/internal/domain/authz"
 	httptransport "github.com/astro-web3/oauth2-token-exchange/internal/transport/http"
+	"github.com/astro-web3/oauth2-token-exchange/pkg/metrics"
 	"github.com/gin-gonic/gin"
 )
 
 type mockAppService struct {
-	checkFunc func(_ context.Context, pat string, cacheTTL time.Duration, headerKeys map[string]string) (*authzdomain.AuthzDecision, error)
+	checkFunc func(_ context.Context, pat string, route authzdomain.Route, cacheTTL time.Duration, headerKeys map[string]string) (*authzdomain.AuthzDecision, error)
 }
 
 func (m *mockAppService) Check(
 	ctx context.Context,
 	pat string,
+	route authzdomain.Route,
 	cacheTTL time.Duration,
 	headerKeys map[string]string,
 ) (*authzdomain.AuthzDecision, error) {
 	if m.checkFunc != nil {
-		return m.checkFunc(ctx, pat, cacheTTL, headerKeys)
+		return m.checkFunc(ctx, pat, route, cacheTTL, headerKeys)
 	}
 	return &authzdomain.AuthzDecision{
 		Allow:   true,
@@ -48,7 +51,7 @@ func TestHandler_Check_MissingAuthorizationHeader(t *testing.T) {
 	mockService := &mockAppService{}
 	cfg := createTestConfig()
 
-	handler := httptransport.NewHandler(mockService, cfg)
+	handler := httptransport.NewHandler(mockService, config.NewStore(cfg))
 	router := gin.New()
 	router.Any("/oauth2/token-exchange/*path", handler.Check)
 
@@ -65,7 +68,7 @@ func TestHandler_Check_ValidPAT(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 
 	mockService := &mockAppService{
-		checkFunc: func(_ context.Context, _ string, _ time.Duration, _ map[string]string) (*authzdomain.AuthzDecision, error) {
+		checkFunc: func(_ context.Context, _ string, _ authzdomain.Route, _ time.Duration, _ map[string]string) (*authzdomain.AuthzDecision, error) {
 			return &authzdomain.AuthzDecision{
 				Allow: true,
 				Headers: map[string]string{
@@ -79,7 +82,7 @@ func TestHandler_Check_ValidPAT(t *testing.T) {
 	}
 
 	cfg := createTestConfig()
-	handler := httptransport.NewHandler(mockService, cfg)
+	handler := httptransport.NewHandler(mockService, config.NewStore(cfg))
 	router := gin.New()
 	router.Any("/oauth2/token-exchange/*path", handler.Check)
 
@@ -107,7 +110,7 @@ func TestHandler_Check_InvalidPAT(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 
 	mockService := &mockAppService{
-		checkFunc: func(_ context.Context, _ string, _ time.Duration, _ map[string]string) (*authzdomain.AuthzDecision, error) {
+		checkFunc: func(_ context.Context, _ string, _ authzdomain.Route, _ time.Duration, _ map[string]string) (*authzdomain.AuthzDecision, error) {
 			return &authzdomain.AuthzDecision{
 				Allow:  false,
 				Reason: "invalid token",
@@ -116,7 +119,7 @@ func TestHandler_Check_InvalidPAT(t *testing.T) {
 	}
 
 	cfg := createTestConfig()
-	handler := httptransport.NewHandler(mockService, cfg)
+	handler := httptransport.NewHandler(mockService, config.NewStore(cfg))
 	router := gin.New()
 	router.Any("/oauth2/token-exchange/*path", handler.Check)
 
@@ -134,13 +137,13 @@ func TestHandler_Check_ServiceError(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 
 	mockService := &mockAppService{
-		checkFunc: func(_ context.Context, _ string, _ time.Duration, _ map[string]string) (*authzdomain.AuthzDecision, error) {
+		checkFunc: func(_ context.Context, _ string, _ authzdomain.Route, _ time.Duration, _ map[string]string) (*authzdomain.AuthzDecision, error) {
 			return nil, context.DeadlineExceeded
 		},
 	}
 
 	cfg := createTestConfig()
-	handler := httptransport.NewHandler(mockService, cfg)
+	handler := httptransport.NewHandler(mockService, config.NewStore(cfg))
 	router := gin.New()
 	router.Any("/oauth2/token-exchange/*path", handler.Check)
 
@@ -158,7 +161,7 @@ func TestHandler_Check_LowercaseAuthorizationHeader(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 
 	mockService := &mockAppService{
-		checkFunc: func(_ context.Context, pat string, _ time.Duration, _ map[string]string) (*authzdomain.AuthzDecision, error) {
+		checkFunc: func(_ context.Context, pat string, _ authzdomain.Route, _ time.Duration, _ map[string]string) (*authzdomain.AuthzDecision, error) {
 			if pat != "valid-token" {
 				t.Errorf("expected pat 'valid-token', got '%s'", pat)
 			}
@@ -170,7 +173,7 @@ func TestHandler_Check_LowercaseAuthorizationHeader(t *testing.T) {
 	}
 
 	cfg := createTestConfig()
-	handler := httptransport.NewHandler(mockService, cfg)
+	handler := httptransport.NewHandler(mockService, config.NewStore(cfg))
 	router := gin.New()
 	router.Any("/oauth2/token-exchange/*path", handler.Check)
 
@@ -183,3 +186,111 @@ func TestHandler_Check_LowercaseAuthorizationHeader(t *testing.T) {
 		t.Errorf("expected status %d, got %d", http.StatusOK, w.Code)
 	}
 }
+
+func TestHandler_Check_RecordsMetrics(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mockService := &mockAppService{
+		checkFunc: func(_ context.Context, _ string, _ authzdomain.Route, _ time.Duration, _ map[string]string) (*authzdomain.AuthzDecision, error) {
+			return &authzdomain.AuthzDecision{
+				Allow:      false,
+				Reason:     "failed to get user info: 401",
+				ReasonCode: authzdomain.ReasonInvalidPAT,
+			}, nil
+		},
+	}
+
+	handler := httptransport.NewHandler(mockService, config.NewStore(createTestConfig()))
+	router := gin.New()
+	router.Any("/oauth2/token-exchange/*path", handler.Check)
+	router.GET("/metrics", gin.WrapH(metrics.Handler()))
+
+	req := httptest.NewRequest(http.MethodGet, "/oauth2/token-exchange/test", nil)
+	req.Header.Set("Authorization", "Bearer invalid-token")
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	body := w.Body.String()
+	for _, want := range []string{
+		`oauth2_token_exchange_authz_decisions_total{reason="invalid_pat",result="deny"}`,
+		`oauth2_token_exchange_authz_check_duration_seconds_count{result="deny"}`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("expected metrics to contain %s", want)
+		}
+	}
+	if strings.Contains(body, "failed to get user info") {
+		t.Error("free-form reason must not be used as a label")
+	}
+}
+
+func TestHandler_Check_RateLimited(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mockService := &mockAppService{
+		checkFunc: func(_ context.Context, _ string, route authzdomain.Route, _ time.Duration, _ map[string]string) (*authzdomain.AuthzDecision, error) {
+			if route.Method != http.MethodPost || route.Path != "/api/orders" {
+				t.Errorf("unexpected route: %+v", route)
+			}
+			return &authzdomain.AuthzDecision{
+				Allow:      false,
+				Reason:     "rate limit per-pat exceeded",
+				ReasonCode: authzdomain.ReasonRateLimited,
+				RateLimit:  &authzdomain.RateLimitStatus{Limit: 10, Reset: 6 * time.Second},
+				RetryAfter: 1500 * time.Millisecond,
+			}, nil
+		},
+	}
+
+	handler := httptransport.NewHandler(mockService, config.NewStore(createTestConfig()))
+	router := gin.New()
+	router.Any("/oauth2/token-exchange/*path", handler.Check)
+
+	req := httptest.NewRequest(http.MethodPost, "/oauth2/token-exchange/api/orders", nil)
+	req.Header.Set("Authorization", "Bearer valid-token")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected status %d, got %d", http.StatusTooManyRequests, w.Code)
+	}
+	for header, want := range map[string]string{
+		"Retry-After":           "2",
+		"X-RateLimit-Limit":     "10",
+		"X-RateLimit-Remaining": "0",
+		"X-RateLimit-Reset":     "6",
+	} {
+		if got := w.Header().Get(header); got != want {
+			t.Errorf("expected %s %q, got %q", header, want, got)
+		}
+	}
+}
+
+func TestHandler_Check_ZitadelUnavailable(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mockService := &mockAppService{
+		checkFunc: func(context.Context, string, authzdomain.Route, time.Duration, map[string]string) (*authzdomain.AuthzDecision, error) {
+			return &authzdomain.AuthzDecision{
+				Allow:      false,
+				Reason:     "zitadel unavailable: circuit breaker is open",
+				ReasonCode: authzdomain.ReasonZitadelUnavailable,
+			}, nil
+		},
+	}
+
+	handler := httptransport.NewHandler(mockService, config.NewStore(createTestConfig()))
+	router := gin.New()
+	router.Any("/oauth2/token-exchange/*path", handler.Check)
+
+	req := httptest.NewRequest(http.MethodGet, "/oauth2/token-exchange/api", nil)
+	req.Header.Set("Authorization", "Bearer valid-token")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected status %d, got %d", http.StatusServiceUnavailable, w.Code)
+	}
+}
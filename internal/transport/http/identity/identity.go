@@ -0,0 +1,141 @@
+// Package identity establishes who is calling the PAT API. A Verifier checks
+// the request against a verified source, and the interceptor returned by
+// NewInterceptor makes the result available to handlers through FromContext.
+package identity
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"connectrpc.com/connect"
+	"github.com/astro-web3/oauth2-token-exchange/pkg/logger"
+)
+
+// HeaderRoles carries the caller's roles. The other identity headers are
+// configured by auth.header_keys.
+const HeaderRoles = "X-Auth-Request-Roles"
+
+// ErrUnauthenticated is returned when the caller's identity cannot be
+// established.
+var ErrUnauthenticated = errors.New("unauthenticated")
+
+// Identity is the verified caller of the PAT API.
+type Identity struct {
+	UserID            string
+	Email             string
+	PreferredUsername string
+	Groups            []string
+	Roles             []string
+}
+
+// Request is the part of an incoming RPC a Verifier looks at.
+type Request struct {
+	// Method is the HTTP method, e.g. POST.
+	Method string
+	// Procedure is the RPC's path, e.g. /pat.v1.PATService/CreatePAT.
+	Procedure string
+	Header    http.Header
+}
+
+// Verifier establishes the caller's identity from an incoming request.
+type Verifier interface {
+	Verify(ctx context.Context, req Request) (*Identity, error)
+}
+
+type contextKey struct{}
+
+// NewContext returns a copy of ctx carrying id.
+func NewContext(ctx context.Context, id *Identity) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// FromContext returns the identity established for the current request.
+func FromContext(ctx context.Context) (*Identity, bool) {
+	id, ok := ctx.Value(contextKey{}).(*Identity)
+	return id, ok && id != nil
+}
+
+// NewInterceptor rejects RPCs whose caller verifier cannot identify with
+// CodeUnauthenticated, and passes the identity of all others to the handler.
+func NewInterceptor(verifier Verifier) connect.UnaryInterceptorFunc {
+	return func(next connect.UnaryFunc) connect.UnaryFunc {
+		return func(ctx context.Context, req connect.AnyRequest) (connect.AnyResponse, error) {
+			if req.Spec().IsClient {
+				return next(ctx, req)
+			}
+
+			id, err := verifier.Verify(ctx, Request{
+				Method:    req.HTTPMethod(),
+				Procedure: req.Spec().Procedure,
+				Header:    req.Header(),
+			})
+			if err != nil {
+				logger.WarnContext(ctx, "rejected caller",
+					slog.String("procedure", req.Spec().Procedure),
+					slog.String("peer", req.Peer().Addr),
+					slog.String("error", err.Error()),
+				)
+				return nil, connect.NewError(connect.CodeUnauthenticated, err)
+			}
+
+			return next(NewContext(ctx, id), req)
+		}
+	}
+}
+
+// Headers names the request headers an upstream proxy sets to describe the
+// caller.
+type Headers struct {
+	UserID            string
+	Email             string
+	PreferredUsername string
+	Groups            string
+	Roles             string
+	AccessToken       string
+}
+
+// identity reads the caller from the headers. Groups and roles are
+// comma-separated lists.
+func (h Headers) identity(header http.Header) (*Identity, error) {
+	id := &Identity{
+		UserID:            header.Get(h.UserID),
+		Email:             header.Get(h.Email),
+		PreferredUsername: header.Get(h.PreferredUsername),
+		Groups:            splitList(header.Get(h.Groups)),
+		Roles:             splitList(header.Get(h.Roles)),
+	}
+	if id.UserID == "" {
+		return nil, fmt.Errorf("%w: missing %s header", ErrUnauthenticated, h.UserID)
+	}
+	return id, nil
+}
+
+// NewTrustedProxyVerifier accepts the identity headers as they are. Only use
+// it when the service is reachable through a proxy that strips these headers
+// from client requests, since anyone reaching the service directly can
+// otherwise act as any user.
+func NewTrustedProxyVerifier(headers Headers) Verifier {
+	return trustedProxyVerifier{headers: headers}
+}
+
+type trustedProxyVerifier struct {
+	headers Headers
+}
+
+func (v trustedProxyVerifier) Verify(_ context.Context, req Request) (*Identity, error) {
+	return v.headers.identity(req.Header)
+}
+
+func splitList(value string) []string {
+	var items []string
+	for item := range strings.SplitSeq(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,353 @@
+package identity_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/astro-web3/oauth2-token-exchange/internal/transport/http/identity"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const issuer = "https://issuer.example.com"
+
+//nolint:gochecknoglobals // Shared read-only test fixture.
+var headers = identity.Headers{
+	UserID:            "X-Auth-Request-User",
+	Email:             "X-Auth-Request-Email",
+	PreferredUsername: "X-Auth-Request-Preferred-Username",
+	Groups:            "X-Auth-Request-Groups",
+	Roles:             identity.HeaderRoles,
+	AccessToken:       "X-Auth-Request-Access-Token",
+}
+
+func identityHeader(id *identity.Identity) http.Header {
+	h := http.Header{}
+	h.Set(headers.UserID, id.UserID)
+	h.Set(headers.Email, id.Email)
+	h.Set(headers.Groups, "dev, security")
+	return h
+}
+
+func encode(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+type jwksServer struct {
+	*httptest.Server
+
+	rsaKey *rsa.PrivateKey
+	ecKey  *ecdsa.PrivateKey
+
+	// fetches counts JWKS requests; published holds the key IDs served.
+	fetches   atomic.Int32
+	published atomic.Pointer[[]string]
+}
+
+func newJWKSServer(t *testing.T) *jwksServer {
+	t.Helper()
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecPoint, err := ecKey.PublicKey.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	set := map[string][]map[string]string{"keys": {
+		{
+			"kty": "RSA", "kid": "rsa-1", "use": "sig",
+			"n": encode(rsaKey.N.Bytes()), "e": encode(big.NewInt(int64(rsaKey.E)).Bytes()),
+		},
+		{"kty": "EC", "kid": "ec-1", "crv": "P-256", "x": encode(ecPoint[1:33]), "y": encode(ecPoint[33:])},
+		{"kty": "OKP", "kid": "ed-1", "crv": "Ed25519", "x": "AA"},
+	}}
+
+	s := &jwksServer{rsaKey: rsaKey, ecKey: ecKey}
+	s.publish("rsa-1", "ec-1", "ed-1")
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		s.fetches.Add(1)
+		published := map[string]any{"keys": slices.DeleteFunc(slices.Clone(set["keys"]), func(k map[string]string) bool {
+			return !slices.Contains(*s.published.Load(), k["kid"])
+		})}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(published)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// publish limits the served key set to kids.
+func (s *jwksServer) publish(kids ...string) {
+	s.published.Store(&kids)
+}
+
+func (s *jwksServer) sign(t *testing.T, method jwt.SigningMethod, kid string, claims jwt.MapClaims) string {
+	t.Helper()
+
+	token := jwt.NewWithClaims(method, claims)
+	token.Header["kid"] = kid
+
+	var key any = s.rsaKey
+	if method == jwt.SigningMethodES256 {
+		key = s.ecKey
+	}
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func validClaims() jwt.MapClaims {
+	return jwt.MapClaims{
+		"iss":    issuer,
+		"sub":    "user-1",
+		"aud":    []string{"project-1"},
+		"exp":    time.Now().Add(time.Hour).Unix(),
+		"email":  "user@example.com",
+		"groups": []string{"dev"},
+		"urn:zitadel:iam:org:project:roles": map[string]any{
+			"pat-admin": map[string]string{"org-1": "example.com"},
+		},
+	}
+}
+
+func TestJWTVerifier(t *testing.T) {
+	server := newJWKSServer(t)
+	verifier := identity.NewJWTVerifier(headers, identity.JWTConfig{
+		JWKSURL:     server.URL,
+		Issuer:      issuer,
+		Audiences:   []string{"project-1"},
+		GroupsClaim: "groups",
+		RolesClaim:  "urn:zitadel:iam:org:project:roles",
+	})
+
+	withClaims := func(change func(jwt.MapClaims)) jwt.MapClaims {
+		claims := validClaims()
+		change(claims)
+		return claims
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr bool
+	}{
+		{"RSA key", server.sign(t, jwt.SigningMethodRS256, "rsa-1", validClaims()), false},
+		{"EC key", server.sign(t, jwt.SigningMethodES256, "ec-1", validClaims()), false},
+		{"unknown key", server.sign(t, jwt.SigningMethodRS256, "rsa-2", validClaims()), true},
+		{"wrong issuer", server.sign(t, jwt.SigningMethodRS256, "rsa-1",
+			withClaims(func(c jwt.MapClaims) { c["iss"] = "https://evil.example.com" })), true},
+		{"wrong audience", server.sign(t, jwt.SigningMethodRS256, "rsa-1",
+			withClaims(func(c jwt.MapClaims) { c["aud"] = "project-2" })), true},
+		{"expired", server.sign(t, jwt.SigningMethodRS256, "rsa-1",
+			withClaims(func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Hour).Unix() })), true},
+		{"no subject", server.sign(t, jwt.SigningMethodRS256, "rsa-1",
+			withClaims(func(c jwt.MapClaims) { delete(c, "sub") })), true},
+		{"unsigned", "eyJhbGciOiJub25lIn0.eyJzdWIiOiJ1c2VyLTEifQ.", true},
+		{"missing", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The identity headers must be ignored in favour of the token.
+			header := identityHeader(&identity.Identity{UserID: "someone-else"})
+			header.Set(headers.AccessToken, tt.token)
+
+			id, err := verifier.Verify(context.Background(), identity.Request{Header: header})
+			if tt.wantErr {
+				if !errors.Is(err, identity.ErrUnauthenticated) {
+					t.Fatalf("expected ErrUnauthenticated, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if id.UserID != "user-1" || id.Email != "user@example.com" ||
+				!slices.Equal(id.Groups, []string{"dev"}) || !slices.Equal(id.Roles, []string{"pat-admin"}) {
+				t.Errorf("unexpected identity: %+v", id)
+			}
+		})
+	}
+}
+
+func TestJWTVerifier_SharesKeySetFetch(t *testing.T) {
+	server := newJWKSServer(t)
+	verifier := identity.NewJWTVerifier(headers, identity.JWTConfig{JWKSURL: server.URL, Issuer: issuer})
+	header := http.Header{}
+	header.Set(headers.AccessToken, server.sign(t, jwt.SigningMethodRS256, "rsa-1", validClaims()))
+
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Go(func() {
+			if _, err := verifier.Verify(context.Background(), identity.Request{Header: header}); err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+	wg.Wait()
+
+	if fetches := server.fetches.Load(); fetches != 1 {
+		t.Errorf("expected concurrent verifications to share one JWKS fetch, got %d", fetches)
+	}
+}
+
+func TestJWTVerifier_ExpiresRemovedKeys(t *testing.T) {
+	server := newJWKSServer(t)
+	verifier := identity.NewJWTVerifier(headers, identity.JWTConfig{
+		JWKSURL:   server.URL,
+		Issuer:    issuer,
+		KeySetTTL: 50 * time.Millisecond,
+	})
+	header := http.Header{}
+	header.Set(headers.AccessToken, server.sign(t, jwt.SigningMethodRS256, "rsa-1", validClaims()))
+
+	if _, err := verifier.Verify(context.Background(), identity.Request{Header: header}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// The issuer stops publishing the key; once the set expires it is gone.
+	server.publish("ec-1")
+	time.Sleep(60 * time.Millisecond)
+	if _, err := verifier.Verify(context.Background(), identity.Request{Header: header}); !errors.Is(
+		err, identity.ErrUnauthenticated) {
+		t.Fatalf("expected the removed key to be rejected, got %v", err)
+	}
+	if fetches := server.fetches.Load(); fetches != 2 {
+		t.Errorf("expected the expired set to be fetched again, got %d fetches", fetches)
+	}
+}
+
+func TestSignedHeaderVerifier(t *testing.T) {
+	const (
+		secret    = "shared-secret"
+		procedure = "/pat.v1.PATService/ListPATs"
+	)
+	verifier := identity.NewSignedHeaderVerifier(headers, stringSecret(secret), time.Minute)
+	want := &identity.Identity{UserID: "user-1", Email: "user@example.com", Groups: []string{"dev", "security"}}
+
+	signed := func(timestamp time.Time, signer string) http.Header {
+		h := identityHeader(want)
+		h.Set(identity.HeaderTimestamp, strconv.FormatInt(timestamp.Unix(), 10))
+		h.Set(identity.HeaderSignature, identity.Sign(signer, http.MethodPost, procedure, timestamp, want))
+		return h
+	}
+	tampered := signed(time.Now(), secret)
+	tampered.Set(headers.UserID, "user-2")
+
+	tests := []struct {
+		name      string
+		method    string
+		procedure string
+		header    http.Header
+		wantErr   bool
+	}{
+		{"valid", http.MethodPost, procedure, signed(time.Now(), secret), false},
+		{"wrong secret", http.MethodPost, procedure, signed(time.Now(), "other-secret"), true},
+		{"stale", http.MethodPost, procedure, signed(time.Now().Add(-2*time.Minute), secret), true},
+		{"tampered", http.MethodPost, procedure, tampered, true},
+		{"unsigned", http.MethodPost, procedure, identityHeader(want), true},
+		{"other procedure", http.MethodPost, "/pat.v1.AdminPATService/RevokeAllPATs", signed(time.Now(), secret), true},
+		{"other method", http.MethodGet, procedure, signed(time.Now(), secret), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id, err := verifier.Verify(context.Background(),
+				identity.Request{Method: tt.method, Procedure: tt.procedure, Header: tt.header})
+			if tt.wantErr {
+				if !errors.Is(err, identity.ErrUnauthenticated) {
+					t.Fatalf("expected ErrUnauthenticated, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if id.UserID != want.UserID || !slices.Equal(id.Groups, want.Groups) {
+				t.Errorf("unexpected identity: %+v", id)
+			}
+		})
+	}
+}
+
+func TestMTLSVerifier(t *testing.T) {
+	verifier := identity.NewMTLSVerifier(headers, []string{"gateway"})
+
+	tests := []struct {
+		name    string
+		state   *tls.ConnectionState
+		wantErr bool
+	}{
+		{"allowed proxy", verifiedState("gateway"), false},
+		{"other client", verifiedState("laptop"), true},
+		{"unverified certificate", &tls.ConnectionState{}, true},
+		{"plain HTTP", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/pat.v1.PATService/ListPATs", nil)
+			req.TLS = tt.state
+			header := identityHeader(&identity.Identity{UserID: "user-1"})
+
+			var err error
+			identity.WithTLSState(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+				_, err = verifier.Verify(r.Context(), identity.Request{Header: header})
+			})).ServeHTTP(httptest.NewRecorder(), req)
+
+			if tt.wantErr != (err != nil) {
+				t.Errorf("expected error %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func verifiedState(commonName string) *tls.ConnectionState {
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: commonName}}
+	return &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+}
+
+func TestTrustedProxyVerifier_RequiresUser(t *testing.T) {
+	verifier := identity.NewTrustedProxyVerifier(headers)
+
+	if _, err := verifier.Verify(context.Background(), identity.Request{Header: http.Header{}}); !errors.Is(err, identity.ErrUnauthenticated) {
+		t.Fatalf("expected ErrUnauthenticated, got %v", err)
+	}
+	id, err := verifier.Verify(context.Background(),
+		identity.Request{Header: identityHeader(&identity.Identity{UserID: "user-1"})})
+	if err != nil || id.UserID != "user-1" || !slices.Equal(id.Groups, []string{"dev", "security"}) {
+		t.Errorf("unexpected result: %+v, %v", id, err)
+	}
+}
+
+type stringSecret string
+
+func (s stringSecret) Value() string {
+	return string(s)
+}
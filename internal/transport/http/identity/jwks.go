@@ -0,0 +1,241 @@
+package identity
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+
+	httpclient "github.com/astro-web3/oauth2-token-exchange/pkg/http"
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	// minJWKSRefreshInterval limits how often an unknown key ID triggers a
+	// fetch, so tokens with made-up key IDs cannot flood the issuer.
+	minJWKSRefreshInterval = time.Minute
+	// jwksRetryInterval is how long a failed fetch blocks the next one.
+	jwksRetryInterval = 5 * time.Second
+	// defaultJWKSTTL is how long a fetched key set is used before it is
+	// fetched again, which drops keys the issuer no longer publishes.
+	defaultJWKSTTL = 15 * time.Minute
+)
+
+// jwks caches the signing keys published at a JWKS URL by key ID. Keys are
+// fetched on first use, when the set is older than its TTL, and when a token
+// names an unknown key, which picks up rotated keys. Concurrent callers share
+// one fetch, made without holding the lock.
+type jwks struct {
+	url    string
+	ttl    time.Duration
+	client *httpclient.Client
+
+	fetches singleflight.Group
+
+	mu        sync.Mutex
+	keys      map[string]crypto.PublicKey
+	fetchedAt time.Time
+	retryAt   time.Time
+}
+
+func newJWKS(url string, ttl time.Duration, client *httpclient.Client) *jwks {
+	if client == nil {
+		client = httpclient.Default()
+	}
+	if ttl <= 0 {
+		ttl = defaultJWKSTTL
+	}
+	return &jwks{url: url, ttl: ttl, client: client}
+}
+
+func (s *jwks) key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	s.mu.Lock()
+	key, found := s.lookup(kid)
+	due := s.due(found, time.Now())
+	s.mu.Unlock()
+
+	if due {
+		if err := s.refresh(ctx); err != nil {
+			// A key of the previous set stays usable while the issuer is
+			// unreachable.
+			if found {
+				return key, nil
+			}
+			return nil, err
+		}
+		s.mu.Lock()
+		key, found = s.lookup(kid)
+		s.mu.Unlock()
+	}
+
+	if !found {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	return key, nil
+}
+
+// due reports whether the key set should be fetched at now, given whether the
+// requested key was found in the current set.
+func (s *jwks) due(found bool, now time.Time) bool {
+	if now.Before(s.retryAt) {
+		return false
+	}
+	if s.fetchedAt.IsZero() {
+		return true
+	}
+	if found {
+		return now.Sub(s.fetchedAt) >= s.ttl
+	}
+	return now.Sub(s.fetchedAt) >= minJWKSRefreshInterval
+}
+
+// lookup finds the key by ID. Tokens without a key ID are accepted only while
+// the set holds a single key.
+func (s *jwks) lookup(kid string) (crypto.PublicKey, bool) {
+	if kid == "" && len(s.keys) == 1 {
+		for _, key := range s.keys {
+			return key, true
+		}
+	}
+	key, ok := s.keys[kid]
+	return key, ok
+}
+
+// refresh fetches the key set once for all concurrent callers. The fetch is
+// not canceled with ctx, since other callers may be waiting for it.
+func (s *jwks) refresh(ctx context.Context) error {
+	fetchCtx := context.WithoutCancel(ctx)
+	result := s.fetches.DoChan("jwks", func() (any, error) {
+		keys, err := s.fetch(fetchCtx)
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if err != nil {
+			s.retryAt = time.Now().Add(jwksRetryInterval)
+			return nil, err
+		}
+		s.keys = keys
+		s.fetchedAt = time.Now()
+		return nil, nil //nolint:nilnil // Only the error is shared.
+	})
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case r := <-result:
+		return r.Err
+	}
+}
+
+func (s *jwks) fetch(ctx context.Context) (map[string]crypto.PublicKey, error) {
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	resp, err := s.client.Get(ctx, s.url, httpclient.WithResult(&set))
+	if err != nil {
+		return nil, fmt.Errorf("fetch JWKS: %w", err)
+	}
+	if resp.StatusCode() >= http.StatusBadRequest {
+		return nil, fmt.Errorf("fetch JWKS: status %d", resp.StatusCode())
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		// Keys of unsupported types are skipped rather than failing the set.
+		if key, keyErr := jwk.publicKey(); keyErr == nil {
+			keys[jwk.Kid] = key
+		}
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("fetch JWKS: no usable signing keys")
+	}
+	return keys, nil
+}
+
+// jsonWebKey is an RSA or EC public key as published in a JWKS (RFC 7517).
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func (k jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		if !e.IsInt64() {
+			return nil, errors.New("RSA exponent is too large")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		curve, err := curveFor(k.Crv)
+		if err != nil {
+			return nil, err
+		}
+		return decodeECPoint(curve, k.X, k.Y)
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
+
+func curveFor(crv string) (elliptic.Curve, error) {
+	switch crv {
+	case "P-256":
+		return elliptic.P256(), nil
+	case "P-384":
+		return elliptic.P384(), nil
+	case "P-521":
+		return elliptic.P521(), nil
+	default:
+		return nil, fmt.Errorf("unsupported curve %q", crv)
+	}
+}
+
+// decodeECPoint parses the coordinates as an uncompressed point, which also
+// checks that it lies on the curve.
+func decodeECPoint(curve elliptic.Curve, x, y string) (*ecdsa.PublicKey, error) {
+	size := (curve.Params().BitSize + 7) / 8 //nolint:mnd // Bits to bytes, rounded up.
+
+	// 0x04 marks an uncompressed point.
+	point := []byte{4}
+	for _, coord := range []string{x, y} {
+		b, err := base64.RawURLEncoding.DecodeString(coord)
+		if err != nil || len(b) > size {
+			return nil, errors.New("invalid EC coordinate")
+		}
+		point = append(point, make([]byte, size-len(b))...)
+		point = append(point, b...)
+	}
+	return ecdsa.ParseUncompressedPublicKey(curve, point)
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || len(b) == 0 {
+		return nil, errors.New("invalid key parameter")
+	}
+	return new(big.Int).SetBytes(b), nil
+}
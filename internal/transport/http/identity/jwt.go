@@ -0,0 +1,127 @@
+package identity
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	httpclient "github.com/astro-web3/oauth2-token-exchange/pkg/http"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// jwtLeeway tolerates clock skew between the issuer and this service.
+const jwtLeeway = 30 * time.Second
+
+// JWTConfig configures NewJWTVerifier.
+type JWTConfig struct {
+	// JWKSURL publishes the issuer's signing keys.
+	JWKSURL string
+	// Issuer must match the iss claim.
+	Issuer string
+	// Audiences, when set, requires the aud claim to contain one of them.
+	Audiences []string
+	// GroupsClaim and RolesClaim name the claims holding the caller's groups
+	// and roles; empty skips them. A claim may be a list of names or, like
+	// ZITADEL's project roles claim, an object keyed by name.
+	GroupsClaim string
+	RolesClaim  string
+	// KeySetTTL is how long fetched keys are used before the JWKS is fetched
+	// again; zero uses 15 minutes.
+	KeySetTTL time.Duration
+	// HTTPClient fetches the JWKS; nil uses the default HTTP client.
+	HTTPClient *httpclient.Client
+}
+
+// NewJWTVerifier accepts callers presenting a JWT in headers.AccessToken that
+// is signed by a key in the issuer's JWKS and is not expired. The caller's
+// identity is read from the token's claims, never from other headers.
+func NewJWTVerifier(headers Headers, cfg JWTConfig) Verifier {
+	opts := []jwt.ParserOption{
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512"}),
+		jwt.WithIssuer(cfg.Issuer),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(jwtLeeway),
+	}
+	if len(cfg.Audiences) > 0 {
+		opts = append(opts, jwt.WithAudience(cfg.Audiences...))
+	}
+
+	return &jwtVerifier{
+		header: headers.AccessToken,
+		cfg:    cfg,
+		keys:   newJWKS(cfg.JWKSURL, cfg.KeySetTTL, cfg.HTTPClient),
+		parser: jwt.NewParser(opts...),
+	}
+}
+
+type jwtVerifier struct {
+	header string
+	cfg    JWTConfig
+	keys   *jwks
+	parser *jwt.Parser
+}
+
+func (v *jwtVerifier) Verify(ctx context.Context, req Request) (*Identity, error) {
+	raw := strings.TrimSpace(strings.TrimPrefix(req.Header.Get(v.header), "Bearer "))
+	if raw == "" {
+		return nil, fmt.Errorf("%w: missing %s header", ErrUnauthenticated, v.header)
+	}
+
+	claims := jwt.MapClaims{}
+	_, err := v.parser.ParseWithClaims(raw, claims, func(token *jwt.Token) (any, error) {
+		kid, _ := token.Header["kid"].(string)
+		return v.keys.key(ctx, kid)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrUnauthenticated, err)
+	}
+
+	id := &Identity{
+		Email:             stringClaim(claims, "email"),
+		PreferredUsername: stringClaim(claims, "preferred_username"),
+		Groups:            listClaim(claims, v.cfg.GroupsClaim),
+		Roles:             listClaim(claims, v.cfg.RolesClaim),
+	}
+	if id.UserID, err = claims.GetSubject(); err != nil || id.UserID == "" {
+		return nil, fmt.Errorf("%w: token has no subject", ErrUnauthenticated)
+	}
+
+	return id, nil
+}
+
+func stringClaim(claims jwt.MapClaims, name string) string {
+	s, _ := claims[name].(string)
+	return s
+}
+
+// listClaim reads a claim holding a list of names, a single name, or an
+// object keyed by name.
+func listClaim(claims jwt.MapClaims, name string) []string {
+	if name == "" {
+		return nil
+	}
+
+	switch value := claims[name].(type) {
+	case string:
+		return splitList(value)
+	case []any:
+		names := make([]string, 0, len(value))
+		for _, item := range value {
+			if s, ok := item.(string); ok && s != "" {
+				names = append(names, s)
+			}
+		}
+		return names
+	case map[string]any:
+		names := make([]string, 0, len(value))
+		for key := range value {
+			names = append(names, key)
+		}
+		slices.Sort(names)
+		return names
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,61 @@
+package identity
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"slices"
+)
+
+type tlsStateKey struct{}
+
+// WithTLSState makes the TLS connection state of requests available to the
+// mTLS verifier. Connect does not expose it to interceptors.
+func WithTLSState(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS != nil {
+			r = r.WithContext(context.WithValue(r.Context(), tlsStateKey{}, r.TLS))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// NewMTLSVerifier accepts the identity headers only on connections from a
+// proxy that presented a client certificate verified by the server's client
+// CA. With allowedSubjects, the certificate's common name, a DNS name or a URI
+// SAN must also be listed.
+func NewMTLSVerifier(headers Headers, allowedSubjects []string) Verifier {
+	return &mtlsVerifier{headers: headers, allowedSubjects: allowedSubjects}
+}
+
+type mtlsVerifier struct {
+	headers         Headers
+	allowedSubjects []string
+}
+
+func (v *mtlsVerifier) Verify(ctx context.Context, req Request) (*Identity, error) {
+	state, ok := ctx.Value(tlsStateKey{}).(*tls.ConnectionState)
+	if !ok || len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		return nil, fmt.Errorf("%w: no verified client certificate", ErrUnauthenticated)
+	}
+
+	cert := state.VerifiedChains[0][0]
+	if len(v.allowedSubjects) > 0 && !slices.ContainsFunc(subjects(cert), func(s string) bool {
+		return slices.Contains(v.allowedSubjects, s)
+	}) {
+		return nil, fmt.Errorf("%w: client certificate %q is not an allowed proxy",
+			ErrUnauthenticated, cert.Subject.CommonName)
+	}
+
+	return v.headers.identity(req.Header)
+}
+
+func subjects(cert *x509.Certificate) []string {
+	names := append([]string{cert.Subject.CommonName}, cert.DNSNames...)
+	for _, uri := range cert.URIs {
+		names = append(names, uri.String())
+	}
+	return names
+}
@@ -0,0 +1,86 @@
+package identity
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/astro-web3/oauth2-token-exchange/pkg/secret"
+)
+
+// Headers carrying the signature over the identity headers.
+const (
+	HeaderTimestamp = "X-Auth-Request-Timestamp"
+	HeaderSignature = "X-Auth-Request-Signature"
+)
+
+// NewSignedHeaderVerifier accepts the identity headers only when they carry a
+// valid signature by Sign with secret that is at most maxAge old.
+func NewSignedHeaderVerifier(headers Headers, secret secret.Secret, maxAge time.Duration) Verifier {
+	return &signedHeaderVerifier{headers: headers, secret: secret, maxAge: maxAge}
+}
+
+type signedHeaderVerifier struct {
+	headers Headers
+	secret  secret.Secret
+	maxAge  time.Duration
+}
+
+func (v *signedHeaderVerifier) Verify(_ context.Context, req Request) (*Identity, error) {
+	id, err := v.headers.identity(req.Header)
+	if err != nil {
+		return nil, err
+	}
+
+	sec, err := strconv.ParseInt(req.Header.Get(HeaderTimestamp), 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("%w: missing or malformed %s header", ErrUnauthenticated, HeaderTimestamp)
+	}
+	timestamp := time.Unix(sec, 0)
+	if age := time.Since(timestamp).Abs(); age > v.maxAge {
+		return nil, fmt.Errorf("%w: signature timestamp is %s off", ErrUnauthenticated, age.Round(time.Second))
+	}
+
+	got, err := hex.DecodeString(req.Header.Get(HeaderSignature))
+	if err != nil || !hmac.Equal(got, sign(v.secret.Value(), req.Method, req.Procedure, timestamp, id)) {
+		return nil, fmt.Errorf("%w: invalid %s header", ErrUnauthenticated, HeaderSignature)
+	}
+
+	return id, nil
+}
+
+// Sign returns the hex-encoded HMAC-SHA256 a proxy sends in HeaderSignature
+// for a request with the given HTTP method and procedure path, alongside the
+// Unix timestamp in HeaderTimestamp. The signed message is
+//
+//	METHOD\nPROCEDURE\nTIMESTAMP\nUSER_ID\nEMAIL\nPREFERRED_USERNAME\nGROUPS\nROLES
+//
+// with groups and roles comma-separated, e.g.
+// "POST\n/pat.v1.PATService/CreatePAT\n1735689600\nuser123\n...". Covering the
+// method and procedure keeps a signature captured from one call from being
+// replayed against another within max_age.
+func Sign(secret, method, procedure string, timestamp time.Time, id *Identity) string {
+	return hex.EncodeToString(sign(secret, method, procedure, timestamp, id))
+}
+
+func sign(secret, method, procedure string, timestamp time.Time, id *Identity) []byte {
+	message := strings.Join([]string{
+		method,
+		procedure,
+		strconv.FormatInt(timestamp.Unix(), 10),
+		id.UserID,
+		id.Email,
+		id.PreferredUsername,
+		strings.Join(id.Groups, ","),
+		strings.Join(id.Roles, ","),
+	}, "\n")
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(message))
+	return mac.Sum(nil)
+}
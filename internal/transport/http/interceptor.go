@@ -0,0 +1,27 @@
+package http
+
+import (
+	"context"
+
+	"connectrpc.com/connect"
+	"github.com/astro-web3/oauth2-token-exchange/pkg/metrics"
+)
+
+const rpcCodeOK = "ok"
+
+// metricsInterceptor counts Connect RPCs by procedure and status code.
+func metricsInterceptor() connect.UnaryInterceptorFunc {
+	return func(next connect.UnaryFunc) connect.UnaryFunc {
+		return func(ctx context.Context, req connect.AnyRequest) (connect.AnyResponse, error) {
+			resp, err := next(ctx, req)
+
+			code := rpcCodeOK
+			if err != nil {
+				code = connect.CodeOf(err).String()
+			}
+			metrics.RecordRPC(req.Spec().Procedure, code)
+
+			return resp, err
+		}
+	}
+}
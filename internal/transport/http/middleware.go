@@ -1,20 +1,26 @@
 package http
 
 import (
+	"net"
 	"net/http"
+	"slices"
 	"strings"
 	"time"
 
 	"log/slog"
 
 	"github.com/astro-web3/oauth2-token-exchange/internal/config"
+	"github.com/astro-web3/oauth2-token-exchange/internal/domain/audit"
 	"github.com/astro-web3/oauth2-token-exchange/pkg/logger"
 	"github.com/gin-gonic/gin"
 )
 
 const minServerErrorStatus = 500
 
-const healthzPath = "/healthz"
+const (
+	healthzPath = "/healthz"
+	metricsPath = "/metrics"
+)
 
 func loggingMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -27,7 +33,7 @@ func loggingMiddleware() gin.HandlerFunc {
 		duration := time.Since(start)
 		status := c.Writer.Status()
 
-		if path == healthzPath {
+		if path == healthzPath || path == metricsPath {
 			return
 		}
 
@@ -49,12 +55,43 @@ func loggingMiddleware() gin.HandlerFunc {
 	}
 }
 
-func corsMiddleware(cfg *config.Config) gin.HandlerFunc {
-	allowedOrigins := make(map[string]bool)
-	for _, origin := range cfg.CORS.AllowedOrigins {
-		allowedOrigins[origin] = true
+// sourceIPMiddleware stores the client IP in the request context so audit
+// events and the brute-force guard can attribute requests to their origin.
+func sourceIPMiddleware(header string, trustedHops int) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ip := clientIP(c.Request, header, trustedHops)
+		c.Request = c.Request.WithContext(audit.WithSourceIP(c.Request.Context(), ip))
+		c.Next()
 	}
+}
+
+// clientIP returns the entry trustedHops from the right of header, which the
+// proxies in front of the service appended for the client. Entries further
+// left are set by the client and cannot be trusted. Without enough entries,
+// or with zero hops, the connection's address is used.
+func clientIP(r *http.Request, header string, trustedHops int) string {
+	if trustedHops > 0 {
+		var hops []string
+		for _, value := range r.Header.Values(header) {
+			for hop := range strings.SplitSeq(value, ",") {
+				hops = append(hops, strings.TrimSpace(hop))
+			}
+		}
+		if len(hops) >= trustedHops {
+			if ip := net.ParseIP(hops[len(hops)-trustedHops]); ip != nil {
+				return ip.String()
+			}
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
 
+func corsMiddleware(store *config.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		path := c.Request.URL.Path
 		// 只对 PAT 服务路径应用 CORS
@@ -64,9 +101,10 @@ func corsMiddleware(cfg *config.Config) gin.HandlerFunc {
 		}
 
 		origin := c.Request.Header.Get("Origin")
+		allowedOrigins := store.Get().CORS.AllowedOrigins
 
 		// 检查 Origin 是否在允许列表中
-		if origin != "" && allowedOrigins[origin] {
+		if origin != "" && slices.Contains(allowedOrigins, origin) {
 			c.Writer.Header().Set("Access-Control-Allow-Origin", origin)
 			c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
 		} else if len(allowedOrigins) == 0 {
@@ -83,8 +121,12 @@ func corsMiddleware(cfg *config.Config) gin.HandlerFunc {
 			"Content-Type, Content-Length, Accept-Encoding, "+
 				"Authorization, accept, origin, Cache-Control, X-Requested-With, "+
 				"Connect-Protocol-Version, Connect-Content-Encoding, Connect-Timeout-Ms, "+
-				"X-Auth-Request-User, X-Auth-Request-Email, X-Auth-Request-Preferred-Username",
+				"X-Grpc-Web, X-User-Agent, Grpc-Timeout, "+
+				"X-Auth-Request-User, X-Auth-Request-Email, X-Auth-Request-Preferred-Username, X-Auth-Request-Groups, "+
+				"X-Auth-Request-Roles",
 		)
+		// gRPC-Web clients read the status from these headers.
+		c.Writer.Header().Set("Access-Control-Expose-Headers", "Grpc-Status, Grpc-Message, Grpc-Status-Details-Bin")
 
 		// 处理 OPTIONS 预检请求
 		if c.Request.Method == http.MethodOptions {
@@ -3,13 +3,28 @@ package http
 import (
 	"net/http"
 
+	"connectrpc.com/connect"
+	"connectrpc.com/grpchealth"
+	"connectrpc.com/grpcreflect"
+	"connectrpc.com/validate"
+
 	"github.com/astro-web3/oauth2-token-exchange/internal/config"
+	"github.com/astro-web3/oauth2-token-exchange/internal/transport/http/identity"
 	patv1connect "github.com/astro-web3/oauth2-token-exchange/pb/gen/go/pat/v1/patv1connect"
+	"github.com/astro-web3/oauth2-token-exchange/pkg/metrics"
 	"github.com/gin-gonic/gin"
 	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
 )
 
-func NewRouter(handler *Handler, cfg *config.Config, patHandler patv1connect.PATServiceHandler) *gin.Engine {
+func NewRouter(
+	handler *Handler,
+	store *config.Store,
+	patHandler patv1connect.PATServiceHandler,
+	adminHandler patv1connect.AdminPATServiceHandler,
+	verifier identity.Verifier,
+	health *grpchealth.StaticChecker,
+) *gin.Engine {
+	cfg := store.Get()
 	if cfg.Server.Mode == "release" {
 		gin.SetMode(gin.ReleaseMode)
 	} else {
@@ -23,16 +38,52 @@ func NewRouter(handler *Handler, cfg *config.Config, patHandler patv1connect.PAT
 		router.Use(otelgin.Middleware(serviceName))
 	}
 	router.Use(loggingMiddleware())
-	router.Use(corsMiddleware(cfg))
+	router.Use(sourceIPMiddleware(cfg.Server.ClientIP.Header, cfg.Server.ClientIP.TrustedHops))
+	router.Use(corsMiddleware(store))
 
 	router.GET("/healthz", func(c *gin.Context) {
 		c.String(http.StatusOK, "ok")
 	})
 
+	if cfg.Observability.MetricsEnabled {
+		router.GET(metricsPath, gin.WrapH(metrics.Handler()))
+	}
+
 	router.Any("/oauth2/token-exchange/*path", handler.Check)
 
-	patServicePath, patServiceHandler := patv1connect.NewPATServiceHandler(patHandler)
-	router.Any(patServicePath+"/*method", gin.WrapH(patServiceHandler))
+	// Requests are checked against their buf.validate rules once the caller
+	// is known, so every RPC gets field-level InvalidArgument errors.
+	interceptors := connect.WithInterceptors(
+		metricsInterceptor(),
+		identity.NewInterceptor(verifier),
+		validate.NewInterceptor(),
+	)
+
+	patServicePath, patServiceHandler := patv1connect.NewPATServiceHandler(patHandler, interceptors)
+	mountConnect(router, patServicePath, identity.WithTLSState(patServiceHandler))
+
+	adminServicePath, adminServiceHandler := patv1connect.NewAdminPATServiceHandler(adminHandler, interceptors)
+	mountConnect(router, adminServicePath, identity.WithTLSState(adminServiceHandler))
+
+	// Health checks and reflection are open, so probes and grpcurl work
+	// without a caller identity.
+	healthPath, healthHandler := grpchealth.NewHandler(health)
+	mountConnect(router, healthPath, healthHandler)
+	reflector := grpcreflect.NewStaticReflector(
+		patv1connect.PATServiceName,
+		patv1connect.AdminPATServiceName,
+		grpchealth.HealthV1ServiceName,
+	)
+	reflectPath, reflectHandler := grpcreflect.NewHandlerV1(reflector)
+	mountConnect(router, reflectPath, reflectHandler)
+	reflectAlphaPath, reflectAlphaHandler := grpcreflect.NewHandlerV1Alpha(reflector)
+	mountConnect(router, reflectAlphaPath, reflectAlphaHandler)
 
 	return router
 }
+
+// mountConnect routes every procedure under a Connect service path, as
+// returned by the generated handler constructors, to its handler.
+func mountConnect(router *gin.Engine, path string, handler http.Handler) {
+	router.Any(path+"*procedure", gin.WrapH(handler))
+}
@@ -0,0 +1,239 @@
+package http_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	validatepb "buf.build/gen/go/bufbuild/protovalidate/protocolbuffers/go/buf/validate"
+	"connectrpc.com/connect"
+	"connectrpc.com/grpchealth"
+	"connectrpc.com/grpcreflect"
+	"github.com/astro-web3/oauth2-token-exchange/internal/config"
+	"github.com/astro-web3/oauth2-token-exchange/internal/domain/audit"
+	authzdomain "github.com/astro-web3/oauth2-token-exchange/internal/domain/authz"
+	httptransport "github.com/astro-web3/oauth2-token-exchange/internal/transport/http"
+	"github.com/astro-web3/oauth2-token-exchange/internal/transport/http/identity"
+	patv1 "github.com/astro-web3/oauth2-token-exchange/pb/gen/go/pat/v1"
+	patv1connect "github.com/astro-web3/oauth2-token-exchange/pb/gen/go/pat/v1/patv1connect"
+	"github.com/gin-gonic/gin"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+type stubPATHandler struct {
+	patv1connect.UnimplementedPATServiceHandler
+}
+
+func (stubPATHandler) DeletePAT(
+	context.Context,
+	*connect.Request[patv1.DeletePATRequest],
+) (*connect.Response[patv1.DeletePATResponse], error) {
+	return connect.NewResponse(&patv1.DeletePATResponse{Success: true}), nil
+}
+
+// newRouterServer serves the router like the production server, with h2c
+// enabled, and returns it with a client speaking HTTP/2 without TLS.
+func newRouterServer(t *testing.T) (*httptest.Server, *http.Client) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	store := config.NewStore(createTestConfig())
+	router := httptransport.NewRouter(
+		httptransport.NewHandler(&mockAppService{}, store),
+		store,
+		stubPATHandler{},
+		patv1connect.UnimplementedAdminPATServiceHandler{},
+		identity.NewTrustedProxyVerifier(identity.Headers{UserID: "x-user-id"}),
+		grpchealth.NewStaticChecker(patv1connect.PATServiceName),
+	)
+
+	protocols := new(http.Protocols)
+	protocols.SetHTTP1(true)
+	protocols.SetUnencryptedHTTP2(true)
+
+	server := httptest.NewUnstartedServer(router)
+	server.Config.Protocols = protocols
+	server.Start()
+	t.Cleanup(server.Close)
+
+	h2c := new(http.Protocols)
+	h2c.SetUnencryptedHTTP2(true)
+	return server, &http.Client{Transport: &http.Transport{Protocols: h2c}}
+}
+
+func newPATClient(t *testing.T, opts ...connect.ClientOption) patv1connect.PATServiceClient {
+	t.Helper()
+	server, client := newRouterServer(t)
+	return patv1connect.NewPATServiceClient(client, server.URL, opts...)
+}
+
+func authenticated[T any](msg *T) *connect.Request[T] {
+	req := connect.NewRequest(msg)
+	req.Header().Set("x-user-id", "user-1")
+	return req
+}
+
+func TestRouter_ValidatesRequests(t *testing.T) {
+	client := newPATClient(t)
+	ctx := context.Background()
+
+	tests := []struct {
+		name  string
+		call  func() error
+		field string
+	}{
+		{"empty pat_id", func() error {
+			_, err := client.DeletePAT(ctx, authenticated(&patv1.DeletePATRequest{}))
+			return err
+		}, "pat_id"},
+		{"negative expiration_date", func() error {
+			_, err := client.CreatePAT(ctx, authenticated(&patv1.CreatePATRequest{ExpirationDate: -1}))
+			return err
+		}, "expiration_date"},
+		{"page_size above maximum", func() error {
+			_, err := client.ListPATs(ctx, authenticated(&patv1.ListPATsRequest{PageSize: 500}))
+			return err
+		}, "page_size"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.call()
+			if connect.CodeOf(err) != connect.CodeInvalidArgument {
+				t.Fatalf("expected invalid_argument, got %v", err)
+			}
+
+			var connectErr *connect.Error
+			if !errors.As(err, &connectErr) || len(connectErr.Details()) == 0 {
+				t.Fatalf("expected violation details, got %v", err)
+			}
+			detail, detailErr := connectErr.Details()[0].Value()
+			violations, ok := detail.(*validatepb.Violations)
+			if detailErr != nil || !ok || len(violations.GetViolations()) != 1 {
+				t.Fatalf("expected one violation, got %v (%v)", detail, detailErr)
+			}
+			if got := violations.GetViolations()[0].GetField().GetElements()[0].GetFieldName(); got != tt.field {
+				t.Errorf("expected violation on %s, got %s", tt.field, got)
+			}
+		})
+	}
+}
+
+func TestRouter_ValidRequestReachesHandler(t *testing.T) {
+	client := newPATClient(t)
+
+	resp, err := client.DeletePAT(context.Background(), authenticated(&patv1.DeletePATRequest{PatId: "pat-1"}))
+	if err != nil || !resp.Msg.GetSuccess() {
+		t.Fatalf("unexpected result: %v, %v", resp, err)
+	}
+
+	// Callers are identified before their requests are validated.
+	_, err = client.DeletePAT(context.Background(), connect.NewRequest(&patv1.DeletePATRequest{}))
+	if connect.CodeOf(err) != connect.CodeUnauthenticated {
+		t.Errorf("expected unauthenticated, got %v", err)
+	}
+}
+
+func TestRouter_Protocols(t *testing.T) {
+	for name, opt := range map[string]connect.ClientOption{
+		"grpc":     connect.WithGRPC(),
+		"grpc-web": connect.WithGRPCWeb(),
+		"connect":  connect.WithProtoJSON(),
+	} {
+		t.Run(name, func(t *testing.T) {
+			client := newPATClient(t, opt)
+
+			resp, err := client.DeletePAT(context.Background(), authenticated(&patv1.DeletePATRequest{PatId: "pat-1"}))
+			if err != nil || !resp.Msg.GetSuccess() {
+				t.Fatalf("unexpected result: %v, %v", resp, err)
+			}
+			_, err = client.DeletePAT(context.Background(), authenticated(&patv1.DeletePATRequest{}))
+			if connect.CodeOf(err) != connect.CodeInvalidArgument {
+				t.Errorf("expected invalid_argument, got %v", err)
+			}
+		})
+	}
+}
+
+func TestRouter_HealthAndReflection(t *testing.T) {
+	server, httpClient := newRouterServer(t)
+	ctx := context.Background()
+
+	health := connect.NewClient[healthpb.HealthCheckRequest, healthpb.HealthCheckResponse](
+		httpClient, server.URL+"/grpc.health.v1.Health/Check", connect.WithGRPC())
+	resp, err := health.CallUnary(ctx, connect.NewRequest(&healthpb.HealthCheckRequest{
+		Service: patv1connect.PATServiceName,
+	}))
+	if err != nil || resp.Msg.GetStatus() != healthpb.HealthCheckResponse_SERVING {
+		t.Fatalf("unexpected health check result: %v, %v", resp, err)
+	}
+
+	stream := grpcreflect.NewClient(httpClient, server.URL, connect.WithGRPC()).NewStream(ctx)
+	services, err := stream.ListServices()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err = stream.Close(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !slices.Contains(services, protoreflect.FullName(patv1connect.PATServiceName)) ||
+		!slices.Contains(services, protoreflect.FullName(grpchealth.HealthV1ServiceName)) {
+		t.Errorf("unexpected services: %v", services)
+	}
+}
+
+func TestRouter_SourceIP(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	var sourceIP string
+	appService := &mockAppService{
+		checkFunc: func(ctx context.Context, _ string, _ authzdomain.Route, _ time.Duration, _ map[string]string) (*authzdomain.AuthzDecision, error) {
+			sourceIP = audit.SourceIP(ctx)
+			return &authzdomain.AuthzDecision{Allow: true}, nil
+		},
+	}
+
+	tests := []struct {
+		name        string
+		trustedHops int
+		xff         string
+		want        string
+	}{
+		{"appended by gateway", 1, "10.0.0.1, 203.0.113.7", "203.0.113.7"},
+		{"two proxies", 2, "10.0.0.1, 203.0.113.7, 10.0.0.2", "203.0.113.7"},
+		{"fewer entries than hops", 2, "203.0.113.7", "192.0.2.1"},
+		{"header ignored", 0, "203.0.113.7", "192.0.2.1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := createTestConfig()
+			cfg.Server.ClientIP.Header = "X-Forwarded-For"
+			cfg.Server.ClientIP.TrustedHops = tt.trustedHops
+			store := config.NewStore(cfg)
+			router := httptransport.NewRouter(
+				httptransport.NewHandler(appService, store),
+				store,
+				stubPATHandler{},
+				patv1connect.UnimplementedAdminPATServiceHandler{},
+				identity.NewTrustedProxyVerifier(identity.Headers{UserID: "x-user-id"}),
+				grpchealth.NewStaticChecker(),
+			)
+
+			req := httptest.NewRequest(http.MethodGet, "/oauth2/token-exchange/api", nil)
+			req.RemoteAddr = "192.0.2.1:51234"
+			req.Header.Set("Authorization", "Bearer token")
+			req.Header.Set("X-Forwarded-For", tt.xff)
+			router.ServeHTTP(httptest.NewRecorder(), req)
+
+			if sourceIP != tt.want {
+				t.Errorf("expected source IP %s, got %s", tt.want, sourceIP)
+			}
+		})
+	}
+}
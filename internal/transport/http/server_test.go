@@ -0,0 +1,241 @@
+package http_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"connectrpc.com/connect"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/astro-web3/oauth2-token-exchange/internal/config"
+	"github.com/astro-web3/oauth2-token-exchange/internal/infra/zitadel/zitadeltest"
+	httptransport "github.com/astro-web3/oauth2-token-exchange/internal/transport/http"
+	"github.com/astro-web3/oauth2-token-exchange/internal/transport/http/identity"
+	patv1 "github.com/astro-web3/oauth2-token-exchange/pb/gen/go/pat/v1"
+	patv1connect "github.com/astro-web3/oauth2-token-exchange/pb/gen/go/pat/v1/patv1connect"
+)
+
+// integration runs the server as built by NewServer from config/config.yaml
+// against a fake Zitadel and an in-memory Redis.
+type integration struct {
+	zitadel *zitadeltest.Server
+	redis   *miniredis.Miniredis
+	server  *httptest.Server
+}
+
+func newIntegration(t *testing.T, mutate func(*config.Config)) *integration {
+	t.Helper()
+
+	fake := zitadeltest.NewServer(t)
+	redis := miniredis.RunT(t)
+
+	cfg, err := config.NewLoader(config.WithConfigFile("../../../config/config.yaml")).Load()
+	if err != nil {
+		t.Fatalf("failed to load config: %v", err)
+	}
+	cfg.Redis.URL = config.Secret("redis://" + redis.Addr())
+	cfg.Auth.Zitadel.Issuer = fake.URL
+	cfg.Auth.Zitadel.ClientID = zitadeltest.ClientID
+	cfg.Auth.Zitadel.ClientSecret = zitadeltest.ClientSecret
+	cfg.Auth.AdminMachineUser.PAT = zitadeltest.AdminToken
+	cfg.Auth.Identity.Mode = config.IdentityModeTrustedProxy
+	// Fail fast instead of backing off, so failure tests stay quick.
+	cfg.Auth.Zitadel.Resilience.Retry.MaxAttempts = 1
+	if mutate != nil {
+		mutate(cfg)
+	}
+	if err = cfg.Validate(); err != nil {
+		t.Fatalf("invalid test config: %v", err)
+	}
+
+	server, err := httptransport.NewServer(config.NewStore(cfg))
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+	t.Cleanup(func() {
+		if shutdownErr := server.Shutdown(context.Background()); shutdownErr != nil {
+			t.Errorf("failed to shut down: %v", shutdownErr)
+		}
+	})
+
+	httpServer := httptest.NewServer(server.Handler())
+	t.Cleanup(httpServer.Close)
+
+	return &integration{zitadel: fake, redis: redis, server: httpServer}
+}
+
+func (it *integration) check(t *testing.T, pat string) *http.Response {
+	t.Helper()
+
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodGet,
+		it.server.URL+"/oauth2/token-exchange/api/orders", nil)
+	if err != nil {
+		t.Fatalf("failed to build request: %v", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+pat)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("check failed: %v", err)
+	}
+	_ = resp.Body.Close()
+	return resp
+}
+
+func (it *integration) patClient() patv1connect.PATServiceClient {
+	return patv1connect.NewPATServiceClient(http.DefaultClient, it.server.URL)
+}
+
+// asUser sets the identity headers the gateway forwards for the caller.
+func asUser[T any](msg *T, userID string) *connect.Request[T] {
+	req := connect.NewRequest(msg)
+	req.Header().Set("X-Auth-Request-User", userID)
+	req.Header().Set("X-Auth-Request-Email", userID+"@example.com")
+	req.Header().Set("X-Auth-Request-Preferred-Username", userID)
+	return req
+}
+
+func patCacheKey(pat string) string {
+	hash := sha256.Sum256([]byte(pat))
+	return "authz:pat:" + hex.EncodeToString(hash[:])
+}
+
+func TestIntegration_PATLifecycle(t *testing.T) {
+	it := newIntegration(t, nil)
+	it.zitadel.AddUser(zitadeltest.User{ID: "user-1", Email: "alice@example.com", Groups: []string{"dev"}})
+	client := it.patClient()
+	ctx := context.Background()
+
+	created, err := client.CreatePAT(ctx, asUser(&patv1.CreatePATRequest{
+		ExpirationDate: time.Now().Add(24 * time.Hour).Unix(),
+	}, "user-1"))
+	if err != nil {
+		t.Fatalf("failed to create PAT: %v", err)
+	}
+	if it.zitadel.MachineUser("user-1") == nil {
+		t.Fatal("expected a machine user for user-1")
+	}
+
+	resp := it.check(t, created.Msg.GetToken())
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, resp.StatusCode)
+	}
+	if got := resp.Header.Get("X-Auth-Request-User"); got != "user-1" {
+		t.Errorf("expected user header user-1, got %q", got)
+	}
+	if got := resp.Header.Get("X-Auth-Request-Groups"); got != "dev" {
+		t.Errorf("expected groups header dev, got %q", got)
+	}
+	if !it.redis.Exists(patCacheKey(created.Msg.GetToken())) {
+		t.Error("expected the exchanged token to be cached in Redis")
+	}
+
+	// The second check is answered from the cache.
+	if resp = it.check(t, created.Msg.GetToken()); resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected cached status %d, got %d", http.StatusOK, resp.StatusCode)
+	}
+	if calls := it.zitadel.Calls(zitadeltest.EndpointUserInfo); calls != 1 {
+		t.Errorf("expected one userinfo call, got %d", calls)
+	}
+
+	listed, err := client.ListPATs(ctx, asUser(&patv1.ListPATsRequest{}, "user-1"))
+	if err != nil {
+		t.Fatalf("failed to list PATs: %v", err)
+	}
+	if len(listed.Msg.GetPats()) != 1 || listed.Msg.GetPats()[0].GetId() != created.Msg.GetPat().GetId() {
+		t.Fatalf("expected the created PAT, got %v", listed.Msg.GetPats())
+	}
+
+	if _, err = client.DeletePAT(ctx, asUser(&patv1.DeletePATRequest{PatId: created.Msg.GetPat().GetId()}, "user-1")); err != nil {
+		t.Fatalf("failed to delete PAT: %v", err)
+	}
+	if pats := it.zitadel.PATs(it.zitadel.MachineUser("user-1").ID); len(pats) != 0 {
+		t.Errorf("expected the PAT to be removed from Zitadel, got %v", pats)
+	}
+}
+
+func TestIntegration_InvalidPATIsCached(t *testing.T) {
+	it := newIntegration(t, nil)
+
+	for range 2 {
+		if resp := it.check(t, "unknown-pat"); resp.StatusCode != http.StatusUnauthorized {
+			t.Fatalf("expected status %d, got %d", http.StatusUnauthorized, resp.StatusCode)
+		}
+	}
+	if calls := it.zitadel.Calls(zitadeltest.EndpointUserInfo); calls != 1 {
+		t.Errorf("expected the invalid PAT to be looked up once, got %d calls", calls)
+	}
+}
+
+func TestIntegration_ZitadelOutage(t *testing.T) {
+	it := newIntegration(t, nil)
+	user := it.zitadel.AddUser(zitadeltest.User{Username: "svc", Machine: true})
+	pat := it.zitadel.AddPAT(user.ID, time.Now().Add(time.Hour))
+
+	it.zitadel.Fail(zitadeltest.EndpointUserInfo, http.StatusServiceUnavailable, 1)
+	if resp := it.check(t, pat); resp.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("expected status %d, got %d", http.StatusServiceUnavailable, resp.StatusCode)
+	}
+	if it.redis.Exists(patCacheKey(pat)) {
+		t.Error("expected an outage not to be cached")
+	}
+}
+
+func TestIntegration_BruteForceBlocksSource(t *testing.T) {
+	it := newIntegration(t, func(cfg *config.Config) {
+		b := &cfg.Auth.BruteForce
+		b.Enabled, b.MaxFailures, b.DelayAfter = true, 2, 0
+		cfg.Server.ClientIP.TrustedHops = 0
+	})
+
+	for range 2 {
+		it.check(t, "guessed-pat")
+	}
+	resp := it.check(t, "another-guess")
+	if resp.StatusCode != http.StatusTooManyRequests || resp.Header.Get("Retry-After") == "" {
+		t.Fatalf("expected 429 with Retry-After, got %d %v", resp.StatusCode, resp.Header)
+	}
+	// The repeated guess is answered from the invalid cache, the blocked one never leaves the proxy.
+	if calls := it.zitadel.Calls(zitadeltest.EndpointUserInfo); calls != 1 {
+		t.Errorf("expected blocked requests not to reach Zitadel, got %d userinfo calls", calls)
+	}
+}
+
+func TestIntegration_SignedHeaderBindsProcedure(t *testing.T) {
+	const secret = "identity-secret"
+	it := newIntegration(t, func(cfg *config.Config) {
+		cfg.Auth.Identity.Mode = config.IdentityModeSignedHeader
+		cfg.Auth.Identity.SignedHeader.Secret = secret
+		cfg.Auth.Identity.SignedHeader.MaxAge = time.Minute
+	})
+	client := it.patClient()
+	ctx := context.Background()
+
+	// The proxy signs the identity for ListPATs only.
+	caller := &identity.Identity{UserID: "user-1", Email: "user-1@example.com", PreferredUsername: "user-1"}
+	now := time.Now()
+	signature := identity.Sign(secret, http.MethodPost, patv1connect.PATServiceListPATsProcedure, now, caller)
+	signed := func(req interface{ Header() http.Header }) {
+		req.Header().Set(identity.HeaderTimestamp, strconv.FormatInt(now.Unix(), 10))
+		req.Header().Set(identity.HeaderSignature, signature)
+	}
+
+	list := asUser(&patv1.ListPATsRequest{}, "user-1")
+	signed(list)
+	if _, err := client.ListPATs(ctx, list); err != nil {
+		t.Fatalf("expected the signed call to succeed, got %v", err)
+	}
+
+	replayed := asUser(&patv1.DeletePATRequest{PatId: "pat-1"}, "user-1")
+	signed(replayed)
+	_, err := client.DeletePAT(ctx, replayed)
+	if connectErr := new(connect.Error); !errors.As(err, &connectErr) || connectErr.Code() != connect.CodeUnauthenticated {
+		t.Fatalf("expected the replayed signature to be rejected, got %v", err)
+	}
+}
@@ -15,30 +15,50 @@ import (
 
 const (
 	DefaultTimeout = 60 * time.Second
-	DefaultRetry   = 2
 )
 
 var (
-	//nolint:gochecknoglobals // Global HTTP client is intentional for application-wide requests
-	client *resty.Client
+	//nolint:gochecknoglobals // Default client for callers without their own configuration
+	defaultClient *Client
 	//nolint:gochecknoglobals // Global once is intentional for thread-safe initialization
 	once sync.Once
 )
 
-func getClient() *resty.Client {
+// Client sends JSON requests over a transport built from a Config, tracing
+// each request and propagating the trace context to the server.
+type Client struct {
+	resty *resty.Client
+}
+
+// New returns a Client using the transport described by cfg.
+func New(cfg Config) (*Client, error) {
+	transport, err := newTransport(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	timeout := cfg.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+
+	return &Client{resty: newResty(timeout).SetTransport(transport)}, nil
+}
+
+// Default returns the shared client with the default Config, used by the
+// package-level request functions.
+func Default() *Client {
 	once.Do(func() {
-		client = resty.New().
-			SetTimeout(DefaultTimeout).
-			SetRetryCount(DefaultRetry).
-			SetHeader("Content-Type", "application/json").
-			SetHeader("Accept", "application/json")
+		defaultClient = &Client{resty: newResty(DefaultTimeout)}
 	})
-	return client
+	return defaultClient
 }
 
-// Client returns the shared HTTP client instance.
-func Client() *resty.Client {
-	return getClient()
+func newResty(timeout time.Duration) *resty.Client {
+	return resty.New().
+		SetTimeout(timeout).
+		SetHeader("Content-Type", "application/json").
+		SetHeader("Accept", "application/json")
 }
 
 type RequestOption func(*resty.Request)
@@ -83,11 +103,28 @@ func WithContentType(contentType string) RequestOption {
 	}
 }
 
+// Request sends a request with the default client.
 func Request(ctx context.Context, method, url string, opts ...RequestOption) (*resty.Response, error) {
+	return Default().Request(ctx, method, url, opts...)
+}
+
+func Get(ctx context.Context, url string, opts ...RequestOption) (*resty.Response, error) {
+	return Default().Request(ctx, http.MethodGet, url, opts...)
+}
+
+func Post(ctx context.Context, url string, opts ...RequestOption) (*resty.Response, error) {
+	return Default().Request(ctx, http.MethodPost, url, opts...)
+}
+
+func Delete(ctx context.Context, url string, opts ...RequestOption) (*resty.Response, error) {
+	return Default().Request(ctx, http.MethodDelete, url, opts...)
+}
+
+func (c *Client) Request(ctx context.Context, method, url string, opts ...RequestOption) (*resty.Response, error) {
 	ctx, span := startClientSpan(ctx, "http.Request", method, url)
 	defer span.End()
 
-	request := getClient().R().SetContext(ctx)
+	request := c.resty.R().SetContext(ctx)
 
 	for _, opt := range opts {
 		opt(request)
@@ -117,16 +154,16 @@ func Request(ctx context.Context, method, url string, opts ...RequestOption) (*r
 	return resp, err
 }
 
-func Get(ctx context.Context, url string, opts ...RequestOption) (*resty.Response, error) {
-	return Request(ctx, http.MethodGet, url, opts...)
+func (c *Client) Get(ctx context.Context, url string, opts ...RequestOption) (*resty.Response, error) {
+	return c.Request(ctx, http.MethodGet, url, opts...)
 }
 
-func Post(ctx context.Context, url string, opts ...RequestOption) (*resty.Response, error) {
-	return Request(ctx, http.MethodPost, url, opts...)
+func (c *Client) Post(ctx context.Context, url string, opts ...RequestOption) (*resty.Response, error) {
+	return c.Request(ctx, http.MethodPost, url, opts...)
 }
 
-func Delete(ctx context.Context, url string, opts ...RequestOption) (*resty.Response, error) {
-	return Request(ctx, http.MethodDelete, url, opts...)
+func (c *Client) Delete(ctx context.Context, url string, opts ...RequestOption) (*resty.Response, error) {
+	return c.Request(ctx, http.MethodDelete, url, opts...)
 }
 
 func startClientSpan(
@@ -0,0 +1,109 @@
+package http_test
+
+import (
+	"context"
+	"encoding/pem"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	httpclient "github.com/astro-web3/oauth2-token-exchange/pkg/http"
+)
+
+func TestClient_RootCAFile(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	untrusting, err := httpclient.New(httpclient.Config{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err = untrusting.Get(context.Background(), server.URL); err == nil {
+		t.Fatal("expected the test server's certificate to be rejected without its CA")
+	}
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if err = os.WriteFile(caFile, caPEM, 0o600); err != nil {
+		t.Fatalf("failed to write CA file: %v", err)
+	}
+
+	client, err := httpclient.New(httpclient.Config{RootCAFile: caFile})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp, err := client.Get(context.Background(), server.URL)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.StatusCode() != http.StatusNoContent {
+		t.Errorf("expected status %d, got %d", http.StatusNoContent, resp.StatusCode())
+	}
+}
+
+func TestClient_InvalidConfig(t *testing.T) {
+	emptyCA := filepath.Join(t.TempDir(), "empty.pem")
+	if err := os.WriteFile(emptyCA, nil, 0o600); err != nil {
+		t.Fatalf("failed to write CA file: %v", err)
+	}
+
+	tests := map[string]httpclient.Config{
+		"missing root CA file": {RootCAFile: filepath.Join(t.TempDir(), "missing.pem")},
+		"empty root CA file":   {RootCAFile: emptyCA},
+		"missing client key":   {ClientCertFile: emptyCA, ClientKeyFile: filepath.Join(t.TempDir(), "missing.key")},
+		"malformed proxy URL":  {ProxyURL: "http://proxy:port"},
+	}
+
+	for name, cfg := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := httpclient.New(cfg); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) { return f(r) }
+
+func TestClient_Transport(t *testing.T) {
+	var got *http.Request
+	client, err := httpclient.New(httpclient.Config{
+		Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+			got = r
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Header:     http.Header{"Content-Type": []string{"application/json"}},
+				Body:       io.NopCloser(strings.NewReader(`{"ok":true}`)),
+				Request:    r,
+			}, nil
+		}),
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var result struct {
+		OK bool `json:"ok"`
+	}
+	if _, err = client.Post(context.Background(), "https://zitadel.invalid/v2/users",
+		httpclient.WithBody(map[string]string{"name": "svc"}),
+		httpclient.WithResult(&result),
+	); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if got == nil || got.Method != http.MethodPost || got.URL.Host != "zitadel.invalid" {
+		t.Fatalf("expected the request to reach the transport, got %v", got)
+	}
+	if !result.OK {
+		t.Error("expected the response to be decoded")
+	}
+}
@@ -0,0 +1,133 @@
+package http
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+)
+
+// Defaults of the transport built by New, matching http.DefaultTransport.
+const (
+	defaultDialTimeout         = 30 * time.Second
+	defaultKeepAlive           = 30 * time.Second
+	defaultMaxIdleConns        = 100
+	defaultIdleConnTimeout     = 90 * time.Second
+	defaultTLSHandshakeTimeout = 10 * time.Second
+)
+
+// Config configures a Client. Zero values keep the defaults of
+// http.DefaultTransport.
+type Config struct {
+	// Timeout bounds each request including reading its response; zero uses
+	// DefaultTimeout.
+	Timeout time.Duration
+	// RootCAFile is a PEM bundle trusted in addition to the system roots.
+	RootCAFile string
+	// ClientCertFile and ClientKeyFile present a client certificate to
+	// servers requiring mTLS.
+	ClientCertFile string
+	ClientKeyFile  string
+	// ProxyURL sends requests through a proxy; empty uses the HTTP_PROXY,
+	// HTTPS_PROXY and NO_PROXY environment variables.
+	ProxyURL string
+	// Connection pool sizing. MaxConnsPerHost zero means no limit.
+	MaxIdleConns        int
+	MaxIdleConnsPerHost int
+	MaxConnsPerHost     int
+	IdleConnTimeout     time.Duration
+	// KeepAlive is the TCP keep-alive period; DisableKeepAlives opens a new
+	// connection for every request.
+	KeepAlive         time.Duration
+	DisableKeepAlives bool
+	// Transport, when set, is used as-is and the fields above other than
+	// Timeout are ignored, e.g. to plug in a test double or a custom
+	// RoundTripper.
+	Transport http.RoundTripper
+}
+
+func newTransport(cfg Config) (http.RoundTripper, error) {
+	if cfg.Transport != nil {
+		return cfg.Transport, nil
+	}
+
+	tlsConfig, err := newTLSConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	proxy := http.ProxyFromEnvironment
+	if cfg.ProxyURL != "" {
+		proxyURL, parseErr := url.Parse(cfg.ProxyURL)
+		if parseErr != nil {
+			return nil, fmt.Errorf("invalid proxy URL: %w", parseErr)
+		}
+		proxy = http.ProxyURL(proxyURL)
+	}
+
+	dialer := &net.Dialer{
+		Timeout:   defaultDialTimeout,
+		KeepAlive: orDefault(cfg.KeepAlive, defaultKeepAlive),
+	}
+
+	return &http.Transport{
+		Proxy:                 proxy,
+		DialContext:           dialer.DialContext,
+		TLSClientConfig:       tlsConfig,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          orDefault(cfg.MaxIdleConns, defaultMaxIdleConns),
+		MaxIdleConnsPerHost:   cfg.MaxIdleConnsPerHost,
+		MaxConnsPerHost:       cfg.MaxConnsPerHost,
+		IdleConnTimeout:       orDefault(cfg.IdleConnTimeout, defaultIdleConnTimeout),
+		TLSHandshakeTimeout:   defaultTLSHandshakeTimeout,
+		ExpectContinueTimeout: time.Second,
+		DisableKeepAlives:     cfg.DisableKeepAlives,
+	}, nil
+}
+
+// newTLSConfig returns nil, for Go's default TLS settings, unless cfg adds
+// root CAs or a client certificate.
+func newTLSConfig(cfg Config) (*tls.Config, error) {
+	if cfg.RootCAFile == "" && cfg.ClientCertFile == "" {
+		return nil, nil //nolint:nilnil // No TLS config uses the defaults.
+	}
+
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if cfg.RootCAFile != "" {
+		caPEM, err := os.ReadFile(cfg.RootCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read root CA file: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(caPEM) {
+			return nil, errors.New("root CA file contains no certificates")
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if cfg.ClientCertFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.ClientCertFile, cfg.ClientKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
+
+func orDefault[T int | time.Duration](value, fallback T) T {
+	if value == 0 {
+		return fallback
+	}
+	return value
+}
@@ -0,0 +1,73 @@
+package logger
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+)
+
+// AddHandler sends every record logged through this package to h as well,
+// filtered by the same level as the console output. It is meant to be called
+// once during startup, after InitLogger and before concurrent logging starts.
+func AddHandler(h slog.Handler) {
+	if defaultLogger == nil || h == nil {
+		return
+	}
+	defaultLogger = slog.New(fanoutHandler{defaultLogger.Handler(), leveledHandler{h}})
+}
+
+// fanoutHandler passes each record to all handlers that accept its level.
+type fanoutHandler []slog.Handler
+
+func (f fanoutHandler) Enabled(ctx context.Context, l slog.Level) bool {
+	for _, h := range f {
+		if h.Enabled(ctx, l) {
+			return true
+		}
+	}
+	return false
+}
+
+func (f fanoutHandler) Handle(ctx context.Context, r slog.Record) error {
+	var errs []error
+	for _, h := range f {
+		if h.Enabled(ctx, r.Level) {
+			errs = append(errs, h.Handle(ctx, r.Clone()))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (f fanoutHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	out := make(fanoutHandler, 0, len(f))
+	for _, h := range f {
+		out = append(out, h.WithAttrs(attrs))
+	}
+	return out
+}
+
+func (f fanoutHandler) WithGroup(name string) slog.Handler {
+	out := make(fanoutHandler, 0, len(f))
+	for _, h := range f {
+		out = append(out, h.WithGroup(name))
+	}
+	return out
+}
+
+// leveledHandler applies the global log level to handlers that do not filter
+// by level themselves.
+type leveledHandler struct {
+	slog.Handler
+}
+
+func (h leveledHandler) Enabled(ctx context.Context, l slog.Level) bool {
+	return l >= level.Level() && h.Handler.Enabled(ctx, l)
+}
+
+func (h leveledHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return leveledHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h leveledHandler) WithGroup(name string) slog.Handler {
+	return leveledHandler{h.Handler.WithGroup(name)}
+}
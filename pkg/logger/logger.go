@@ -21,6 +21,8 @@ var (
 	initOnce sync.Once
 	//nolint:gochecknoglobals // Global addSource is intentional for configuration
 	addSource bool
+	//nolint:gochecknoglobals // Global level is intentional so it can be changed at runtime
+	level slog.LevelVar
 )
 
 // otelHandler wraps a slog.Handler to add OpenTelemetry trace context to logs.
@@ -45,14 +47,15 @@ func (h *otelHandler) Handle(ctx context.Context, r slog.Record) error {
 
 // InitLogger initializes the global logger.
 // It is safe to call multiple times, but only the first call will take effect.
-func InitLogger(level, format string, enableSource bool) {
+func InitLogger(logLevel, format string, enableSource bool) {
 	initOnce.Do(func() {
 		addSource = enableSource
+		level.Set(parseLevel(logLevel))
 
 		var handler slog.Handler
 		if format == "json" {
 			handler = slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{
-				Level:     parseLevel(level),
+				Level:     &level,
 				AddSource: addSource,
 				ReplaceAttr: func(_ []string, a slog.Attr) slog.Attr {
 					if a.Key == slog.TimeKey {
@@ -66,7 +69,7 @@ func InitLogger(level, format string, enableSource bool) {
 			})
 		} else {
 			handler = slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{
-				Level:     parseLevel(level),
+				Level:     &level,
 				AddSource: addSource,
 			})
 		}
@@ -76,6 +79,11 @@ func InitLogger(level, format string, enableSource bool) {
 	})
 }
 
+// SetLevel changes the minimum level of the global logger at runtime.
+func SetLevel(logLevel string) {
+	level.Set(parseLevel(logLevel))
+}
+
 // InfoContext logs at Info level with context.
 func InfoContext(ctx context.Context, msg string, attrs ...slog.Attr) {
 	if defaultLogger != nil {
@@ -144,8 +152,8 @@ func logWithCaller(ctx context.Context, level slog.Level, msg string, attrs ...s
 	}
 }
 
-func parseLevel(level string) slog.Level {
-	switch strings.ToLower(level) {
+func parseLevel(logLevel string) slog.Level {
+	switch strings.ToLower(logLevel) {
 	case "debug":
 		return slog.LevelDebug
 	case "warn", "warning":
@@ -0,0 +1,229 @@
+// Package metrics holds the application-wide Prometheus collectors. Labels are
+// limited to small fixed sets (results, reason codes, endpoint and operation
+// names) so series cardinality stays bounded; user IDs and request paths are
+// never used as label values.
+package metrics
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "oauth2_token_exchange"
+
+const (
+	ResultAllow = "allow"
+	ResultDeny  = "deny"
+	ResultError = "error"
+
+	CacheHit   = "hit"
+	CacheMiss  = "miss"
+	CacheError = "error"
+
+	CircuitClosed   = "closed"
+	CircuitOpen     = "open"
+	CircuitHalfOpen = "half_open"
+
+	outcomeOK    = "ok"
+	outcomeError = "error"
+
+	labelResult  = "result"
+	labelOutcome = "outcome"
+)
+
+var (
+	//nolint:gochecknoglobals // Global collectors are intentional for application-wide metrics
+	authzDecisions = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "authz_decisions_total",
+		Help:      "Authorization decisions by result and reason code.",
+	}, []string{labelResult, "reason"})
+
+	//nolint:gochecknoglobals // Global collectors are intentional for application-wide metrics
+	checkDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "authz_check_duration_seconds",
+		Help:      "Latency of the ext_authz check handler by result.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{labelResult})
+
+	//nolint:gochecknoglobals // Global collectors are intentional for application-wide metrics
+	sourceBlocks = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "authz_source_blocks_total",
+		Help:      "Source IPs blocked after repeated invalid PATs.",
+	})
+
+	//nolint:gochecknoglobals // Global collectors are intentional for application-wide metrics
+	cacheRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "token_cache_requests_total",
+		Help:      "Token cache lookups by tier and result (hit, miss, error).",
+	}, []string{"tier", labelResult})
+
+	//nolint:gochecknoglobals // Global collectors are intentional for application-wide metrics
+	cacheRefreshes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "token_cache_refreshes_total",
+		Help:      "Background refreshes of stale cached tokens by reason code of the outcome.",
+	}, []string{"reason"})
+
+	//nolint:gochecknoglobals // Global collectors are intentional for application-wide metrics
+	zitadelDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "zitadel_request_duration_seconds",
+		Help:      "Latency of Zitadel API calls by endpoint and outcome.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"endpoint", labelOutcome})
+
+	//nolint:gochecknoglobals // Global collectors are intentional for application-wide metrics
+	zitadelRetries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "zitadel_retries_total",
+		Help:      "Retried Zitadel API calls by endpoint.",
+	}, []string{"endpoint"})
+
+	//nolint:gochecknoglobals // Global collectors are intentional for application-wide metrics
+	zitadelCircuitState = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "zitadel_circuit_breaker_state",
+		Help:      "1 for the current state of the Zitadel circuit breaker (closed, open, half_open), 0 for the others.",
+	}, []string{"state"})
+
+	//nolint:gochecknoglobals // Global collectors are intentional for application-wide metrics
+	redisDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "redis_operation_duration_seconds",
+		Help:      "Latency of Redis commands by command name and outcome.",
+		Buckets:   []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1},
+	}, []string{"operation", labelOutcome})
+
+	//nolint:gochecknoglobals // Global collectors are intentional for application-wide metrics
+	rpcRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rpc_requests_total",
+		Help:      "Connect RPCs by procedure and status code.",
+	}, []string{"procedure", "code"})
+
+	//nolint:gochecknoglobals // Global collectors are intentional for application-wide metrics
+	configInfo = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "config_info",
+		Help:      "Always 1, labeled with the version of the active configuration.",
+	}, []string{"version"})
+
+	//nolint:gochecknoglobals // Global mutex guards config_info so only one version is exported
+	configMu sync.Mutex
+
+	//nolint:gochecknoglobals // Global registry is intentional for application-wide metrics
+	registry = newRegistry()
+)
+
+func newRegistry() *prometheus.Registry {
+	r := prometheus.NewRegistry()
+	r.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		authzDecisions,
+		checkDuration,
+		sourceBlocks,
+		cacheRequests,
+		cacheRefreshes,
+		zitadelDuration,
+		zitadelRetries,
+		zitadelCircuitState,
+		redisDuration,
+		rpcRequests,
+		configInfo,
+	)
+	return r
+}
+
+// Handler serves the registered metrics in the Prometheus exposition format.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{Registry: registry})
+}
+
+// Gatherer exposes the registry, e.g. to bridge these metrics into OTLP export.
+func Gatherer() prometheus.Gatherer {
+	return registry
+}
+
+// RecordDecision counts an authorization decision. reason must be a reason
+// code, not a free-form message.
+func RecordDecision(result, reason string) {
+	authzDecisions.WithLabelValues(result, reason).Inc()
+}
+
+// ObserveCheck records the latency of one ext_authz check.
+func ObserveCheck(result string, d time.Duration) {
+	checkDuration.WithLabelValues(result).Observe(d.Seconds())
+}
+
+// RecordSourceBlock counts a source IP being blocked by the brute-force guard.
+func RecordSourceBlock() {
+	sourceBlocks.Inc()
+}
+
+// RecordCache counts a token cache lookup on the given tier.
+func RecordCache(tier, result string) {
+	cacheRequests.WithLabelValues(tier, result).Inc()
+}
+
+// RecordCacheRefresh counts a background refresh of a stale cached token.
+// reason must be a reason code.
+func RecordCacheRefresh(reason string) {
+	cacheRefreshes.WithLabelValues(reason).Inc()
+}
+
+// ObserveZitadel records the latency and outcome of a call to a Zitadel endpoint.
+func ObserveZitadel(endpoint string, d time.Duration, err error) {
+	zitadelDuration.WithLabelValues(endpoint, outcome(err)).Observe(d.Seconds())
+}
+
+// RecordZitadelRetry counts a retried call to a Zitadel endpoint.
+func RecordZitadelRetry(endpoint string) {
+	zitadelRetries.WithLabelValues(endpoint).Inc()
+}
+
+// SetZitadelCircuitState exports the current state of the Zitadel circuit breaker.
+func SetZitadelCircuitState(state string) {
+	for _, s := range []string{CircuitClosed, CircuitOpen, CircuitHalfOpen} {
+		value := 0.0
+		if s == state {
+			value = 1
+		}
+		zitadelCircuitState.WithLabelValues(s).Set(value)
+	}
+}
+
+// ObserveRedis records the latency and outcome of a Redis command.
+func ObserveRedis(operation string, d time.Duration, err error) {
+	redisDuration.WithLabelValues(operation, outcome(err)).Observe(d.Seconds())
+}
+
+// RecordRPC counts a Connect RPC by procedure and status code.
+func RecordRPC(procedure, code string) {
+	rpcRequests.WithLabelValues(procedure, code).Inc()
+}
+
+// SetConfigVersion exports the active config version, replacing the previous one.
+func SetConfigVersion(version string) {
+	configMu.Lock()
+	defer configMu.Unlock()
+
+	configInfo.Reset()
+	configInfo.WithLabelValues(version).Set(1)
+}
+
+func outcome(err error) string {
+	if err != nil {
+		return outcomeError
+	}
+	return outcomeOK
+}
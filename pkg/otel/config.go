@@ -1,16 +1,31 @@
 package otel
 
 import (
+	"time"
+
 	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
 )
 
+const defaultMetricInterval = 30 * time.Second
+
+// Config configures the telemetry pipeline. All signals are exported to
+// EndpointURL and share ServiceName and ResourceAttributes; Enabled turns on
+// traces, MetricsEnabled and LogsEnabled the other two signals.
 type Config struct {
 	ServiceName        string
 	EndpointURL        string
 	Enabled            bool
+	MetricsEnabled     bool
+	LogsEnabled        bool
 	SampleRatio        float64
 	Insecure           bool
 	ResourceAttributes map[string]string
+	// MetricInterval is how often metrics are exported; zero uses 30s.
+	MetricInterval time.Duration
+	// MetricProducers contribute metrics collected outside the OTel SDK, such
+	// as a Prometheus registry, to the OTLP metric export.
+	MetricProducers []sdkmetric.Producer
 }
 
 func DefaultConfig() Config {
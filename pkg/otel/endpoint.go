@@ -0,0 +1,54 @@
+package otel
+
+import (
+	"net/url"
+	"strings"
+)
+
+const grpcScheme = "grpc://"
+
+// OTLP/HTTP signal paths, appended to the base endpoint URL.
+const (
+	signalTraces  = "/v1/traces"
+	signalMetrics = "/v1/metrics"
+	signalLogs    = "/v1/logs"
+)
+
+// endpoint is the collector address shared by all signals. A grpc:// URL
+// selects the OTLP/gRPC exporters; anything else is an OTLP/HTTP base URL.
+type endpoint struct {
+	raw string
+}
+
+func (e endpoint) isGRPC() bool {
+	return strings.HasPrefix(e.raw, grpcScheme)
+}
+
+// grpcHost returns the host:port of a grpc:// endpoint.
+func (e endpoint) grpcHost() string {
+	return strings.TrimPrefix(e.raw, grpcScheme)
+}
+
+// httpURL returns the OTLP/HTTP URL for a signal. A base URL such as
+// http://collector:4318 gets the signal path appended. A URL with a path is
+// the traces URL, used as-is as it always has been; for the other signals a
+// trailing signal path, e.g. .../v1/traces, is replaced and any other path
+// gets the signal path appended.
+func (e endpoint) httpURL(signal string) string {
+	u, err := url.Parse(e.raw)
+	if err != nil {
+		// Let the exporter report the malformed URL.
+		return e.raw
+	}
+
+	path := strings.TrimSuffix(u.Path, "/")
+	if signal == signalTraces && path != "" {
+		return e.raw
+	}
+	for _, suffix := range []string{signalTraces, signalMetrics, signalLogs} {
+		path = strings.TrimSuffix(path, suffix)
+	}
+	u.Path = path + signal
+
+	return u.String()
+}
@@ -0,0 +1,70 @@
+package otel
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"go.opentelemetry.io/contrib/bridges/otelslog"
+	"go.opentelemetry.io/otel/exporters/otlp/otlplog/otlploggrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlplog/otlploghttp"
+	"go.opentelemetry.io/otel/log/global"
+	sdklog "go.opentelemetry.io/otel/sdk/log"
+	"go.opentelemetry.io/otel/sdk/resource"
+)
+
+// initLoggerProvider exports log records over OTLP and registers the global
+// LoggerProvider.
+func initLoggerProvider(ctx context.Context, cfg Config, res *resource.Resource) error {
+	exporter, err := createLogExporter(ctx, cfg)
+	if err != nil {
+		return err
+	}
+
+	lp := sdklog.NewLoggerProvider(
+		sdklog.WithProcessor(sdklog.NewBatchProcessor(exporter)),
+		sdklog.WithResource(res),
+	)
+
+	global.SetLoggerProvider(lp)
+	loggerProvider = lp
+	return nil
+}
+
+func createLogExporter(ctx context.Context, cfg Config) (sdklog.Exporter, error) {
+	ep := endpoint{raw: cfg.EndpointURL}
+
+	if ep.isGRPC() {
+		grpcOpts := []otlploggrpc.Option{otlploggrpc.WithEndpoint(ep.grpcHost())}
+		if cfg.Insecure {
+			grpcOpts = append(grpcOpts, otlploggrpc.WithInsecure())
+		}
+		exporter, err := otlploggrpc.New(ctx, grpcOpts...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create OTLP gRPC log exporter: %w", err)
+		}
+		return exporter, nil
+	}
+
+	httpOpts := []otlploghttp.Option{otlploghttp.WithEndpointURL(ep.httpURL(signalLogs))}
+	if cfg.Insecure {
+		httpOpts = append(httpOpts, otlploghttp.WithInsecure())
+	}
+	exporter, err := otlploghttp.New(ctx, httpOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create OTLP HTTP log exporter: %w", err)
+	}
+	return exporter, nil
+}
+
+// LogHandler returns a slog.Handler that emits records as OTel logs, or nil
+// if log export is not enabled.
+func LogHandler(serviceName string) slog.Handler {
+	tracerProviderMu.Lock()
+	defer tracerProviderMu.Unlock()
+
+	if loggerProvider == nil {
+		return nil
+	}
+	return otelslog.NewHandler(serviceName, otelslog.WithLoggerProvider(loggerProvider))
+}
@@ -0,0 +1,72 @@
+package otel
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/contrib/instrumentation/runtime"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/resource"
+)
+
+// initMeterProvider exports metrics over OTLP, including Go runtime metrics
+// and those of cfg.MetricProducers, and registers the global MeterProvider.
+func initMeterProvider(ctx context.Context, cfg Config, res *resource.Resource) error {
+	exporter, err := createMetricExporter(ctx, cfg)
+	if err != nil {
+		return err
+	}
+
+	interval := cfg.MetricInterval
+	if interval <= 0 {
+		interval = defaultMetricInterval
+	}
+
+	readerOpts := []sdkmetric.PeriodicReaderOption{sdkmetric.WithInterval(interval)}
+	for _, producer := range cfg.MetricProducers {
+		readerOpts = append(readerOpts, sdkmetric.WithProducer(producer))
+	}
+
+	mp := sdkmetric.NewMeterProvider(
+		sdkmetric.WithReader(sdkmetric.NewPeriodicReader(exporter, readerOpts...)),
+		sdkmetric.WithResource(res),
+	)
+
+	if err = runtime.Start(runtime.WithMeterProvider(mp)); err != nil {
+		_ = mp.Shutdown(ctx)
+		return fmt.Errorf("failed to start runtime metrics: %w", err)
+	}
+
+	otel.SetMeterProvider(mp)
+	meterProvider = mp
+	return nil
+}
+
+func createMetricExporter(ctx context.Context, cfg Config) (sdkmetric.Exporter, error) {
+	ep := endpoint{raw: cfg.EndpointURL}
+
+	if ep.isGRPC() {
+		grpcOpts := []otlpmetricgrpc.Option{otlpmetricgrpc.WithEndpoint(ep.grpcHost())}
+		if cfg.Insecure {
+			grpcOpts = append(grpcOpts, otlpmetricgrpc.WithInsecure())
+		}
+		exporter, err := otlpmetricgrpc.New(ctx, grpcOpts...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create OTLP gRPC metric exporter: %w", err)
+		}
+		return exporter, nil
+	}
+
+	httpOpts := []otlpmetrichttp.Option{otlpmetrichttp.WithEndpointURL(ep.httpURL(signalMetrics))}
+	if cfg.Insecure {
+		httpOpts = append(httpOpts, otlpmetrichttp.WithInsecure())
+	}
+	exporter, err := otlpmetrichttp.New(ctx, httpOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create OTLP HTTP metric exporter: %w", err)
+	}
+	return exporter, nil
+}
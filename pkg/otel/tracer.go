@@ -2,14 +2,16 @@ package otel
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"strings"
 	"sync"
 
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
 	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
 	"go.opentelemetry.io/otel/propagation"
+	sdklog "go.opentelemetry.io/otel/sdk/log"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
 	"go.opentelemetry.io/otel/sdk/resource"
 	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 	"go.opentelemetry.io/otel/trace"
@@ -19,17 +21,22 @@ import (
 var (
 	//nolint:gochecknoglobals // Global tracer provider is intentional for application-wide tracing
 	tracerProvider *sdktrace.TracerProvider
+	//nolint:gochecknoglobals // Global meter provider is intentional for application-wide metrics
+	meterProvider *sdkmetric.MeterProvider
+	//nolint:gochecknoglobals // Global logger provider is intentional for application-wide logs
+	loggerProvider *sdklog.LoggerProvider
 	//nolint:gochecknoglobals // Global mutex is intentional for thread-safe access
 	tracerProviderMu sync.Mutex
 )
 
-// InitTracer initializes the global OpenTelemetry TracerProvider.
+// InitTracer initializes the global OpenTelemetry providers for every enabled
+// signal (traces, metrics and logs) and returns a tracer for the service.
 // It should be called once during application startup.
 func InitTracer(cfg Config) (trace.Tracer, error) {
 	tracerProviderMu.Lock()
 	defer tracerProviderMu.Unlock()
 
-	if !cfg.Enabled || cfg.EndpointURL == "" {
+	if cfg.EndpointURL == "" || (!cfg.Enabled && !cfg.MetricsEnabled && !cfg.LogsEnabled) {
 		tp := noop.NewTracerProvider()
 		otel.SetTracerProvider(tp)
 		return tp.Tracer(cfg.ServiceName), nil
@@ -37,11 +44,6 @@ func InitTracer(cfg Config) (trace.Tracer, error) {
 
 	ctx := context.Background()
 
-	exporter, err := createExporter(ctx, cfg)
-	if err != nil {
-		return nil, err
-	}
-
 	res, err := resource.New(ctx,
 		resource.WithAttributes(cfg.toResourceAttributes()...),
 	)
@@ -49,6 +51,29 @@ func InitTracer(cfg Config) (trace.Tracer, error) {
 		return nil, fmt.Errorf("failed to create resource: %w", err)
 	}
 
+	if cfg.MetricsEnabled {
+		if err = initMeterProvider(ctx, cfg, res); err != nil {
+			return nil, err
+		}
+	}
+
+	if cfg.LogsEnabled {
+		if err = initLoggerProvider(ctx, cfg, res); err != nil {
+			return nil, errors.Join(err, shutdownProviders(ctx))
+		}
+	}
+
+	if !cfg.Enabled {
+		tp := noop.NewTracerProvider()
+		otel.SetTracerProvider(tp)
+		return tp.Tracer(cfg.ServiceName), nil
+	}
+
+	exporter, err := createExporter(ctx, cfg)
+	if err != nil {
+		return nil, errors.Join(err, shutdownProviders(ctx))
+	}
+
 	sampler := sdktrace.TraceIDRatioBased(cfg.SampleRatio)
 	if cfg.SampleRatio <= 0 {
 		sampler = sdktrace.NeverSample()
@@ -73,18 +98,17 @@ func InitTracer(cfg Config) (trace.Tracer, error) {
 }
 
 func createExporter(ctx context.Context, cfg Config) (sdktrace.SpanExporter, error) {
-	if strings.HasPrefix(cfg.EndpointURL, "grpc://") {
-		return createGRPCExporter(ctx, cfg)
+	ep := endpoint{raw: cfg.EndpointURL}
+	if ep.isGRPC() {
+		return createGRPCExporter(ctx, ep, cfg)
 	}
 
-	return createHTTPExporter(ctx, cfg)
+	return createHTTPExporter(ctx, ep, cfg)
 }
 
-func createGRPCExporter(ctx context.Context, cfg Config) (sdktrace.SpanExporter, error) {
-	endpoint := strings.TrimPrefix(cfg.EndpointURL, "grpc://")
-
+func createGRPCExporter(ctx context.Context, ep endpoint, cfg Config) (sdktrace.SpanExporter, error) {
 	grpcOpts := []otlptracegrpc.Option{
-		otlptracegrpc.WithEndpoint(endpoint),
+		otlptracegrpc.WithEndpoint(ep.grpcHost()),
 	}
 	if cfg.Insecure {
 		grpcOpts = append(grpcOpts, otlptracegrpc.WithInsecure())
@@ -98,9 +122,9 @@ func createGRPCExporter(ctx context.Context, cfg Config) (sdktrace.SpanExporter,
 	return exporter, nil
 }
 
-func createHTTPExporter(ctx context.Context, cfg Config) (sdktrace.SpanExporter, error) {
+func createHTTPExporter(ctx context.Context, ep endpoint, cfg Config) (sdktrace.SpanExporter, error) {
 	httpOpts := []otlptracehttp.Option{
-		otlptracehttp.WithEndpointURL(cfg.EndpointURL),
+		otlptracehttp.WithEndpointURL(ep.httpURL(signalTraces)),
 	}
 	if cfg.Insecure {
 		httpOpts = append(httpOpts, otlptracehttp.WithInsecure())
@@ -114,22 +138,39 @@ func createHTTPExporter(ctx context.Context, cfg Config) (sdktrace.SpanExporter,
 	return exporter, nil
 }
 
-// Shutdown gracefully shuts down the TracerProvider.
+// Shutdown flushes and shuts down the tracer, meter and logger providers.
 // It should be called during application shutdown.
 func Shutdown(ctx context.Context) error {
 	tracerProviderMu.Lock()
 	defer tracerProviderMu.Unlock()
 
-	if tracerProvider == nil {
-		return nil
-	}
+	return shutdownProviders(ctx)
+}
 
-	if err := tracerProvider.Shutdown(ctx); err != nil {
-		return fmt.Errorf("failed to shutdown tracer provider: %w", err)
+// shutdownProviders shuts down the started providers. The caller must hold
+// tracerProviderMu.
+func shutdownProviders(ctx context.Context) error {
+	var errs []error
+	if tracerProvider != nil {
+		if err := tracerProvider.Shutdown(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("failed to shutdown tracer provider: %w", err))
+		}
+		tracerProvider = nil
+	}
+	if meterProvider != nil {
+		if err := meterProvider.Shutdown(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("failed to shutdown meter provider: %w", err))
+		}
+		meterProvider = nil
+	}
+	if loggerProvider != nil {
+		if err := loggerProvider.Shutdown(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("failed to shutdown logger provider: %w", err))
+		}
+		loggerProvider = nil
 	}
 
-	tracerProvider = nil
-	return nil
+	return errors.Join(errs...)
 }
 
 // GetTracer returns a tracer instance for the given service name.
@@ -0,0 +1,117 @@
+// Package retry runs operations with capped exponential backoff.
+package retry
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"time"
+)
+
+const (
+	DefaultMaxAttempts    = 3
+	DefaultInitialBackoff = 500 * time.Millisecond
+	DefaultMaxBackoff     = 30 * time.Second
+)
+
+// Policy bounds the number of attempts and the wait between them. The wait
+// doubles after every failed attempt up to MaxBackoff. Zero values select the
+// defaults.
+type Policy struct {
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	// Jitter waits a random duration up to the backoff instead of the
+	// backoff itself, so that callers failing together spread out.
+	Jitter bool
+}
+
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent marks err as not worth retrying; Do returns it immediately.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+type retryAfterError struct {
+	err   error
+	after time.Duration
+}
+
+func (e *retryAfterError) Error() string { return e.err.Error() }
+func (e *retryAfterError) Unwrap() error { return e.err }
+
+// After asks Do to wait d before the next attempt, as a server's Retry-After
+// does. Do gives up when d exceeds the policy's MaxBackoff.
+func After(err error, d time.Duration) error {
+	if err == nil {
+		return nil
+	}
+	return &retryAfterError{err: err, after: d}
+}
+
+// Do calls fn until it succeeds, returns a Permanent error, the attempts are
+// exhausted or ctx is done. It returns the last error from fn.
+func Do(ctx context.Context, p Policy, fn func(ctx context.Context) error) error {
+	p = p.withDefaults()
+
+	backoff := p.InitialBackoff
+	var err error
+	for attempt := 1; ; attempt++ {
+		err = fn(ctx)
+		if err == nil {
+			return nil
+		}
+
+		var perm *permanentError
+		if errors.As(err, &perm) {
+			return perm.err
+		}
+		if attempt >= p.MaxAttempts {
+			return err
+		}
+
+		wait := backoff
+		if p.Jitter {
+			wait = rand.N(backoff) + 1 //nolint:gosec // Jitter does not need a cryptographic source.
+		}
+		var after *retryAfterError
+		if errors.As(err, &after) {
+			if after.after > p.MaxBackoff {
+				return after.err
+			}
+			wait = after.after
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return errors.Join(err, ctx.Err())
+		case <-timer.C:
+		}
+
+		backoff = min(backoff*2, p.MaxBackoff) //nolint:mnd // Exponential backoff doubles the wait.
+	}
+}
+
+func (p Policy) withDefaults() Policy {
+	if p.MaxAttempts <= 0 {
+		p.MaxAttempts = DefaultMaxAttempts
+	}
+	if p.InitialBackoff <= 0 {
+		p.InitialBackoff = DefaultInitialBackoff
+	}
+	if p.MaxBackoff <= 0 {
+		p.MaxBackoff = DefaultMaxBackoff
+	}
+	return p
+}
@@ -0,0 +1,15 @@
+// Package secret is the view components get of a credential: a value that is
+// read for every use, so it may be rotated while the process is running.
+package secret
+
+// Secret yields the current value of a credential.
+type Secret interface {
+	Value() string
+}
+
+// Static is a Secret with a fixed value.
+type Static string
+
+func (s Static) Value() string {
+	return string(s)
+}